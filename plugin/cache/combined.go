@@ -168,3 +168,49 @@ func CombinedGetPluginDeclaration(
 
 	return &declaration, nil
 }
+
+// InvalidatePluginDeclaration drops the cached declaration of a plugin for every
+// runtime type, it's called once the declaration of a plugin changes in place
+func InvalidatePluginDeclaration(pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier) {
+	pluginCache.Lock()
+	defer pluginCache.Unlock()
+
+	for _, runtimeType := range []plugin_entities.PluginRuntimeType{
+		plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL,
+		plugin_entities.PLUGIN_RUNTIME_TYPE_REMOTE,
+		plugin_entities.PLUGIN_RUNTIME_TYPE_SERVERLESS,
+		plugin_entities.PLUGIN_RUNTIME_TYPE_MCP,
+	} {
+		cacheKey := strings.Join(
+			[]string{
+				"declaration_cache",
+				string(runtimeType),
+				string(pluginUniqueIdentifier),
+			},
+			":",
+		)
+		if _, ok := pluginCache.items[cacheKey]; ok {
+			pluginCache.itemSize--
+			delete(pluginCache.items, cacheKey)
+		}
+	}
+}
+
+// BroadcastPluginDeclarationInvalidation drops the cached declaration of a plugin on
+// every daemon of the cluster, the local cache is dropped even if redis fails
+func BroadcastPluginDeclarationInvalidation(pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier) error {
+	InvalidatePluginDeclaration(pluginUniqueIdentifier)
+	return Publish(PluginDeclarationInvalidationChannel(), pluginUniqueIdentifier.String())
+}
+
+// SubscribePluginDeclarationInvalidation drops the cached declarations invalidated
+// by the other daemons of the cluster, it returns the function to unsubscribe
+func SubscribePluginDeclarationInvalidation() func() {
+	identifiers, unsubscribe := Subscribe[string](PluginDeclarationInvalidationChannel())
+	go func() {
+		for identifier := range identifiers {
+			InvalidatePluginDeclaration(plugin_entities.PluginUniqueIdentifier(identifier))
+		}
+	}()
+	return unsubscribe
+}
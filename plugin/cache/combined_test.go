@@ -1,10 +1,13 @@
 package cache
 
 import (
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCacheSetAndGet(t *testing.T) {
@@ -75,3 +78,40 @@ func TestCacheConcurrentAccess(t *testing.T) {
 
 	assert.True(t, pluginCache.itemSize <= maxCacheSize)
 }
+
+func TestInvalidatePluginDeclaration(t *testing.T) {
+	id := plugin_entities.PluginUniqueIdentifier("mcp/github:0.0.1@" + strings.Repeat("a", 64))
+	other := plugin_entities.PluginUniqueIdentifier("mcp/slack:0.0.1@" + strings.Repeat("b", 64))
+	declaration := &plugin_entities.PluginDeclaration{}
+
+	pluginCache.set("declaration_cache:local:"+id.String(), declaration)
+	pluginCache.set("declaration_cache:mcp:"+id.String(), declaration)
+	pluginCache.set("declaration_cache:local:"+other.String(), declaration)
+
+	InvalidatePluginDeclaration(id)
+
+	// 所有运行时类型下的缓存都被清除，其它插件不受影响
+	assert.Nil(t, pluginCache.get("declaration_cache:local:"+id.String()))
+	assert.Nil(t, pluginCache.get("declaration_cache:mcp:"+id.String()))
+	assert.NotNil(t, pluginCache.get("declaration_cache:local:"+other.String()))
+}
+
+func TestBroadcastPluginDeclarationInvalidation(t *testing.T) {
+	if err := getConnection(); err != nil {
+		t.Errorf("get redis connection failed: %v", err)
+		return
+	}
+	defer Close()
+
+	unsubscribe := SubscribePluginDeclarationInvalidation()
+	defer unsubscribe()
+
+	id := plugin_entities.PluginUniqueIdentifier("mcp/github:0.0.1@" + strings.Repeat("c", 64))
+
+	// 其它节点发布通知后清除本地缓存
+	pluginCache.set("declaration_cache:mcp:"+id.String(), &plugin_entities.PluginDeclaration{})
+	require.NoError(t, Publish(PluginDeclarationInvalidationChannel(), id.String()))
+	assert.Eventually(t, func() bool {
+		return pluginCache.get("declaration_cache:mcp:"+id.String()) == nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -23,3 +23,57 @@ func EndPointCacheKey(hookId string) string {
 		":",
 	)
 }
+
+func PluginRolloutStatsKey(rolloutId, pluginUniqueIdentifier, field string) string {
+	return strings.Join(
+		[]string{
+			"rollout_id",
+			rolloutId,
+			"plugin_unique_identifier",
+			pluginUniqueIdentifier,
+			field,
+		},
+		":",
+	)
+}
+
+func PluginRolloutCacheKey(tenantId, pluginId string) string {
+	return strings.Join(
+		[]string{
+			"plugin_rollout",
+			"tenant_id",
+			tenantId,
+			"plugin_id",
+			pluginId,
+		},
+		":",
+	)
+}
+
+func PluginInstallationTaskChannel(taskId string) string {
+	return strings.Join(
+		[]string{
+			"plugin_installation_task",
+			taskId,
+		},
+		":",
+	)
+}
+
+// PluginDeclarationInvalidationChannel receives the identifiers of the plugins whose
+// declaration changed in place
+func PluginDeclarationInvalidationChannel() string {
+	return "plugin_declaration_invalidation"
+}
+
+func IdempotencyKey(tenantId, scope, key string) string {
+	return strings.Join(
+		[]string{
+			"idempotency",
+			tenantId,
+			scope,
+			key,
+		},
+		":",
+	)
+}
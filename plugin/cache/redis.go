@@ -524,6 +524,10 @@ func Subscribe[T any](channel string) (<-chan T, func()) {
 		alive := true
 		for alive {
 			rec, err := pubsub.Receive(context.Background())
+			if err == redis.ErrClosed {
+				// unsubscribed
+				return
+			}
 			if err != nil {
 				utils.Error("failed to receive message from redis: %s, will retry in 1 second", err.Error())
 				time.Sleep(1 * time.Second)
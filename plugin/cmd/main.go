@@ -4,9 +4,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 
+	"github.com/jjgagacy/workflow-app/plugin/cmd/mcp"
 	"github.com/jjgagacy/workflow-app/plugin/cmd/plugin"
 	"github.com/jjgagacy/workflow-app/plugin/cmd/run"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager"
 	"github.com/jjgagacy/workflow-app/plugin/utils"
 
 	"github.com/spf13/cobra"
@@ -89,9 +92,16 @@ If no parameter are provided, an interactive mode will be started.`,
 				outputPath = base + ".moniepkg"
 			}
 
-			plugin.PackagePlugin(inputPath, outputPath)
+			var vendorWheels *plugin_packager.VendorWheelsOptions
+			if packageVendorWheels {
+				vendorWheels = &packageVendorWheelsOptions
+			}
+
+			plugin.PackagePlugin(inputPath, outputPath, vendorWheels)
 		},
 	}
+	packageVendorWheels        bool
+	packageVendorWheelsOptions plugin_packager.VendorWheelsOptions
 )
 
 var (
@@ -109,6 +119,26 @@ var (
 	runMode          string
 )
 
+var (
+	mcpCmd = &cobra.Command{
+		Use:   "mcp",
+		Short: "mcp",
+		Long:  "MCP (Model Context Protocol) commands",
+	}
+
+	mcpServeCmd = &cobra.Command{
+		Use:   "serve",
+		Short: "Serve installed tools over stdio",
+		Long: `Serve the tools installed by a tenant to an MCP client over stdio.
+Messages are forwarded to the MCP endpoint of a running daemon, clients able to
+reach the daemon can use its streamable HTTP endpoint /plugin/{tenant_id}/mcp directly.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			mcp.Serve(mcpServePayload)
+		},
+	}
+	mcpServePayload mcp.ServePayload
+)
+
 func main() {
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
@@ -155,17 +185,29 @@ func init() {
 	pluginInitCmd.Flags().BoolVar(&quick, "quick", false, "Skip interactive mode and create plugin directly")
 
 	pluginPackageCmd.Flags().StringP("output_path", "o", "", "output path")
+	pluginPackageCmd.Flags().BoolVar(&packageVendorWheels, "vendor-wheels", false, "bundle the wheels of requirements.txt for an offline installation")
+	pluginPackageCmd.Flags().StringVar(&packageVendorWheelsOptions.PythonPath, "python", "", "python interpreter downloading the wheels (default python3)")
+	pluginPackageCmd.Flags().StringVar(&packageVendorWheelsOptions.IndexUrl, "index-url", "", "index the wheels are downloaded from")
 
 	runCmd.Flags().StringVarP(&runMode, "mode", "m", "stdio", "run mode, stdio or tcp")
 	runCmd.Flags().BoolVarP(&runPluginPayload.EnableLogs, "enable-logs", "l", false, "enable logs")
 	runCmd.Flags().BoolVarP(&runPluginPayload.ZipFilePlugin, "zip-file", "z", false, "plugin file is zip")
 	runCmd.Flags().StringVarP(&runPluginPayload.ResponseFormat, "response-format", "r", "text", "response format, text or json")
+	runCmd.Flags().BoolVarP(&runPluginPayload.Watch, "watch", "w", false, "reload the plugin when files in the plugin directory change")
+
+	mcpServeCmd.Flags().StringVar(&mcpServePayload.DaemonURL, "daemon-url", "http://localhost:5002", "url of the plugin daemon")
+	mcpServeCmd.Flags().StringVar(&mcpServePayload.ServerKey, "server-key", "", "server key of the plugin daemon (default is $SERVER_KEY)")
+	mcpServeCmd.Flags().StringVar(&mcpServePayload.TenantID, "tenant-id", "", "tenant whose installed tools are served")
+	mcpServeCmd.Flags().StringVar(&mcpServePayload.UserID, "user-id", "", "user the tools are invoked for (optional)")
+	mcpServeCmd.Flags().DurationVar(&mcpServePayload.Timeout, "timeout", 10*time.Minute, "timeout of a single message")
 
 	rootCmd.AddCommand(pluginCmd)
 	pluginCmd.AddCommand(bundleCmd)
 	pluginCmd.AddCommand(pluginInitCmd)
 	pluginCmd.AddCommand(pluginPackageCmd)
 	pluginCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(mcpCmd)
+	mcpCmd.AddCommand(mcpServeCmd)
 }
 
 func initConfig() {
@@ -183,6 +225,7 @@ func initConfig() {
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err == nil {
-		fmt.Println("Using config file:", viper.ConfigFileUsed())
+		// stderr as stdout may carry a protocol, e.g. mcp serve
+		fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
 }
@@ -0,0 +1,59 @@
+package mcp
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	mcp_server "github.com/jjgagacy/workflow-app/plugin/core/mcp"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+type ServePayload struct {
+	DaemonURL string
+	ServerKey string
+	TenantID  string
+	UserID    string
+	Timeout   time.Duration
+}
+
+// Serve serves the stdio transport for clients which launch their mcp servers as
+// subprocesses, messages are forwarded to the mcp endpoint of a running daemon
+func Serve(payload ServePayload) {
+	if err := serve(payload); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err.Error())
+		os.Exit(1)
+	}
+}
+
+func serve(payload ServePayload) error {
+	// stdout belongs to the protocol
+	utils.SetLogVisibility(false)
+
+	if payload.ServerKey == "" {
+		payload.ServerKey = os.Getenv("SERVER_KEY")
+	}
+	if payload.ServerKey == "" {
+		return errors.New("server key is required, set --server-key or SERVER_KEY")
+	}
+	if payload.TenantID == "" {
+		return errors.New("tenant id is required")
+	}
+
+	endpoint, err := url.JoinPath(strings.TrimRight(payload.DaemonURL, "/"), "plugin", payload.TenantID, "mcp")
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("invalid daemon url"))
+	}
+	if payload.UserID != "" {
+		endpoint += "?" + url.Values{"user_id": {payload.UserID}}.Encode()
+	}
+
+	return mcp_server.ServeStdio(
+		os.Stdin,
+		os.Stdout,
+		mcp_server.NewHTTPForwarder(endpoint, payload.ServerKey, payload.Timeout),
+	)
+}
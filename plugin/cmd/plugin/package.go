@@ -12,7 +12,9 @@ var (
 	MaxPluginPackageSize = int64(50 * 1024 * 1024) // 50MB
 )
 
-func PackagePlugin(inputPath string, outputPath string) {
+// PackagePlugin packs the plugin at inputPath, the wheels of its requirements
+// are bundled if vendorWheels is not nil
+func PackagePlugin(inputPath string, outputPath string, vendorWheels *plugin_packager.VendorWheelsOptions) {
 	decoder, err := decoder.NewFSPluginDecoder(inputPath)
 	if err != nil {
 		utils.Error("failed to create plugin decoder, plugin path: %s, error: %v", inputPath, err)
@@ -21,6 +23,7 @@ func PackagePlugin(inputPath string, outputPath string) {
 	}
 
 	packager := plugin_packager.NewPackager(decoder)
+	packager.SetVendorWheels(vendorWheels)
 	zipFile, err := packager.Pack(MaxPluginPackageSize)
 
 	if err != nil {
@@ -25,6 +25,9 @@ type RunPluginPayload struct {
 
 	ResponseFormat string
 	ZipFilePlugin  bool
+
+	// Watch repackages and restarts the plugin when files in PluginPath change
+	Watch bool
 }
 
 type GenericResponseType = string
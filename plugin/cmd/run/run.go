@@ -10,12 +10,9 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/jjgagacy/workflow-app/plugin/core/invocation"
-	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/local_runtime"
-	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager/decoder"
 	"github.com/jjgagacy/workflow-app/plugin/core/session_manager"
 	"github.com/jjgagacy/workflow-app/plugin/core/testing_utils"
-	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
 	"github.com/jjgagacy/workflow-app/plugin/utils"
 	"github.com/joho/godotenv"
 )
@@ -41,6 +38,10 @@ func runPlugin(payload RunPluginPayload) error {
 		return fmt.Errorf("error loading .env file")
 	}
 
+	if payload.Watch && payload.ZipFilePlugin {
+		return fmt.Errorf("watch mode is not supported for zip file plugins")
+	}
+
 	tempDir := os.TempDir()
 	dir, err := os.MkdirTemp(tempDir, "plugin-run-*")
 	if err != nil {
@@ -60,16 +61,9 @@ func runPlugin(payload RunPluginPayload) error {
 			return errors.Join(err, fmt.Errorf("read plugin zip file error"))
 		}
 	default:
-		dec, err := decoder.NewFSPluginDecoder(payload.PluginPath)
-		if err != nil {
-			utils.Error("failed to create plugin decoder, plugin path: %s, error: %v", payload.PluginPath, err)
-			os.Exit(-1)
-		}
-		packager := plugin_packager.NewPackager(dec)
-		pluginFile, err = packager.Pack(int64(5 * 1024 * 1024))
-
+		pluginFile, err = packPlugin(payload.PluginPath)
 		if err != nil {
-			utils.Error("failed to package plugin: %v", err)
+			utils.Error("failed to package plugin, plugin path: %s, error: %v", payload.PluginPath, err)
 			os.Exit(-1)
 		}
 	}
@@ -100,6 +94,18 @@ func runPlugin(payload RunPluginPayload) error {
 		return err
 	}
 
+	holder := newPluginHolder(runtime, &declaration)
+	if payload.Watch {
+		utils.Submit(nil, func() {
+			if err := watchPlugin(payload, dir, holder); err != nil {
+				runLog(GenericResponse{
+					Type:     GENERIC_RESPONSE_TYPE_ERROR,
+					Response: map[string]any{"error": err.Error()},
+				}, payload.ResponseFormat)
+			}
+		})
+	}
+
 	var stream *utils.Stream[client]
 	switch payload.RunMode {
 	case RUN_MODE_STDIO:
@@ -130,7 +136,7 @@ func runPlugin(payload RunPluginPayload) error {
 		}
 
 		utils.Submit(nil, func() {
-			handleClient(client, &declaration, runtime, payload.ResponseFormat)
+			handleClient(client, holder, payload.ResponseFormat)
 		})
 	}
 
@@ -151,8 +157,7 @@ func setupSignalHandler(dir string) {
 
 func handleClient(
 	client client,
-	declaration *plugin_entities.PluginDeclaration,
-	runtime *local_runtime.LocalPluginRuntime,
+	holder *pluginHolder,
 	responseFormat string,
 ) {
 	// handle request from client
@@ -163,7 +168,6 @@ func handleClient(
 	userId := uuid.New().String()
 	tenantId := uuid.New().String()
 
-	pluginUniqueIdentifier, _ := runtime.Identity()
 	mockedInvocation := invocation.NewMockedInvocation()
 
 	logResponse(GenericResponse{
@@ -198,6 +202,18 @@ func handleClient(
 			continue
 		}
 
+		// the runtime may be replaced between invocations in watch mode
+		runtime, declaration, err := holder.acquire()
+		if err != nil {
+			logResponse(GenericResponse{
+				InvokeId: invokePayload.InvokeId,
+				Type:     GENERIC_RESPONSE_TYPE_ERROR,
+				Response: map[string]any{"error": err.Error()},
+			}, responseFormat, client)
+			continue
+		}
+		pluginUniqueIdentifier, _ := runtime.Identity()
+
 		session := session_manager.NewSession(
 			session_manager.SessionPayload{
 				UserID:                 userId,
@@ -219,6 +235,7 @@ func handleClient(
 		)
 
 		if err != nil {
+			holder.release()
 			logResponse(GenericResponse{
 				Type:     GENERIC_RESPONSE_TYPE_ERROR,
 				InvokeId: invokePayload.InvokeId,
@@ -228,6 +245,8 @@ func handleClient(
 		}
 
 		utils.Submit(nil, func() {
+			defer holder.release()
+
 			for stream.Next() {
 				response, err := stream.Read()
 				if err != nil {
@@ -0,0 +1,295 @@
+package run
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/local_runtime"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager/decoder"
+	"github.com/jjgagacy/workflow-app/plugin/core/testing_utils"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+)
+
+const (
+	// changes within this window are merged into a single reload
+	watchDebounce = 500 * time.Millisecond
+	// max time to wait for in-flight invocations before restarting the plugin
+	watchDrainTimeout = 30 * time.Second
+)
+
+// directories which are never watched, they are either generated by the
+// plugin environment or irrelevant to the plugin package
+var watchIgnoredDirs = map[string]bool{
+	".venv":        true,
+	"__pycache__":  true,
+	".git":         true,
+	"node_modules": true,
+	".idea":        true,
+	".vscode":      true,
+}
+
+// pluginHolder keeps the runtime shared by all clients, in watch mode the
+// runtime is replaced after all in-flight invocations are drained
+type pluginHolder struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	runtime     *local_runtime.LocalPluginRuntime
+	declaration *plugin_entities.PluginDeclaration
+
+	inflight  int
+	reloading bool
+}
+
+func newPluginHolder(
+	runtime *local_runtime.LocalPluginRuntime,
+	declaration *plugin_entities.PluginDeclaration,
+) *pluginHolder {
+	h := &pluginHolder{
+		runtime:     runtime,
+		declaration: declaration,
+	}
+	h.cond = sync.NewCond(&h.mu)
+	return h
+}
+
+// acquire returns the current runtime and marks an invocation as in flight,
+// it blocks while the plugin is reloading, release MUST be called once done
+func (h *pluginHolder) acquire() (*local_runtime.LocalPluginRuntime, *plugin_entities.PluginDeclaration, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for h.reloading {
+		h.cond.Wait()
+	}
+
+	if h.runtime == nil {
+		return nil, nil, errors.New("plugin is not running, waiting for the next change to reload")
+	}
+
+	h.inflight++
+	return h.runtime, h.declaration, nil
+}
+
+func (h *pluginHolder) release() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.inflight--
+	h.cond.Broadcast()
+}
+
+// reload blocks new invocations, waits at most timeout for in-flight ones to
+// finish and replaces the runtime with the one returned by fn
+func (h *pluginHolder) reload(
+	timeout time.Duration,
+	fn func(old *local_runtime.LocalPluginRuntime) (*local_runtime.LocalPluginRuntime, *plugin_entities.PluginDeclaration, error),
+) error {
+	h.mu.Lock()
+	h.reloading = true
+
+	deadline := time.Now().Add(timeout)
+	timer := time.AfterFunc(timeout, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		h.cond.Broadcast()
+	})
+	for h.inflight > 0 && time.Now().Before(deadline) {
+		h.cond.Wait()
+	}
+	timer.Stop()
+
+	old := h.runtime
+	h.mu.Unlock()
+
+	runtime, declaration, err := fn(old)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.runtime = runtime
+	if declaration != nil {
+		h.declaration = declaration
+	}
+	h.reloading = false
+	h.cond.Broadcast()
+
+	return err
+}
+
+// packPlugin packages the plugin directory into a zip file
+func packPlugin(pluginPath string) ([]byte, error) {
+	dec, err := decoder.NewFSPluginDecoder(pluginPath)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("create plugin decoder error"))
+	}
+	return plugin_packager.NewPackager(dec).Pack(int64(5 * 1024 * 1024))
+}
+
+// watchPlugin watches the plugin directory, repackages the plugin and restarts
+// the runtime on every change until the watcher fails
+func watchPlugin(payload RunPluginPayload, dir string, holder *pluginHolder) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("create file watcher error"))
+	}
+	defer watcher.Close()
+
+	if err := addWatchDirs(watcher, payload.PluginPath); err != nil {
+		return err
+	}
+
+	generation := 0
+	timer := time.NewTimer(watchDebounce)
+	timer.Stop()
+
+	for {
+		select {
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if isWatchIgnored(payload.PluginPath, event.Name) {
+				continue
+			}
+			// fsnotify is not recursive, new directories need to be added manually
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					addWatchDirs(watcher, event.Name)
+				}
+			}
+			timer.Reset(watchDebounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			runLog(GenericResponse{
+				Type:     GENERIC_RESPONSE_TYPE_ERROR,
+				Response: map[string]any{"error": fmt.Sprintf("watch plugin error: %s", err.Error())},
+			}, payload.ResponseFormat)
+		case <-timer.C:
+			generation++
+			if err := reloadPlugin(payload, path.Join(dir, fmt.Sprintf("reload-%d", generation)), holder); err != nil {
+				runLog(GenericResponse{
+					Type:     GENERIC_RESPONSE_TYPE_ERROR,
+					Response: map[string]any{"error": err.Error()},
+				}, payload.ResponseFormat)
+			}
+		}
+	}
+}
+
+func reloadPlugin(payload RunPluginPayload, dir string, holder *pluginHolder) error {
+	pluginFile, err := packPlugin(payload.PluginPath)
+	if err != nil {
+		// keep the running plugin until it's packaged successfully
+		return errors.Join(err, fmt.Errorf("package plugin error, keep the running plugin"))
+	}
+
+	zipDecoder, err := decoder.NewZipPluginDecoder(pluginFile)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("decode plugin file error"))
+	}
+	checksum, err := zipDecoder.Checksum()
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("calculate checksum error"))
+	}
+	declaration, err := zipDecoder.Manifest()
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("get declaration error"))
+	}
+
+	holder.mu.Lock()
+	current := holder.runtime
+	holder.mu.Unlock()
+	if current != nil {
+		if oldChecksum, err := current.Checksum(); err == nil && oldChecksum == checksum {
+			// nothing in the package has changed
+			return nil
+		}
+	}
+
+	runLog(GenericResponse{
+		Type:     GENERIC_RESPONSE_TYPE_INFO,
+		Response: map[string]any{"info": "plugin changed, reloading"},
+	}, payload.ResponseFormat)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Join(err, fmt.Errorf("create working directory error"))
+	}
+
+	// the virtual environment is kept outside of the working path while the
+	// plugin restarts, InitPython reuses it if requirements.txt is unchanged
+	venvPath := path.Join(dir, ".venv")
+
+	return holder.reload(watchDrainTimeout, func(old *local_runtime.LocalPluginRuntime) (*local_runtime.LocalPluginRuntime, *plugin_entities.PluginDeclaration, error) {
+		if old != nil {
+			os.Rename(path.Join(old.State.WorkingPath, ".venv"), venvPath)
+			old.Stop()
+		}
+
+		runtime, err := testing_utils.GetRuntimeWithPrepare(pluginFile, dir, func(workingPath string) error {
+			if _, err := os.Stat(venvPath); err != nil {
+				return nil
+			}
+			return os.Rename(venvPath, path.Join(workingPath, ".venv"))
+		})
+		if err != nil {
+			return nil, nil, errors.Join(err, fmt.Errorf("reload plugin error"))
+		}
+
+		runLog(GenericResponse{
+			Type:     GENERIC_RESPONSE_TYPE_INFO,
+			Response: map[string]any{"info": "plugin reloaded"},
+		}, payload.ResponseFormat)
+
+		return runtime, &declaration, nil
+	})
+}
+
+// addWatchDirs adds root and all its subdirectories to the watcher
+func addWatchDirs(watcher *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != root && watchIgnoredDirs[d.Name()] {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(p); err != nil {
+			return errors.Join(err, fmt.Errorf("watch %s error", p))
+		}
+		return nil
+	})
+}
+
+// isWatchIgnored reports whether a change of name should not trigger a reload
+func isWatchIgnored(root string, name string) bool {
+	rel, err := filepath.Rel(root, name)
+	if err != nil {
+		return false
+	}
+	for _, part := range strings.Split(filepath.ToSlash(rel), "/") {
+		if watchIgnoredDirs[part] {
+			return true
+		}
+	}
+
+	base := filepath.Base(name)
+	// editor swap and backup files
+	return strings.HasSuffix(base, ".swp") ||
+		strings.HasSuffix(base, ".swx") ||
+		strings.HasSuffix(base, "~") ||
+		strings.HasPrefix(base, ".#")
+}
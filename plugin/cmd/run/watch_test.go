@@ -0,0 +1,120 @@
+package run
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/local_runtime"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPluginHolderReloadDrainsInflight(t *testing.T) {
+	oldRuntime := &local_runtime.LocalPluginRuntime{}
+	newRuntime := &local_runtime.LocalPluginRuntime{}
+	holder := newPluginHolder(oldRuntime, &plugin_entities.PluginDeclaration{})
+
+	runtime, _, err := holder.acquire()
+	require.NoError(t, err)
+	assert.Same(t, oldRuntime, runtime)
+
+	var released atomic.Bool
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		released.Store(true)
+		holder.release()
+	}()
+
+	err = holder.reload(time.Second, func(old *local_runtime.LocalPluginRuntime) (*local_runtime.LocalPluginRuntime, *plugin_entities.PluginDeclaration, error) {
+		// the in-flight invocation must be finished before the restart
+		assert.True(t, released.Load())
+		assert.Same(t, oldRuntime, old)
+		return newRuntime, nil, nil
+	})
+	require.NoError(t, err)
+
+	runtime, _, err = holder.acquire()
+	require.NoError(t, err)
+	assert.Same(t, newRuntime, runtime)
+	holder.release()
+}
+
+func TestPluginHolderReloadTimeout(t *testing.T) {
+	holder := newPluginHolder(&local_runtime.LocalPluginRuntime{}, &plugin_entities.PluginDeclaration{})
+
+	_, _, err := holder.acquire()
+	require.NoError(t, err)
+
+	start := time.Now()
+	err = holder.reload(100*time.Millisecond, func(old *local_runtime.LocalPluginRuntime) (*local_runtime.LocalPluginRuntime, *plugin_entities.PluginDeclaration, error) {
+		return nil, nil, assert.AnError
+	})
+	assert.ErrorIs(t, err, assert.AnError)
+	assert.Less(t, time.Since(start), time.Second)
+
+	// the runtime failed to reload, invocations are rejected until the next change
+	_, _, err = holder.acquire()
+	assert.Error(t, err)
+}
+
+func TestPluginHolderAcquireBlocksWhileReloading(t *testing.T) {
+	holder := newPluginHolder(&local_runtime.LocalPluginRuntime{}, &plugin_entities.PluginDeclaration{})
+	newRuntime := &local_runtime.LocalPluginRuntime{}
+
+	started := make(chan bool)
+	finish := make(chan bool)
+	go holder.reload(time.Second, func(old *local_runtime.LocalPluginRuntime) (*local_runtime.LocalPluginRuntime, *plugin_entities.PluginDeclaration, error) {
+		close(started)
+		<-finish
+		return newRuntime, nil, nil
+	})
+	<-started
+
+	acquired := make(chan *local_runtime.LocalPluginRuntime)
+	go func() {
+		runtime, _, _ := holder.acquire()
+		acquired <- runtime
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquire should block while reloading")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(finish)
+	select {
+	case runtime := <-acquired:
+		assert.Same(t, newRuntime, runtime)
+	case <-time.After(time.Second):
+		t.Fatal("acquire should return once reloaded")
+	}
+}
+
+func TestIsWatchIgnored(t *testing.T) {
+	root := filepath.Join("tmp", "plugin")
+
+	tests := []struct {
+		name string
+		file string
+		want bool
+	}{
+		{name: "源码文件", file: "main.py", want: false},
+		{name: "子目录文件", file: "tools/search.py", want: false},
+		{name: "依赖文件", file: "requirements.txt", want: false},
+		{name: "虚拟环境", file: ".venv/lib/site.py", want: true},
+		{name: "字节码缓存", file: "tools/__pycache__/search.cpython-312.pyc", want: true},
+		{name: "git 目录", file: ".git/index", want: true},
+		{name: "vim 交换文件", file: ".main.py.swp", want: true},
+		{name: "备份文件", file: "main.py~", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, isWatchIgnored(root, filepath.Join(root, tt.file)))
+		})
+	}
+}
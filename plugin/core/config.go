@@ -3,8 +3,11 @@ package core
 import (
 	"fmt"
 	"log"
+	"runtime"
 
 	"github.com/go-playground/validator/v10"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/sandbox"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/manifest_entites"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 )
@@ -20,6 +23,9 @@ type Config struct {
 	ServerPort uint16 `envconfig:"SERVER_PORT" validate:"required"`
 	ServerKey  string `envconfig:"SERVER_KEY" validate:"required"`
 
+	// seconds to wait for active sessions to finish on shutdown
+	ShutdownDrainTimeout int `envconfig:"SHUTDOWN_DRAIN_TIMEOUT"`
+
 	InnerApiUrl string `envconfig:"INNER_API_URL" validate:"required"`
 	InnerApiKey string `envconfig:"INNER_API_KEY" validate:"required"`
 
@@ -35,6 +41,28 @@ type Config struct {
 
 	// local launching max concurrent
 	PluginLocalLaunchingConcurrent int `envconfig:"PLUGIN_LOCAL_LAUNCHING_CONCURRENT" validate:"required"`
+	// processes per local plugin, the manifest may ask for more up to the maximum
+	PluginLocalReplicas    int `envconfig:"PLUGIN_LOCAL_REPLICAS"`
+	PluginLocalMaxReplicas int `envconfig:"PLUGIN_LOCAL_MAX_REPLICAS"`
+	// seconds without sessions before a local plugin is stopped, 0 keeps plugins running
+	PluginIdleTimeout int `envconfig:"PLUGIN_IDLE_TIMEOUT"`
+	// seconds a request waits for a stopped plugin to be launched
+	PluginColdStartTimeout int `envconfig:"PLUGIN_COLD_START_TIMEOUT"`
+	// plugin ids (author/name) or unique identifiers which are never stopped for idleness
+	PluginPinWarm []string `envconfig:"PLUGIN_PIN_WARM"`
+	// crashed plugins are restarted with an exponential backoff, milliseconds
+	PluginRestartBackoffInitial int `envconfig:"PLUGIN_RESTART_BACKOFF_INITIAL"`
+	PluginRestartBackoffMax     int `envconfig:"PLUGIN_RESTART_BACKOFF_MAX"`
+	// a plugin crashed PluginCrashLoopThreshold times in the window (seconds) is not
+	// restarted until it's reset
+	PluginCrashLoopThreshold int `envconfig:"PLUGIN_CRASH_LOOP_THRESHOLD"`
+	PluginCrashLoopWindow    int `envconfig:"PLUGIN_CRASH_LOOP_WINDOW"`
+	// seconds between resource usage samples of local plugins, negative disables sampling
+	PluginResourceSampleInterval int `envconfig:"PLUGIN_RESOURCE_SAMPLE_INTERVAL"`
+	// alert when a plugin uses more cpu (percentage of a core) or open files, 0 disables
+	// the alert. Memory is alerted above the resource memory of the manifest
+	PluginCPUAlertPercent int `envconfig:"PLUGIN_CPU_ALERT_PERCENT"`
+	PluginOpenFilesAlert  int `envconfig:"PLUGIN_OPEN_FILES_ALERT"`
 
 	Platform PlatformType `envconfig:"PLATFORM" validate:"required"`
 
@@ -76,6 +104,11 @@ type Config struct {
 
 	// plugin endpoint
 	PluginEndPointEnabled *bool `envconfig:"PLUGIN_ENDPOINT_ENABLED"`
+	// max size of a request body forwarded to an endpoint plugin
+	PluginEndPointMaxBodySize int64 `envconfig:"PLUGIN_ENDPOINT_MAX_BODY_SIZE"`
+	// bodies larger than this are streamed to the plugin in chunks instead of being inlined
+	PluginEndPointInlineBodySize int64 `envconfig:"PLUGIN_ENDPOINT_INLINE_BODY_SIZE"`
+	PluginEndPointBodyChunkSize  int   `envconfig:"PLUGIN_ENDPOINT_BODY_CHUNK_SIZE"`
 
 	// storage
 	PluginWorkingPath      string `envconfig:"PLUGIN_WORKING_PATH"` // where the plugin finally running
@@ -106,11 +139,45 @@ type Config struct {
 	MaxBundlePackageSize            int64 `envconfig:"MAX_BUNDLE_PACKAGE_SIZE" validate:"required"`
 	MaxServerlessTransactionTimeout int   `envconfig:"MAX_SERVERLESS_TRANSACTION_TIMEOUT"`
 
+	PluginGitCloneTimeout int   `envconfig:"PLUGIN_GIT_CLONE_TIMEOUT"`  // seconds
+	PluginGitCloneMaxSize int64 `envconfig:"PLUGIN_GIT_CLONE_MAX_SIZE"` // bytes of the clone on disk
+
+	PluginInstallTaskStreamTimeout int `envconfig:"PLUGIN_INSTALL_TASK_STREAM_TIMEOUT"` // seconds
+
+	// plugin logs
+	PluginLogBufferSize          int    `envconfig:"PLUGIN_LOG_BUFFER_SIZE"` // entries kept in memory per plugin runtime
+	PluginLogPersistenceEnabled  bool   `envconfig:"PLUGIN_LOG_PERSISTENCE_ENABLED"`
+	PluginLogPersistencePath     string `envconfig:"PLUGIN_LOG_PERSISTENCE_PATH"`
+	PluginLogPersistenceInterval int    `envconfig:"PLUGIN_LOG_PERSISTENCE_INTERVAL"` // seconds
+
 	PluginStdioBufferSize    int `envconfig:"PLUGIN_STDIO_BUFFER_SIZE" default:"1024"`
 	PluginStdioMaxBufferSize int `envconfig:"PLUGIN_STDIO_MAX_BUFFER_SIZE" default:"5242880"`
+	// stdio protocols offered to plugins in preference order, plugins select one
+	// in their handshake and fall back to json lines without it
+	PluginStdioProtocols []string `envconfig:"PLUGIN_STDIO_PROTOCOLS" default:"length_prefixed_cbor,length_prefixed_json,json_lines"`
+	// range of plugin sdk versions announced in the handshake which are accepted, empty
+	// means unbounded. Plugins without a handshake are refused once a minimum is set
+	PluginSdkMinVersion string `envconfig:"PLUGIN_SDK_MIN_VERSION"`
+	PluginSdkMaxVersion string `envconfig:"PLUGIN_SDK_MAX_VERSION"`
+
+	// chunks emitted by plugins which fail the validation fail the invocation in strict
+	// mode, in warn mode they are passed through and logged
+	PluginResponseValidationMode string `envconfig:"PLUGIN_RESPONSE_VALIDATION_MODE" validate:"omitempty,oneof=strict warn"`
+
+	// yaml file listing the mcp servers exposed as tool plugins, see mcp_runtime.MCPServersConfig
+	MCPServersConfigPath string `envconfig:"MCP_SERVERS_CONFIG_PATH"`
 
 	DisplayClusterLog bool `envconfig:"DISPLAY_CLUSTER_LOG"`
 
+	// sandbox of local plugin processes, linux only, the level is selected by
+	// the authorized category of the plugin: disabled, standard or strict
+	PluginSandboxEnabled         bool     `envconfig:"PLUGIN_SANDBOX_ENABLED"`
+	PluginSandboxPartnerLevel    string   `envconfig:"PLUGIN_SANDBOX_PARTNER_LEVEL"`
+	PluginSandboxCommunityLevel  string   `envconfig:"PLUGIN_SANDBOX_COMMUNITY_LEVEL"`
+	PluginSandboxUnverifiedLevel string   `envconfig:"PLUGIN_SANDBOX_UNVERIFIED_LEVEL"`
+	PluginSandboxMaskedPaths     []string `envconfig:"PLUGIN_SANDBOX_MASKED_PATHS"`  // paths hidden from sandboxed plugins
+	PluginSandboxEnvAllowList    []string `envconfig:"PLUGIN_SANDBOX_ENV_ALLOWLIST"` // daemon env variables passed to sandboxed plugins
+
 	// proxy settings
 	HttpProxy  string `envconfig:"HTTP_PROXY"`
 	HttpsProxy string `envconfig:"HTTPS_PROXY"`
@@ -139,10 +206,16 @@ type Config struct {
 	UvPath                 string `envconfig:"UV_PATH"  default:""`
 	PythonEnvInitTimeout   int    `envconfig:"PYTHON_ENV_INIT_TIMEOUT" validate:"required"`
 	PythonCompileExtraArgs string `envconfig:"PYTHON_COMPILE_EXTRA_ARGS"`
-	PipMirrorUrl           string `envconfig:"PIP_MIRROR_URL"`
-	PipPreferBinary        *bool  `envconfig:"PIP_PREFER_BINARY"`
-	PipVerbose             *bool  `envconfig:"PIP_VERBOSE"`
-	PipExtraArgs           string `envconfig:"PIP_EXTRA_ARGS"`
+	// virtual environments and wheels shared by plugins with the same requirements
+	PythonVenvCacheEnabled *bool  `envconfig:"PYTHON_VENV_CACHE_ENABLED"`
+	PythonVenvCachePath    string `envconfig:"PYTHON_VENV_CACHE_PATH"`
+	PythonVenvCacheMaxSize int64  `envconfig:"PYTHON_VENV_CACHE_MAX_SIZE"` // bytes
+	// install dependencies from the wheels bundled into the package, the index is never used
+	PythonOfflineInstall bool   `envconfig:"PYTHON_OFFLINE_INSTALL"`
+	PipMirrorUrl         string `envconfig:"PIP_MIRROR_URL"`
+	PipPreferBinary      *bool  `envconfig:"PIP_PREFER_BINARY"`
+	PipVerbose           *bool  `envconfig:"PIP_VERBOSE"`
+	PipExtraArgs         string `envconfig:"PIP_EXTRA_ARGS"`
 
 	NodeExecutePath    string `envconfig:"NODE_EXECUTE_PATH"`
 	NodeEnvInitTimeout int    `envconfig:"NODE_ENV_INIT_TIMEOUT"`
@@ -178,6 +251,23 @@ func (c *Config) Validate() error {
 	if c.PluginPackageCachePath == "" {
 		return fmt.Errorf("plugin package cache path is empty")
 	}
+
+	for _, version := range []string{c.PluginSdkMinVersion, c.PluginSdkMaxVersion} {
+		if version != "" && !manifest_entites.PluginDeclarationVersionRegex.MatchString(version) {
+			return fmt.Errorf("invalid plugin sdk version: %s", version)
+		}
+	}
+
+	if c.PluginSandboxEnabled {
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("plugin sandbox is only supported on linux")
+		}
+		for _, level := range []string{c.PluginSandboxPartnerLevel, c.PluginSandboxCommunityLevel, c.PluginSandboxUnverifiedLevel} {
+			if _, err := sandbox.ParseLevel(level); err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
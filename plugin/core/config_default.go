@@ -1,12 +1,14 @@
 package core
 
 import (
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/sandbox"
 	"github.com/jjgagacy/workflow-app/plugin/oss"
 	"golang.org/x/exp/constraints"
 )
 
 func (config *Config) SetDefault() {
 	setDefaultInt(&config.ServerPort, 5002)
+	setDefaultInt(&config.ShutdownDrainTimeout, 30)
 	setDefaultInt(&config.RoutinePoolSize, 10000)
 
 	setDefaultInt(&config.LifetimeCollectionGCInterval, 60)
@@ -16,19 +18,45 @@ func (config *Config) SetDefault() {
 	setDefaultInt(&config.MaxPluginPackageSize, 50*1024*1024)    // 50Mb
 	setDefaultInt(&config.MaxBundlePackageSize, 12*50*1024*1024) // 600Mb
 	setDefaultInt(&config.MaxServerlessTransactionTimeout, 300)
+	setDefaultInt(&config.PluginGitCloneTimeout, 120)
+	setDefaultInt(&config.PluginGitCloneMaxSize, 200*1024*1024) // 200Mb
+	setDefaultInt(&config.PluginInstallTaskStreamTimeout, 15*60)
 
 	setDefaultString(&config.PluginStorageType, oss.OSS_TYPE_LOCAL)
 	setDefaultInt(&config.PluginMediaCacheSize, 1024)
 	setDefaultBoolPtr(&config.PluginEndPointEnabled, true)
+	setDefaultInt(&config.PluginEndPointMaxBodySize, 100*1024*1024) // 100Mb
+	setDefaultInt(&config.PluginEndPointInlineBodySize, 1024*1024)  // 1Mb
+	setDefaultInt(&config.PluginEndPointBodyChunkSize, 64*1024)     // 64Kb
 	setDefaultString(&config.DBSslMode, "disable")
 	setDefaultString(&config.PluginInstalledPath, "plugin")
 	setDefaultString(&config.PluginMediaCachePath, "assets")
 	setDefaultString(&config.PersistenceStoragePath, "persistence")
 	setDefaultInt(&config.PluginLocalLaunchingConcurrent, 2)
+	setDefaultInt(&config.PluginLocalReplicas, 1)
+	setDefaultInt(&config.PluginLocalMaxReplicas, 8)
+	setDefaultInt(&config.PluginColdStartTimeout, 120)
+	setDefaultInt(&config.PluginRestartBackoffInitial, 1000)
+	setDefaultInt(&config.PluginRestartBackoffMax, 60000)
+	setDefaultInt(&config.PluginCrashLoopThreshold, 5)
+	setDefaultInt(&config.PluginCrashLoopWindow, 300)
+	setDefaultInt(&config.PluginResourceSampleInterval, 15)
 	setDefaultInt(&config.PersistenceStorageMaxSize, 100*1024*1024) // 100Mb
 
 	setDefaultInt(&config.PluginMaxExecutionTimeout, 10*60)
+	setDefaultInt(&config.PluginLogBufferSize, 1000)
+	setDefaultString(&config.PluginLogPersistencePath, "plugin_logs")
+	setDefaultInt(&config.PluginLogPersistenceInterval, 60)
 	setDefaultString(&config.PluginPackageCachePath, "plugin_packages")
+	setDefaultString(&config.PluginResponseValidationMode, "strict")
+
+	setDefaultString(&config.PluginSandboxPartnerLevel, string(sandbox.LEVEL_STANDARD))
+	setDefaultString(&config.PluginSandboxCommunityLevel, string(sandbox.LEVEL_STRICT))
+	setDefaultString(&config.PluginSandboxUnverifiedLevel, string(sandbox.LEVEL_STRICT))
+
+	setDefaultBoolPtr(&config.PythonVenvCacheEnabled, true)
+	setDefaultString(&config.PythonVenvCachePath, "python_venv_cache")
+	setDefaultInt(&config.PythonVenvCacheMaxSize, 10*1024*1024*1024) // 10Gb
 
 	setDefaultInt(&config.InvocationConnectionIdleTimeout, 120)
 	setDefaultInt(&config.InvocationWriteTimeout, 5000)  // Milliseconds = 5s
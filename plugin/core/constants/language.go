@@ -13,6 +13,9 @@ const (
 	Python Language = "python"
 )
 
+// python version of the virtual environments of python plugins
+const PythonVersion = "3.12"
+
 var validLanguages = map[Language]bool{
 	Node:   true,
 	Go:     true,
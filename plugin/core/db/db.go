@@ -15,6 +15,8 @@ func migrate() error {
 	err := DB.AutoMigrate(
 		model.Plugin{},
 		model.PluginInstallation{},
+		model.PluginInstallationHistory{},
+		model.PluginRollout{},
 		model.PluginDeclaration{},
 		model.EndPoint{},
 		model.AIModelInstallation{},
@@ -0,0 +1,124 @@
+package mcp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/tool_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+// ToolResult maps the chunks emitted by a tool to the content blocks of an mcp tool
+// result, variables go to the structured content which matches the output schema
+//
+//   - consecutive text chunks are merged as they're usually pieces of one answer
+//   - json, links and image links are passed as text
+//   - blobs, including the ones sent in chunks, become image, audio or resource blocks
+//     according to their mime type
+//   - logs, files and retriever resources have no counterpart and are dropped
+func ToolResult(chunks []tool_entities.ToolResponseChunk) mcp_entities.CallToolResult {
+	result := mcp_entities.CallToolResult{Content: []mcp_entities.Content{}}
+	text := strings.Builder{}
+	flushText := func() {
+		if text.Len() == 0 {
+			return
+		}
+		result.Content = append(result.Content, textContent(text.String()))
+		text.Reset()
+	}
+
+	// pieces of the blobs sent in chunks, by blob id
+	blobs := map[string][]byte{}
+	// variables streamed in pieces, by name
+	streamed := map[string]*strings.Builder{}
+
+	for _, chunk := range chunks {
+		switch chunk.Type {
+		case tool_entities.ToolResponseChunkTypeText:
+			s, _ := chunk.Message["text"].(string)
+			text.WriteString(s)
+		case tool_entities.ToolResponseChunkTypeJson:
+			flushText()
+			result.Content = append(result.Content, textContent(utils.MarshalJson(chunk.Message["json_object"])))
+		case tool_entities.ToolResponseChunkTypeLink,
+			tool_entities.ToolResponseChunkTypeImage,
+			tool_entities.ToolResponseChunkTypeImageLink:
+			flushText()
+			if s, _ := chunk.Message["text"].(string); s != "" {
+				result.Content = append(result.Content, textContent(s))
+			}
+		case tool_entities.ToolResponseChunkTypeBlob:
+			flushText()
+			blob, _ := chunk.Message["blob"].(string)
+			result.Content = append(result.Content, blobContent(blob, mimeType(chunk)))
+		case tool_entities.ToolResponseChunkTypeBlobChunk:
+			id, _ := chunk.Message["id"].(string)
+			piece, _ := chunk.Message["blob"].(string)
+			if decoded, err := base64.StdEncoding.DecodeString(piece); err == nil {
+				blobs[id] = append(blobs[id], decoded...)
+			}
+			if end, _ := chunk.Message["end"].(bool); end {
+				flushText()
+				blob := base64.StdEncoding.EncodeToString(blobs[id])
+				delete(blobs, id)
+				result.Content = append(result.Content, blobContent(blob, mimeType(chunk)))
+			}
+		case tool_entities.ToolResponseChunkTypeVariable:
+			name, _ := chunk.Message["variable_name"].(string)
+			if name == "" {
+				continue
+			}
+			if result.StructuredContent == nil {
+				result.StructuredContent = map[string]any{}
+			}
+			value := chunk.Message["variable_value"]
+			if stream, _ := chunk.Message["stream"].(bool); stream {
+				if streamed[name] == nil {
+					streamed[name] = &strings.Builder{}
+				}
+				streamed[name].WriteString(fmt.Sprint(value))
+				value = streamed[name].String()
+			}
+			result.StructuredContent[name] = value
+		}
+	}
+	flushText()
+
+	// clients which ignore structured content still get the variables
+	if result.StructuredContent != nil {
+		result.Content = append(result.Content, textContent(utils.MarshalJson(result.StructuredContent)))
+	}
+	return result
+}
+
+func textContent(text string) mcp_entities.Content {
+	return mcp_entities.Content{Type: mcp_entities.CONTENT_TYPE_TEXT, Text: text}
+}
+
+func blobContent(blob string, mimeType string) mcp_entities.Content {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return mcp_entities.Content{Type: mcp_entities.CONTENT_TYPE_IMAGE, Data: blob, MimeType: mimeType}
+	case strings.HasPrefix(mimeType, "audio/"):
+		return mcp_entities.Content{Type: mcp_entities.CONTENT_TYPE_AUDIO, Data: blob, MimeType: mimeType}
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	return mcp_entities.Content{
+		Type: mcp_entities.CONTENT_TYPE_RESOURCE,
+		Resource: &mcp_entities.EmbeddedResource{
+			URI:      fmt.Sprintf("blob://%x", sha256.Sum256([]byte(blob))),
+			MimeType: mimeType,
+			Blob:     blob,
+		},
+	}
+}
+
+func mimeType(chunk tool_entities.ToolResponseChunk) string {
+	s, _ := chunk.Meta["mime_type"].(string)
+	return s
+}
@@ -0,0 +1,50 @@
+package mcp
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/tool_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToolResult(t *testing.T) {
+	chunk := func(typ tool_entities.ToolResponseChunkType, message map[string]any, meta map[string]any) tool_entities.ToolResponseChunk {
+		return tool_entities.ToolResponseChunk{Type: typ, Message: message, Meta: meta}
+	}
+	png := base64.StdEncoding.EncodeToString([]byte("png-data"))
+
+	result := ToolResult([]tool_entities.ToolResponseChunk{
+		chunk(tool_entities.ToolResponseChunkTypeText, map[string]any{"text": "hello "}, nil),
+		chunk(tool_entities.ToolResponseChunkTypeText, map[string]any{"text": "world"}, nil),
+		chunk(tool_entities.ToolResponseChunkTypeLog, map[string]any{"label": "step"}, nil),
+		chunk(tool_entities.ToolResponseChunkTypeJson, map[string]any{"json_object": map[string]any{"a": 1}}, nil),
+		chunk(tool_entities.ToolResponseChunkTypeLink, map[string]any{"text": "https://example.com"}, nil),
+		chunk(tool_entities.ToolResponseChunkTypeBlob, map[string]any{"blob": png}, map[string]any{"mime_type": "image/png"}),
+		// 分块发送的文件在结束时合并
+		chunk(tool_entities.ToolResponseChunkTypeBlobChunk, map[string]any{"id": "f", "blob": base64.StdEncoding.EncodeToString([]byte("a,")), "end": false}, nil),
+		chunk(tool_entities.ToolResponseChunkTypeBlobChunk, map[string]any{"id": "f", "blob": base64.StdEncoding.EncodeToString([]byte("b")), "end": true}, map[string]any{"mime_type": "text/csv"}),
+		// 流式变量逐段拼接
+		chunk(tool_entities.ToolResponseChunkTypeVariable, map[string]any{"variable_name": "summary", "variable_value": "sun", "stream": true}, nil),
+		chunk(tool_entities.ToolResponseChunkTypeVariable, map[string]any{"variable_name": "summary", "variable_value": "ny", "stream": true}, nil),
+		chunk(tool_entities.ToolResponseChunkTypeVariable, map[string]any{"variable_name": "temperature", "variable_value": 21.5}, nil),
+	})
+
+	require.Len(t, result.Content, 6)
+	assert.Equal(t, mcp_entities.Content{Type: mcp_entities.CONTENT_TYPE_TEXT, Text: "hello world"}, result.Content[0])
+	assert.Equal(t, mcp_entities.Content{Type: mcp_entities.CONTENT_TYPE_TEXT, Text: `{"a":1}`}, result.Content[1])
+	assert.Equal(t, mcp_entities.Content{Type: mcp_entities.CONTENT_TYPE_TEXT, Text: "https://example.com"}, result.Content[2])
+	assert.Equal(t, mcp_entities.Content{Type: mcp_entities.CONTENT_TYPE_IMAGE, Data: png, MimeType: "image/png"}, result.Content[3])
+
+	resource := result.Content[4]
+	assert.Equal(t, mcp_entities.CONTENT_TYPE_RESOURCE, resource.Type)
+	require.NotNil(t, resource.Resource)
+	assert.Equal(t, "text/csv", resource.Resource.MimeType)
+	assert.Equal(t, base64.StdEncoding.EncodeToString([]byte("a,b")), resource.Resource.Blob)
+
+	assert.Equal(t, map[string]any{"summary": "sunny", "temperature": 21.5}, result.StructuredContent)
+	// 不支持结构化内容的客户端也能看到变量
+	assert.JSONEq(t, `{"summary":"sunny","temperature":21.5}`, result.Content[5].Text)
+}
@@ -0,0 +1,75 @@
+package mcp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/core/server/server_const"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+)
+
+// HandleHTTP serves the streamable http transport, every message is answered in the
+// body of its request as the server never sends anything on its own
+func (s *Server) HandleHTTP(ctx *gin.Context, caller Caller, maxBodySize int64) {
+	if ctx.Request.Method != http.MethodPost {
+		ctx.Header("Allow", http.MethodPost)
+		ctx.AbortWithStatus(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(ctx.Request.Body, maxBodySize+1))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, entities.BadRequestError(err).ToResponse())
+		return
+	}
+	if int64(len(body)) > maxBodySize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, entities.BadRequestError(errors.New("request body too large")).ToResponse())
+		return
+	}
+
+	response := s.Handle(caller, body)
+	if response == nil {
+		ctx.Status(http.StatusAccepted)
+		return
+	}
+	ctx.Data(http.StatusOK, "application/json", response)
+}
+
+// NewHTTPForwarder returns a handler which forwards the messages to the mcp endpoint
+// of a daemon, it's used to serve the stdio transport out of the daemon
+func NewHTTPForwarder(url string, serverKey string, timeout time.Duration) func([]byte) ([]byte, error) {
+	client := &http.Client{Timeout: timeout}
+
+	return func(message []byte) ([]byte, error) {
+		req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(message))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		req.Header.Set(server_const.X_API_KEY, serverKey)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, errors.Join(err, fmt.Errorf("failed to reach the daemon"))
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return body, nil
+		case http.StatusAccepted:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("daemon responded with status %d: %s", resp.StatusCode, string(body))
+	}
+}
@@ -0,0 +1,252 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/tool_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+const (
+	SERVER_NAME    = "monie-plugin-daemon"
+	SERVER_VERSION = "0.1.0"
+)
+
+// Caller is whom the tools are listed and invoked for
+type Caller struct {
+	TenantID string
+	UserID   string
+}
+
+// InstalledTool is a tool of a tool provider installed by the tenant
+type InstalledTool struct {
+	PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier
+	Provider               string
+	Declaration            plugin_entities.ToolDeclaration
+}
+
+// Name is the name of the tool exposed to mcp clients, tools of different providers
+// may share a name so the provider is part of it
+func (t *InstalledTool) Name() string {
+	return t.Provider + "__" + t.Declaration.Identity.Name
+}
+
+// ToolBackend lists and invokes the tools installed by a tenant
+type ToolBackend interface {
+	ListTools(caller Caller) ([]InstalledTool, error)
+	// InvokeTool runs the tool to the end and returns every chunk it emitted
+	InvokeTool(
+		caller Caller,
+		tool InstalledTool,
+		parameters map[string]any,
+		meta *mcp_entities.CallToolMeta,
+	) ([]tool_entities.ToolResponseChunk, error)
+}
+
+// Server answers the json-rpc messages of mcp clients, it keeps no state between
+// messages so that any daemon node can serve any of them
+type Server struct {
+	backend ToolBackend
+}
+
+func NewServer(backend ToolBackend) *Server {
+	return &Server{backend: backend}
+}
+
+// Handle answers a json-rpc message or a batch of them, nil is returned if the
+// message contains notifications only
+func (s *Server) Handle(caller Caller, message []byte) []byte {
+	message = bytes.TrimSpace(message)
+	if len(message) > 0 && message[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(message, &batch); err != nil || len(batch) == 0 {
+			return utils.MarshalJsonBytes(errorResponse(nil, mcp_entities.ERROR_CODE_INVALID_REQUEST, "invalid batch"))
+		}
+
+		responses := []*mcp_entities.Response{}
+		for _, m := range batch {
+			if response := s.handle(caller, m); response != nil {
+				responses = append(responses, response)
+			}
+		}
+		if len(responses) == 0 {
+			return nil
+		}
+		return utils.MarshalJsonBytes(responses)
+	}
+
+	response := s.handle(caller, message)
+	if response == nil {
+		return nil
+	}
+	return utils.MarshalJsonBytes(response)
+}
+
+func (s *Server) handle(caller Caller, message []byte) *mcp_entities.Response {
+	var request mcp_entities.Request
+	if err := json.Unmarshal(message, &request); err != nil {
+		return errorResponse(nil, mcp_entities.ERROR_CODE_PARSE_ERROR, "parse error")
+	}
+	if request.JSONRPC != mcp_entities.JSONRPC_VERSION || request.Method == "" {
+		return errorResponse(request.ID, mcp_entities.ERROR_CODE_INVALID_REQUEST, "invalid request")
+	}
+
+	if request.IsNotification() {
+		// notifications/initialized and cancellations need no answer, tool calls are
+		// not cancelled as they're bound to the request which carries them
+		return nil
+	}
+
+	var result any
+	var rpcErr *mcp_entities.Error
+	switch request.Method {
+	case mcp_entities.METHOD_INITIALIZE:
+		result, rpcErr = s.initialize(request.Params)
+	case mcp_entities.METHOD_PING:
+		result = map[string]any{}
+	case mcp_entities.METHOD_TOOLS_LIST:
+		result, rpcErr = s.listTools(caller)
+	case mcp_entities.METHOD_TOOLS_CALL:
+		result, rpcErr = s.callTool(caller, request.Params)
+	default:
+		rpcErr = &mcp_entities.Error{
+			Code:    mcp_entities.ERROR_CODE_METHOD_NOT_FOUND,
+			Message: fmt.Sprintf("method %s not found", request.Method),
+		}
+	}
+
+	if rpcErr != nil {
+		return &mcp_entities.Response{JSONRPC: mcp_entities.JSONRPC_VERSION, ID: request.ID, Error: rpcErr}
+	}
+	return &mcp_entities.Response{JSONRPC: mcp_entities.JSONRPC_VERSION, ID: request.ID, Result: result}
+}
+
+func (s *Server) initialize(raw json.RawMessage) (any, *mcp_entities.Error) {
+	var params mcp_entities.InitializeParams
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	version := mcp_entities.LATEST_PROTOCOL_VERSION
+	if slices.Contains(mcp_entities.SupportedProtocolVersions, params.ProtocolVersion) {
+		version = params.ProtocolVersion
+	}
+
+	return mcp_entities.InitializeResult{
+		ProtocolVersion: version,
+		Capabilities: mcp_entities.ServerCapabilities{
+			Tools: &mcp_entities.ToolsCapability{},
+		},
+		ServerInfo: mcp_entities.Implementation{Name: SERVER_NAME, Version: SERVER_VERSION},
+	}, nil
+}
+
+func (s *Server) listTools(caller Caller) (any, *mcp_entities.Error) {
+	installed, err := s.backend.ListTools(caller)
+	if err != nil {
+		return nil, internalError(err)
+	}
+
+	tools := make([]mcp_entities.Tool, 0, len(installed))
+	for _, tool := range uniqueTools(installed) {
+		tools = append(tools, mcp_entities.Tool{
+			Name:         tool.Name(),
+			Title:        tool.Declaration.Identity.Label.EnUs,
+			Description:  tool.Declaration.Description.LLM,
+			InputSchema:  plugin_entities.ToolParametersJsonSchema(tool.Declaration.Parameters),
+			OutputSchema: tool.Declaration.OutputSchema,
+		})
+	}
+	return mcp_entities.ListToolsResult{Tools: tools}, nil
+}
+
+func (s *Server) callTool(caller Caller, raw json.RawMessage) (any, *mcp_entities.Error) {
+	var params mcp_entities.CallToolParams
+	if err := decodeParams(raw, &params); err != nil {
+		return nil, err
+	}
+
+	installed, err := s.backend.ListTools(caller)
+	if err != nil {
+		return nil, internalError(err)
+	}
+	var tool *InstalledTool
+	for _, t := range uniqueTools(installed) {
+		if t.Name() == params.Name {
+			tool = &t
+			break
+		}
+	}
+	if tool == nil {
+		return nil, &mcp_entities.Error{
+			Code:    mcp_entities.ERROR_CODE_INVALID_PARAMS,
+			Message: fmt.Sprintf("unknown tool: %s", params.Name),
+		}
+	}
+
+	parameters, err := plugin_entities.ValidateToolParameters(tool.Declaration.Parameters, params.Arguments)
+	if err != nil {
+		rpcErr := &mcp_entities.Error{Code: mcp_entities.ERROR_CODE_INVALID_PARAMS, Message: err.Error()}
+		var invalid *plugin_entities.InvalidParametersError
+		if errors.As(err, &invalid) {
+			rpcErr.Data = map[string]any{"parameters": invalid.Parameters}
+		}
+		return nil, rpcErr
+	}
+
+	chunks, err := s.backend.InvokeTool(caller, *tool, parameters, params.Meta)
+	if err != nil {
+		// failures of the tool are told to the model rather than the client
+		return mcp_entities.CallToolResult{
+			Content: []mcp_entities.Content{{Type: mcp_entities.CONTENT_TYPE_TEXT, Text: err.Error()}},
+			IsError: true,
+		}, nil
+	}
+	return ToolResult(chunks), nil
+}
+
+// uniqueTools drops the tools whose name is already taken, it happens only if two
+// plugins of the tenant declare the same provider
+func uniqueTools(tools []InstalledTool) []InstalledTool {
+	seen := map[string]bool{}
+	result := make([]InstalledTool, 0, len(tools))
+	for _, tool := range tools {
+		if seen[tool.Name()] {
+			continue
+		}
+		seen[tool.Name()] = true
+		result = append(result, tool)
+	}
+	return result
+}
+
+func decodeParams(raw json.RawMessage, params any) *mcp_entities.Error {
+	if len(raw) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(raw, params); err != nil {
+		return &mcp_entities.Error{Code: mcp_entities.ERROR_CODE_INVALID_PARAMS, Message: err.Error()}
+	}
+	return nil
+}
+
+func internalError(err error) *mcp_entities.Error {
+	return &mcp_entities.Error{Code: mcp_entities.ERROR_CODE_INTERNAL_ERROR, Message: err.Error()}
+}
+
+func errorResponse(id json.RawMessage, code int, message string) *mcp_entities.Response {
+	if len(id) == 0 {
+		id = json.RawMessage("null")
+	}
+	return &mcp_entities.Response{
+		JSONRPC: mcp_entities.JSONRPC_VERSION,
+		ID:      id,
+		Error:   &mcp_entities.Error{Code: code, Message: message},
+	}
+}
@@ -0,0 +1,227 @@
+package mcp
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/tool_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend 按租户返回预设的工具，并记录调用
+type fakeBackend struct {
+	tools     map[string][]InstalledTool
+	chunks    []tool_entities.ToolResponseChunk
+	invokeErr error
+
+	invoked    *InstalledTool
+	parameters map[string]any
+	meta       *mcp_entities.CallToolMeta
+}
+
+func (f *fakeBackend) ListTools(caller Caller) ([]InstalledTool, error) {
+	return f.tools[caller.TenantID], nil
+}
+
+func (f *fakeBackend) InvokeTool(
+	caller Caller,
+	tool InstalledTool,
+	parameters map[string]any,
+	meta *mcp_entities.CallToolMeta,
+) ([]tool_entities.ToolResponseChunk, error) {
+	f.invoked = &tool
+	f.parameters = parameters
+	f.meta = meta
+	return f.chunks, f.invokeErr
+}
+
+func weatherTool() InstalledTool {
+	return InstalledTool{
+		PluginUniqueIdentifier: "author/weather:0.0.1@abc",
+		Provider:               "weather",
+		Declaration: plugin_entities.ToolDeclaration{
+			Identity:    plugin_entities.ToolIdentity{Name: "forecast", Label: plugin_entities.I18nObject{EnUs: "Forecast"}},
+			Description: plugin_entities.ToolDescription{LLM: "forecast of a city"},
+			Parameters: []plugin_entities.ToolParameter{
+				{Name: "city", Type: plugin_entities.TOOL_PARAMETER_TYPE_STRING, Required: true},
+				{Name: "days", Type: plugin_entities.TOOL_PARAMETER_TYPE_NUMBER, Default: 3},
+			},
+		},
+	}
+}
+
+// call 发送一条请求并解析响应
+func call(t *testing.T, server *Server, caller Caller, method string, params any) mcp_entities.Response {
+	message := map[string]any{"jsonrpc": "2.0", "id": 1, "method": method}
+	if params != nil {
+		message["params"] = params
+	}
+	data, err := json.Marshal(message)
+	require.NoError(t, err)
+
+	var response mcp_entities.Response
+	require.NoError(t, json.Unmarshal(server.Handle(caller, data), &response))
+	assert.JSONEq(t, "1", string(response.ID))
+	return response
+}
+
+// result 将响应的结果转换为指定类型
+func result[T any](t *testing.T, response mcp_entities.Response) T {
+	require.Nil(t, response.Error)
+	var v T
+	data, err := json.Marshal(response.Result)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &v))
+	return v
+}
+
+func TestServerInitialize(t *testing.T) {
+	server := NewServer(&fakeBackend{})
+
+	tests := []struct {
+		name      string
+		requested string
+		expected  string
+	}{
+		{"支持的版本", "2025-03-26", "2025-03-26"},
+		{"不支持的版本返回最新版本", "2099-01-01", mcp_entities.LATEST_PROTOCOL_VERSION},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := call(t, server, Caller{TenantID: "tenant"}, "initialize", map[string]any{
+				"protocolVersion": tt.requested,
+				"capabilities":    map[string]any{},
+				"clientInfo":      map[string]any{"name": "ide", "version": "1.0"},
+			})
+			initialized := result[mcp_entities.InitializeResult](t, response)
+			assert.Equal(t, tt.expected, initialized.ProtocolVersion)
+			assert.NotNil(t, initialized.Capabilities.Tools)
+			assert.Equal(t, SERVER_NAME, initialized.ServerInfo.Name)
+		})
+	}
+}
+
+func TestServerListTools(t *testing.T) {
+	duplicated := weatherTool()
+	duplicated.PluginUniqueIdentifier = "other/weather:0.0.1@def"
+	server := NewServer(&fakeBackend{tools: map[string][]InstalledTool{
+		"tenant": {weatherTool(), duplicated},
+	}})
+
+	listed := result[mcp_entities.ListToolsResult](t, call(t, server, Caller{TenantID: "tenant"}, "tools/list", nil))
+	// 同名的工具只保留第一个
+	require.Len(t, listed.Tools, 1)
+	tool := listed.Tools[0]
+	assert.Equal(t, "weather__forecast", tool.Name)
+	assert.Equal(t, "Forecast", tool.Title)
+	assert.Equal(t, "forecast of a city", tool.Description)
+	assert.Equal(t, []any{"city"}, tool.InputSchema["required"])
+
+	// 只返回当前租户的工具
+	listed = result[mcp_entities.ListToolsResult](t, call(t, server, Caller{TenantID: "other"}, "tools/list", nil))
+	assert.Empty(t, listed.Tools)
+}
+
+func TestServerCallTool(t *testing.T) {
+	caller := Caller{TenantID: "tenant", UserID: "user"}
+
+	t.Run("调用工具", func(t *testing.T) {
+		backend := &fakeBackend{
+			tools: map[string][]InstalledTool{"tenant": {weatherTool()}},
+			chunks: []tool_entities.ToolResponseChunk{
+				{Type: tool_entities.ToolResponseChunkTypeText, Message: map[string]any{"text": "sunny"}},
+			},
+		}
+		response := call(t, NewServer(backend), caller, "tools/call", map[string]any{
+			"name":      "weather__forecast",
+			"arguments": map[string]any{"city": "Hangzhou", "days": "2"},
+			"_meta":     map[string]any{"credentials": map[string]any{"api_key": "secret"}},
+		})
+
+		called := result[mcp_entities.CallToolResult](t, response)
+		assert.False(t, called.IsError)
+		assert.Equal(t, []mcp_entities.Content{{Type: mcp_entities.CONTENT_TYPE_TEXT, Text: "sunny"}}, called.Content)
+
+		// 参数按照声明转换
+		require.NotNil(t, backend.invoked)
+		assert.Equal(t, "forecast", backend.invoked.Declaration.Identity.Name)
+		assert.Equal(t, map[string]any{"city": "Hangzhou", "days": 2.0}, backend.parameters)
+		assert.Equal(t, map[string]any{"api_key": "secret"}, backend.meta.Credentials)
+	})
+
+	t.Run("未知的工具", func(t *testing.T) {
+		backend := &fakeBackend{tools: map[string][]InstalledTool{"tenant": {weatherTool()}}}
+		response := call(t, NewServer(backend), Caller{TenantID: "other"}, "tools/call", map[string]any{
+			"name": "weather__forecast",
+		})
+		require.NotNil(t, response.Error)
+		assert.Equal(t, mcp_entities.ERROR_CODE_INVALID_PARAMS, response.Error.Code)
+		assert.Nil(t, backend.invoked)
+	})
+
+	t.Run("非法的参数", func(t *testing.T) {
+		backend := &fakeBackend{tools: map[string][]InstalledTool{"tenant": {weatherTool()}}}
+		response := call(t, NewServer(backend), caller, "tools/call", map[string]any{
+			"name":      "weather__forecast",
+			"arguments": map[string]any{"days": "many"},
+		})
+		require.NotNil(t, response.Error)
+		assert.Equal(t, mcp_entities.ERROR_CODE_INVALID_PARAMS, response.Error.Code)
+		assert.Contains(t, response.Error.Message, "city: is required")
+		assert.Nil(t, backend.invoked)
+	})
+
+	t.Run("工具执行失败", func(t *testing.T) {
+		backend := &fakeBackend{
+			tools:     map[string][]InstalledTool{"tenant": {weatherTool()}},
+			invokeErr: errors.New("plugin crashed"),
+		}
+		response := call(t, NewServer(backend), caller, "tools/call", map[string]any{
+			"name":      "weather__forecast",
+			"arguments": map[string]any{"city": "Hangzhou"},
+		})
+		// 执行失败作为结果返回给模型
+		called := result[mcp_entities.CallToolResult](t, response)
+		assert.True(t, called.IsError)
+		assert.Equal(t, "plugin crashed", called.Content[0].Text)
+	})
+}
+
+func TestServerHandleMessages(t *testing.T) {
+	server := NewServer(&fakeBackend{})
+	caller := Caller{TenantID: "tenant"}
+
+	tests := []struct {
+		name    string
+		message string
+		// 期望的响应，空表示没有响应
+		expected string
+	}{
+		{"通知没有响应", `{"jsonrpc":"2.0","method":"notifications/initialized"}`, ""},
+		{"ping", `{"jsonrpc":"2.0","id":"a","method":"ping"}`, `{"jsonrpc":"2.0","id":"a","result":{}}`},
+		{"未知的方法", `{"jsonrpc":"2.0","id":2,"method":"resources/list"}`, `{"jsonrpc":"2.0","id":2,"error":{"code":-32601,"message":"method resources/list not found"}}`},
+		{"无法解析", `{"jsonrpc"`, `{"jsonrpc":"2.0","id":null,"error":{"code":-32700,"message":"parse error"}}`},
+		{"非法的请求", `{"jsonrpc":"1.0","id":3,"method":"ping"}`, `{"jsonrpc":"2.0","id":3,"error":{"code":-32600,"message":"invalid request"}}`},
+		{
+			"批量请求",
+			`[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/initialized"},{"jsonrpc":"2.0","id":2,"method":"ping"}]`,
+			`[{"jsonrpc":"2.0","id":1,"result":{}},{"jsonrpc":"2.0","id":2,"result":{}}]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := server.Handle(caller, []byte(tt.message))
+			if tt.expected == "" {
+				assert.Nil(t, response)
+				return
+			}
+			assert.JSONEq(t, tt.expected, string(response))
+		})
+	}
+}
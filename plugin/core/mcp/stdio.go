@@ -0,0 +1,58 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+// the largest message accepted by both transports
+const MAX_MESSAGE_SIZE = 16 * 1024 * 1024
+
+// ServeStdio serves the stdio transport, messages are delimited by newlines and
+// answered one after another, handle returns nil for messages which need no answer
+func ServeStdio(in io.Reader, out io.Writer, handle func([]byte) ([]byte, error)) error {
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_MESSAGE_SIZE)
+
+	for scanner.Scan() {
+		message := bytes.TrimSpace(scanner.Bytes())
+		if len(message) == 0 {
+			continue
+		}
+
+		response, err := handle(message)
+		if err != nil {
+			utils.Error("failed to handle mcp message: %s", err.Error())
+			response = failedResponse(message, err)
+		}
+		if response == nil {
+			continue
+		}
+
+		// the transport forbids newlines inside a message
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, response); err != nil {
+			return err
+		}
+		compacted.WriteByte('\n')
+		if _, err := out.Write(compacted.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// failedResponse answers a request which couldn't be handled, notifications and
+// batches are left unanswered
+func failedResponse(message []byte, err error) []byte {
+	var request mcp_entities.Request
+	if json.Unmarshal(message, &request) != nil || request.IsNotification() {
+		return nil
+	}
+	return utils.MarshalJsonBytes(errorResponse(request.ID, mcp_entities.ERROR_CODE_INTERNAL_ERROR, err.Error()))
+}
@@ -0,0 +1,116 @@
+package mcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/core/server/server_const"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newDaemon 启动一个只包含 mcp 路由的服务
+func newDaemon(t *testing.T, server *Server) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Any("/plugin/:tenant_id/mcp", func(ctx *gin.Context) {
+		if ctx.GetHeader(server_const.X_API_KEY) != "key" {
+			ctx.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		server.HandleHTTP(ctx, Caller{TenantID: ctx.Param("tenant_id")}, 1024)
+	})
+	daemon := httptest.NewServer(engine)
+	t.Cleanup(daemon.Close)
+	return daemon
+}
+
+func TestHandleHTTP(t *testing.T) {
+	daemon := newDaemon(t, NewServer(&fakeBackend{}))
+	url := daemon.URL + "/plugin/tenant/mcp"
+
+	post := func(body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set(server_const.X_API_KEY, "key")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	resp := post(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	// 通知返回 202
+	resp = post(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	assert.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	// 超出大小限制
+	resp = post(`{"jsonrpc":"2.0","id":1,"method":"ping","params":{"padding":"` + strings.Repeat("x", 1024) + `"}}`)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	// 服务端不主动推送消息
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	require.NoError(t, err)
+	req.Header.Set(server_const.X_API_KEY, "key")
+	getResp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer getResp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, getResp.StatusCode)
+}
+
+func TestServeStdioForwardsToDaemon(t *testing.T) {
+	backend := &fakeBackend{tools: map[string][]InstalledTool{"tenant": {weatherTool()}}}
+	daemon := newDaemon(t, NewServer(backend))
+
+	in := strings.NewReader(strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		"",
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+	}, "\n"))
+	out := &bytes.Buffer{}
+
+	err := ServeStdio(in, out, NewHTTPForwarder(daemon.URL+"/plugin/tenant/mcp", "key", time.Second))
+	require.NoError(t, err)
+
+	// 每条响应占一行，通知没有响应
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 2)
+
+	var listed struct {
+		ID     int                          `json:"id"`
+		Result mcp_entities.ListToolsResult `json:"result"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &listed))
+	assert.Equal(t, 2, listed.ID)
+	require.Len(t, listed.Result.Tools, 1)
+	assert.Equal(t, "weather__forecast", listed.Result.Tools[0].Name)
+}
+
+func TestServeStdioDaemonFailure(t *testing.T) {
+	daemon := newDaemon(t, NewServer(&fakeBackend{}))
+
+	in := strings.NewReader(`{"jsonrpc":"2.0","id":7,"method":"ping"}` + "\n")
+	out := &bytes.Buffer{}
+
+	// 服务密钥错误时请求以错误响应结束
+	err := ServeStdio(in, out, NewHTTPForwarder(daemon.URL+"/plugin/tenant/mcp", "wrong", time.Second))
+	require.NoError(t, err)
+
+	var response mcp_entities.Response
+	require.NoError(t, json.Unmarshal(out.Bytes(), &response))
+	assert.JSONEq(t, "7", string(response.ID))
+	require.NotNil(t, response.Error)
+	assert.Equal(t, mcp_entities.ERROR_CODE_INTERNAL_ERROR, response.Error.Code)
+	assert.Contains(t, response.Error.Message, "401")
+}
@@ -0,0 +1,217 @@
+package openai
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/model_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/openai_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+// max size of an uploaded audio file, the same as the one of openai
+const MAX_AUDIO_FILE_SIZE = 25 * 1024 * 1024
+
+var speechContentTypes = map[string]string{
+	"mp3":  "audio/mpeg",
+	"opus": "audio/opus",
+	"aac":  "audio/aac",
+	"flac": "audio/flac",
+	"wav":  "audio/wav",
+	"pcm":  "audio/pcm",
+}
+
+// Speech invokes the tts model of a model plugin, the audio is written to the client
+// as the plugin produces it
+func (s *Server) Speech(ctx *gin.Context, caller Caller) {
+	var request openai_entities.SpeechRequest
+	if !bindRequest(ctx, &request) {
+		return
+	}
+	if request.Model == "" || request.Input == "" || request.Voice == "" {
+		abortWithInvalidRequest(ctx, "model, input and voice are required")
+		return
+	}
+	// the plugins choose the format of the audio, the requested one only names it
+	contentType := "audio/mpeg"
+	if request.ResponseFormat != "" {
+		var ok bool
+		if contentType, ok = speechContentTypes[request.ResponseFormat]; !ok {
+			abortWithInvalidRequest(ctx, fmt.Sprintf("unsupported response_format %s", request.ResponseFormat))
+			return
+		}
+	}
+
+	model, ok := s.resolveModel(ctx, caller, request.Model, plugin_entities.MODEL_TYPE_TTS)
+	if !ok {
+		return
+	}
+	if caller.UserID == "" {
+		caller.UserID = request.User
+	}
+
+	stream, err := s.backend.InvokeTTS(caller, model.Provider, &requests.RequestInvokeTTS{
+		BaseRequestInvokeModel: requests.BaseRequestInvokeModel{
+			Provider: model.Provider.Declaration.Provider,
+			Model:    model.Name,
+		},
+		Credentials: requests.Credentials{
+			Credentials:    request.Credentials,
+			CredentialType: request.CredentialType,
+		},
+		InvokeTTSSchema: requests.InvokeTTSSchema{
+			ContentText: request.Input,
+			Voice:       request.Voice,
+			TenantID:    caller.TenantID,
+		},
+		ModelType: model_entities.MODEL_TYPE_TTS,
+	})
+	if err != nil {
+		abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+		return
+	}
+
+	// the status is sent with the first chunk so that a failure before it is still
+	// told as an error response
+	written := false
+	var decodeErr error
+	err = consume(ctx, stream, s.maxTimeout, func(chunk model_entities.TTSResult) {
+		if decodeErr != nil {
+			return
+		}
+		// the plugins send the audio hex encoded
+		audio, err := hex.DecodeString(chunk.Result)
+		if err != nil {
+			decodeErr = errors.Join(err, fmt.Errorf("decode audio error"))
+			stream.Close()
+			return
+		}
+		if !written {
+			ctx.Header("Content-Type", contentType)
+			ctx.Status(http.StatusOK)
+			written = true
+		}
+		if _, err := ctx.Writer.Write(audio); err != nil {
+			stream.Close()
+			return
+		}
+		ctx.Writer.Flush()
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	if err != nil {
+		if written {
+			// the client finds the audio cut short, the status can't be changed anymore
+			utils.Warn("tts of %s failed after the audio was sent: %s", model.ID(), err.Error())
+			return
+		}
+		abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+		return
+	}
+	if !written {
+		ctx.Data(http.StatusOK, contentType, []byte{})
+	}
+}
+
+// Transcriptions invokes the speech2text model of a model plugin with the uploaded
+// audio file
+func (s *Server) Transcriptions(ctx *gin.Context, caller Caller) {
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, MAX_AUDIO_FILE_SIZE+1024*1024)
+
+	fileHeader, err := ctx.FormFile("file")
+	if err != nil {
+		abortWithInvalidRequest(ctx, "file is required")
+		return
+	}
+	if fileHeader.Size > MAX_AUDIO_FILE_SIZE {
+		abortWithError(ctx, http.StatusRequestEntityTooLarge, openai_entities.ERROR_TYPE_INVALID_REQUEST, "file too large", nil)
+		return
+	}
+	modelName := ctx.PostForm("model")
+	if modelName == "" {
+		abortWithInvalidRequest(ctx, "model is required")
+		return
+	}
+	// speech2text models return the text only, verbose_json has no language,
+	// duration or segments to fill in
+	responseFormat := ctx.DefaultPostForm("response_format", openai_entities.TRANSCRIPTION_FORMAT_JSON)
+	switch responseFormat {
+	case openai_entities.TRANSCRIPTION_FORMAT_JSON, openai_entities.TRANSCRIPTION_FORMAT_TEXT:
+	default:
+		abortWithInvalidRequest(ctx, fmt.Sprintf("unsupported response_format %s", responseFormat))
+		return
+	}
+	// credentials are a json field of the form as the rest of it is flat
+	var credentials map[string]any
+	if value := ctx.PostForm("credentials"); value != "" {
+		if err := json.Unmarshal([]byte(value), &credentials); err != nil {
+			abortWithInvalidRequest(ctx, "credentials must be a json object")
+			return
+		}
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		abortWithInvalidRequest(ctx, err.Error())
+		return
+	}
+	audio, err := io.ReadAll(file)
+	file.Close()
+	if err != nil {
+		abortWithInvalidRequest(ctx, err.Error())
+		return
+	}
+
+	model, ok := s.resolveModel(ctx, caller, modelName, plugin_entities.MODEL_TYPE_SPEECH2TEXT)
+	if !ok {
+		return
+	}
+	if caller.UserID == "" {
+		caller.UserID = ctx.PostForm("user")
+	}
+
+	stream, err := s.backend.InvokeSpeech2Text(caller, model.Provider, &requests.RequestInvokeSpeech2Text{
+		BaseRequestInvokeModel: requests.BaseRequestInvokeModel{
+			Provider: model.Provider.Declaration.Provider,
+			Model:    model.Name,
+		},
+		Credentials: requests.Credentials{
+			Credentials:    credentials,
+			CredentialType: ctx.PostForm("credential_type"),
+		},
+		InvokeSpeech2TextSchema: requests.InvokeSpeech2TextSchema{
+			// the plugins receive the file hex encoded
+			File: hex.EncodeToString(audio),
+		},
+		ModelType: model_entities.MODEL_TYPE_SPEECH2TEXT,
+	})
+	if err != nil {
+		abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+		return
+	}
+
+	results, err := collect(ctx, stream, s.maxTimeout)
+	if err != nil {
+		abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+		return
+	}
+	var text strings.Builder
+	for _, result := range results {
+		text.WriteString(result.Result)
+	}
+
+	if responseFormat == openai_entities.TRANSCRIPTION_FORMAT_TEXT {
+		ctx.String(http.StatusOK, text.String())
+		return
+	}
+	ctx.JSON(http.StatusOK, openai_entities.Transcription{Text: text.String()})
+}
@@ -0,0 +1,133 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/model_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/openai_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerSpeech(t *testing.T) {
+	backend := newBackend()
+	backend.speeches = []model_entities.TTSResult{
+		{Result: hex.EncodeToString([]byte("ID3"))},
+		{Result: hex.EncodeToString([]byte("audio"))},
+	}
+	daemon := newDaemon(t, NewServer(backend, time.Minute))
+	url := daemon.URL + "/plugin/tenant/v1/audio/speech"
+
+	resp := postJSON(t, url, `{"model": "localai/tts-1", "input": "hello", "voice": "alloy"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "audio/mpeg", resp.Header.Get("Content-Type"))
+	audio, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "ID3audio", string(audio))
+
+	request := backend.invoked[0].(*requests.RequestInvokeTTS)
+	assert.Equal(t, "hello", request.ContentText)
+	assert.Equal(t, "alloy", request.Voice)
+	assert.Equal(t, "tenant", request.TenantID)
+
+	resp = postJSON(t, url, `{"model": "localai/tts-1", "input": "hello", "voice": "alloy", "response_format": "wav"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "audio/wav", resp.Header.Get("Content-Type"))
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "缺少音色", body: `{"model": "localai/tts-1", "input": "hello"}`, status: http.StatusBadRequest},
+		{name: "不支持的格式", body: `{"model": "localai/tts-1", "input": "hello", "voice": "alloy", "response_format": "ogg"}`, status: http.StatusBadRequest},
+		{name: "模型类型不符", body: `{"model": "openai/gpt-4o", "input": "hello", "voice": "alloy"}`, status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := postJSON(t, url, tt.body)
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+
+	// 发送音频之前出错时返回错误
+	backend.speeches = nil
+	backend.streamErr = errors.New("voice not found")
+	resp = postJSON(t, url, `{"model": "localai/tts-1", "input": "hello", "voice": "alloy"}`)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "voice not found", decodeBody[openai_entities.ErrorResponse](t, resp).Error.Message)
+}
+
+// postAudio 以 multipart 上传音频文件
+func postAudio(t *testing.T, url string, audio []byte, fields map[string]string) *http.Response {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if audio != nil {
+		part, err := writer.CreateFormFile("file", "speech.mp3")
+		require.NoError(t, err)
+		_, err = part.Write(audio)
+		require.NoError(t, err)
+	}
+	for key, value := range fields {
+		require.NoError(t, writer.WriteField(key, value))
+	}
+	require.NoError(t, writer.Close())
+
+	resp, err := http.Post(url, writer.FormDataContentType(), body)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServerTranscriptions(t *testing.T) {
+	backend := newBackend()
+	backend.transcripts = []model_entities.Speech2TextResult{{Result: "hello "}, {Result: "world"}}
+	daemon := newDaemon(t, NewServer(backend, time.Minute))
+	url := daemon.URL + "/plugin/tenant/v1/audio/transcriptions"
+
+	resp := postAudio(t, url, []byte("ID3audio"), map[string]string{
+		"model":       "localai/whisper-1",
+		"credentials": `{"api_key": "sk-1"}`,
+	})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "hello world", decodeBody[openai_entities.Transcription](t, resp).Text)
+
+	request := backend.invoked[0].(*requests.RequestInvokeSpeech2Text)
+	assert.Equal(t, hex.EncodeToString([]byte("ID3audio")), request.File)
+	assert.Equal(t, map[string]any{"api_key": "sk-1"}, request.Credentials.Credentials)
+	assert.Equal(t, model_entities.MODEL_TYPE_SPEECH2TEXT, request.ModelType)
+
+	resp = postAudio(t, url, []byte("ID3audio"), map[string]string{"model": "localai/whisper-1", "response_format": "text"})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	text, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", string(text))
+
+	tests := []struct {
+		name   string
+		audio  []byte
+		fields map[string]string
+		status int
+	}{
+		{name: "缺少文件", fields: map[string]string{"model": "localai/whisper-1"}, status: http.StatusBadRequest},
+		{name: "缺少模型", audio: []byte("ID3"), status: http.StatusBadRequest},
+		{name: "不支持的格式", audio: []byte("ID3"), fields: map[string]string{"model": "localai/whisper-1", "response_format": "srt"}, status: http.StatusBadRequest},
+		{name: "不支持详细格式", audio: []byte("ID3"), fields: map[string]string{"model": "localai/whisper-1", "response_format": "verbose_json"}, status: http.StatusBadRequest},
+		{name: "凭据不合法", audio: []byte("ID3"), fields: map[string]string{"model": "localai/whisper-1", "credentials": "sk-1"}, status: http.StatusBadRequest},
+		{name: "文件过大", audio: make([]byte, MAX_AUDIO_FILE_SIZE+1), fields: map[string]string{"model": "localai/whisper-1"}, status: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := postAudio(t, url, tt.audio, tt.fields)
+			assert.Equal(t, tt.status, resp.StatusCode)
+		})
+	}
+}
@@ -0,0 +1,429 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/model_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/openai_entities"
+)
+
+// PromptMessages translates the messages of a chat completion request, developer
+// messages are system messages to the model plugins
+func PromptMessages(messages []openai_entities.ChatMessage) ([]model_entities.PromptMessage, error) {
+	result := make([]model_entities.PromptMessage, 0, len(messages))
+	for i, message := range messages {
+		var role model_entities.PromptMessageRole
+		switch message.Role {
+		case openai_entities.ROLE_SYSTEM, openai_entities.ROLE_DEVELOPER:
+			role = model_entities.PROMPT_MESSAGE_ROLE_SYSTEM
+		case openai_entities.ROLE_USER:
+			role = model_entities.PROMPT_MESSAGE_ROLE_USER
+		case openai_entities.ROLE_ASSISTANT:
+			role = model_entities.PROMPT_MESSAGE_ROLE_ASSISTANT
+		case openai_entities.ROLE_TOOL:
+			role = model_entities.PROMPT_MESSAGE_ROLE_TOOL
+		default:
+			return nil, fmt.Errorf("messages[%d]: unsupported role %s", i, message.Role)
+		}
+
+		promptMessage := model_entities.PromptMessage{
+			Role:       role,
+			Content:    "",
+			Name:       message.Name,
+			ToolCallId: message.ToolCallID,
+		}
+		if message.Content != nil && message.Content.Parts != nil {
+			contents := make([]model_entities.PromptMessageContent, 0, len(message.Content.Parts))
+			for j, part := range message.Content.Parts {
+				content, err := promptMessageContent(part)
+				if err != nil {
+					return nil, fmt.Errorf("messages[%d].content[%d]: %s", i, j, err.Error())
+				}
+				contents = append(contents, content)
+			}
+			promptMessage.Content = contents
+		} else if message.Content != nil {
+			promptMessage.Content = message.Content.Text
+		}
+
+		for _, toolCall := range message.ToolCalls {
+			call := model_entities.PromptMessageToolCall{
+				ID:   toolCall.ID,
+				Type: toolCall.Type,
+			}
+			if call.Type == "" {
+				call.Type = openai_entities.TOOL_TYPE_FUNCTION
+			}
+			call.Function.Name = toolCall.Function.Name
+			call.Function.Arguments = toolCall.Function.Arguments
+			promptMessage.ToolCalls = append(promptMessage.ToolCalls, call)
+		}
+
+		result = append(result, promptMessage)
+	}
+	return result, nil
+}
+
+func promptMessageContent(part openai_entities.ContentPart) (model_entities.PromptMessageContent, error) {
+	switch part.Type {
+	case openai_entities.CONTENT_PART_TYPE_TEXT:
+		return model_entities.PromptMessageContent{
+			Type: model_entities.PROMPT_MESSAGE_CONTENT_TYPE_TEXT,
+			Data: part.Text,
+		}, nil
+	case openai_entities.CONTENT_PART_TYPE_IMAGE_URL:
+		if part.ImageURL == nil {
+			return model_entities.PromptMessageContent{}, fmt.Errorf("image_url is required")
+		}
+		content := model_entities.PromptMessageContent{
+			Type:   model_entities.PROMPT_MESSAGE_CONTENT_TYPE_IMAGE,
+			Detail: part.ImageURL.Detail,
+		}
+		if mimeType, data, ok := parseDataURL(part.ImageURL.URL); ok {
+			content.Base64Data = data
+			content.MimeType = mimeType
+			content.Format = strings.TrimPrefix(mimeType, "image/")
+			content.EncodeFormat = "base64"
+		} else {
+			content.URL = part.ImageURL.URL
+		}
+		return content, nil
+	case openai_entities.CONTENT_PART_TYPE_INPUT_AUDIO:
+		if part.InputAudio == nil {
+			return model_entities.PromptMessageContent{}, fmt.Errorf("input_audio is required")
+		}
+		return model_entities.PromptMessageContent{
+			Type:         model_entities.PROMPT_MESSAGE_CONTENT_TYPE_AUDIO,
+			Base64Data:   part.InputAudio.Data,
+			Format:       part.InputAudio.Format,
+			MimeType:     "audio/" + part.InputAudio.Format,
+			EncodeFormat: "base64",
+		}, nil
+	case openai_entities.CONTENT_PART_TYPE_FILE:
+		// files are not stored by the daemon, only inline ones can be passed on
+		if part.File == nil || part.File.FileData == "" {
+			return model_entities.PromptMessageContent{}, fmt.Errorf("only inline file_data is supported")
+		}
+		mimeType, data, ok := parseDataURL(part.File.FileData)
+		if !ok {
+			return model_entities.PromptMessageContent{}, fmt.Errorf("file_data must be a data url")
+		}
+		return model_entities.PromptMessageContent{
+			Type:         model_entities.PROMPT_MESSAGE_CONTENT_TYPE_DOCUMENT,
+			Base64Data:   data,
+			MimeType:     mimeType,
+			Data:         part.File.Filename,
+			EncodeFormat: "base64",
+		}, nil
+	}
+	return model_entities.PromptMessageContent{}, fmt.Errorf("unsupported content type %s", part.Type)
+}
+
+// parseDataURL splits a base64 data url into its mime type and data
+func parseDataURL(url string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", "", false
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mimeType, ok := strings.CutSuffix(meta, ";base64")
+	if !ok {
+		return "", "", false
+	}
+	return mimeType, data, true
+}
+
+// PromptTools translates the tools of a chat completion request, only functions
+// are known to the model plugins
+func PromptTools(tools []openai_entities.Tool) ([]model_entities.PromptMessageTool, error) {
+	result := make([]model_entities.PromptMessageTool, 0, len(tools))
+	for i, tool := range tools {
+		if tool.Type != openai_entities.TOOL_TYPE_FUNCTION {
+			return nil, fmt.Errorf("tools[%d]: unsupported type %s", i, tool.Type)
+		}
+		if tool.Function.Name == "" {
+			return nil, fmt.Errorf("tools[%d]: function name is required", i)
+		}
+		parameters := tool.Function.Parameters
+		if parameters == nil {
+			parameters = map[string]any{"type": "object", "properties": map[string]any{}}
+		}
+		result = append(result, model_entities.PromptMessageTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			Parameters:  parameters,
+		})
+	}
+	return result, nil
+}
+
+// ModelParameters picks the sampling parameters of a chat completion request, the
+// names are the default parameter names of the model plugins
+func ModelParameters(request *openai_entities.ChatCompletionRequest) map[string]any {
+	parameters := map[string]any{}
+	if request.Temperature != nil {
+		parameters["temperature"] = *request.Temperature
+	}
+	if request.TopP != nil {
+		parameters["top_p"] = *request.TopP
+	}
+	if request.MaxCompletionTokens != nil {
+		parameters["max_tokens"] = *request.MaxCompletionTokens
+	} else if request.MaxTokens != nil {
+		parameters["max_tokens"] = *request.MaxTokens
+	}
+	if request.PresencePenalty != nil {
+		parameters["presence_penalty"] = *request.PresencePenalty
+	}
+	if request.FrequencyPenalty != nil {
+		parameters["frequency_penalty"] = *request.FrequencyPenalty
+	}
+	if request.Seed != nil {
+		parameters["seed"] = *request.Seed
+	}
+	if request.ResponseFormat != nil && request.ResponseFormat.Type != "" {
+		parameters["response_format"] = request.ResponseFormat.Type
+		if request.ResponseFormat.JSONSchema != nil {
+			// the schema is a text parameter of the model plugins
+			schema, _ := json.Marshal(request.ResponseFormat.JSONSchema)
+			parameters["json_schema"] = string(schema)
+		}
+	}
+	return parameters
+}
+
+// contentText returns the text of a prompt message content emitted by a plugin, it's
+// either a string or a list of contents
+func contentText(content any) string {
+	switch v := content.(type) {
+	case string:
+		return v
+	case []any:
+		var builder strings.Builder
+		for _, item := range v {
+			if m, ok := item.(map[string]any); ok && m["type"] == string(model_entities.PROMPT_MESSAGE_CONTENT_TYPE_TEXT) {
+				if data, ok := m["data"].(string); ok {
+					builder.WriteString(data)
+				}
+			}
+		}
+		return builder.String()
+	case []model_entities.PromptMessageContent:
+		var builder strings.Builder
+		for _, item := range v {
+			if item.Type == model_entities.PROMPT_MESSAGE_CONTENT_TYPE_TEXT {
+				builder.WriteString(item.Data)
+			}
+		}
+		return builder.String()
+	}
+	return ""
+}
+
+// Usage translates the usage reported by a plugin
+func Usage(usage *model_entities.LLMUsage) *openai_entities.Usage {
+	if usage == nil {
+		return nil
+	}
+	result := &openai_entities.Usage{}
+	if usage.PromptTokens != nil {
+		result.PromptTokens = *usage.PromptTokens
+	}
+	if usage.CompletionTokens != nil {
+		result.CompletionTokens = *usage.CompletionTokens
+	}
+	if usage.TotalTokens != nil {
+		result.TotalTokens = *usage.TotalTokens
+	} else {
+		result.TotalTokens = result.PromptTokens + result.CompletionTokens
+	}
+	return result
+}
+
+// ChunkTranslator turns the chunks of a plugin into the chunks of a chat completion,
+// it keeps the state needed to number the tool calls across chunks
+type ChunkTranslator struct {
+	id      string
+	created int64
+	model   string
+
+	roleSent     bool
+	toolCalled   bool
+	toolCalls    map[string]int
+	lastToolCall int
+	finishReason string
+	usage        *openai_entities.Usage
+	fingerprint  string
+}
+
+func NewChunkTranslator(id string, created int64, model string) *ChunkTranslator {
+	return &ChunkTranslator{
+		id:           id,
+		created:      created,
+		model:        model,
+		toolCalls:    map[string]int{},
+		lastToolCall: -1,
+	}
+}
+
+func (t *ChunkTranslator) newChunk(choices []openai_entities.ChatCompletionChunkChoice) openai_entities.ChatCompletionChunk {
+	return openai_entities.ChatCompletionChunk{
+		ID:                t.id,
+		Object:            openai_entities.OBJECT_CHAT_COMPLETION_CHUNK,
+		Created:           t.created,
+		Model:             t.model,
+		SystemFingerprint: t.fingerprint,
+		Choices:           choices,
+	}
+}
+
+// Translate returns the chunk of a chat completion, the usage is kept aside as it's
+// sent in a chunk of its own
+func (t *ChunkTranslator) Translate(chunk model_entities.LLMResultChunk) openai_entities.ChatCompletionChunk {
+	if chunk.SystemFingerprint != "" {
+		t.fingerprint = chunk.SystemFingerprint
+	}
+	if chunk.Delta.Usage != nil {
+		t.usage = Usage(chunk.Delta.Usage)
+	}
+
+	delta := openai_entities.ChunkDelta{}
+	if !t.roleSent {
+		delta.Role = openai_entities.ROLE_ASSISTANT
+		t.roleSent = true
+	}
+	if text := contentText(chunk.Delta.Message.Content); text != "" {
+		delta.Content = &text
+	}
+
+	for _, toolCall := range chunk.Delta.Message.ToolCalls {
+		// a call without id continues the arguments of the last one
+		index, ok := t.toolCalls[toolCall.ID]
+		if toolCall.ID == "" && t.lastToolCall >= 0 {
+			index = t.lastToolCall
+		} else if !ok {
+			index = len(t.toolCalls)
+			t.toolCalls[toolCall.ID] = index
+		}
+		t.lastToolCall = index
+		t.toolCalled = true
+
+		call := openai_entities.ToolCall{
+			Index: &index,
+			ID:    toolCall.ID,
+			Function: openai_entities.FunctionCall{
+				Name:      toolCall.Function.Name,
+				Arguments: toolCall.Function.Arguments,
+			},
+		}
+		if toolCall.ID != "" {
+			call.Type = openai_entities.TOOL_TYPE_FUNCTION
+		}
+		delta.ToolCalls = append(delta.ToolCalls, call)
+	}
+
+	choice := openai_entities.ChatCompletionChunkChoice{Delta: delta}
+	if chunk.Delta.FinishReason != nil && *chunk.Delta.FinishReason != "" {
+		finishReason := *chunk.Delta.FinishReason
+		t.finishReason = finishReason
+		choice.FinishReason = &finishReason
+	}
+	return t.newChunk([]openai_entities.ChatCompletionChunkChoice{choice})
+}
+
+// Finish returns the last chunk if the plugin didn't tell why it stopped, clients
+// wait for a finish reason
+func (t *ChunkTranslator) Finish() *openai_entities.ChatCompletionChunk {
+	if t.finishReason != "" {
+		return nil
+	}
+	t.finishReason = t.defaultFinishReason()
+	finishReason := t.finishReason
+	chunk := t.newChunk([]openai_entities.ChatCompletionChunkChoice{{
+		Delta:        openai_entities.ChunkDelta{},
+		FinishReason: &finishReason,
+	}})
+	return &chunk
+}
+
+func (t *ChunkTranslator) defaultFinishReason() string {
+	if t.toolCalled {
+		return openai_entities.FINISH_REASON_TOOL_CALLS
+	}
+	return openai_entities.FINISH_REASON_STOP
+}
+
+// UsageChunk returns the chunk carrying the usage, choices of it are always empty
+func (t *ChunkTranslator) UsageChunk() openai_entities.ChatCompletionChunk {
+	chunk := t.newChunk([]openai_entities.ChatCompletionChunkChoice{})
+	chunk.Usage = t.usage
+	if chunk.Usage == nil {
+		chunk.Usage = &openai_entities.Usage{}
+	}
+	return chunk
+}
+
+// Completion merges the chunks of a stream into a chat completion
+type Completion struct {
+	translator *ChunkTranslator
+	content    strings.Builder
+	hasContent bool
+	toolCalls  []openai_entities.ToolCall
+}
+
+func NewCompletion(translator *ChunkTranslator) *Completion {
+	return &Completion{translator: translator}
+}
+
+func (c *Completion) Add(chunk model_entities.LLMResultChunk) {
+	translated := c.translator.Translate(chunk)
+	delta := translated.Choices[0].Delta
+	if delta.Content != nil {
+		c.content.WriteString(*delta.Content)
+		c.hasContent = true
+	}
+	for _, call := range delta.ToolCalls {
+		index := *call.Index
+		if index < len(c.toolCalls) {
+			c.toolCalls[index].Function.Name += call.Function.Name
+			c.toolCalls[index].Function.Arguments += call.Function.Arguments
+			continue
+		}
+		c.toolCalls = append(c.toolCalls, openai_entities.ToolCall{
+			ID:       call.ID,
+			Type:     openai_entities.TOOL_TYPE_FUNCTION,
+			Function: call.Function,
+		})
+	}
+}
+
+func (c *Completion) Result() openai_entities.ChatCompletion {
+	c.translator.Finish()
+
+	message := openai_entities.ResponseMessage{
+		Role:      openai_entities.ROLE_ASSISTANT,
+		ToolCalls: c.toolCalls,
+	}
+	if c.hasContent || len(c.toolCalls) == 0 {
+		content := c.content.String()
+		message.Content = &content
+	}
+
+	return openai_entities.ChatCompletion{
+		ID:                c.translator.id,
+		Object:            openai_entities.OBJECT_CHAT_COMPLETION,
+		Created:           c.translator.created,
+		Model:             c.translator.model,
+		SystemFingerprint: c.translator.fingerprint,
+		Choices: []openai_entities.ChatCompletionChoice{{
+			Message:      message,
+			FinishReason: c.translator.finishReason,
+		}},
+		Usage: c.translator.usage,
+	}
+}
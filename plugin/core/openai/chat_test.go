@@ -0,0 +1,213 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/model_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/openai_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeMessages(t *testing.T, data string) []openai_entities.ChatMessage {
+	var messages []openai_entities.ChatMessage
+	require.NoError(t, json.Unmarshal([]byte(data), &messages))
+	return messages
+}
+
+func TestPromptMessages(t *testing.T) {
+	messages := decodeMessages(t, `[
+		{"role": "developer", "content": "be brief"},
+		{"role": "user", "content": [
+			{"type": "text", "text": "what is it?"},
+			{"type": "image_url", "image_url": {"url": "data:image/png;base64,aW1n", "detail": "low"}},
+			{"type": "image_url", "image_url": {"url": "https://example.com/a.jpg"}},
+			{"type": "input_audio", "input_audio": {"data": "YXVkaW8=", "format": "wav"}}
+		]},
+		{"role": "assistant", "content": null, "tool_calls": [
+			{"id": "call_1", "type": "function", "function": {"name": "weather", "arguments": "{\"city\":\"paris\"}"}}
+		]},
+		{"role": "tool", "tool_call_id": "call_1", "content": "sunny"}
+	]`)
+
+	promptMessages, err := PromptMessages(messages)
+	require.NoError(t, err)
+	require.Len(t, promptMessages, 4)
+
+	// developer 消息作为 system 消息
+	assert.Equal(t, model_entities.PROMPT_MESSAGE_ROLE_SYSTEM, promptMessages[0].Role)
+	assert.Equal(t, "be brief", promptMessages[0].Content)
+
+	contents, ok := promptMessages[1].Content.([]model_entities.PromptMessageContent)
+	require.True(t, ok)
+	require.Len(t, contents, 4)
+	assert.Equal(t, model_entities.PromptMessageContent{Type: model_entities.PROMPT_MESSAGE_CONTENT_TYPE_TEXT, Data: "what is it?"}, contents[0])
+	assert.Equal(t, "aW1n", contents[1].Base64Data)
+	assert.Equal(t, "image/png", contents[1].MimeType)
+	assert.Equal(t, "png", contents[1].Format)
+	assert.Equal(t, "low", contents[1].Detail)
+	assert.Equal(t, "https://example.com/a.jpg", contents[2].URL)
+	assert.Empty(t, contents[2].Base64Data)
+	assert.Equal(t, model_entities.PROMPT_MESSAGE_CONTENT_TYPE_AUDIO, contents[3].Type)
+	assert.Equal(t, "audio/wav", contents[3].MimeType)
+
+	// 没有内容的助手消息保留工具调用
+	assert.Equal(t, "", promptMessages[2].Content)
+	require.Len(t, promptMessages[2].ToolCalls, 1)
+	assert.Equal(t, "call_1", promptMessages[2].ToolCalls[0].ID)
+	assert.Equal(t, "weather", promptMessages[2].ToolCalls[0].Function.Name)
+	assert.Equal(t, `{"city":"paris"}`, promptMessages[2].ToolCalls[0].Function.Arguments)
+
+	assert.Equal(t, model_entities.PROMPT_MESSAGE_ROLE_TOOL, promptMessages[3].Role)
+	assert.Equal(t, "call_1", promptMessages[3].ToolCallId)
+}
+
+func TestPromptMessagesInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		messages string
+		err      string
+	}{
+		{
+			name:     "不支持的角色",
+			messages: `[{"role": "function", "content": "x"}]`,
+			err:      "unsupported role",
+		},
+		{
+			name:     "不支持的内容类型",
+			messages: `[{"role": "user", "content": [{"type": "video_url"}]}]`,
+			err:      "unsupported content type",
+		},
+		{
+			name:     "引用已上传的文件",
+			messages: `[{"role": "user", "content": [{"type": "file", "file": {"file_id": "file-1"}}]}]`,
+			err:      "only inline file_data",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := PromptMessages(decodeMessages(t, tt.messages))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestModelParameters(t *testing.T) {
+	var request openai_entities.ChatCompletionRequest
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"model": "openai/gpt-4o",
+		"temperature": 0.2,
+		"max_tokens": 100,
+		"max_completion_tokens": 200,
+		"stop": "END",
+		"response_format": {"type": "json_schema", "json_schema": {"name": "answer"}}
+	}`), &request))
+
+	parameters := ModelParameters(&request)
+	assert.Equal(t, 0.2, parameters["temperature"])
+	// max_completion_tokens 优先于 max_tokens
+	assert.Equal(t, 200, parameters["max_tokens"])
+	assert.Equal(t, "json_schema", parameters["response_format"])
+	assert.JSONEq(t, `{"name": "answer"}`, parameters["json_schema"].(string))
+	assert.NotContains(t, parameters, "top_p")
+	assert.Equal(t, openai_entities.StringOrArray{"END"}, request.Stop)
+}
+
+func llmChunk(content any, toolCalls []model_entities.PromptMessageToolCall, finishReason string) model_entities.LLMResultChunk {
+	index := 0
+	chunk := model_entities.LLMResultChunk{
+		Model: "gpt-4o",
+		Delta: model_entities.LLMResultChunkDelta{
+			Index: &index,
+			Message: model_entities.PromptMessage{
+				Role:      model_entities.PROMPT_MESSAGE_ROLE_ASSISTANT,
+				Content:   content,
+				ToolCalls: toolCalls,
+			},
+		},
+	}
+	if finishReason != "" {
+		chunk.Delta.FinishReason = &finishReason
+	}
+	return chunk
+}
+
+func toolCall(id string, name string, arguments string) model_entities.PromptMessageToolCall {
+	call := model_entities.PromptMessageToolCall{ID: id, Type: "function"}
+	call.Function.Name = name
+	call.Function.Arguments = arguments
+	return call
+}
+
+func TestChunkTranslator(t *testing.T) {
+	translator := NewChunkTranslator("chatcmpl-1", 1700000000, "openai/gpt-4o")
+
+	first := translator.Translate(llmChunk("Hel", nil, ""))
+	assert.Equal(t, openai_entities.OBJECT_CHAT_COMPLETION_CHUNK, first.Object)
+	assert.Equal(t, "openai/gpt-4o", first.Model)
+	// 角色只在第一个分片中出现
+	assert.Equal(t, openai_entities.ROLE_ASSISTANT, first.Choices[0].Delta.Role)
+	assert.Equal(t, "Hel", *first.Choices[0].Delta.Content)
+	assert.Nil(t, first.Choices[0].FinishReason)
+
+	// 内容列表中的文本被拼接
+	second := translator.Translate(llmChunk([]any{
+		map[string]any{"type": "text", "data": "lo"},
+		map[string]any{"type": "image", "url": "x"},
+	}, nil, ""))
+	assert.Empty(t, second.Choices[0].Delta.Role)
+	assert.Equal(t, "lo", *second.Choices[0].Delta.Content)
+
+	// 没有 id 的调用延续上一个调用的参数
+	calls := translator.Translate(llmChunk("", []model_entities.PromptMessageToolCall{
+		toolCall("call_1", "weather", `{"city":`),
+		toolCall("", "", `"paris"}`),
+		toolCall("call_2", "time", `{}`),
+	}, ""))
+	require.Len(t, calls.Choices[0].Delta.ToolCalls, 3)
+	assert.Nil(t, calls.Choices[0].Delta.Content)
+	assert.Equal(t, 0, *calls.Choices[0].Delta.ToolCalls[0].Index)
+	assert.Equal(t, 0, *calls.Choices[0].Delta.ToolCalls[1].Index)
+	assert.Empty(t, calls.Choices[0].Delta.ToolCalls[1].Type)
+	assert.Equal(t, 1, *calls.Choices[0].Delta.ToolCalls[2].Index)
+
+	// 插件没有给出结束原因时补充
+	last := translator.Finish()
+	require.NotNil(t, last)
+	assert.Equal(t, openai_entities.FINISH_REASON_TOOL_CALLS, *last.Choices[0].FinishReason)
+	assert.Nil(t, translator.Finish())
+
+	usage := translator.UsageChunk()
+	assert.Empty(t, usage.Choices)
+	assert.NotNil(t, usage.Choices)
+	assert.Equal(t, &openai_entities.Usage{}, usage.Usage)
+}
+
+func TestCompletion(t *testing.T) {
+	promptTokens, completionTokens := 10, 5
+	finished := llmChunk("!", nil, "stop")
+	finished.Delta.Usage = &model_entities.LLMUsage{
+		PromptTokens:     &promptTokens,
+		CompletionTokens: &completionTokens,
+	}
+
+	completion := NewCompletion(NewChunkTranslator("chatcmpl-1", 1700000000, "openai/gpt-4o"))
+	completion.Add(llmChunk("Hello", nil, ""))
+	completion.Add(llmChunk("", []model_entities.PromptMessageToolCall{toolCall("call_1", "weather", `{"city":`)}, ""))
+	completion.Add(llmChunk("", []model_entities.PromptMessageToolCall{toolCall("", "", `"paris"}`)}, ""))
+	completion.Add(finished)
+
+	result := completion.Result()
+	assert.Equal(t, openai_entities.OBJECT_CHAT_COMPLETION, result.Object)
+	require.Len(t, result.Choices, 1)
+	assert.Equal(t, "stop", result.Choices[0].FinishReason)
+	assert.Equal(t, "Hello!", *result.Choices[0].Message.Content)
+	require.Len(t, result.Choices[0].Message.ToolCalls, 1)
+	assert.Nil(t, result.Choices[0].Message.ToolCalls[0].Index)
+	assert.Equal(t, `{"city":"paris"}`, result.Choices[0].Message.ToolCalls[0].Function.Arguments)
+	// 总数缺失时由输入和输出相加
+	assert.Equal(t, &openai_entities.Usage{PromptTokens: 10, CompletionTokens: 5, TotalTokens: 15}, result.Usage)
+}
@@ -0,0 +1,216 @@
+package openai
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/model_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/openai_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+)
+
+const DEFAULT_EMBEDDING_INPUT_TYPE = "document"
+
+// Embeddings invokes the text embedding model of a model plugin
+func (s *Server) Embeddings(ctx *gin.Context, caller Caller) {
+	var request openai_entities.EmbeddingRequest
+	if !bindRequest(ctx, &request) {
+		return
+	}
+	if request.Model == "" || len(request.Input) == 0 {
+		abortWithInvalidRequest(ctx, "model and input are required")
+		return
+	}
+	switch request.EncodingFormat {
+	case "", openai_entities.ENCODING_FORMAT_FLOAT, openai_entities.ENCODING_FORMAT_BASE64:
+	default:
+		abortWithInvalidRequest(ctx, fmt.Sprintf("unsupported encoding_format %s", request.EncodingFormat))
+		return
+	}
+
+	model, ok := s.resolveModel(ctx, caller, request.Model, plugin_entities.MODEL_TYPE_TEXT_EMBEDDING)
+	if !ok {
+		return
+	}
+
+	inputType := request.InputType
+	if inputType == "" {
+		inputType = DEFAULT_EMBEDDING_INPUT_TYPE
+	}
+	if caller.UserID == "" {
+		caller.UserID = request.User
+	}
+	stream, err := s.backend.InvokeTextEmbedding(caller, model.Provider, &requests.RequestInvokeTextEmbedding{
+		BaseRequestInvokeModel: requests.BaseRequestInvokeModel{
+			Provider: model.Provider.Declaration.Provider,
+			Model:    model.Name,
+		},
+		Credentials: requests.Credentials{
+			Credentials:    request.Credentials,
+			CredentialType: request.CredentialType,
+		},
+		InvokeTextEmbeddingSchema: requests.InvokeTextEmbeddingSchema{
+			Texts:     request.Input,
+			InputType: inputType,
+		},
+		// the model type of embeddings is spelled with a hyphen by the plugins
+		ModelType: model_entities.ModelType(plugin_entities.MODEL_TYPE_TEXT_EMBEDDING),
+	})
+	if err != nil {
+		abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+		return
+	}
+
+	results, err := collect(ctx, stream, s.maxTimeout)
+	if err != nil {
+		abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+		return
+	}
+
+	response := openai_entities.EmbeddingResponse{
+		Object: openai_entities.OBJECT_LIST,
+		Data:   []openai_entities.Embedding{},
+		Model:  model.ID(),
+	}
+	for _, result := range results {
+		for _, embedding := range result.Embeddings {
+			if request.Dimensions != nil && *request.Dimensions != len(embedding) {
+				// the plugins can't shorten the embeddings, a vector store expecting the
+				// requested size would reject them anyway
+				abortWithInvalidRequest(ctx, fmt.Sprintf("model %s does not support %d dimensions", request.Model, *request.Dimensions))
+				return
+			}
+
+			var value any = embedding
+			if request.EncodingFormat == openai_entities.ENCODING_FORMAT_BASE64 {
+				value = EncodeEmbedding(embedding)
+			}
+			response.Data = append(response.Data, openai_entities.Embedding{
+				Object:    openai_entities.OBJECT_EMBEDDING,
+				Embedding: value,
+				Index:     len(response.Data),
+			})
+		}
+		if result.Usage.Tokens != nil {
+			response.Usage.PromptTokens += *result.Usage.Tokens
+		}
+		if result.Usage.TotalTokens != nil {
+			response.Usage.TotalTokens += *result.Usage.TotalTokens
+		}
+	}
+	if len(response.Data) != len(request.Input) {
+		abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, fmt.Sprintf(
+			"model returned %d embeddings for %d inputs", len(response.Data), len(request.Input),
+		), nil)
+		return
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// EncodeEmbedding encodes the embedding as the base64 string of its little-endian
+// float32 values, it's what openai clients expect from the base64 encoding format
+func EncodeEmbedding(embedding []float64) string {
+	data := make([]byte, 4*len(embedding))
+	for i, v := range embedding {
+		binary.LittleEndian.PutUint32(data[4*i:], math.Float32bits(float32(v)))
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+// Rerank invokes the rerank model of a model plugin, the request and the response are
+// shaped as the rerank apis of cohere and jina
+func (s *Server) Rerank(ctx *gin.Context, caller Caller) {
+	var request openai_entities.RerankRequest
+	if !bindRequest(ctx, &request) {
+		return
+	}
+	if request.Model == "" || request.Query == "" || len(request.Documents) == 0 {
+		abortWithInvalidRequest(ctx, "model, query and documents are required")
+		return
+	}
+
+	model, ok := s.resolveModel(ctx, caller, request.Model, plugin_entities.MODEL_TYPE_RERANK)
+	if !ok {
+		return
+	}
+
+	docs := make([]string, 0, len(request.Documents))
+	for _, document := range request.Documents {
+		docs = append(docs, document.Text)
+	}
+	topN := len(docs)
+	if request.TopN != nil && *request.TopN > 0 && *request.TopN < topN {
+		topN = *request.TopN
+	}
+	var scoreThreshold float64
+	if request.ScoreThreshold != nil {
+		scoreThreshold = *request.ScoreThreshold
+	}
+	if caller.UserID == "" {
+		caller.UserID = request.User
+	}
+
+	stream, err := s.backend.InvokeRerank(caller, model.Provider, &requests.RequestInvokeRerank{
+		BaseRequestInvokeModel: requests.BaseRequestInvokeModel{
+			Provider: model.Provider.Declaration.Provider,
+			Model:    model.Name,
+		},
+		Credentials: requests.Credentials{
+			Credentials:    request.Credentials,
+			CredentialType: request.CredentialType,
+		},
+		InvokeRerankSchema: requests.InvokeRerankSchema{
+			Query:          request.Query,
+			Docs:           docs,
+			ScoreThreshold: scoreThreshold,
+			TopN:           topN,
+		},
+		ModelType: model_entities.MODEL_TYPE_RERANK,
+	})
+	if err != nil {
+		abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+		return
+	}
+
+	results, err := collect(ctx, stream, s.maxTimeout)
+	if err != nil {
+		abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+		return
+	}
+
+	returnDocuments := request.ReturnDocuments == nil || *request.ReturnDocuments
+	response := openai_entities.RerankResponse{
+		ID:      uuid.New().String(),
+		Model:   model.ID(),
+		Results: []openai_entities.RerankResult{},
+	}
+	for _, result := range results {
+		for _, doc := range result.Docs {
+			if doc.Index == nil || *doc.Index < 0 || *doc.Index >= len(docs) {
+				continue
+			}
+			item := openai_entities.RerankResult{Index: *doc.Index}
+			if doc.Score != nil {
+				item.RelevanceScore = *doc.Score
+			}
+			if returnDocuments {
+				item.Document = &openai_entities.RerankInput{Text: docs[*doc.Index]}
+			}
+			response.Results = append(response.Results, item)
+		}
+	}
+	sort.SliceStable(response.Results, func(i, j int) bool {
+		return response.Results[i].RelevanceScore > response.Results[j].RelevanceScore
+	})
+	if len(response.Results) > topN {
+		response.Results = response.Results[:topN]
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,150 @@
+package openai
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/model_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/openai_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func embeddingResult(tokens int, embeddings ...[]float64) model_entities.TextEmbeddingResult {
+	return model_entities.TextEmbeddingResult{
+		Model:      "text-embedding-3-small",
+		Embeddings: embeddings,
+		Usage:      model_entities.EmbeddingUsage{Tokens: &tokens, TotalTokens: &tokens},
+	}
+}
+
+func TestEncodeEmbedding(t *testing.T) {
+	data, err := base64.StdEncoding.DecodeString(EncodeEmbedding([]float64{0.5, -1, 2}))
+	require.NoError(t, err)
+	require.Len(t, data, 12)
+
+	values := []float32{}
+	for i := 0; i < len(data); i += 4 {
+		values = append(values, math.Float32frombits(binary.LittleEndian.Uint32(data[i:])))
+	}
+	assert.Equal(t, []float32{0.5, -1, 2}, values)
+}
+
+func TestServerEmbeddings(t *testing.T) {
+	backend := newBackend()
+	backend.embeddings = []model_entities.TextEmbeddingResult{embeddingResult(5, []float64{0.1, 0.2}, []float64{0.3, 0.4})}
+	daemon := newDaemon(t, NewServer(backend, time.Minute))
+	url := daemon.URL + "/plugin/tenant/v1/embeddings"
+
+	resp := postJSON(t, url, `{"model": "openai/text-embedding-3-small", "input": ["hello", "world"], "user": "user-1"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	response := decodeBody[openai_entities.EmbeddingResponse](t, resp)
+	assert.Equal(t, openai_entities.OBJECT_LIST, response.Object)
+	assert.Equal(t, "openai/text-embedding-3-small", response.Model)
+	require.Len(t, response.Data, 2)
+	assert.Equal(t, []any{0.3, 0.4}, response.Data[1].Embedding)
+	assert.Equal(t, 1, response.Data[1].Index)
+	assert.Equal(t, openai_entities.Usage{PromptTokens: 5, TotalTokens: 5}, response.Usage)
+
+	require.Len(t, backend.invoked, 1)
+	request := backend.invoked[0].(*requests.RequestInvokeTextEmbedding)
+	assert.Equal(t, []string{"hello", "world"}, request.Texts)
+	assert.Equal(t, DEFAULT_EMBEDDING_INPUT_TYPE, request.InputType)
+	assert.Equal(t, model_entities.ModelType(plugin_entities.MODEL_TYPE_TEXT_EMBEDDING), request.ModelType)
+	assert.Equal(t, "user-1", backend.caller.UserID)
+
+	// base64 编码时返回 float32 的字节
+	resp = postJSON(t, url, `{"model": "openai/text-embedding-3-small", "input": ["hello", "world"], "encoding_format": "base64", "input_type": "query"}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	response = decodeBody[openai_entities.EmbeddingResponse](t, resp)
+	assert.Equal(t, EncodeEmbedding([]float64{0.1, 0.2}), response.Data[0].Embedding)
+	assert.Equal(t, "query", backend.invoked[1].(*requests.RequestInvokeTextEmbedding).InputType)
+}
+
+func TestServerEmbeddingsErrors(t *testing.T) {
+	backend := newBackend()
+	backend.embeddings = []model_entities.TextEmbeddingResult{embeddingResult(5, []float64{0.1, 0.2})}
+	daemon := newDaemon(t, NewServer(backend, time.Minute))
+	url := daemon.URL + "/plugin/tenant/v1/embeddings"
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+	}{
+		{name: "缺少输入", body: `{"model": "openai/text-embedding-3-small"}`, status: http.StatusBadRequest},
+		{name: "不支持的编码", body: `{"model": "openai/text-embedding-3-small", "input": "hi", "encoding_format": "int8"}`, status: http.StatusBadRequest},
+		{name: "维度不符", body: `{"model": "openai/text-embedding-3-small", "input": "hi", "dimensions": 256}`, status: http.StatusBadRequest},
+		{name: "模型类型不符", body: `{"model": "openai/gpt-4o", "input": "hi"}`, status: http.StatusNotFound},
+		{name: "结果数量不符", body: `{"model": "openai/text-embedding-3-small", "input": ["a", "b"]}`, status: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := postJSON(t, url, tt.body)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			assert.NotEmpty(t, decodeBody[openai_entities.ErrorResponse](t, resp).Error.Message)
+		})
+	}
+
+	backend.streamErr = errors.New("rate limited")
+	resp := postJSON(t, url, `{"model": "openai/text-embedding-3-small", "input": "hi"}`)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "rate limited", decodeBody[openai_entities.ErrorResponse](t, resp).Error.Message)
+}
+
+func TestServerRerank(t *testing.T) {
+	index := func(i int) *int { return &i }
+	score := func(f float64) *float64 { return &f }
+
+	backend := newBackend()
+	backend.reranks = []model_entities.RerankResult{{
+		Model: "bge-reranker",
+		Docs: []model_entities.RerankDocument{
+			{Index: index(0), Score: score(0.2)},
+			{Index: index(2), Score: score(0.9)},
+			{Index: index(1), Score: score(0.5)},
+		},
+	}}
+	daemon := newDaemon(t, NewServer(backend, time.Minute))
+	url := daemon.URL + "/plugin/tenant/v1/rerank"
+
+	// 文档可以是字符串或对象，结果按分数降序并截取 top_n
+	resp := postJSON(t, url, `{
+		"model": "localai/bge-reranker",
+		"query": "apple",
+		"documents": ["banana", {"text": "pear"}, "apple"],
+		"top_n": 2
+	}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	response := decodeBody[openai_entities.RerankResponse](t, resp)
+	assert.NotEmpty(t, response.ID)
+	assert.Equal(t, "localai/bge-reranker", response.Model)
+	assert.Equal(t, []openai_entities.RerankResult{
+		{Index: 2, RelevanceScore: 0.9, Document: &openai_entities.RerankInput{Text: "apple"}},
+		{Index: 1, RelevanceScore: 0.5, Document: &openai_entities.RerankInput{Text: "pear"}},
+	}, response.Results)
+
+	request := backend.invoked[0].(*requests.RequestInvokeRerank)
+	assert.Equal(t, []string{"banana", "pear", "apple"}, request.Docs)
+	assert.Equal(t, 2, request.TopN)
+	assert.Equal(t, model_entities.MODEL_TYPE_RERANK, request.ModelType)
+
+	// 不返回文档时默认保留全部结果
+	resp = postJSON(t, url, `{"model": "localai/bge-reranker", "query": "apple", "documents": ["banana", "pear", "apple"], "return_documents": false}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	response = decodeBody[openai_entities.RerankResponse](t, resp)
+	require.Len(t, response.Results, 3)
+	assert.Nil(t, response.Results[0].Document)
+	assert.Equal(t, 3, backend.invoked[1].(*requests.RequestInvokeRerank).TopN)
+
+	resp = postJSON(t, url, `{"model": "localai/bge-reranker", "documents": ["banana"]}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,73 @@
+package openai
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/model_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/openai_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+)
+
+// Moderations invokes the moderation model of a model plugin for each input, the
+// plugins only tell whether a text is flagged so the categories are left empty
+func (s *Server) Moderations(ctx *gin.Context, caller Caller) {
+	var request openai_entities.ModerationRequest
+	if !bindRequest(ctx, &request) {
+		return
+	}
+	if request.Model == "" || len(request.Input) == 0 {
+		abortWithInvalidRequest(ctx, "model and input are required")
+		return
+	}
+
+	model, ok := s.resolveModel(ctx, caller, request.Model, plugin_entities.MODEL_TYPE_MODERATION)
+	if !ok {
+		return
+	}
+	if caller.UserID == "" {
+		caller.UserID = request.User
+	}
+
+	response := openai_entities.ModerationResponse{
+		ID:      "modr-" + uuid.New().String(),
+		Model:   model.ID(),
+		Results: make([]openai_entities.ModerationResult, 0, len(request.Input)),
+	}
+	for _, input := range request.Input {
+		stream, err := s.backend.InvokeModeration(caller, model.Provider, &requests.RequestInvokeModeration{
+			BaseRequestInvokeModel: requests.BaseRequestInvokeModel{
+				Provider: model.Provider.Declaration.Provider,
+				Model:    model.Name,
+			},
+			Credentials: requests.Credentials{
+				Credentials:    request.Credentials,
+				CredentialType: request.CredentialType,
+			},
+			InvokeModerationSchema: requests.InvokeModerationSchema{Text: input},
+			ModelType:              model_entities.MODEL_TYPE_MODERATION,
+		})
+		if err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+			return
+		}
+
+		results, err := collect(ctx, stream, s.maxTimeout)
+		if err != nil {
+			abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+			return
+		}
+		flagged := false
+		for _, result := range results {
+			flagged = flagged || result.Result
+		}
+		response.Results = append(response.Results, openai_entities.ModerationResult{
+			Flagged:        flagged,
+			Categories:     map[string]bool{},
+			CategoryScores: map[string]float64{},
+		})
+	}
+	ctx.JSON(http.StatusOK, response)
+}
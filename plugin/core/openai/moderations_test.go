@@ -0,0 +1,41 @@
+package openai
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/model_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/openai_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerModerations(t *testing.T) {
+	backend := newBackend()
+	backend.moderations = []model_entities.ModerationResult{{Result: false}, {Result: true}}
+	daemon := newDaemon(t, NewServer(backend, time.Minute))
+	url := daemon.URL + "/plugin/tenant/v1/moderations"
+
+	// 每个输入调用一次模型
+	resp := postJSON(t, url, `{"model": "localai/omni-moderation", "input": ["hello", "go away"]}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	response := decodeBody[openai_entities.ModerationResponse](t, resp)
+	assert.True(t, strings.HasPrefix(response.ID, "modr-"))
+	assert.Equal(t, "localai/omni-moderation", response.Model)
+	require.Len(t, response.Results, 2)
+	assert.False(t, response.Results[0].Flagged)
+	assert.True(t, response.Results[1].Flagged)
+	assert.NotNil(t, response.Results[1].Categories)
+
+	require.Len(t, backend.invoked, 2)
+	assert.Equal(t, "go away", backend.invoked[1].(*requests.RequestInvokeModeration).Text)
+	assert.Equal(t, model_entities.MODEL_TYPE_MODERATION, backend.invoked[1].(*requests.RequestInvokeModeration).ModelType)
+
+	resp = postJSON(t, url, `{"model": "localai/omni-moderation"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp = postJSON(t, url, `{"model": "ollama/llama-guard", "input": "hello"}`)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,359 @@
+package openai
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/model_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/openai_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+	"github.com/jjgagacy/workflow-app/plugin/types"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+// Caller is whom the models are listed and invoked for
+type Caller struct {
+	TenantID string
+	UserID   string
+}
+
+// InstalledProvider is a model provider installed by the tenant
+type InstalledProvider struct {
+	PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier
+	Declaration            plugin_entities.ModelProviderDeclaration
+}
+
+// Model is a model of an installed provider, named as the openai clients see it
+type Model struct {
+	Provider *InstalledProvider
+	Name     string
+}
+
+// ID is the name of the model exposed to openai clients, models of different
+// providers may share a name so the provider is part of it
+func (m *Model) ID() string {
+	return m.Provider.Declaration.Provider + "/" + m.Name
+}
+
+// ModelBackend lists and invokes the models installed by a tenant
+type ModelBackend interface {
+	ListProviders(caller Caller) ([]InstalledProvider, error)
+	// InvokeLLM starts the invocation, the stream is closed once the plugin is done
+	InvokeLLM(caller Caller, provider *InstalledProvider, request *requests.RequestInvokeLLM) (*utils.Stream[model_entities.LLMResultChunk], error)
+	InvokeTextEmbedding(caller Caller, provider *InstalledProvider, request *requests.RequestInvokeTextEmbedding) (*utils.Stream[model_entities.TextEmbeddingResult], error)
+	InvokeRerank(caller Caller, provider *InstalledProvider, request *requests.RequestInvokeRerank) (*utils.Stream[model_entities.RerankResult], error)
+	InvokeTTS(caller Caller, provider *InstalledProvider, request *requests.RequestInvokeTTS) (*utils.Stream[model_entities.TTSResult], error)
+	InvokeSpeech2Text(caller Caller, provider *InstalledProvider, request *requests.RequestInvokeSpeech2Text) (*utils.Stream[model_entities.Speech2TextResult], error)
+	InvokeModeration(caller Caller, provider *InstalledProvider, request *requests.RequestInvokeModeration) (*utils.Stream[model_entities.ModerationResult], error)
+}
+
+// Server serves the openai api over the model plugins installed by a tenant
+type Server struct {
+	backend    ModelBackend
+	maxTimeout time.Duration
+}
+
+func NewServer(backend ModelBackend, maxTimeout time.Duration) *Server {
+	return &Server{backend: backend, maxTimeout: maxTimeout}
+}
+
+// ResolveModel finds the model of a name, models which are not declared are accepted
+// if the provider lets them be configured by the tenant
+func (s *Server) ResolveModel(caller Caller, name string, modelType plugin_entities.ModelType) (*Model, error) {
+	providerName, modelName, ok := strings.Cut(name, "/")
+	if !ok || providerName == "" || modelName == "" {
+		return nil, fmt.Errorf("model %s must be named as <provider>/<model>", name)
+	}
+
+	providers, err := s.backend.ListProviders(caller)
+	if err != nil {
+		return nil, err
+	}
+	for _, provider := range providers {
+		if provider.Declaration.Provider != providerName {
+			continue
+		}
+		if !slices.Contains(provider.Declaration.SupportedModelTypes, modelType) {
+			break
+		}
+		for _, model := range provider.Declaration.Models {
+			if model.Model == modelName && model.ModelType == modelType {
+				return &Model{Provider: &provider, Name: modelName}, nil
+			}
+		}
+		if provider.Declaration.ModelCredentialSchema != nil {
+			return &Model{Provider: &provider, Name: modelName}, nil
+		}
+		break
+	}
+	return nil, types.ErrPluginNotFound
+}
+
+// Models lists the declared models of the providers installed by the tenant
+func (s *Server) Models(ctx *gin.Context, caller Caller) {
+	providers, err := s.backend.ListProviders(caller)
+	if err != nil {
+		abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+		return
+	}
+
+	models := []openai_entities.Model{}
+	seen := map[string]bool{}
+	for _, provider := range providers {
+		for _, declaration := range provider.Declaration.Models {
+			if declaration.Deprecated {
+				continue
+			}
+			model := Model{Provider: &provider, Name: declaration.Model}
+			if seen[model.ID()] {
+				continue
+			}
+			seen[model.ID()] = true
+			models = append(models, openai_entities.Model{
+				ID:      model.ID(),
+				Object:  openai_entities.OBJECT_MODEL,
+				OwnedBy: provider.PluginUniqueIdentifier.Author(),
+			})
+		}
+	}
+	ctx.JSON(http.StatusOK, openai_entities.ModelList{Object: openai_entities.OBJECT_LIST, Data: models})
+}
+
+// ChatCompletions invokes the llm of a model plugin, the chunks are sent as deltas if
+// the client asks for a stream and merged into a single completion otherwise
+func (s *Server) ChatCompletions(ctx *gin.Context, caller Caller) {
+	var request openai_entities.ChatCompletionRequest
+	if !bindRequest(ctx, &request) {
+		return
+	}
+	if request.Model == "" || len(request.Messages) == 0 {
+		abortWithInvalidRequest(ctx, "model and messages are required")
+		return
+	}
+	if request.N != nil && *request.N != 1 {
+		abortWithInvalidRequest(ctx, "only n=1 is supported")
+		return
+	}
+
+	promptMessages, err := PromptMessages(request.Messages)
+	if err != nil {
+		abortWithInvalidRequest(ctx, err.Error())
+		return
+	}
+	tools, err := PromptTools(request.Tools)
+	if err != nil {
+		abortWithInvalidRequest(ctx, err.Error())
+		return
+	}
+	// the model plugins always choose the tools on their own, none is the only choice
+	// which can be honored
+	if choice, ok := request.ToolChoice.(string); ok && choice == "none" {
+		tools = nil
+	}
+
+	model, ok := s.resolveModel(ctx, caller, request.Model, plugin_entities.MODEL_TYPE_LLM)
+	if !ok {
+		return
+	}
+
+	invokeRequest := &requests.RequestInvokeLLM{
+		BaseRequestInvokeModel: requests.BaseRequestInvokeModel{
+			Provider: model.Provider.Declaration.Provider,
+			Model:    model.Name,
+		},
+		Credentials: requests.Credentials{
+			Credentials:    request.Credentials,
+			CredentialType: request.CredentialType,
+		},
+		InvokeLLMSchema: requests.InvokeLLMSchema{
+			ModelParameters: ModelParameters(&request),
+			PromptMessages:  promptMessages,
+			Tools:           tools,
+			Stop:            request.Stop,
+			Stream:          request.Stream,
+		},
+		ModelType: model_entities.MODEL_TYPE_LLM,
+	}
+	if caller.UserID == "" {
+		caller.UserID = request.User
+	}
+
+	stream, err := s.backend.InvokeLLM(caller, model.Provider, invokeRequest)
+	if err != nil {
+		abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+		return
+	}
+
+	translator := NewChunkTranslator("chatcmpl-"+uuid.New().String(), time.Now().Unix(), model.ID())
+	if request.Stream {
+		includeUsage := request.StreamOptions != nil && request.StreamOptions.IncludeUsage
+		s.streamChatCompletion(ctx, stream, translator, includeUsage)
+		return
+	}
+
+	completion := NewCompletion(translator)
+	if err := consume(ctx, stream, s.maxTimeout, completion.Add); err != nil {
+		abortWithError(ctx, http.StatusInternalServerError, openai_entities.ERROR_TYPE_API, err.Error(), nil)
+		return
+	}
+	ctx.JSON(http.StatusOK, completion.Result())
+}
+
+func (s *Server) streamChatCompletion(
+	ctx *gin.Context,
+	stream *utils.Stream[model_entities.LLMResultChunk],
+	translator *ChunkTranslator,
+	includeUsage bool,
+) {
+	writer := newEventWriter(ctx)
+	err := consume(ctx, stream, s.maxTimeout, func(chunk model_entities.LLMResultChunk) {
+		writer.write(translator.Translate(chunk))
+	})
+	if err != nil {
+		// the status is sent already, the error is told in the stream
+		writer.write(openai_entities.ErrorResponse{Error: openai_entities.Error{
+			Message: err.Error(),
+			Type:    openai_entities.ERROR_TYPE_API,
+		}})
+		return
+	}
+
+	if last := translator.Finish(); last != nil {
+		writer.write(*last)
+	}
+	if includeUsage {
+		writer.write(translator.UsageChunk())
+	}
+	writer.done()
+}
+
+// consume reads the stream until it's closed, the stream is closed early if the
+// client goes away or the invocation takes too long
+func consume[T any](
+	ctx *gin.Context,
+	stream *utils.Stream[T],
+	maxTimeout time.Duration,
+	fn func(T),
+) error {
+	timedOut := new(int32)
+	timer := time.AfterFunc(maxTimeout, func() {
+		atomic.StoreInt32(timedOut, 1)
+		stream.Close()
+	})
+	defer timer.Stop()
+
+	finished := make(chan struct{})
+	defer close(finished)
+	go func() {
+		select {
+		case <-ctx.Request.Context().Done():
+			stream.Close()
+		case <-finished:
+		}
+	}()
+
+	for stream.Next() {
+		chunk, err := stream.Read()
+		if err != nil {
+			stream.Close()
+			return err
+		}
+		fn(chunk)
+	}
+	if atomic.LoadInt32(timedOut) == 1 {
+		return errors.New("killed by timeout")
+	}
+	return nil
+}
+
+// collect reads every chunk of the stream, most models answer with a single one
+func collect[T any](ctx *gin.Context, stream *utils.Stream[T], maxTimeout time.Duration) ([]T, error) {
+	chunks := []T{}
+	err := consume(ctx, stream, maxTimeout, func(chunk T) {
+		chunks = append(chunks, chunk)
+	})
+	return chunks, err
+}
+
+// resolveModel resolves the model of a request, the error is written to the client
+// if it fails
+func (s *Server) resolveModel(
+	ctx *gin.Context,
+	caller Caller,
+	name string,
+	modelType plugin_entities.ModelType,
+) (*Model, bool) {
+	model, err := s.ResolveModel(caller, name, modelType)
+	if errors.Is(err, types.ErrPluginNotFound) {
+		code := openai_entities.ERROR_CODE_MODEL_NOT_FOUND
+		abortWithError(ctx, http.StatusNotFound, openai_entities.ERROR_TYPE_NOT_FOUND, fmt.Sprintf("model %s does not exist", name), &code)
+		return nil, false
+	}
+	if err != nil {
+		abortWithInvalidRequest(ctx, err.Error())
+		return nil, false
+	}
+	return model, true
+}
+
+// bindRequest decodes the json body, the error is written to the client if it fails
+func bindRequest(ctx *gin.Context, request any) bool {
+	if err := ctx.ShouldBindJSON(request); err != nil {
+		abortWithInvalidRequest(ctx, err.Error())
+		return false
+	}
+	return true
+}
+
+func abortWithInvalidRequest(ctx *gin.Context, message string) {
+	abortWithError(ctx, http.StatusBadRequest, openai_entities.ERROR_TYPE_INVALID_REQUEST, message, nil)
+}
+
+func abortWithError(ctx *gin.Context, status int, errorType string, message string, code *string) {
+	ctx.AbortWithStatusJSON(status, openai_entities.ErrorResponse{Error: openai_entities.Error{
+		Message: message,
+		Type:    errorType,
+		Code:    code,
+	}})
+}
+
+// eventWriter writes the server-sent events of a stream in the format of the openai
+// api, it's terminated by a [DONE] event
+type eventWriter struct {
+	writer gin.ResponseWriter
+}
+
+func newEventWriter(ctx *gin.Context) *eventWriter {
+	writer := ctx.Writer
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("Connection", "keep-alive")
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+	writer.Flush()
+	return &eventWriter{writer: writer}
+}
+
+func (w *eventWriter) write(data any) {
+	w.send(utils.MarshalJsonBytes(data))
+}
+
+func (w *eventWriter) done() {
+	w.send([]byte("[DONE]"))
+}
+
+func (w *eventWriter) send(data []byte) {
+	if _, err := w.writer.Write(append(append([]byte("data: "), data...), '\n', '\n')); err != nil {
+		utils.Debug("write openai event error: %v", err)
+		return
+	}
+	w.writer.Flush()
+}
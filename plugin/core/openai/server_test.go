@@ -0,0 +1,439 @@
+package openai
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/model_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/openai_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+	"github.com/jjgagacy/workflow-app/plugin/types"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBackend 按租户返回预设的模型供应商，调用时依次输出预设的分片
+type fakeBackend struct {
+	providers   map[string][]InstalledProvider
+	chunks      []model_entities.LLMResultChunk
+	embeddings  []model_entities.TextEmbeddingResult
+	reranks     []model_entities.RerankResult
+	speeches    []model_entities.TTSResult
+	transcripts []model_entities.Speech2TextResult
+	moderations []model_entities.ModerationResult
+	streamErr   error
+
+	caller   Caller
+	provider *InstalledProvider
+	request  *requests.RequestInvokeLLM
+	// invoked 依次记录非 LLM 调用的请求
+	invoked []any
+}
+
+func (f *fakeBackend) ListProviders(caller Caller) ([]InstalledProvider, error) {
+	return f.providers[caller.TenantID], nil
+}
+
+func (f *fakeBackend) InvokeLLM(
+	caller Caller,
+	provider *InstalledProvider,
+	request *requests.RequestInvokeLLM,
+) (*utils.Stream[model_entities.LLMResultChunk], error) {
+	f.caller = caller
+	f.provider = provider
+	f.request = request
+	return fakeStream(f.chunks, f.streamErr), nil
+}
+
+func (f *fakeBackend) InvokeTextEmbedding(
+	caller Caller,
+	provider *InstalledProvider,
+	request *requests.RequestInvokeTextEmbedding,
+) (*utils.Stream[model_entities.TextEmbeddingResult], error) {
+	f.caller, f.provider, f.invoked = caller, provider, append(f.invoked, request)
+	return fakeStream(f.embeddings, f.streamErr), nil
+}
+
+func (f *fakeBackend) InvokeRerank(
+	caller Caller,
+	provider *InstalledProvider,
+	request *requests.RequestInvokeRerank,
+) (*utils.Stream[model_entities.RerankResult], error) {
+	f.caller, f.provider, f.invoked = caller, provider, append(f.invoked, request)
+	return fakeStream(f.reranks, f.streamErr), nil
+}
+
+func (f *fakeBackend) InvokeTTS(
+	caller Caller,
+	provider *InstalledProvider,
+	request *requests.RequestInvokeTTS,
+) (*utils.Stream[model_entities.TTSResult], error) {
+	f.caller, f.provider, f.invoked = caller, provider, append(f.invoked, request)
+	return fakeStream(f.speeches, f.streamErr), nil
+}
+
+func (f *fakeBackend) InvokeSpeech2Text(
+	caller Caller,
+	provider *InstalledProvider,
+	request *requests.RequestInvokeSpeech2Text,
+) (*utils.Stream[model_entities.Speech2TextResult], error) {
+	f.caller, f.provider, f.invoked = caller, provider, append(f.invoked, request)
+	return fakeStream(f.transcripts, f.streamErr), nil
+}
+
+func (f *fakeBackend) InvokeModeration(
+	caller Caller,
+	provider *InstalledProvider,
+	request *requests.RequestInvokeModeration,
+) (*utils.Stream[model_entities.ModerationResult], error) {
+	f.caller, f.provider, f.invoked = caller, provider, append(f.invoked, request)
+	// 每次调用取出一个结果
+	var results []model_entities.ModerationResult
+	if len(f.moderations) > 0 {
+		results, f.moderations = f.moderations[:1], f.moderations[1:]
+	}
+	return fakeStream(results, f.streamErr), nil
+}
+
+// fakeStream 返回已写入全部分片并关闭的流
+func fakeStream[T any](items []T, err error) *utils.Stream[T] {
+	stream := utils.NewStream[T](len(items) + 1)
+	for _, item := range items {
+		stream.Write(item)
+	}
+	if err != nil {
+		stream.WriteError(err)
+	}
+	stream.Close()
+	return stream
+}
+
+func openAIProvider() InstalledProvider {
+	return InstalledProvider{
+		PluginUniqueIdentifier: "langgenius/openai:0.0.1@abc",
+		Declaration: plugin_entities.ModelProviderDeclaration{
+			Provider:            "openai",
+			SupportedModelTypes: []plugin_entities.ModelType{plugin_entities.MODEL_TYPE_LLM, plugin_entities.MODEL_TYPE_TEXT_EMBEDDING},
+			Models: []plugin_entities.ModelDeclaration{
+				{Model: "gpt-4o", ModelType: plugin_entities.MODEL_TYPE_LLM},
+				{Model: "gpt-3.5", ModelType: plugin_entities.MODEL_TYPE_LLM, Deprecated: true},
+				{Model: "text-embedding-3-small", ModelType: plugin_entities.MODEL_TYPE_TEXT_EMBEDDING},
+			},
+		},
+	}
+}
+
+func ollamaProvider() InstalledProvider {
+	return InstalledProvider{
+		PluginUniqueIdentifier: "langgenius/ollama:0.0.1@def",
+		Declaration: plugin_entities.ModelProviderDeclaration{
+			Provider:              "ollama",
+			SupportedModelTypes:   []plugin_entities.ModelType{plugin_entities.MODEL_TYPE_LLM},
+			ModelCredentialSchema: &plugin_entities.ModelCredentialSchema{},
+		},
+	}
+}
+
+// localAIProvider 支持除 LLM 外的各类模型，模型均由租户配置
+func localAIProvider() InstalledProvider {
+	return InstalledProvider{
+		PluginUniqueIdentifier: "langgenius/localai:0.0.1@ghi",
+		Declaration: plugin_entities.ModelProviderDeclaration{
+			Provider: "localai",
+			SupportedModelTypes: []plugin_entities.ModelType{
+				plugin_entities.MODEL_TYPE_RERANK,
+				plugin_entities.MODEL_TYPE_TTS,
+				plugin_entities.MODEL_TYPE_SPEECH2TEXT,
+				plugin_entities.MODEL_TYPE_MODERATION,
+			},
+			ModelCredentialSchema: &plugin_entities.ModelCredentialSchema{},
+		},
+	}
+}
+
+func newBackend() *fakeBackend {
+	return &fakeBackend{
+		providers: map[string][]InstalledProvider{
+			"tenant": {openAIProvider(), ollamaProvider(), localAIProvider()},
+		},
+	}
+}
+
+// newDaemon 启动一个只包含 openai 路由的服务
+func newDaemon(t *testing.T, server *Server) *httptest.Server {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.GET("/plugin/:tenant_id/v1/models", func(ctx *gin.Context) {
+		server.Models(ctx, Caller{TenantID: ctx.Param("tenant_id")})
+	})
+	routes := map[string]func(*gin.Context, Caller){
+		"/chat/completions":     server.ChatCompletions,
+		"/embeddings":           server.Embeddings,
+		"/rerank":               server.Rerank,
+		"/audio/speech":         server.Speech,
+		"/audio/transcriptions": server.Transcriptions,
+		"/moderations":          server.Moderations,
+	}
+	for path, handler := range routes {
+		engine.POST("/plugin/:tenant_id/v1"+path, func(ctx *gin.Context) {
+			handler(ctx, Caller{TenantID: ctx.Param("tenant_id")})
+		})
+	}
+	daemon := httptest.NewServer(engine)
+	t.Cleanup(daemon.Close)
+	return daemon
+}
+
+func postJSON(t *testing.T, url string, body string) *http.Response {
+	resp, err := http.Post(url, "application/json", strings.NewReader(body))
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func decodeBody[T any](t *testing.T, resp *http.Response) T {
+	var v T
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&v))
+	return v
+}
+
+// readEvents 读取流中全部事件的数据
+func readEvents(t *testing.T, resp *http.Response) []string {
+	events := []string{}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			events = append(events, data)
+		}
+	}
+	require.NoError(t, scanner.Err())
+	return events
+}
+
+func TestServerResolveModel(t *testing.T) {
+	server := NewServer(newBackend(), time.Minute)
+	caller := Caller{TenantID: "tenant"}
+
+	tests := []struct {
+		name      string
+		model     string
+		modelType plugin_entities.ModelType
+		err       error
+		provider  string
+	}{
+		{name: "已声明的模型", model: "openai/gpt-4o", modelType: plugin_entities.MODEL_TYPE_LLM, provider: "openai"},
+		{name: "类型不匹配", model: "openai/text-embedding-3-small", modelType: plugin_entities.MODEL_TYPE_LLM, err: types.ErrPluginNotFound},
+		{name: "未声明的模型", model: "openai/gpt-5", modelType: plugin_entities.MODEL_TYPE_LLM, err: types.ErrPluginNotFound},
+		{name: "可自定义模型的供应商", model: "ollama/llama3:8b", modelType: plugin_entities.MODEL_TYPE_LLM, provider: "ollama"},
+		{name: "供应商不支持该类型", model: "ollama/nomic-embed", modelType: plugin_entities.MODEL_TYPE_TEXT_EMBEDDING, err: types.ErrPluginNotFound},
+		{name: "供应商未安装", model: "anthropic/claude", modelType: plugin_entities.MODEL_TYPE_LLM, err: types.ErrPluginNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			model, err := server.ResolveModel(caller, tt.model, tt.modelType)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.provider, model.Provider.Declaration.Provider)
+			assert.Equal(t, tt.model, model.ID())
+		})
+	}
+
+	// 名称中没有供应商
+	_, err := server.ResolveModel(caller, "gpt-4o", plugin_entities.MODEL_TYPE_LLM)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, types.ErrPluginNotFound)
+}
+
+func TestServerModels(t *testing.T) {
+	daemon := newDaemon(t, NewServer(newBackend(), time.Minute))
+
+	resp, err := http.Get(daemon.URL + "/plugin/tenant/v1/models")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	list := decodeBody[openai_entities.ModelList](t, resp)
+	assert.Equal(t, openai_entities.OBJECT_LIST, list.Object)
+	ids := []string{}
+	for _, model := range list.Data {
+		ids = append(ids, model.ID)
+		assert.Equal(t, "langgenius", model.OwnedBy)
+	}
+	// 弃用的模型不列出
+	assert.Equal(t, []string{"openai/gpt-4o", "openai/text-embedding-3-small"}, ids)
+
+	// 其他租户看不到
+	resp, err = http.Get(daemon.URL + "/plugin/other/v1/models")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Empty(t, decodeBody[openai_entities.ModelList](t, resp).Data)
+}
+
+func TestServerChatCompletions(t *testing.T) {
+	promptTokens, completionTokens, totalTokens := 12, 3, 15
+	finished := llmChunk("lo", nil, "stop")
+	finished.Delta.Usage = &model_entities.LLMUsage{
+		PromptTokens:     &promptTokens,
+		CompletionTokens: &completionTokens,
+		TotalTokens:      &totalTokens,
+	}
+
+	backend := newBackend()
+	backend.chunks = []model_entities.LLMResultChunk{llmChunk("Hel", nil, ""), finished}
+	daemon := newDaemon(t, NewServer(backend, time.Minute))
+	url := daemon.URL + "/plugin/tenant/v1/chat/completions"
+
+	t.Run("非流式", func(t *testing.T) {
+		resp := postJSON(t, url, `{
+			"model": "openai/gpt-4o",
+			"messages": [{"role": "user", "content": "hi"}],
+			"tools": [{"type": "function", "function": {"name": "weather"}}],
+			"temperature": 0.5,
+			"user": "user-1",
+			"credentials": {"api_key": "sk-1"}
+		}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		completion := decodeBody[openai_entities.ChatCompletion](t, resp)
+		assert.True(t, strings.HasPrefix(completion.ID, "chatcmpl-"))
+		assert.Equal(t, "openai/gpt-4o", completion.Model)
+		assert.Equal(t, "Hello", *completion.Choices[0].Message.Content)
+		assert.Equal(t, "stop", completion.Choices[0].FinishReason)
+		assert.Equal(t, &openai_entities.Usage{PromptTokens: 12, CompletionTokens: 3, TotalTokens: 15}, completion.Usage)
+
+		// 请求被转换为插件的调用
+		require.NotNil(t, backend.request)
+		assert.Equal(t, "openai", backend.request.Provider)
+		assert.Equal(t, "gpt-4o", backend.request.Model)
+		assert.Equal(t, model_entities.MODEL_TYPE_LLM, backend.request.ModelType)
+		assert.Equal(t, map[string]any{"api_key": "sk-1"}, backend.request.Credentials.Credentials)
+		assert.Equal(t, 0.5, backend.request.ModelParameters["temperature"])
+		require.Len(t, backend.request.Tools, 1)
+		assert.Equal(t, "weather", backend.request.Tools[0].Name)
+		assert.False(t, backend.request.Stream)
+		assert.Equal(t, "user-1", backend.caller.UserID)
+	})
+
+	t.Run("流式", func(t *testing.T) {
+		resp := postJSON(t, url, `{
+			"model": "openai/gpt-4o",
+			"messages": [{"role": "user", "content": "hi"}],
+			"stream": true,
+			"stream_options": {"include_usage": true}
+		}`)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		assert.True(t, backend.request.Stream)
+
+		events := readEvents(t, resp)
+		require.Len(t, events, 4)
+		assert.Equal(t, "[DONE]", events[3])
+
+		chunks := []openai_entities.ChatCompletionChunk{}
+		for _, event := range events[:3] {
+			var chunk openai_entities.ChatCompletionChunk
+			require.NoError(t, json.Unmarshal([]byte(event), &chunk))
+			chunks = append(chunks, chunk)
+		}
+		assert.Equal(t, chunks[0].ID, chunks[2].ID)
+		assert.Equal(t, "Hel", *chunks[0].Choices[0].Delta.Content)
+		assert.Equal(t, "stop", *chunks[1].Choices[0].FinishReason)
+		// 用量单独放在最后一个分片
+		assert.Nil(t, chunks[1].Usage)
+		assert.Empty(t, chunks[2].Choices)
+		assert.Equal(t, 15, chunks[2].Usage.TotalTokens)
+	})
+
+	t.Run("流式不返回用量", func(t *testing.T) {
+		resp := postJSON(t, url, `{"model": "openai/gpt-4o", "messages": [{"role": "user", "content": "hi"}], "stream": true}`)
+		events := readEvents(t, resp)
+		require.Len(t, events, 3)
+		assert.Equal(t, "[DONE]", events[2])
+	})
+}
+
+func TestServerChatCompletionsErrors(t *testing.T) {
+	backend := newBackend()
+	daemon := newDaemon(t, NewServer(backend, time.Minute))
+	url := daemon.URL + "/plugin/tenant/v1/chat/completions"
+
+	tests := []struct {
+		name      string
+		body      string
+		status    int
+		errorType string
+		code      string
+	}{
+		{
+			name:      "模型不存在",
+			body:      `{"model": "openai/gpt-5", "messages": [{"role": "user", "content": "hi"}]}`,
+			status:    http.StatusNotFound,
+			errorType: openai_entities.ERROR_TYPE_NOT_FOUND,
+			code:      openai_entities.ERROR_CODE_MODEL_NOT_FOUND,
+		},
+		{
+			name:      "缺少消息",
+			body:      `{"model": "openai/gpt-4o", "messages": []}`,
+			status:    http.StatusBadRequest,
+			errorType: openai_entities.ERROR_TYPE_INVALID_REQUEST,
+		},
+		{
+			name:      "多个候选",
+			body:      `{"model": "openai/gpt-4o", "messages": [{"role": "user", "content": "hi"}], "n": 2}`,
+			status:    http.StatusBadRequest,
+			errorType: openai_entities.ERROR_TYPE_INVALID_REQUEST,
+		},
+		{
+			name:      "不支持的工具类型",
+			body:      `{"model": "openai/gpt-4o", "messages": [{"role": "user", "content": "hi"}], "tools": [{"type": "code_interpreter"}]}`,
+			status:    http.StatusBadRequest,
+			errorType: openai_entities.ERROR_TYPE_INVALID_REQUEST,
+		},
+		{
+			name:      "请求体不合法",
+			body:      `{"model": `,
+			status:    http.StatusBadRequest,
+			errorType: openai_entities.ERROR_TYPE_INVALID_REQUEST,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := postJSON(t, url, tt.body)
+			assert.Equal(t, tt.status, resp.StatusCode)
+			response := decodeBody[openai_entities.ErrorResponse](t, resp)
+			assert.Equal(t, tt.errorType, response.Error.Type)
+			if tt.code != "" {
+				require.NotNil(t, response.Error.Code)
+				assert.Equal(t, tt.code, *response.Error.Code)
+			}
+		})
+	}
+
+	// 插件出错时非流式返回错误，流式在流中返回错误且不发送 [DONE]
+	backend.chunks = []model_entities.LLMResultChunk{llmChunk("Hel", nil, "")}
+	backend.streamErr = errors.New("rate limited")
+
+	resp := postJSON(t, url, `{"model": "openai/gpt-4o", "messages": [{"role": "user", "content": "hi"}]}`)
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	assert.Equal(t, "rate limited", decodeBody[openai_entities.ErrorResponse](t, resp).Error.Message)
+
+	resp = postJSON(t, url, `{"model": "openai/gpt-4o", "messages": [{"role": "user", "content": "hi"}], "stream": true}`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	events := readEvents(t, resp)
+	require.Len(t, events, 2)
+	assert.Contains(t, events[1], `"rate limited"`)
+}
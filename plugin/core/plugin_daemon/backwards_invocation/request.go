@@ -68,6 +68,27 @@ func (b *BackwardsInvocation) EndResponse() {
 	)
 }
 
+// Cancelled reports whether the session of the invocation is cancelled or closed
+func (b *BackwardsInvocation) Cancelled() bool {
+	if b.session == nil {
+		return false
+	}
+	select {
+	case <-b.session.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// OnCancel runs f once the session is cancelled or closed, the returned function stops it
+func (b *BackwardsInvocation) OnCancel(f func()) func() bool {
+	if b.session == nil {
+		return func() bool { return false }
+	}
+	return b.session.AfterDone(f)
+}
+
 func (b *BackwardsInvocation) Type() BackwardsInvocationType {
 	return b.typ
 }
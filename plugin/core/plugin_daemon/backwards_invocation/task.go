@@ -127,6 +127,11 @@ func prepareInvocationArgs(
 }
 
 func dispatchInvocationTask(handle *BackwardsInvocation) {
+	if handle.Cancelled() {
+		handle.WriteError(fmt.Errorf("session is cancelled"))
+		return
+	}
+
 	requestData := handle.RequestData()
 	tenantId, err := handle.TenantID()
 	if err != nil {
@@ -177,6 +182,8 @@ func executeInvocationLLMTask(
 		handle.WriteError(fmt.Errorf("invoke llm model failed: %s", err.Error()))
 		return
 	}
+	// the stream is aborted once the session is cancelled
+	defer handle.OnCancel(response.Close)()
 
 	for response.Next() {
 		value, err := response.Read()
@@ -197,6 +204,8 @@ func executeInvocationToolTask(
 		handle.WriteError(fmt.Errorf("invoke tool model failed: %s", err.Error()))
 		return
 	}
+	// the stream is aborted once the session is cancelled
+	defer handle.OnCancel(response.Close)()
 
 	for response.Next() {
 		value, err := response.Read()
@@ -217,6 +226,8 @@ func executeInvocationLLMStructuredOutputTask(
 		handle.WriteError(fmt.Errorf("invoke llm with structured output model failed: %s", err.Error()))
 		return
 	}
+	// the stream is aborted once the session is cancelled
+	defer handle.OnCancel(response.Close)()
 
 	for response.Next() {
 		value, err := response.Read()
@@ -263,6 +274,8 @@ func executeInvocationTTSTask(
 		handle.WriteError(fmt.Errorf("invoke tts model failed: %s", err.Error()))
 		return
 	}
+	// the stream is aborted once the session is cancelled
+	defer handle.OnCancel(response.Close)()
 
 	for response.Next() {
 		value, err := response.Read()
@@ -310,6 +323,8 @@ func executeInvocationAppTask(
 		handle.WriteError(fmt.Errorf("invoke app failed: %s", err.Error()))
 		return
 	}
+	// the stream is aborted once the session is cancelled
+	defer handle.OnCancel(response.Close)()
 
 	userId, err := handle.UserID()
 	if err != nil {
@@ -2,6 +2,8 @@ package plugin_daemon
 
 import (
 	"encoding/hex"
+	"errors"
+	"io"
 	"net/http"
 	"sync/atomic"
 
@@ -11,10 +13,15 @@ import (
 	"github.com/jjgagacy/workflow-app/plugin/utils"
 )
 
+// InvokeEndPoint invokes the endpoint of a plugin, if body is not nil, it will be
+// streamed to the plugin in chunks of chunkSize after the request was sent
 func InvokeEndPoint(
 	session *session_manager.Session,
 	request *requests.RequestInvokeEndPoint,
+	body io.Reader,
+	chunkSize int,
 ) (int, *http.Header, *utils.Stream[[]byte], error) {
+	request.BodyStreaming = body != nil
 	resp, err := GenericInvokePlugin[requests.RequestInvokeEndPoint, endpoint_entities.EndpointResponseChunk](
 		session,
 		request,
@@ -24,6 +31,21 @@ func InvokeEndPoint(
 		return http.StatusInternalServerError, nil, nil, err
 	}
 
+	if body != nil {
+		utils.Submit(map[string]string{
+			"module":   "plugin_daemon",
+			"function": "InvokeEndPoint",
+			"type":     "body_streaming",
+		}, func() {
+			write := func(chunk endpoint_entities.EndpointRequestBodyChunk) error {
+				return session.Write(session_manager.EVENT_STREAM_REQUEST_BODY, session.AccessAction, chunk)
+			}
+			if err := streamEndPointBody(body, chunkSize, resp.IsClosed, write); err != nil {
+				utils.Warn("failed to stream endpoint request body: %v", err)
+			}
+		})
+	}
+
 	statusCode := int32(http.StatusContinue)
 	headers := &http.Header{}
 	response := utils.NewStream[[]byte](128)
@@ -72,3 +94,47 @@ func InvokeEndPoint(
 
 	return int(statusCode), headers, response, nil
 }
+
+// streamEndPointBody writes body to the plugin chunk by chunk, the next chunk is only
+// read after the previous one was written to the runtime, so a slow plugin slows down
+// the reading from the client instead of buffering the whole body in memory
+func streamEndPointBody(
+	body io.Reader,
+	chunkSize int,
+	aborted func() bool,
+	write func(chunk endpoint_entities.EndpointRequestBodyChunk) error,
+) error {
+	if chunkSize <= 0 {
+		chunkSize = 64 * 1024
+	}
+
+	buf := make([]byte, chunkSize)
+	seq := 0
+	for {
+		// plugin has already finished the request, no need to send the rest
+		if aborted() {
+			return nil
+		}
+
+		n, err := io.ReadFull(body, buf)
+		if n > 0 {
+			if werr := write(endpoint_entities.EndpointRequestBodyChunk{
+				Seq:   seq,
+				Chunk: hex.EncodeToString(buf[:n]),
+			}); werr != nil {
+				return werr
+			}
+			seq++
+		}
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return write(endpoint_entities.EndpointRequestBodyChunk{Seq: seq, End: true})
+		}
+
+		if err != nil {
+			message := err.Error()
+			werr := write(endpoint_entities.EndpointRequestBodyChunk{Seq: seq, End: true, Error: &message})
+			return errors.Join(err, werr)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package plugin_daemon
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/endpoint_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamEndPointBody(t *testing.T) {
+	message := "read failed"
+
+	tests := []struct {
+		name      string
+		body      io.Reader
+		chunkSize int
+		aborted   bool
+		want      []endpoint_entities.EndpointRequestBodyChunk
+		wantErr   bool
+	}{
+		{
+			name:      "按块发送，最后一块不足块大小",
+			body:      strings.NewReader("hello world"),
+			chunkSize: 4,
+			want: []endpoint_entities.EndpointRequestBodyChunk{
+				{Seq: 0, Chunk: hex.EncodeToString([]byte("hell"))},
+				{Seq: 1, Chunk: hex.EncodeToString([]byte("o wo"))},
+				{Seq: 2, Chunk: hex.EncodeToString([]byte("rld"))},
+				{Seq: 3, End: true},
+			},
+		},
+		{
+			name:      "空请求体只发送结束标记",
+			body:      strings.NewReader(""),
+			chunkSize: 4,
+			want:      []endpoint_entities.EndpointRequestBodyChunk{{Seq: 0, End: true}},
+		},
+		{
+			name:      "插件已结束请求时不再读取",
+			body:      strings.NewReader("hello"),
+			chunkSize: 4,
+			aborted:   true,
+		},
+		{
+			name:      "读取失败时带上错误结束",
+			body:      io.MultiReader(strings.NewReader("hello"), iotest.ErrReader(errors.New(message))),
+			chunkSize: 4,
+			want: []endpoint_entities.EndpointRequestBodyChunk{
+				{Seq: 0, Chunk: hex.EncodeToString([]byte("hell"))},
+				{Seq: 1, Chunk: hex.EncodeToString([]byte("o"))},
+				{Seq: 2, End: true, Error: &message},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var chunks []endpoint_entities.EndpointRequestBodyChunk
+			err := streamEndPointBody(tt.body, tt.chunkSize, func() bool { return tt.aborted }, func(chunk endpoint_entities.EndpointRequestBodyChunk) error {
+				chunks = append(chunks, chunk)
+				return nil
+			})
+			if tt.wantErr {
+				require.Error(t, err)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.want, chunks)
+		})
+	}
+
+	// 写入运行时失败时停止读取
+	writeErr := errors.New("runtime closed")
+	err := streamEndPointBody(strings.NewReader("hello world"), 4, func() bool { return false }, func(endpoint_entities.EndpointRequestBodyChunk) error {
+		return writeErr
+	})
+	assert.ErrorIs(t, err, writeErr)
+}
@@ -3,6 +3,7 @@ package plugin_daemon
 import (
 	"errors"
 	"fmt"
+	"sync/atomic"
 
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/backwards_invocation"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/backwards_invocation/transaction"
@@ -18,6 +19,19 @@ func GenericInvokePlugin[T any, R any](
 	responseBufferSize int,
 ) (
 	*utils.Stream[R], error,
+) {
+	return genericInvokePlugin[T, R](session, req, responseBufferSize, nil)
+}
+
+// genericInvokePlugin invokes the plugin, every chunk is validated against its entity
+// and check before it's passed to the caller, check may be nil
+func genericInvokePlugin[T any, R any](
+	session *session_manager.Session,
+	req *T,
+	responseBufferSize int,
+	check func(*R) error,
+) (
+	*utils.Stream[R], error,
 ) {
 	runtime := session.Runtime()
 	if runtime == nil {
@@ -25,6 +39,8 @@ func GenericInvokePlugin[T any, R any](
 	}
 
 	response := utils.NewStream[R](responseBufferSize)
+	// whether the plugin finished the session, otherwise it's cancelled on close
+	finished := new(int32)
 	listener, err := runtime.Listen(session.ID)
 	if err != nil {
 		return nil, err
@@ -32,7 +48,7 @@ func GenericInvokePlugin[T any, R any](
 	listener.Listen(func(chunk plugin_entities.SessionMessage) {
 		switch chunk.Type {
 		case plugin_entities.SESSION_MESSAGE_TYPE_STREAM:
-			data, err := utils.UnmarshalJsonBytes[R](chunk.Data)
+			data, err := decodeChunk[R](chunk.Data)
 			if err != nil {
 				response.WriteError(errors.New(utils.MarshalJson(map[string]string{
 					"error_type": "unmarshal error",
@@ -40,9 +56,20 @@ func GenericInvokePlugin[T any, R any](
 				})))
 				response.Close()
 				return
-			} else {
-				response.WriteBlocking(data)
 			}
+			if err := validateChunk(&data, check); err != nil {
+				validationErr := &PluginResponseValidationError{
+					PluginUniqueIdentifier: session.PluginUniqueIdentifier,
+					Entity:                 chunkEntityName[R](),
+					Reason:                 err.Error(),
+				}
+				if !reportInvalidChunk(runtime, validationErr) {
+					response.WriteError(validationErr)
+					response.Close()
+					return
+				}
+			}
+			response.WriteBlocking(data)
 		case plugin_entities.SESSION_MESSAGE_TYPE_INVOKE:
 			if runtime.Type() == plugin_entities.PLUGIN_RUNTIME_TYPE_SERVERLESS {
 				// todo
@@ -62,8 +89,10 @@ func GenericInvokePlugin[T any, R any](
 				return
 			}
 		case plugin_entities.SESSION_MESSAGE_TYPE_END:
+			atomic.StoreInt32(finished, 1)
 			response.Close()
 		case plugin_entities.SESSION_MESSAGE_TYPE_ERROR:
+			atomic.StoreInt32(finished, 1)
 			e, err := utils.UnmarshalJsonBytes[plugin_entities.ErrorResponse](chunk.Data)
 			if err != nil {
 				break
@@ -80,6 +109,11 @@ func GenericInvokePlugin[T any, R any](
 	})
 
 	response.OnClose(func() {
+		// the client is gone or timed out, cancel before the listener is closed
+		// as the session is routed to its replica until then
+		if atomic.LoadInt32(finished) == 0 {
+			session.Cancel()
+		}
 		listener.Close()
 	})
 
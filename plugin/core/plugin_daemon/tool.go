@@ -13,10 +13,11 @@ func InvokeTool(
 ) (
 	*utils.Stream[tool_entities.ToolResponseChunk], error,
 ) {
-	return GenericInvokePlugin[requests.RequestInvokeTool, tool_entities.ToolResponseChunk](
+	return genericInvokePlugin(
 		session,
 		request,
 		1,
+		toolOutputCheck(session.Declaration, request.Tool),
 	)
 }
 
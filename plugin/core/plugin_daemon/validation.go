@@ -0,0 +1,193 @@
+package plugin_daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/tool_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/validators"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ResponseValidationMode decides what happens to a chunk emitted by a plugin which
+// fails the validation
+type ResponseValidationMode string
+
+const (
+	// the invocation fails with a PluginResponseValidationError
+	RESPONSE_VALIDATION_MODE_STRICT ResponseValidationMode = "strict"
+	// the chunk is passed through and the violation is logged
+	RESPONSE_VALIDATION_MODE_WARN ResponseValidationMode = "warn"
+)
+
+// set once on startup
+var responseValidationMode = RESPONSE_VALIDATION_MODE_STRICT
+
+func SetResponseValidationMode(mode ResponseValidationMode) {
+	if mode == "" {
+		mode = RESPONSE_VALIDATION_MODE_STRICT
+	}
+	responseValidationMode = mode
+}
+
+// PluginResponseValidationError is returned when a chunk emitted by a plugin doesn't
+// match its response entity or the output schema declared by the plugin
+type PluginResponseValidationError struct {
+	PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier
+	// name of the response entity, e.g. ToolResponseChunk
+	Entity string
+	Reason string
+}
+
+func (e *PluginResponseValidationError) Message() string {
+	return fmt.Sprintf("plugin %s emitted an invalid %s: %s", e.PluginUniqueIdentifier, e.Entity, e.Reason)
+}
+
+func (e *PluginResponseValidationError) Error() string {
+	return utils.MarshalJson(map[string]string{
+		"error_type": "PluginResponseValidationError",
+		"message":    e.Message(),
+	})
+}
+
+// validateChunk checks the chunk against the validate tags of its entity and the
+// extra check of the invocation, check may be nil
+func validateChunk[R any](chunk *R, check func(*R) error) error {
+	value := reflect.ValueOf(chunk).Elem()
+	if value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return errors.New("chunk is null")
+		}
+		value = value.Elem()
+	}
+	if value.Kind() == reflect.Struct {
+		if err := validators.EntitiesValidator.Struct(value.Interface()); err != nil {
+			return err
+		}
+	}
+
+	if check != nil {
+		return check(chunk)
+	}
+	return nil
+}
+
+// decodeChunk unmarshals a chunk emitted by the plugin, the chunk is validated on its
+// own so that it can still be passed through in warn mode
+func decodeChunk[R any](data []byte) (R, error) {
+	var chunk R
+	err := json.Unmarshal(data, &chunk)
+	return chunk, err
+}
+
+// reportInvalidChunk logs the violation to the daemon and the plugin, it returns
+// false if the invocation has to fail
+func reportInvalidChunk(runtime plugin_entities.PluginLifetime, err *PluginResponseValidationError) bool {
+	if responseValidationMode == RESPONSE_VALIDATION_MODE_WARN {
+		utils.Warn("%s", err.Message())
+		runtime.Warn(err.Message())
+		return true
+	}
+	utils.Error("%s", err.Message())
+	runtime.Error(err.Message())
+	return false
+}
+
+func chunkEntityName[R any]() string {
+	typ := reflect.TypeFor[R]()
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	return typ.Name()
+}
+
+// toolOutputCheck validates the variables emitted by a tool against the properties of
+// its declared output schema, it returns nil if the tool declares no output schema
+func toolOutputCheck(
+	declaration *plugin_entities.PluginDeclaration,
+	tool string,
+) func(*tool_entities.ToolResponseChunk) error {
+	if declaration == nil || declaration.Tool == nil {
+		return nil
+	}
+
+	var outputSchema plugin_entities.ToolOutputSchema
+	for _, t := range declaration.Tool.Tools {
+		if t.Identity.Name == tool {
+			outputSchema = t.OutputSchema
+			break
+		}
+	}
+	properties, ok := outputSchema["properties"].(map[string]any)
+	if !ok {
+		return nil
+	}
+	additional, _ := outputSchema["additionalProperties"].(bool)
+	closed := outputSchema["additionalProperties"] != nil && !additional
+
+	// schemas of the properties are compiled once they're used
+	schemas := map[string]*gojsonschema.Schema{}
+
+	return func(chunk *tool_entities.ToolResponseChunk) error {
+		if chunk.Type != tool_entities.ToolResponseChunkTypeVariable {
+			return nil
+		}
+
+		name, _ := chunk.Message["variable_name"].(string)
+		if name == "" {
+			return errors.New("variable_name is required")
+		}
+		property, ok := properties[name].(map[string]any)
+		if !ok {
+			if closed {
+				return fmt.Errorf("variable %s is not declared in the output schema", name)
+			}
+			return nil
+		}
+
+		value := chunk.Message["variable_value"]
+		if stream, _ := chunk.Message["stream"].(bool); stream {
+			// streamed variables are strings sent in pieces, only the type is checked
+			if property["type"] != "string" {
+				return fmt.Errorf("variable %s is streamed but it's not a string in the output schema", name)
+			}
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("streamed variable %s is not a string", name)
+			}
+			return nil
+		}
+
+		schema, ok := schemas[name]
+		if !ok {
+			compiled, err := gojsonschema.NewSchema(gojsonschema.NewGoLoader(property))
+			if err != nil {
+				// the declaration is validated on install, a broken schema checks nothing
+				schemas[name] = nil
+				return nil
+			}
+			schemas[name] = compiled
+			schema = compiled
+		}
+		if schema == nil {
+			return nil
+		}
+
+		result, err := schema.Validate(gojsonschema.NewGoLoader(value))
+		if err != nil {
+			return fmt.Errorf("validate variable %s failed: %s", name, err.Error())
+		}
+		if !result.Valid() {
+			reasons := make([]string, 0, len(result.Errors()))
+			for _, e := range result.Errors() {
+				reasons = append(reasons, e.String())
+			}
+			return fmt.Errorf("variable %s doesn't match the output schema: %s", name, strings.Join(reasons, "; "))
+		}
+		return nil
+	}
+}
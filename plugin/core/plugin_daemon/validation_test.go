@@ -0,0 +1,247 @@
+package plugin_daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/access_types"
+	"github.com/jjgagacy/workflow-app/plugin/core/session_manager"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/tool_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLifetime 收到请求后回复预设的消息
+type fakeLifetime struct {
+	plugin_entities.PluginLifetime
+
+	declaration *plugin_entities.PluginDeclaration
+	chunks      []string
+	listener    *entities.Broadcast[plugin_entities.SessionMessage]
+
+	mu       sync.Mutex
+	warnings []string
+	errors   []string
+}
+
+func (f *fakeLifetime) Type() plugin_entities.PluginRuntimeType {
+	return plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL
+}
+
+func (f *fakeLifetime) Configuration() *plugin_entities.PluginDeclaration {
+	return f.declaration
+}
+
+func (f *fakeLifetime) Listen(sessionId string) (*entities.Broadcast[plugin_entities.SessionMessage], error) {
+	f.listener = entities.NewBroadcast[plugin_entities.SessionMessage]()
+	return f.listener, nil
+}
+
+func (f *fakeLifetime) Write(sessionId string, action access_types.PluginAccessAction, data []byte) {
+	go func() {
+		for _, chunk := range f.chunks {
+			f.listener.Send(plugin_entities.SessionMessage{
+				Type: plugin_entities.SESSION_MESSAGE_TYPE_STREAM,
+				Data: json.RawMessage(chunk),
+			})
+		}
+		f.listener.Send(plugin_entities.SessionMessage{Type: plugin_entities.SESSION_MESSAGE_TYPE_END})
+	}()
+}
+
+func (f *fakeLifetime) Warn(msg string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.warnings = append(f.warnings, msg)
+}
+
+func (f *fakeLifetime) Error(msg string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors = append(f.errors, msg)
+}
+
+// logged 返回记录的警告和错误数量
+func (f *fakeLifetime) logged() (int, int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.warnings), len(f.errors)
+}
+
+func toolDeclaration(outputSchema plugin_entities.ToolOutputSchema) *plugin_entities.PluginDeclaration {
+	return &plugin_entities.PluginDeclaration{
+		Tool: &plugin_entities.ToolProviderDeclaration{
+			Tools: []plugin_entities.ToolDeclaration{
+				{
+					Identity:     plugin_entities.ToolIdentity{Name: "weather"},
+					OutputSchema: outputSchema,
+				},
+			},
+		},
+	}
+}
+
+func TestToolOutputCheck(t *testing.T) {
+	schema := plugin_entities.ToolOutputSchema{
+		"type": "object",
+		"properties": map[string]any{
+			"temperature": map[string]any{"type": "number", "minimum": -100},
+			"summary":     map[string]any{"type": "string"},
+		},
+	}
+	closedSchema := plugin_entities.ToolOutputSchema{
+		"type":                 "object",
+		"properties":           schema["properties"],
+		"additionalProperties": false,
+	}
+
+	variable := func(name string, value any, stream bool) *tool_entities.ToolResponseChunk {
+		return &tool_entities.ToolResponseChunk{
+			Type: tool_entities.ToolResponseChunkTypeVariable,
+			Message: map[string]any{
+				"variable_name":  name,
+				"variable_value": value,
+				"stream":         stream,
+			},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		schema plugin_entities.ToolOutputSchema
+		chunk  *tool_entities.ToolResponseChunk
+		// 错误包含的内容，空表示通过
+		invalid string
+	}{
+		{"符合输出结构", schema, variable("temperature", 21.5, false), ""},
+		{"类型不符", schema, variable("temperature", "hot", false), "variable temperature doesn't match the output schema"},
+		{"超出范围", schema, variable("temperature", -200, false), "variable temperature doesn't match the output schema"},
+		{"未声明的变量", schema, variable("humidity", 50, false), ""},
+		{"不允许未声明的变量", closedSchema, variable("humidity", 50, false), "variable humidity is not declared"},
+		{"缺少变量名", schema, variable("", 1, false), "variable_name is required"},
+		{"流式字符串变量", schema, variable("summary", "sun", true), ""},
+		{"流式非字符串变量", schema, variable("temperature", "2", true), "it's not a string in the output schema"},
+		{"非变量消息不检查", schema, &tool_entities.ToolResponseChunk{
+			Type:    tool_entities.ToolResponseChunkTypeText,
+			Message: map[string]any{"text": "hello"},
+		}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := toolOutputCheck(toolDeclaration(tt.schema), "weather")
+			require.NotNil(t, check)
+
+			err := check(tt.chunk)
+			if tt.invalid == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.invalid)
+		})
+	}
+
+	// 没有声明输出结构时不检查
+	assert.Nil(t, toolOutputCheck(toolDeclaration(nil), "weather"))
+	assert.Nil(t, toolOutputCheck(toolDeclaration(schema), "unknown"))
+}
+
+func TestInvokeToolResponseValidation(t *testing.T) {
+	schema := plugin_entities.ToolOutputSchema{
+		"type": "object",
+		"properties": map[string]any{
+			"temperature": map[string]any{"type": "number"},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		mode   ResponseValidationMode
+		chunks []string
+		// 调用方收到的消息数量
+		received int
+		warnings int
+		failed   bool
+	}{
+		{
+			"合法的消息",
+			RESPONSE_VALIDATION_MODE_STRICT,
+			[]string{`{"type":"text","message":{"text":"hi"}}`, `{"type":"variable","message":{"variable_name":"temperature","variable_value":21}}`},
+			2, 0, false,
+		},
+		{
+			"严格模式下未知的消息类型失败",
+			RESPONSE_VALIDATION_MODE_STRICT,
+			[]string{`{"type":"unknown","message":{}}`},
+			0, 0, true,
+		},
+		{
+			"严格模式下不符合输出结构失败",
+			RESPONSE_VALIDATION_MODE_STRICT,
+			[]string{`{"type":"text","message":{"text":"hi"}}`, `{"type":"variable","message":{"variable_name":"temperature","variable_value":"hot"}}`},
+			1, 0, true,
+		},
+		{
+			"警告模式下继续传递",
+			RESPONSE_VALIDATION_MODE_WARN,
+			[]string{`{"type":"unknown","message":{}}`, `{"type":"variable","message":{"variable_name":"temperature","variable_value":"hot"}}`},
+			2, 2, false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetResponseValidationMode(tt.mode)
+			t.Cleanup(func() { SetResponseValidationMode(RESPONSE_VALIDATION_MODE_STRICT) })
+
+			runtime := &fakeLifetime{declaration: toolDeclaration(schema), chunks: tt.chunks}
+			session := session_manager.NewSession(session_manager.SessionPayload{
+				TenantID:               "tenant",
+				PluginUniqueIdentifier: "author/weather:0.0.1@abc",
+				AccessType:             access_types.PLUGIN_ACCESS_TYPE_TOOL,
+				AccessAction:           access_types.PLUGIN_ACCESS_ACTION_INVOKE_TOOL,
+				Declaration:            runtime.declaration,
+				IgnoreCache:            true,
+			})
+			defer session.Close(session_manager.CloseSessionPayload{IgnoreCache: true})
+			session.BindRuntime(runtime)
+
+			request := &requests.RequestInvokeTool{}
+			request.Provider = "weather"
+			request.Tool = "weather"
+			response, err := InvokeTool(session, request)
+			require.NoError(t, err)
+
+			received := 0
+			var streamErr error
+			for response.Next() {
+				if _, err := response.Read(); err != nil {
+					streamErr = err
+					break
+				}
+				received++
+			}
+
+			assert.Equal(t, tt.received, received)
+			warnings, errs := runtime.logged()
+			if !tt.failed {
+				assert.NoError(t, streamErr)
+				assert.Equal(t, tt.warnings, warnings)
+				return
+			}
+
+			var validationErr *PluginResponseValidationError
+			require.True(t, errors.As(streamErr, &validationErr))
+			assert.Equal(t, plugin_entities.PluginUniqueIdentifier("author/weather:0.0.1@abc"), validationErr.PluginUniqueIdentifier)
+			assert.Equal(t, "ToolResponseChunk", validationErr.Entity)
+			assert.Contains(t, streamErr.Error(), "PluginResponseValidationError")
+			assert.Equal(t, 1, errs)
+		})
+	}
+}
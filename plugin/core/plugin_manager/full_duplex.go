@@ -2,6 +2,7 @@ package plugin_manager
 
 import (
 	"fmt"
+	"math/rand/v2"
 	"sync"
 	"time"
 
@@ -9,10 +10,81 @@ import (
 	"github.com/jjgagacy/workflow-app/plugin/utils"
 )
 
+// RestartPolicy controls how a crashed plugin is restarted
+type RestartPolicy struct {
+	// first restart interval, doubled on each crash up to MaxInterval
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	// the plugin is crash looping after CrashLoopThreshold crashes in CrashLoopWindow
+	CrashLoopThreshold int
+	CrashLoopWindow    time.Duration
+}
+
+var defaultRestartPolicy = RestartPolicy{
+	InitialInterval:    time.Second,
+	MaxInterval:        time.Minute,
+	CrashLoopThreshold: 5,
+	CrashLoopWindow:    5 * time.Minute,
+}
+
+// restartBackoff returns exponential intervals with jitter
+type restartBackoff struct {
+	initial time.Duration
+	max     time.Duration
+	attempt int
+}
+
+func (b *restartBackoff) Next() time.Duration {
+	interval := b.max
+	if b.attempt < 32 {
+		if d := b.initial << b.attempt; d > 0 && d < b.max {
+			interval = d
+		}
+	}
+	b.attempt++
+	// equal jitter, half of the interval is random so that plugins crashed at the
+	// same time are not restarted together
+	half := interval / 2
+	return half + rand.N(half+1)
+}
+
+func (b *restartBackoff) Reset() {
+	b.attempt = 0
+}
+
+// sleepUnlessStopped sleeps for d, it returns early once the plugin is stopped
+func sleepUnlessStopped(r plugin_entities.PluginFullDuplexLifetime, d time.Duration) {
+	deadline := time.Now().Add(d)
+	for !r.Stopped() {
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return
+		}
+		time.Sleep(min(remaining, 100*time.Millisecond))
+	}
+}
+
+// waitCrashLoopReset blocks until the crash loop is reset, it returns false if the plugin is stopped
+func waitCrashLoopReset(r plugin_entities.PluginFullDuplexLifetime) bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.WaitReset():
+			return true
+		case <-ticker.C:
+			if r.Stopped() {
+				return false
+			}
+		}
+	}
+}
+
 func FullDuplex(
 	r plugin_entities.PluginFullDuplexLifetime,
 	launchedChan chan bool,
 	errChan chan error,
+	policy *RestartPolicy,
 ) {
 	// stop plugin when the end of its lifetime
 	defer r.Stop()
@@ -21,6 +93,11 @@ func FullDuplex(
 	// remove lifetime state after plugin if it has been stopped
 	defer r.TriggerStop()
 
+	if policy == nil {
+		policy = &defaultRestartPolicy
+	}
+	backoff := &restartBackoff{initial: policy.InitialInterval, max: policy.MaxInterval}
+
 	config := r.Configuration()
 
 	utils.Info("new plugin logged in: %s", config.Identity())
@@ -53,10 +130,14 @@ func FullDuplex(
 			}
 			utils.Error("init plugin failed: %s", err.Error())
 			failedTimes++
+			if failedTimes <= 3 {
+				sleepUnlessStopped(r, backoff.Next())
+			}
 			continue
 		}
 		break
 	}
+	backoff.Reset()
 
 	// notify launched
 	once.Do(func() {
@@ -69,8 +150,12 @@ func FullDuplex(
 		}
 	})
 
+	// crash times within the crash loop window
+	crashes := []time.Time{}
+
 	// init successfully
 	for !r.Stopped() {
+		startedAt := time.Now()
 		if err := r.StartPlugin(); err != nil {
 			if r.Stopped() {
 				// exit
@@ -83,9 +168,47 @@ func FullDuplex(
 			<-c
 		}
 
-		// restart plugin in 5s (skip for debugging runtime)
-		if r.Type() != plugin_entities.PLUGIN_RUNTIME_TYPE_REMOTE {
-			time.Sleep(5 * time.Second)
+		if r.Stopped() {
+			break
+		}
+
+		if state := r.RuntimeState(); state.Status == plugin_entities.PLUGIN_RUNTIME_STATUS_INCOMPATIBLE.String() {
+			// restarting doesn't help, keep the lifetime to report the reason until it's stopped
+			utils.Error("plugin %s is incompatible, it's not restarted: %s", config.Identity(), state.FailureReason)
+			for !r.Stopped() {
+				sleepUnlessStopped(r, time.Second)
+			}
+			break
+		}
+
+		// a plugin which stayed up for a while is not crashing in a loop
+		if time.Since(startedAt) >= policy.MaxInterval {
+			backoff.Reset()
+		}
+
+		now := time.Now()
+		crashes = append(crashes, now)
+		for len(crashes) > 0 && now.Sub(crashes[0]) > policy.CrashLoopWindow {
+			crashes = crashes[1:]
+		}
+
+		if policy.CrashLoopThreshold > 0 && len(crashes) >= policy.CrashLoopThreshold {
+			reason := r.LastError()
+			if reason == "" {
+				reason = fmt.Sprintf("plugin crashed %d times in %s", len(crashes), policy.CrashLoopWindow)
+			}
+			utils.Error("plugin %s is crash looping, it's not restarted until reset: %s", config.Identity(), reason)
+			r.SetCrashLoop(reason)
+
+			if !waitCrashLoopReset(r) {
+				break
+			}
+			utils.Info("crash loop of plugin %s is reset, restarting", config.Identity())
+			crashes = crashes[:0]
+			backoff.Reset()
+		} else if r.Type() != plugin_entities.PLUGIN_RUNTIME_TYPE_REMOTE {
+			// restart plugin after the backoff (skip for debugging runtime)
+			sleepUnlessStopped(r, backoff.Next())
 		}
 
 		// add restart
@@ -0,0 +1,221 @@
+package plugin_manager
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRestartBackoff(t *testing.T) {
+	backoff := &restartBackoff{initial: time.Second, max: 10 * time.Second}
+
+	// 间隔指数增长，抖动范围为间隔的一半到间隔本身，且不超过上限
+	expected := []time.Duration{
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		8 * time.Second,
+		10 * time.Second,
+		10 * time.Second,
+	}
+	for _, interval := range expected {
+		d := backoff.Next()
+		assert.GreaterOrEqual(t, d, interval/2)
+		assert.LessOrEqual(t, d, interval)
+	}
+
+	// 多次崩溃后不会溢出
+	for range 100 {
+		d := backoff.Next()
+		assert.GreaterOrEqual(t, d, 5*time.Second)
+		assert.LessOrEqual(t, d, 10*time.Second)
+	}
+
+	// 重置后从初始间隔开始
+	backoff.Reset()
+	assert.LessOrEqual(t, backoff.Next(), time.Second)
+}
+
+// fakeFullDuplexLifetime is a plugin which crashes after uptime each time it's started
+type fakeFullDuplexLifetime struct {
+	plugin_entities.PluginFullDuplexLifetime
+
+	uptime    time.Duration
+	lastError string
+
+	lock    sync.Mutex
+	starts  int
+	stopped bool
+	state   plugin_entities.PluginRuntimeState
+	reset   chan bool
+}
+
+func newFakeFullDuplexLifetime(uptime time.Duration, lastError string) *fakeFullDuplexLifetime {
+	return &fakeFullDuplexLifetime{uptime: uptime, lastError: lastError, reset: make(chan bool, 1)}
+}
+
+func (r *fakeFullDuplexLifetime) Configuration() *plugin_entities.PluginDeclaration {
+	return &plugin_entities.PluginDeclaration{}
+}
+
+func (r *fakeFullDuplexLifetime) Type() plugin_entities.PluginRuntimeType {
+	return plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL
+}
+
+func (r *fakeFullDuplexLifetime) Init() error  { return nil }
+func (r *fakeFullDuplexLifetime) Cleanup()     {}
+func (r *fakeFullDuplexLifetime) TriggerStop() {}
+func (r *fakeFullDuplexLifetime) AddRestarts() {}
+
+func (r *fakeFullDuplexLifetime) StartPlugin() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.starts++
+	r.state.Status = plugin_entities.PLUGIN_RUNTIME_STATUS_ACTIVE.String()
+	return nil
+}
+
+func (r *fakeFullDuplexLifetime) Wait() (<-chan bool, error) {
+	c := make(chan bool)
+	time.AfterFunc(r.uptime, func() { close(c) })
+	return c, nil
+}
+
+func (r *fakeFullDuplexLifetime) Stop() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.stopped = true
+}
+
+func (r *fakeFullDuplexLifetime) Stopped() bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.stopped
+}
+
+func (r *fakeFullDuplexLifetime) RuntimeState() plugin_entities.PluginRuntimeState {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.state
+}
+
+func (r *fakeFullDuplexLifetime) SetCrashLoop(reason string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.state.Status = plugin_entities.PLUGIN_RUNTIME_STATUS_CRASH_LOOP.String()
+	r.state.FailureReason = reason
+}
+
+func (r *fakeFullDuplexLifetime) LastError() string {
+	return r.lastError
+}
+
+func (r *fakeFullDuplexLifetime) WaitReset() <-chan bool {
+	return r.reset
+}
+
+func (r *fakeFullDuplexLifetime) ResetCrashLoop() {
+	r.lock.Lock()
+	r.state.Status = plugin_entities.PLUGIN_RUNTIME_STATUS_PENDING.String()
+	r.lock.Unlock()
+	r.reset <- true
+}
+
+func (r *fakeFullDuplexLifetime) Starts() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.starts
+}
+
+// runFullDuplex runs the plugin until it's stopped by the returned function
+func runFullDuplex(t *testing.T, r *fakeFullDuplexLifetime, policy *RestartPolicy) func() {
+	launched := make(chan bool)
+	done := make(chan bool)
+	go func() {
+		FullDuplex(r, launched, nil, policy)
+		close(done)
+	}()
+	<-launched
+
+	return func() {
+		r.Stop()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("full duplex is not stopped")
+		}
+	}
+}
+
+func TestFullDuplexCrashLoop(t *testing.T) {
+	policy := &RestartPolicy{
+		InitialInterval:    time.Millisecond,
+		MaxInterval:        2 * time.Millisecond,
+		CrashLoopThreshold: 3,
+		CrashLoopWindow:    time.Minute,
+	}
+
+	r := newFakeFullDuplexLifetime(0, "ModuleNotFoundError: No module named 'requests'")
+	stop := runFullDuplex(t, r, policy)
+	defer stop()
+
+	// 窗口内崩溃达到阈值后进入 crash loop，并记录最后的错误
+	require.Eventually(t, func() bool {
+		return r.RuntimeState().Status == plugin_entities.PLUGIN_RUNTIME_STATUS_CRASH_LOOP.String()
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "ModuleNotFoundError: No module named 'requests'", r.RuntimeState().FailureReason)
+	assert.Equal(t, 3, r.Starts())
+
+	// crash loop 期间不再重启
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, 3, r.Starts())
+
+	// 重置后恢复重启，崩溃计数重新开始
+	r.ResetCrashLoop()
+	require.Eventually(t, func() bool {
+		return r.RuntimeState().Status == plugin_entities.PLUGIN_RUNTIME_STATUS_CRASH_LOOP.String()
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, 6, r.Starts())
+}
+
+func TestFullDuplexCrashLoopWithoutLastError(t *testing.T) {
+	policy := &RestartPolicy{
+		InitialInterval:    time.Millisecond,
+		MaxInterval:        2 * time.Millisecond,
+		CrashLoopThreshold: 2,
+		CrashLoopWindow:    time.Minute,
+	}
+
+	r := newFakeFullDuplexLifetime(0, "")
+	stop := runFullDuplex(t, r, policy)
+	defer stop()
+
+	// 没有错误输出时以崩溃次数作为原因
+	require.Eventually(t, func() bool {
+		return r.RuntimeState().Status == plugin_entities.PLUGIN_RUNTIME_STATUS_CRASH_LOOP.String()
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, "plugin crashed 2 times in 1m0s", r.RuntimeState().FailureReason)
+}
+
+func TestFullDuplexCrashesOutsideWindow(t *testing.T) {
+	policy := &RestartPolicy{
+		InitialInterval:    time.Millisecond,
+		MaxInterval:        2 * time.Millisecond,
+		CrashLoopThreshold: 3,
+		CrashLoopWindow:    20 * time.Millisecond,
+	}
+
+	// 每次运行 15ms 后崩溃，窗口内最多两次崩溃
+	r := newFakeFullDuplexLifetime(15*time.Millisecond, "")
+	stop := runFullDuplex(t, r, policy)
+	defer stop()
+
+	require.Eventually(t, func() bool {
+		return r.Starts() >= 8
+	}, 2*time.Second, 5*time.Millisecond)
+	assert.NotEqual(t, plugin_entities.PLUGIN_RUNTIME_STATUS_CRASH_LOOP.String(), r.RuntimeState().Status)
+}
@@ -0,0 +1,107 @@
+package plugin_manager
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/local_runtime"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+// pinnedWarm reports whether the plugin keeps running without sessions
+func (p *PluginManager) pinnedWarm(identity plugin_entities.PluginUniqueIdentifier) bool {
+	if p.config.PluginIdleTimeout <= 0 {
+		return true
+	}
+	for _, pinned := range p.config.PluginPinWarm {
+		if pinned == identity.PluginID() || pinned == identity.String() {
+			return true
+		}
+	}
+	return false
+}
+
+// stopIdleLocalPlugins stops the local plugins without sessions for the idle
+// timeout, they stay installed and are launched again by Get
+func (p *PluginManager) stopIdleLocalPlugins() {
+	if p.config.PluginIdleTimeout <= 0 {
+		return
+	}
+	timeout := time.Duration(p.config.PluginIdleTimeout) * time.Second
+
+	p.m.Range(func(key string, value plugin_entities.PluginLifetime) bool {
+		replicas, ok := value.(*local_runtime.LocalPluginReplicas)
+		if !ok {
+			return true
+		}
+		if p.pinnedWarm(plugin_entities.PluginUniqueIdentifier(key)) {
+			return true
+		}
+		if replicas.StopIfIdle(timeout) {
+			utils.Info("plugin %s has been idle for %s, stopped", key, timeout)
+		}
+		return true
+	})
+}
+
+// coldStart launches an installed plugin which is not running and blocks until
+// it's ready or the cold start timeout is reached
+func (p *PluginManager) coldStart(identity plugin_entities.PluginUniqueIdentifier) (plugin_entities.PluginLifetime, error) {
+	exists, err := p.installedBucket.Exists(identity.FsID())
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("check plugin installed error"))
+	}
+	if !exists {
+		return nil, errors.New("plugin not found")
+	}
+
+	utils.Info("cold starting plugin %s", identity)
+	lifetime, _, errChan, err := p.launchLocal(identity, nil)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("cold start plugin error"))
+	}
+
+	// the launch blocks until its error is received
+	utils.Submit(map[string]string{
+		"module":   "plugin_manager",
+		"function": "coldStart",
+	}, func() {
+		for err := range errChan {
+			utils.Error("cold start plugin %s failed: %s", identity, err.Error())
+		}
+	})
+
+	return p.waitLaunched(lifetime)
+}
+
+// waitLaunched blocks until a local plugin being launched is ready
+func (p *PluginManager) waitLaunched(lifetime plugin_entities.PluginLifetime) (plugin_entities.PluginLifetime, error) {
+	replicas, ok := lifetime.(*local_runtime.LocalPluginReplicas)
+	if !ok {
+		return lifetime, nil
+	}
+
+	select {
+	case <-replicas.WaitLaunched():
+	default:
+		timeout := time.Duration(p.config.PluginColdStartTimeout) * time.Second
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-replicas.WaitLaunched():
+		case <-timer.C:
+			return nil, fmt.Errorf("plugin is not ready after %s", timeout)
+		}
+	}
+
+	if replicas.Stopped() {
+		return nil, errors.New("plugin is stopped")
+	}
+	if state := replicas.RuntimeState(); state.Status == plugin_entities.PLUGIN_RUNTIME_STATUS_INCOMPATIBLE.String() {
+		return nil, fmt.Errorf("plugin is incompatible: %s", state.FailureReason)
+	}
+	return lifetime, nil
+}
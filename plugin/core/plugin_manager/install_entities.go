@@ -1,14 +1,19 @@
 package plugin_manager
 
+import "github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+
 type PluginInstallEvent string
 
 const (
-	PluginInstallEventInfo  PluginInstallEvent = "info"
-	PluginInstallEventDone  PluginInstallEvent = "done"
-	PluginInstallEventError PluginInstallEvent = "error"
+	PluginInstallEventInfo     PluginInstallEvent = "info"
+	PluginInstallEventProgress PluginInstallEvent = "progress"
+	PluginInstallEventDone     PluginInstallEvent = "done"
+	PluginInstallEventError    PluginInstallEvent = "error"
 )
 
 type PluginInstallResponse struct {
 	Event PluginInstallEvent `json:"event"`
-	Data  string             `json:"data"`
+	// only set for progress events
+	Stage plugin_entities.PluginInstallStage `json:"stage,omitempty"`
+	Data  string                             `json:"data"`
 }
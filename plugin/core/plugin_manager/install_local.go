@@ -2,6 +2,7 @@ package plugin_manager
 
 import (
 	"errors"
+	"sync/atomic"
 	"time"
 
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
@@ -26,18 +27,33 @@ func (p *PluginManager) InstallLocal(
 		}
 	}
 
-	runtime, launchedChan, errChan, err := p.launchLocal(pluginUniqueIdentifier)
+	response := utils.NewStream[PluginInstallResponse](128)
+
+	// the runtime keeps the handler after it's launched, progress of restarts is dropped
+	installing := int32(1)
+	runtime, launchedChan, errChan, err := p.launchLocal(
+		pluginUniqueIdentifier,
+		func(stage plugin_entities.PluginInstallStage, message string) {
+			if atomic.LoadInt32(&installing) == 1 {
+				response.Write(PluginInstallResponse{
+					Event: PluginInstallEventProgress,
+					Stage: stage,
+					Data:  message,
+				})
+			}
+		},
+	)
 	if err != nil {
+		response.Close()
 		return nil, err
 	}
 
-	response := utils.NewStream[PluginInstallResponse](128)
-
 	utils.Submit(map[string]string{
 		"module":   "plugin_manager",
 		"function": "InstallLocal",
 	}, func() {
 		defer response.Close()
+		defer atomic.StoreInt32(&installing, 0)
 
 		// Check heartbeat every 5 seconds
 		ticker := time.NewTicker(time.Second * 5)
@@ -85,6 +101,20 @@ func (p *PluginManager) InstallLocal(
 					return
 				}
 			case <-launchedChan:
+				// the launch is interrupted if the plugin is stopped while initializing,
+				// e.g. the installation is cancelled
+				if runtime.Stopped() {
+					response.Write(PluginInstallResponse{
+						Event: PluginInstallEventError,
+						Data:  "plugin stopped before launched",
+					})
+					return
+				}
+				response.Write(PluginInstallResponse{
+					Event: PluginInstallEventProgress,
+					Stage: plugin_entities.PLUGIN_INSTALL_STAGE_READY,
+					Data:  "plugin is ready",
+				})
 				response.Write(PluginInstallResponse{
 					Event: PluginInstallEventDone,
 					Data:  "Installed",
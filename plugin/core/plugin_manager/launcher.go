@@ -6,9 +6,13 @@ import (
 	"os"
 	"path"
 	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/basic_runtime"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/local_runtime"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/sandbox"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager/decoder"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
 	"github.com/jjgagacy/workflow-app/plugin/utils"
@@ -51,14 +55,25 @@ func (p *PluginManager) getLocalPluginRuntime(pluginUniqueIdentifier plugin_enti
 				Verified:    manifest.Verified,
 				WorkingPath: pluginWorkingPath,
 			},
+			LogBuffer: plugin_entities.NewPluginLogBuffer(p.config.PluginLogBufferSize),
 		},
 		decoder: decoder,
 	}, nil
 }
 
+// launchLocal launches the plugin if it's not running yet, progress receives the
+// install progress until the plugin is launched, it can be nil
 func (p *PluginManager) launchLocal(
 	pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
-) (plugin_entities.PluginFullDuplexLifetime, <-chan bool, <-chan error, error) {
+	progress plugin_entities.PluginInstallProgressHandler,
+) (plugin_entities.PluginLifetime, <-chan bool, <-chan error, error) {
+	report := func(stage plugin_entities.PluginInstallStage, message string) {
+		if progress != nil {
+			progress(stage, message)
+		}
+	}
+
+	report(plugin_entities.PLUGIN_INSTALL_STAGE_VERIFY, "verifying plugin package")
 	plugin, err := p.getLocalPluginRuntime(pluginUniqueIdentifier)
 	if err != nil {
 		return nil, nil, nil, err
@@ -75,11 +90,6 @@ func (p *PluginManager) launchLocal(
 
 	// check if the plugin is alrady running
 	if lifetime, ok := p.m.Load(identity.String()); ok {
-		lifetime, ok := lifetime.(plugin_entities.PluginFullDuplexLifetime)
-		if !ok {
-			return nil, nil, nil, fmt.Errorf("plugin runtime not found")
-		}
-
 		// returns a closed channel indicates the plugin is already running
 		c := make(chan bool)
 		close(c)
@@ -95,6 +105,7 @@ func (p *PluginManager) launchLocal(
 		return nil, nil, nil, fmt.Errorf("plugin decoder is not a zip decoder")
 	}
 
+	report(plugin_entities.PLUGIN_INSTALL_STAGE_EXTRACT, "extracting plugin to working directory")
 	if _, err := os.Stat(plugin.runtime.State.WorkingPath); err != nil {
 		if err := decoder.ExtractTo(plugin.runtime.State.WorkingPath); err != nil {
 			return nil, nil, nil, errors.Join(err, fmt.Errorf("extract plugin to working directory error"))
@@ -114,26 +125,13 @@ func (p *PluginManager) launchLocal(
 		return nil, nil, nil, failed(err.Error())
 	}
 
-	localPluginRuntime := local_runtime.NewLocalPluginRuntime(local_runtime.LocalPluginRuntimeConfig{
-		HttpProxy:              p.config.HttpProxy,
-		HttpsProxy:             p.config.HttpsProxy,
-		NoProxy:                p.config.NoProxy,
-		StdoutBufferSize:       p.config.PluginStdioBufferSize,
-		StdoutMaxBufferSize:    p.config.PluginStdioMaxBufferSize,
-		PythonInterpreterPath:  p.config.PythonInterpreterPath,
-		UvPath:                 p.config.UvPath,
-		PythonEnvInitTimeout:   p.config.PythonEnvInitTimeout,
-		PythonCompileExtraArgs: p.config.PythonCompileExtraArgs,
-		NodeExecutePath:        p.config.NodeExecutePath,
-		NodeEnvInitTimeout:     p.config.NodeEnvInitTimeout,
-		NodeExtraArg:           p.config.NodeExtraArg,
-	})
-	localPluginRuntime.PluginRuntime = plugin.runtime
-	localPluginRuntime.BasicChecksum = basic_runtime.BasicChecksum{
-		MediaTransport: basic_runtime.NewMediaTransport(p.mediaBucket),
-		WorkingPath:    plugin.runtime.State.WorkingPath,
-		Decoder:        plugin.decoder,
+	// the first replica installs the environment, the others reuse it
+	replicas := make([]*local_runtime.LocalPluginRuntime, p.localReplicas(&plugin.runtime.Config))
+	for i := range replicas {
+		replicas[i] = p.newLocalPluginRuntime(plugin, decoder)
 	}
+	localPluginRuntime := replicas[0]
+	localPluginRuntime.SetInstallProgressHandler(progress)
 
 	if err := localPluginRuntime.RemapAssets(
 		&localPluginRuntime.Config,
@@ -141,11 +139,15 @@ func (p *PluginManager) launchLocal(
 	); err != nil {
 		return nil, nil, nil, failed(errors.Join(err, fmt.Errorf("remap plugin assets error")).Error())
 	}
+	// the replicas share the remapped declaration and the log buffer
+	for _, replica := range replicas[1:] {
+		replica.PluginRuntime = localPluginRuntime.PluginRuntime
+	}
 
 	success = true
 
-	//p.m.Store(identity.String(), localPluginRuntime)
-	p.m.Store(string(pluginUniqueIdentifier), localPluginRuntime)
+	lifetime := local_runtime.NewLocalPluginReplicas(replicas)
+	p.m.Store(string(pluginUniqueIdentifier), lifetime)
 
 	launchedChan := make(chan bool)
 	errChan := make(chan error)
@@ -173,14 +175,96 @@ func (p *PluginManager) launchLocal(
 			<-p.maxLaunchingLock
 		})
 
-		p.fullDuplexLifecycle(localPluginRuntime, launchedChan, errChan)
+		p.fullDuplexLifecycle(lifetime, launchedChan, errChan)
+	})
+
+	return lifetime, launchedChan, errChan, nil
+}
+
+// localReplicas returns the number of processes of a plugin, the manifest
+// overrides the default of the daemon up to its maximum
+func (p *PluginManager) localReplicas(declaration *plugin_entities.PluginDeclaration) int {
+	replicas := p.config.PluginLocalReplicas
+	if declaration.Resource.Replicas > 0 {
+		replicas = declaration.Resource.Replicas
+	}
+	if p.config.PluginLocalMaxReplicas > 0 && replicas > p.config.PluginLocalMaxReplicas {
+		replicas = p.config.PluginLocalMaxReplicas
+	}
+	return max(replicas, 1)
+}
+
+func (p *PluginManager) newLocalPluginRuntime(plugin *pluginRuntimeWithDecoder, decoder *decoder.ZipPluginDecoder) *local_runtime.LocalPluginRuntime {
+	localPluginRuntime := local_runtime.NewLocalPluginRuntime(local_runtime.LocalPluginRuntimeConfig{
+		HttpProxy:              p.config.HttpProxy,
+		HttpsProxy:             p.config.HttpsProxy,
+		NoProxy:                p.config.NoProxy,
+		StdoutBufferSize:       p.config.PluginStdioBufferSize,
+		StdoutMaxBufferSize:    p.config.PluginStdioMaxBufferSize,
+		StdioProtocols:         p.stdioProtocols(),
+		SdkMinVersion:          p.config.PluginSdkMinVersion,
+		SdkMaxVersion:          p.config.PluginSdkMaxVersion,
+		PythonInterpreterPath:  p.config.PythonInterpreterPath,
+		UvPath:                 p.config.UvPath,
+		PythonEnvInitTimeout:   p.config.PythonEnvInitTimeout,
+		PythonCompileExtraArgs: p.config.PythonCompileExtraArgs,
+		PythonVenvCache:        p.pythonVenvCache,
+		PythonOfflineInstall:   p.config.PythonOfflineInstall,
+		NodeExecutePath:        p.config.NodeExecutePath,
+		NodeEnvInitTimeout:     p.config.NodeEnvInitTimeout,
+		NodeExtraArg:           p.config.NodeExtraArg,
+		Sandbox:                p.sandboxConfig().Policy(decoder.Verification(), plugin.runtime.State.WorkingPath),
 	})
+	localPluginRuntime.PluginRuntime = plugin.runtime
+	localPluginRuntime.BasicChecksum = basic_runtime.BasicChecksum{
+		MediaTransport: basic_runtime.NewMediaTransport(p.mediaBucket),
+		WorkingPath:    plugin.runtime.State.WorkingPath,
+		Decoder:        plugin.decoder,
+	}
+	return localPluginRuntime
+}
+
+// stdioProtocols returns the configured protocols offered to local plugins
+func (p *PluginManager) stdioProtocols() []plugin_entities.PluginStdioProtocol {
+	protocols := []plugin_entities.PluginStdioProtocol{}
+	for _, name := range p.config.PluginStdioProtocols {
+		protocol := plugin_entities.PluginStdioProtocol(strings.TrimSpace(name))
+		switch protocol {
+		case plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES,
+			plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_JSON,
+			plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR:
+			protocols = append(protocols, protocol)
+		default:
+			utils.Warn("unknown stdio protocol %s is ignored", name)
+		}
+	}
+	return protocols
+}
 
-	return localPluginRuntime, launchedChan, errChan, nil
+func (p *PluginManager) restartPolicy() *RestartPolicy {
+	return &RestartPolicy{
+		InitialInterval:    time.Duration(p.config.PluginRestartBackoffInitial) * time.Millisecond,
+		MaxInterval:        time.Duration(p.config.PluginRestartBackoffMax) * time.Millisecond,
+		CrashLoopThreshold: p.config.PluginCrashLoopThreshold,
+		CrashLoopWindow:    time.Duration(p.config.PluginCrashLoopWindow) * time.Second,
+	}
+}
+
+func (p *PluginManager) sandboxConfig() *sandbox.Config {
+	return &sandbox.Config{
+		Enabled:      p.config.PluginSandboxEnabled,
+		Partner:      sandbox.Level(p.config.PluginSandboxPartnerLevel),
+		Community:    sandbox.Level(p.config.PluginSandboxCommunityLevel),
+		Unverified:   sandbox.Level(p.config.PluginSandboxUnverifiedLevel),
+		MaskedPaths:  p.config.PluginSandboxMaskedPaths,
+		EnvAllowList: p.config.PluginSandboxEnvAllowList,
+		HttpProxy:    p.config.HttpProxy,
+		HttpsProxy:   p.config.HttpsProxy,
+	}
 }
 
 func (p *PluginManager) fullDuplexLifecycle(
-	r plugin_entities.PluginFullDuplexLifetime,
+	r *local_runtime.LocalPluginReplicas,
 	launchedChan chan bool,
 	errChan chan error,
 ) {
@@ -192,5 +276,62 @@ func (p *PluginManager) fullDuplexLifecycle(
 		}
 	}
 
-	FullDuplex(r, launchedChan, errChan)
+	// the working path and the stop hooks are shared, they are handled once all replicas exited
+	defer r.Cleanup()
+	defer r.TriggerStop()
+
+	replicas := r.Replicas()
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+
+	// the first replica initializes the environment and reports the launch
+	firstLaunchedChan := make(chan bool)
+	firstErrChan := make(chan error, 1)
+	utils.Submit(map[string]string{
+		"module":   "plugin_manager",
+		"function": "FullDuplex",
+	}, func() {
+		defer wg.Done()
+		FullDuplex(&localReplica{replicas[0]}, firstLaunchedChan, firstErrChan, p.restartPolicy())
+	})
+
+	<-firstLaunchedChan
+	if err, ok := <-firstErrChan; ok && err != nil {
+		// the other replicas never start
+		r.Stop()
+		r.SetLaunched()
+		errChan <- err
+		close(errChan)
+		close(launchedChan)
+		wg.Wait()
+		return
+	}
+	r.SetLaunched()
+	close(errChan)
+	close(launchedChan)
+
+	for _, replica := range replicas[1:] {
+		if r.Stopped() {
+			break
+		}
+		wg.Add(1)
+		utils.Submit(map[string]string{
+			"module":   "plugin_manager",
+			"function": "FullDuplex",
+		}, func() {
+			defer wg.Done()
+			FullDuplex(&localReplica{replica}, nil, nil, p.restartPolicy())
+		})
+	}
+
+	wg.Wait()
+}
+
+// localReplica restarts a single process of a plugin independently of the others
+type localReplica struct {
+	*local_runtime.LocalPluginRuntime
 }
+
+func (r *localReplica) Cleanup() {}
+
+func (r *localReplica) TriggerStop() {}
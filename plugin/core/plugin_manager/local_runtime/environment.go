@@ -1,18 +1,24 @@
 package local_runtime
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/jjgagacy/workflow-app/plugin/core/constants"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
 	"github.com/jjgagacy/workflow-app/plugin/utils"
 )
 
@@ -22,11 +28,34 @@ func (r *LocalPluginRuntime) InitNode() error {
 	return nil
 }
 
+// pythonVenvMeta is stored as .venv/plugin.json once the virtual environment is ready
+type pythonVenvMeta struct {
+	Timestamp        int64  `json:"timestamp"`
+	RequirementsHash string `json:"requirements_hash"`
+}
+
+// requirementsHash returns the sha256 of requirements.txt in the working path
+func requirementsHash(workingPath string) (string, error) {
+	content, err := os.ReadFile(path.Join(workingPath, "requirements.txt"))
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 func (r *LocalPluginRuntime) InitPython() error {
+	// try to find requirements.txt
+	hash, err := requirementsHash(r.State.WorkingPath)
+	if err != nil {
+		return fmt.Errorf("failed to find requirements.txt: %s", err)
+	}
+
 	// check if virtual environment exists
 	if _, err := os.Stat(path.Join(r.State.WorkingPath, ".venv")); err == nil {
-		// check if venv is valid
-		if _, err := os.Stat(path.Join(r.State.WorkingPath, ".venv/plugin.json")); err != nil {
+		// the venv is reused only if it was built from the same requirements
+		meta, err := readPythonVenvMeta(r.State.WorkingPath)
+		if err != nil || meta.RequirementsHash != hash {
 			// remove the venv and rebuild it
 			os.RemoveAll(path.Join(r.State.WorkingPath, ".venv"))
 		} else {
@@ -34,10 +63,33 @@ func (r *LocalPluginRuntime) InitPython() error {
 			if err != nil {
 				return fmt.Errorf("failed to find python: %s", err)
 			}
-			r.pythonInterpreterPath = pythonPath
+			if _, err := os.Stat(pythonPath); err == nil {
+				r.pythonInterpreterPath = pythonPath
+				utils.Info("requirements of %s unchanged, reuse the virtual environment", r.Config.Identity())
+				r.reportInstallProgress(plugin_entities.PLUGIN_INSTALL_STAGE_VENV, "requirements unchanged, reuse the virtual environment")
+				return nil
+			}
+			os.RemoveAll(path.Join(r.State.WorkingPath, ".venv"))
 		}
 	}
 
+	// a plugin with the same requirements may have built the virtual environment already
+	if restored, err := r.restorePythonVenv(hash); err != nil {
+		utils.Warn("failed to restore the virtual environment of %s from cache: %s", r.Config.Identity(), err.Error())
+	} else if restored {
+		return nil
+	}
+
+	// wheels bundled by the packager are preferred over the index
+	wheelsPath := path.Join(r.State.WorkingPath, plugin_packager.WHEELS_DIR)
+	hasWheels := false
+	if info, err := os.Stat(wheelsPath); err == nil && info.IsDir() {
+		hasWheels = true
+	}
+	if r.pythonOfflineInstall && !hasWheels {
+		return fmt.Errorf("plugin has no bundled wheels, it can't be installed offline")
+	}
+
 	success := false
 
 	var uvPath string
@@ -53,7 +105,13 @@ func (r *LocalPluginRuntime) InitPython() error {
 		uvPath = strings.TrimSpace(string(output))
 	}
 
-	cmd := exec.Command(uvPath, "venv", ".venv", "--python", "3.12")
+	r.reportInstallProgress(plugin_entities.PLUGIN_INSTALL_STAGE_VENV, "creating virtual environment")
+	venvArgs := []string{"venv", ".venv", "--python", constants.PythonVersion}
+	if r.pythonOfflineInstall {
+		// uv must not try to download the interpreter
+		venvArgs = append(venvArgs, "--offline")
+	}
+	cmd := exec.CommandContext(r.stopCtx, uvPath, venvArgs...)
 	cmd.Dir = r.State.WorkingPath
 	b := bytes.NewBuffer(nil)
 	cmd.Stdout = b
@@ -66,9 +124,7 @@ func (r *LocalPluginRuntime) InitPython() error {
 		if !success {
 			os.RemoveAll(path.Join(r.State.WorkingPath, ".venv"))
 		} else {
-			pluginJsonPath := path.Join(r.State.WorkingPath, ".venv/plugin.json")
-			os.MkdirAll(path.Dir(pluginJsonPath), 0755)
-			os.WriteFile(pluginJsonPath, []byte(`{"timestamp":`+strconv.FormatInt(time.Now().Unix(), 10)+`}`), 0644)
+			writePythonVenvMeta(r.State.WorkingPath, hash)
 		}
 	}()
 
@@ -83,22 +139,22 @@ func (r *LocalPluginRuntime) InitPython() error {
 
 	r.pythonInterpreterPath = pythonPath
 
-	// try to find requirements.txt
-	requirementsPath := path.Join(r.State.WorkingPath, "requiredments.txt")
-	if _, err := os.Stat(requirementsPath); err != nil {
-		return fmt.Errorf("failed to find requirements.txt: %s", err)
-	}
-
 	// install dependencies
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	ctx, cancel := context.WithTimeout(r.stopCtx, 10*time.Minute)
 	defer cancel()
 
 	args := []string{"install"}
 
-	if r.pipMirrorUrl != "" {
+	if r.pythonOfflineInstall {
+		args = append(args, "--offline", "--no-index")
+	} else if r.pipMirrorUrl != "" {
 		args = append(args, "-i", r.pipMirrorUrl)
 	}
 
+	if hasWheels {
+		args = append(args, "--find-links", plugin_packager.WHEELS_DIR)
+	}
+
 	args = append(args, "-r", "requirements.txt")
 
 	if r.pipVerbose {
@@ -114,6 +170,14 @@ func (r *LocalPluginRuntime) InitPython() error {
 	virtualEnvPath := path.Join(r.State.WorkingPath, ".venv")
 	cmd = exec.CommandContext(ctx, uvPath, args...)
 	cmd.Env = append(cmd.Env, "VIRTUAL_ENV="+virtualEnvPath, "PATH="+os.Getenv("PATH"))
+	if r.pythonVenvCache != nil {
+		// wheels are shared by all plugins, uv hardlinks them into the venv
+		cmd.Env = append(cmd.Env, "UV_CACHE_DIR="+r.pythonVenvCache.UvCacheDir())
+		if r.sandbox != nil {
+			// the sandboxed plugin can write its venv, it must not share files with the cache
+			cmd.Env = append(cmd.Env, "UV_LINK_MODE=copy")
+		}
+	}
 	if r.HttpProxy != "" {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("HTTP_PROXY=%s", r.HttpProxy))
 	}
@@ -138,6 +202,8 @@ func (r *LocalPluginRuntime) InitPython() error {
 	}
 	defer stderr.Close()
 
+	r.reportInstallProgress(plugin_entities.PLUGIN_INSTALL_STAGE_DEPENDENCIES, "installing dependencies")
+
 	// start command
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start command: %s", err)
@@ -159,14 +225,12 @@ func (r *LocalPluginRuntime) InitPython() error {
 		"function": "InitPython",
 	}, func() {
 		defer wg.Done()
-		// read stdout
-		buf := make([]byte, 1024)
-		for {
-			n, err := stdout.Read(buf)
-			if err != nil {
-				break
-			}
-			utils.Info("installing %s - %s", r.Config.Identity(), string(buf[:n]))
+		// read stdout line by line, every line is reported as progress
+		scanner := newOutputScanner(stdout)
+		for scanner.Scan() {
+			line := scanner.Text()
+			utils.Info("installing %s - %s", r.Config.Identity(), line)
+			r.reportInstallProgress(plugin_entities.PLUGIN_INSTALL_STAGE_DEPENDENCIES, line)
 			lastActiveAt = time.Now()
 		}
 	})
@@ -176,22 +240,14 @@ func (r *LocalPluginRuntime) InitPython() error {
 		"function": "InitPython",
 	}, func() {
 		defer wg.Done()
-		// read stderr
-		buf := make([]byte, 1024)
-		for {
-			n, err := stderr.Read(buf)
-			if err != nil && err != os.ErrClosed {
-				lastActiveAt = time.Now()
-				errMsg.WriteString(string(buf[:n]))
-				break
-			} else if err == os.ErrClosed {
-				break
-			}
-
-			if n > 0 {
-				errMsg.WriteString(string(buf[:n]))
-				lastActiveAt = time.Now()
-			}
+		// read stderr, uv writes its progress here as well
+		scanner := newOutputScanner(stderr)
+		for scanner.Scan() {
+			line := scanner.Text()
+			errMsg.WriteString(line)
+			errMsg.WriteString("\n")
+			r.reportInstallProgress(plugin_entities.PLUGIN_INSTALL_STAGE_DEPENDENCIES, line)
+			lastActiveAt = time.Now()
 		}
 	})
 
@@ -221,13 +277,82 @@ func (r *LocalPluginRuntime) InitPython() error {
 		return fmt.Errorf("failed to install dependencies: %s, output: %s", err, errMsg.String())
 	}
 
+	if err := r.compilePython(ctx, pythonPath); err != nil {
+		return err
+	}
+
+	if r.pythonVenvCache != nil {
+		if err := r.pythonVenvCache.Store(r.pythonVenvCache.Key(hash, constants.PythonVersion), virtualEnvPath, r.sandbox != nil); err != nil {
+			utils.Warn("failed to cache the virtual environment of %s: %s", r.Config.Identity(), err.Error())
+		} else {
+			r.gcPythonVenvCache(uvPath)
+		}
+	}
+
+	utils.Info("pre-loaded the plugin %s", r.Config.Identity())
+
+	success = true
+
+	return nil
+}
+
+// restorePythonVenv restores the virtual environment from the shared cache, it
+// returns false if the requirements were never built before
+func (r *LocalPluginRuntime) restorePythonVenv(hash string) (bool, error) {
+	if r.pythonVenvCache == nil {
+		return false, nil
+	}
+
+	virtualEnvPath := path.Join(r.State.WorkingPath, ".venv")
+	restored, err := r.pythonVenvCache.Restore(r.pythonVenvCache.Key(hash, constants.PythonVersion), virtualEnvPath, r.sandbox != nil)
+	if err != nil || !restored {
+		return false, err
+	}
+
+	pythonPath, err := filepath.Abs(path.Join(virtualEnvPath, "bin/python"))
+	if err == nil {
+		_, err = os.Stat(pythonPath)
+	}
+	if err != nil {
+		os.RemoveAll(virtualEnvPath)
+		return false, fmt.Errorf("failed to find python: %s", err)
+	}
+
+	r.pythonInterpreterPath = pythonPath
+	utils.Info("restored the virtual environment of %s from cache", r.Config.Identity())
+	r.reportInstallProgress(plugin_entities.PLUGIN_INSTALL_STAGE_VENV, "requirements cached, reuse the shared virtual environment")
+
+	ctx, cancel := context.WithTimeout(r.stopCtx, 10*time.Minute)
+	defer cancel()
+	if err := r.compilePython(ctx, pythonPath); err != nil {
+		os.RemoveAll(virtualEnvPath)
+		return false, err
+	}
+
+	writePythonVenvMeta(r.State.WorkingPath, hash)
+	return true, nil
+}
+
+func (r *LocalPluginRuntime) gcPythonVenvCache(uvPath string) {
+	utils.Submit(map[string]string{
+		"module":   "plugin_manager",
+		"function": "gcPythonVenvCache",
+	}, func() {
+		if err := r.pythonVenvCache.GC(uvPath); err != nil {
+			utils.Warn("failed to gc the virtual environment cache: %s", err.Error())
+		}
+	})
+}
+
+// compilePython pre-compiles the plugin to avoid costly compilation on first invocation
+func (r *LocalPluginRuntime) compilePython(ctx context.Context, pythonPath string) error {
 	compileArgs := []string{"-m", "compileall"}
 	if r.pythonCompileExtraArgs != "" {
 		compileArgs = append(compileArgs, strings.Split(r.pythonCompileExtraArgs, " ")...)
 	}
 	compileArgs = append(compileArgs, ".")
 
-	// pre-compile the plugin to avoid costly compilation on first invocation
+	r.reportInstallProgress(plugin_entities.PLUGIN_INSTALL_STAGE_COMPILE, "pre-compiling the plugin")
 	compileCmd := exec.CommandContext(ctx, pythonPath, compileArgs...)
 	compileCmd.Dir = r.State.WorkingPath
 
@@ -305,9 +430,34 @@ func (r *LocalPluginRuntime) InitPython() error {
 		utils.Warn("failed to pre-compile the plugin: %s", cErrMsg.String())
 	}
 
-	utils.Info("pre-loaded the plugin %s", r.Config.Identity())
+	return nil
+}
 
-	success = true
+// newOutputScanner scans the output of a command line by line, long lines
+// such as resolver errors are allowed up to 1MB
+func newOutputScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	return scanner
+}
 
-	return nil
+func writePythonVenvMeta(workingPath string, hash string) {
+	pluginJsonPath := path.Join(workingPath, ".venv/plugin.json")
+	os.MkdirAll(path.Dir(pluginJsonPath), 0755)
+	os.WriteFile(pluginJsonPath, utils.MarshalJsonBytes(pythonVenvMeta{
+		Timestamp:        time.Now().Unix(),
+		RequirementsHash: hash,
+	}), 0644)
+}
+
+func readPythonVenvMeta(workingPath string) (*pythonVenvMeta, error) {
+	content, err := os.ReadFile(path.Join(workingPath, ".venv/plugin.json"))
+	if err != nil {
+		return nil, err
+	}
+	meta, err := utils.UnmarshalJsonBytes[pythonVenvMeta](content)
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
 }
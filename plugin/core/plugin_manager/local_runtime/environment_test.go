@@ -0,0 +1,95 @@
+package local_runtime
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitPythonReuseVenv(t *testing.T) {
+	tests := []struct {
+		name         string
+		requirements string
+		venvHash     func(hash string) string
+		wantReuse    bool
+		wantProgress []string
+	}{
+		{
+			name:         "依赖未变化，复用虚拟环境",
+			requirements: "requests==2.31.0\n",
+			venvHash:     func(hash string) string { return hash },
+			wantReuse:    true,
+			wantProgress: []string{"requirements unchanged, reuse the virtual environment"},
+		},
+		{
+			name:         "依赖变化，重建虚拟环境",
+			requirements: "requests==2.32.0\n",
+			venvHash:     func(hash string) string { return "outdated" },
+			wantReuse:    false,
+			wantProgress: []string{"creating virtual environment"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workingPath := t.TempDir()
+			require.NoError(t, os.WriteFile(path.Join(workingPath, "requirements.txt"), []byte(tt.requirements), 0644))
+
+			hash, err := requirementsHash(workingPath)
+			require.NoError(t, err)
+
+			require.NoError(t, os.MkdirAll(path.Join(workingPath, ".venv/bin"), 0755))
+			require.NoError(t, os.WriteFile(path.Join(workingPath, ".venv/bin/python"), []byte{}, 0755))
+			require.NoError(t, os.WriteFile(path.Join(workingPath, ".venv/plugin.json"), utils.MarshalJsonBytes(pythonVenvMeta{
+				RequirementsHash: tt.venvHash(hash),
+			}), 0644))
+
+			// uv is not available, rebuilding the venv fails
+			r := NewLocalPluginRuntime(LocalPluginRuntimeConfig{
+				UvPath: path.Join(workingPath, "not-exists-uv"),
+			})
+			r.State.WorkingPath = workingPath
+
+			progress := []string{}
+			r.SetInstallProgressHandler(func(stage plugin_entities.PluginInstallStage, message string) {
+				assert.Equal(t, plugin_entities.PLUGIN_INSTALL_STAGE_VENV, stage)
+				progress = append(progress, message)
+			})
+
+			err = r.InitPython()
+			assert.Equal(t, tt.wantProgress, progress)
+			if tt.wantReuse {
+				assert.NoError(t, err)
+				assert.Equal(t, path.Join(workingPath, ".venv/bin/python"), r.pythonInterpreterPath)
+			} else {
+				assert.Error(t, err)
+				_, statErr := os.Stat(path.Join(workingPath, ".venv/plugin.json"))
+				assert.True(t, os.IsNotExist(statErr))
+			}
+		})
+	}
+}
+
+func TestInitPythonRequirementsNotFound(t *testing.T) {
+	r := NewLocalPluginRuntime(LocalPluginRuntimeConfig{})
+	r.State.WorkingPath = t.TempDir()
+
+	err := r.InitPython()
+	assert.ErrorContains(t, err, "failed to find requirements.txt")
+}
+
+func TestInitPythonOfflineWithoutWheels(t *testing.T) {
+	r := NewLocalPluginRuntime(LocalPluginRuntimeConfig{PythonOfflineInstall: true})
+	r.State.WorkingPath = t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(r.State.WorkingPath, "requirements.txt"), []byte("requests==2.31.0\n"), 0644))
+
+	err := r.InitPython()
+	assert.ErrorContains(t, err, "plugin has no bundled wheels")
+	_, err = os.Stat(path.Join(r.State.WorkingPath, ".venv"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,72 @@
+package local_runtime
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/manifest_entites"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+)
+
+// sdkVersionRange is the range of plugin sdk versions accepted by the daemon,
+// an empty bound is not checked
+type sdkVersionRange struct {
+	min manifest_entites.Version
+	max manifest_entites.Version
+}
+
+// validateHandshake checks the sdk announced by the plugin against the minimum
+// version of its manifest and the range supported by the daemon, handshake is nil
+// if the plugin didn't send one
+func (r *LocalPluginRuntime) validateHandshake(handshake *plugin_entities.PluginHandshake) error {
+	var required manifest_entites.Version
+	if r.Config.Meta.MinimumVersion != nil {
+		required = manifest_entites.Version(*r.Config.Meta.MinimumVersion)
+	}
+
+	if handshake == nil || handshake.SdkVersion == "" {
+		// plugins built before the handshake only run if nothing is required
+		if r.sdkVersions.min != "" {
+			return fmt.Errorf("plugin sdk version is unknown, the daemon requires %s or later", r.sdkVersions.min)
+		}
+		if required != "" {
+			return fmt.Errorf("plugin sdk version is unknown, the plugin requires %s or later", required)
+		}
+		return nil
+	}
+
+	version := manifest_entites.Version(handshake.SdkVersion)
+	if required != "" {
+		if result, err := version.Compare(required); err != nil {
+			return fmt.Errorf("plugin sdk %s is not supported: %s", version, err.Error())
+		} else if result < 0 {
+			return fmt.Errorf("plugin sdk %s is not supported, the plugin requires %s or later", version, required)
+		}
+	}
+	if r.sdkVersions.min != "" {
+		if result, err := version.Compare(r.sdkVersions.min); err != nil {
+			return fmt.Errorf("plugin sdk %s is not supported: %s", version, err.Error())
+		} else if result < 0 {
+			return fmt.Errorf("plugin sdk %s is not supported, the daemon requires %s or later", version, r.sdkVersions.min)
+		}
+	}
+	if r.sdkVersions.max != "" {
+		if result, err := version.Compare(r.sdkVersions.max); err != nil {
+			return fmt.Errorf("plugin sdk %s is not supported: %s", version, err.Error())
+		} else if result > 0 {
+			return fmt.Errorf("plugin sdk %s is not supported, the daemon supports up to %s", version, r.sdkVersions.max)
+		}
+	}
+	return nil
+}
+
+// HasCapability reports whether the running plugin supports the capability, the
+// capabilities negotiated in the handshake take precedence over the manifest
+func (r *LocalPluginRuntime) HasCapability(capability plugin_entities.PluginCapability) bool {
+	if r.stdioHolder != nil {
+		if capabilities, ok := r.stdioHolder.Capabilities(); ok {
+			return slices.Contains(capabilities, capability)
+		}
+	}
+	return r.Config.Meta.HasCapability(capability)
+}
@@ -0,0 +1,76 @@
+package local_runtime
+
+import (
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalPluginRuntimeValidateHandshake(t *testing.T) {
+	minimumVersion := "0.2.0"
+
+	tests := []struct {
+		name     string
+		required *string
+		min      string
+		max      string
+		// nil 表示插件没有握手
+		handshake *plugin_entities.PluginHandshake
+		// 拒绝原因包含的内容，空表示接受
+		refused string
+	}{
+		{"没有握手也没有要求", nil, "", "", nil, ""},
+		{"没有握手但守护进程要求最低版本", nil, "0.1.0", "", nil, "the daemon requires 0.1.0 or later"},
+		{"没有握手但插件要求最低版本", &minimumVersion, "", "", nil, "the plugin requires 0.2.0 or later"},
+		{"握手没有版本", nil, "0.1.0", "", &plugin_entities.PluginHandshake{}, "version is unknown"},
+		{"版本在范围内", &minimumVersion, "0.1.0", "1.0.0", &plugin_entities.PluginHandshake{SdkVersion: "0.3.1"}, ""},
+		{"等于边界", &minimumVersion, "0.2.0", "0.2.0", &plugin_entities.PluginHandshake{SdkVersion: "0.2.0"}, ""},
+		{"低于插件要求", &minimumVersion, "", "", &plugin_entities.PluginHandshake{SdkVersion: "0.1.9"}, "the plugin requires 0.2.0 or later"},
+		{"预发布版本低于正式版本", &minimumVersion, "", "", &plugin_entities.PluginHandshake{SdkVersion: "0.2.0-beta"}, "the plugin requires 0.2.0 or later"},
+		{"低于守护进程最低版本", nil, "0.10.0", "", &plugin_entities.PluginHandshake{SdkVersion: "0.9.99"}, "the daemon requires 0.10.0 or later"},
+		{"高于守护进程最高版本", nil, "", "1.0.0", &plugin_entities.PluginHandshake{SdkVersion: "1.0.1"}, "the daemon supports up to 1.0.0"},
+		{"无效版本", nil, "0.1.0", "", &plugin_entities.PluginHandshake{SdkVersion: "latest"}, "invalid version: latest"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewLocalPluginRuntime(LocalPluginRuntimeConfig{
+				SdkMinVersion: tt.min,
+				SdkMaxVersion: tt.max,
+			})
+			r.Config.Meta.MinimumVersion = tt.required
+
+			err := r.validateHandshake(tt.handshake)
+			if tt.refused == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.refused)
+		})
+	}
+}
+
+func TestLocalPluginRuntimeHasCapability(t *testing.T) {
+	r := NewLocalPluginRuntime(LocalPluginRuntimeConfig{})
+	r.Config.Meta.Capabilities = []plugin_entities.PluginCapability{plugin_entities.PLUGIN_CAPABILITY_CANCEL}
+
+	// 没有协商时使用 manifest 中声明的能力
+	assert.True(t, r.HasCapability(plugin_entities.PLUGIN_CAPABILITY_CANCEL))
+	assert.True(t, plugin_entities.HasCapability(r, plugin_entities.PLUGIN_CAPABILITY_CANCEL))
+	assert.False(t, r.HasCapability(plugin_entities.PLUGIN_CAPABILITY_STREAMING_ENDPOINT))
+
+	// 握手协商的能力优先于 manifest
+	r.stdioHolder = newStdioHolder("test-plugin", nopWriteCloser{}, nil, nil, nil)
+	r.stdioHolder.acceptHandshake(&plugin_entities.PluginHandshake{
+		Protocol:     plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES,
+		Capabilities: []plugin_entities.PluginCapability{plugin_entities.PLUGIN_CAPABILITY_STREAMING_ENDPOINT},
+	})
+	assert.False(t, r.HasCapability(plugin_entities.PLUGIN_CAPABILITY_CANCEL))
+	assert.True(t, r.HasCapability(plugin_entities.PLUGIN_CAPABILITY_STREAMING_ENDPOINT))
+
+	replicas := NewLocalPluginReplicas([]*LocalPluginRuntime{r})
+	assert.True(t, plugin_entities.HasCapability(replicas, plugin_entities.PLUGIN_CAPABILITY_STREAMING_ENDPOINT))
+}
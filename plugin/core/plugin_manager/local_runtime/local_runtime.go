@@ -1,13 +1,17 @@
 package local_runtime
 
 import (
+	"context"
 	"fmt"
 	"os/exec"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jjgagacy/workflow-app/plugin/core/constants"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/basic_runtime"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/sandbox"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/manifest_entites"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
 )
 
@@ -31,6 +35,8 @@ type LocalPluginRuntime struct {
 
 	defaultPythonInterpreterPath string
 	uvPath                       string
+	pythonVenvCache              *PythonVenvCache
+	pythonOfflineInstall         bool
 
 	pipMirrorUrl    string
 	pipPreferBinary bool
@@ -42,15 +48,47 @@ type LocalPluginRuntime struct {
 	waitStopChan  []chan bool
 
 	stdoutBufferSize    int
+	stdioProtocols      []plugin_entities.PluginStdioProtocol
 	stdoutMaxBufferSize int
+	sdkVersions         sdkVersionRange
 
 	isNotFirstStart bool
 	stdioHolder     *stdioHolder
+	// set while the process is up, the stdio holder outlives a crashed process
+	running atomic.Bool
+
+	installProgress plugin_entities.PluginInstallProgressHandler
+
+	// nil if the plugin runs without a sandbox
+	sandbox *sandbox.Policy
+
+	// cancelled once the runtime is stopped, it interrupts the environment initialization
+	stopCtx    context.Context
+	stopCancel context.CancelFunc
+
+	// receives a value when the crash loop is reset
+	resetChan chan bool
 
 	cmd *exec.Cmd
+
+	// the running process sampled for resource usage, 0 if not started
+	usageLock    sync.Mutex
+	pid          int
+	lastCPUTicks uint64
+	lastSampleAt time.Time
+}
+
+// Running reports whether the process of the plugin is started and has not exited,
+// it's false while the plugin is restarting or crash looping
+func (r *LocalPluginRuntime) Running() bool {
+	return r.running.Load()
 }
 
+// RuntimeState returns a copy of the state, the resource usage is replaced by the
+// sampler so it's read under the same lock
 func (r *LocalPluginRuntime) RuntimeState() plugin_entities.PluginRuntimeState {
+	r.usageLock.Lock()
+	defer r.usageLock.Unlock()
 	return r.State
 }
 
@@ -75,9 +113,21 @@ func (r *LocalPluginRuntime) Init() error {
 	if err != nil {
 		return err
 	}
+	r.reportInstallProgress(plugin_entities.PLUGIN_INSTALL_STAGE_LAUNCH, "environment is ready, launching the plugin")
 	return nil
 }
 
+// SetInstallProgressHandler sets the handler receiving the progress of Init, nil disables it
+func (r *LocalPluginRuntime) SetInstallProgressHandler(handler plugin_entities.PluginInstallProgressHandler) {
+	r.installProgress = handler
+}
+
+func (r *LocalPluginRuntime) reportInstallProgress(stage plugin_entities.PluginInstallStage, message string) {
+	if r.installProgress != nil {
+		r.installProgress(stage, message)
+	}
+}
+
 func (r *LocalPluginRuntime) Identity() (plugin_entities.PluginUniqueIdentifier, error) {
 	checksum, err := r.Checksum()
 	if err != nil {
@@ -116,30 +166,53 @@ type LocalPluginRuntimeConfig struct {
 	NoProxy             string
 	StdoutBufferSize    int
 	StdoutMaxBufferSize int
+	// stdio protocols offered to the plugin, json lines only if empty
+	StdioProtocols []plugin_entities.PluginStdioProtocol
+	// plugin sdk versions accepted in the handshake, empty means unbounded
+	SdkMinVersion string
+	SdkMaxVersion string
 
 	PythonInterpreterPath  string
 	UvPath                 string
 	PythonEnvInitTimeout   int
 	PythonCompileExtraArgs string
+	// nil disables the shared virtual environment cache
+	PythonVenvCache *PythonVenvCache
+	// dependencies are installed from the bundled wheels only
+	PythonOfflineInstall bool
 
 	NodeExecutePath    string
 	NodeEnvInitTimeout int
 	NodeExtraArg       string
+
+	Sandbox *sandbox.Policy
 }
 
 func NewLocalPluginRuntime(config LocalPluginRuntimeConfig) *LocalPluginRuntime {
+	stopCtx, stopCancel := context.WithCancel(context.Background())
 	return &LocalPluginRuntime{
+		stopCtx:                      stopCtx,
+		stopCancel:                   stopCancel,
+		resetChan:                    make(chan bool, 1),
 		defaultPythonInterpreterPath: config.PythonInterpreterPath,
 		uvPath:                       config.UvPath,
 		pythonEnvInitTimeout:         config.PythonEnvInitTimeout,
 		pythonCompileExtraArgs:       config.PythonCompileExtraArgs,
+		pythonVenvCache:              config.PythonVenvCache,
+		pythonOfflineInstall:         config.PythonOfflineInstall,
 		HttpProxy:                    config.HttpProxy,
 		HttpsProxy:                   config.HttpsProxy,
 		NoProxy:                      config.NoProxy,
 		stdoutBufferSize:             config.StdoutBufferSize,
 		stdoutMaxBufferSize:          config.StdoutMaxBufferSize,
-		nodeExecutePath:              config.NodeExecutePath,
-		nodeEnvInitTimeout:           config.NodeEnvInitTimeout,
-		nodeExtraArg:                 config.NodeExtraArg,
+		stdioProtocols:               config.StdioProtocols,
+		sdkVersions: sdkVersionRange{
+			min: manifest_entites.Version(config.SdkMinVersion),
+			max: manifest_entites.Version(config.SdkMaxVersion),
+		},
+		nodeExecutePath:    config.NodeExecutePath,
+		nodeEnvInitTimeout: config.NodeEnvInitTimeout,
+		nodeExtraArg:       config.NodeExtraArg,
+		sandbox:            config.Sandbox,
 	}
 }
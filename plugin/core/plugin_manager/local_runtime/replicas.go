@@ -0,0 +1,307 @@
+package local_runtime
+
+import (
+	"sync"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/access_types"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+)
+
+// LocalPluginReplicas runs several processes of the same plugin, new sessions are
+// balanced to the process with the least in-flight sessions and stay pinned to it
+// until they are closed. The replicas share the working path and the log buffer
+type LocalPluginReplicas struct {
+	replicas []*LocalPluginRuntime
+
+	lock sync.Mutex
+	// index of the replica serving each session
+	sessions map[string]int
+	// number of sessions pinned to each replica
+	inFlight []int
+	// the last time a session was dispatched to the plugin
+	lastUsedAt time.Time
+
+	// closed once the first replica is launched or failed to launch
+	launched     chan bool
+	launchedOnce sync.Once
+
+	// the working path is kept for the next launch if the plugin is stopped for idleness
+	keepWorkingPath bool
+
+	onStop []func()
+}
+
+func NewLocalPluginReplicas(replicas []*LocalPluginRuntime) *LocalPluginReplicas {
+	return &LocalPluginReplicas{
+		replicas:   replicas,
+		sessions:   map[string]int{},
+		inFlight:   make([]int, len(replicas)),
+		lastUsedAt: time.Now(),
+		launched:   make(chan bool),
+	}
+}
+
+// SetLaunched marks the plugin as launched, the idle time starts from now
+func (s *LocalPluginReplicas) SetLaunched() {
+	s.launchedOnce.Do(func() {
+		s.lock.Lock()
+		s.lastUsedAt = time.Now()
+		s.lock.Unlock()
+		close(s.launched)
+	})
+}
+
+// WaitLaunched returns a channel which is closed once the plugin is launched or
+// failed to launch, check Stopped after it's closed
+func (s *LocalPluginReplicas) WaitLaunched() <-chan bool {
+	return s.launched
+}
+
+// StopIfIdle stops all replicas if the plugin is launched and has no session in
+// flight for timeout. The working path is kept, the plugin is launched from it on
+// the next request
+func (s *LocalPluginReplicas) StopIfIdle(timeout time.Duration) bool {
+	select {
+	case <-s.launched:
+	default:
+		return false
+	}
+
+	s.lock.Lock()
+	for _, n := range s.inFlight {
+		if n > 0 {
+			s.lock.Unlock()
+			return false
+		}
+	}
+	if time.Since(s.lastUsedAt) < timeout {
+		s.lock.Unlock()
+		return false
+	}
+	s.keepWorkingPath = true
+	s.lock.Unlock()
+
+	s.Stop()
+	return true
+}
+
+// Replicas returns the runtimes of all replicas, the first one prepares the environment
+func (s *LocalPluginReplicas) Replicas() []*LocalPluginRuntime {
+	return s.replicas
+}
+
+// InFlight returns the number of sessions pinned to each replica
+func (s *LocalPluginReplicas) InFlight() []int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]int{}, s.inFlight...)
+}
+
+// pick returns the running replica with the least in-flight sessions, the lock must be held
+func (s *LocalPluginReplicas) pick() int {
+	best := -1
+	for i, r := range s.replicas {
+		// crashed replicas keep their stdio holder while restarting
+		if !r.Running() || r.Stopped() {
+			continue
+		}
+		if best == -1 || s.inFlight[i] < s.inFlight[best] {
+			best = i
+		}
+	}
+	if best == -1 {
+		// none is running, the first one reports it
+		return 0
+	}
+	return best
+}
+
+func (s *LocalPluginReplicas) release(sessionId string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if i, ok := s.sessions[sessionId]; ok {
+		delete(s.sessions, sessionId)
+		s.inFlight[i]--
+	}
+}
+
+func (s *LocalPluginReplicas) Listen(sessionId string) (*entities.Broadcast[plugin_entities.SessionMessage], error) {
+	s.lock.Lock()
+	i, ok := s.sessions[sessionId]
+	if !ok {
+		i = s.pick()
+		s.sessions[sessionId] = i
+		s.inFlight[i]++
+	}
+	s.lastUsedAt = time.Now()
+	s.lock.Unlock()
+
+	replicaListener, err := s.replicas[i].Listen(sessionId)
+	if err != nil {
+		s.release(sessionId)
+		return nil, err
+	}
+
+	listener := entities.NewBroadcast[plugin_entities.SessionMessage]()
+	replicaListener.Listen(listener.Send)
+	once := sync.Once{}
+	listener.OnClose(func() {
+		once.Do(func() {
+			replicaListener.Close()
+			s.release(sessionId)
+		})
+	})
+	return listener, nil
+}
+
+// Write sends data to the replica the session is pinned to, sessions which are
+// not listened to are not pinned
+func (s *LocalPluginReplicas) Write(sessionId string, action access_types.PluginAccessAction, data []byte) {
+	s.lock.Lock()
+	i, ok := s.sessions[sessionId]
+	if !ok {
+		i = s.pick()
+	}
+	s.lastUsedAt = time.Now()
+	s.lock.Unlock()
+
+	s.replicas[i].Write(sessionId, action, data)
+}
+
+func (s *LocalPluginReplicas) Type() plugin_entities.PluginRuntimeType {
+	return s.replicas[0].Type()
+}
+
+func (s *LocalPluginReplicas) Configuration() *plugin_entities.PluginDeclaration {
+	return s.replicas[0].Configuration()
+}
+
+func (s *LocalPluginReplicas) Identity() (plugin_entities.PluginUniqueIdentifier, error) {
+	return s.replicas[0].Identity()
+}
+
+func (s *LocalPluginReplicas) HashedIdentity() (string, error) {
+	return s.replicas[0].HashedIdentity()
+}
+
+func (s *LocalPluginReplicas) Checksum() (string, error) {
+	return s.replicas[0].Checksum()
+}
+
+func (s *LocalPluginReplicas) Log(msg string) {
+	s.replicas[0].Log(msg)
+}
+
+func (s *LocalPluginReplicas) Warn(msg string) {
+	s.replicas[0].Warn(msg)
+}
+
+func (s *LocalPluginReplicas) Error(msg string) {
+	s.replicas[0].Error(msg)
+}
+
+func (s *LocalPluginReplicas) Logs() *plugin_entities.PluginLogBuffer {
+	return s.replicas[0].Logs()
+}
+
+// Stop stops all replicas
+func (s *LocalPluginReplicas) Stop() {
+	for _, r := range s.replicas {
+		r.Stop()
+	}
+}
+
+func (s *LocalPluginReplicas) Stopped() bool {
+	for _, r := range s.replicas {
+		if !r.Stopped() {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *LocalPluginReplicas) OnStop(f func()) {
+	s.onStop = append(s.onStop, f)
+}
+
+// TriggerStop runs the stop hooks, it's called once all replicas exited
+func (s *LocalPluginReplicas) TriggerStop() {
+	for _, f := range s.onStop {
+		f()
+	}
+}
+
+// Cleanup removes the working path shared by the replicas unless it's stopped for idleness
+func (s *LocalPluginReplicas) Cleanup() {
+	s.lock.Lock()
+	keep := s.keepWorkingPath
+	s.lock.Unlock()
+	if keep {
+		return
+	}
+	s.replicas[0].Cleanup()
+}
+
+// RuntimeState returns the state of the first replica with the restarts and the
+// resource usage of all replicas, a crash looping replica takes precedence
+func (s *LocalPluginReplicas) RuntimeState() plugin_entities.PluginRuntimeState {
+	state := s.replicas[0].RuntimeState()
+	if state.ResourceUsage != nil {
+		usage := *state.ResourceUsage
+		state.ResourceUsage = &usage
+	}
+	for _, r := range s.replicas[1:] {
+		replicaState := r.RuntimeState()
+		state.Restarts += replicaState.Restarts
+		if replicaState.ResourceUsage != nil {
+			if state.ResourceUsage == nil {
+				state.ResourceUsage = &plugin_entities.PluginResourceUsage{}
+			}
+			state.ResourceUsage.Add(replicaState.ResourceUsage)
+		}
+		if replicaState.Status == plugin_entities.PLUGIN_RUNTIME_STATUS_CRASH_LOOP.String() &&
+			state.Status != plugin_entities.PLUGIN_RUNTIME_STATUS_CRASH_LOOP.String() {
+			state.Status = replicaState.Status
+			state.FailureReason = replicaState.FailureReason
+		}
+	}
+	return state
+}
+
+// SampleResourceUsage samples every running replica and returns the usage of each
+// of them, empty if none of them is running
+func (s *LocalPluginReplicas) SampleResourceUsage() []*plugin_entities.PluginResourceUsage {
+	usages := []*plugin_entities.PluginResourceUsage{}
+	for _, r := range s.replicas {
+		usage, err := r.SampleResourceUsage()
+		if err != nil {
+			continue
+		}
+		usages = append(usages, usage)
+	}
+	return usages
+}
+
+// HasCapability reports the capabilities of the first replica, all replicas run the same sdk
+func (s *LocalPluginReplicas) HasCapability(capability plugin_entities.PluginCapability) bool {
+	return s.replicas[0].HasCapability(capability)
+}
+
+// ResetCrashLoop restarts the crash looping replicas, it returns false if there is none
+func (s *LocalPluginReplicas) ResetCrashLoop() bool {
+	reset := false
+	for _, r := range s.replicas {
+		if r.ResetCrashLoop() {
+			reset = true
+		}
+	}
+	return reset
+}
+
+func (s *LocalPluginReplicas) UpdateScheduleAt(t time.Time) {
+	for _, r := range s.replicas {
+		r.UpdateScheduleAt(t)
+	}
+}
@@ -0,0 +1,196 @@
+package local_runtime
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type bufferWriteCloser struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *bufferWriteCloser) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *bufferWriteCloser) Close() error {
+	return nil
+}
+
+func (b *bufferWriteCloser) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// newStartedReplica 创建一个已启动的副本，返回其 stdin 的内容
+func newStartedReplica(t *testing.T) (*LocalPluginRuntime, *bufferWriteCloser) {
+	r := NewLocalPluginRuntime(LocalPluginRuntimeConfig{})
+	stdin := &bufferWriteCloser{}
+	pr, pw := io.Pipe()
+	t.Cleanup(func() { pw.Close() })
+	r.stdioHolder = newStdioHolder("test-plugin", stdin, pr, pr, nil)
+	r.running.Store(true)
+	return r, stdin
+}
+
+func TestLocalPluginReplicasBalance(t *testing.T) {
+	first, firstStdin := newStartedReplica(t)
+	second, secondStdin := newStartedReplica(t)
+	// 未启动的副本不分配会话
+	pending := NewLocalPluginRuntime(LocalPluginRuntimeConfig{})
+
+	replicas := NewLocalPluginReplicas([]*LocalPluginRuntime{first, second, pending})
+
+	listen := func(sessionId string) func() {
+		listener, err := replicas.Listen(sessionId)
+		require.NoError(t, err)
+		return listener.Close
+	}
+
+	closeS1 := listen("s1")
+	listen("s2")
+	listen("s3")
+	assert.Equal(t, []int{2, 1, 0}, replicas.InFlight())
+
+	// 会话固定在所属的副本上
+	replicas.Write("s2", "", []byte("to-second"))
+	assert.Equal(t, "to-second\n", secondStdin.String())
+	assert.Empty(t, firstStdin.String())
+
+	// 关闭会话后释放，重复关闭不影响计数
+	closeS1()
+	closeS1()
+	assert.Equal(t, []int{1, 1, 0}, replicas.InFlight())
+
+	// 已停止的副本不再分配会话
+	first.Stop()
+	listen("s4")
+	assert.Equal(t, []int{1, 2, 0}, replicas.InFlight())
+}
+
+func TestLocalPluginReplicasSkipCrashed(t *testing.T) {
+	crashed, crashedStdin := newStartedReplica(t)
+	healthy, healthyStdin := newStartedReplica(t)
+	replicas := NewLocalPluginReplicas([]*LocalPluginRuntime{crashed, healthy})
+
+	// 进程退出后仍保留 stdio，正在重启或崩溃循环中的副本不分配会话
+	crashed.running.Store(false)
+
+	for _, sessionId := range []string{"s1", "s2", "s3", "s4"} {
+		_, err := replicas.Listen(sessionId)
+		require.NoError(t, err)
+		replicas.Write(sessionId, "", []byte(sessionId))
+	}
+	assert.Equal(t, []int{0, 4}, replicas.InFlight())
+	assert.Empty(t, crashedStdin.String())
+	assert.Equal(t, "s1\ns2\ns3\ns4\n", healthyStdin.String())
+
+	// 重启后重新参与分配
+	crashed.running.Store(true)
+	_, err := replicas.Listen("s5")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 4}, replicas.InFlight())
+}
+
+func TestLocalPluginReplicasListen(t *testing.T) {
+	first, _ := newStartedReplica(t)
+	second, _ := newStartedReplica(t)
+	replicas := NewLocalPluginReplicas([]*LocalPluginRuntime{first, second})
+
+	_, err := replicas.Listen("s1")
+	require.NoError(t, err)
+	listener, err := replicas.Listen("s2")
+	require.NoError(t, err)
+
+	received := []plugin_entities.SessionMessage{}
+	listener.Listen(func(message plugin_entities.SessionMessage) {
+		received = append(received, message)
+	})
+
+	// 只有所属副本的消息会到达会话
+	second.stdioHolder.mu.Lock()
+	dispatch := second.stdioHolder.listener["s2"]
+	second.stdioHolder.mu.Unlock()
+	require.NotNil(t, dispatch)
+	dispatch(utils.MarshalJsonBytes(plugin_entities.SessionMessage{
+		Type: plugin_entities.SESSION_MESSAGE_TYPE_END,
+	}))
+
+	require.Len(t, received, 1)
+	assert.Equal(t, plugin_entities.SESSION_MESSAGE_TYPE_END, received[0].Type)
+
+	listener.Close()
+	second.stdioHolder.mu.Lock()
+	_, ok := second.stdioHolder.listener["s2"]
+	second.stdioHolder.mu.Unlock()
+	assert.False(t, ok)
+}
+
+func TestLocalPluginReplicasStopIfIdle(t *testing.T) {
+	first, _ := newStartedReplica(t)
+	first.BasicChecksum.WorkingPath = t.TempDir()
+	replicas := NewLocalPluginReplicas([]*LocalPluginRuntime{first})
+
+	// 启动完成前不会停止
+	assert.False(t, replicas.StopIfIdle(0))
+	replicas.SetLaunched()
+
+	// 有会话时不会停止
+	listener, err := replicas.Listen("s1")
+	require.NoError(t, err)
+	assert.False(t, replicas.StopIfIdle(0))
+	listener.Close()
+
+	assert.False(t, replicas.StopIfIdle(time.Hour))
+	assert.True(t, replicas.StopIfIdle(0))
+	assert.True(t, replicas.Stopped())
+
+	// 空闲停止后保留工作目录
+	replicas.Cleanup()
+	_, err = os.Stat(first.BasicChecksum.WorkingPath)
+	assert.NoError(t, err)
+}
+
+func TestLocalPluginReplicasResetCrashLoop(t *testing.T) {
+	first, _ := newStartedReplica(t)
+	second, _ := newStartedReplica(t)
+	replicas := NewLocalPluginReplicas([]*LocalPluginRuntime{first, second})
+
+	// 没有副本崩溃循环时不重置
+	assert.False(t, replicas.ResetCrashLoop())
+
+	// 任一副本崩溃循环时，状态以其为准
+	second.SetCrashLoop("ModuleNotFoundError: No module named 'requests'")
+	state := replicas.RuntimeState()
+	assert.Equal(t, plugin_entities.PLUGIN_RUNTIME_STATUS_CRASH_LOOP.String(), state.Status)
+	assert.Equal(t, "ModuleNotFoundError: No module named 'requests'", state.FailureReason)
+
+	assert.True(t, replicas.ResetCrashLoop())
+	select {
+	case <-second.WaitReset():
+	default:
+		t.Fatal("crash looping replica is not notified")
+	}
+	select {
+	case <-first.WaitReset():
+		t.Fatal("running replica should not be notified")
+	default:
+	}
+
+	state = replicas.RuntimeState()
+	assert.NotEqual(t, plugin_entities.PLUGIN_RUNTIME_STATUS_CRASH_LOOP.String(), state.Status)
+	assert.Empty(t, state.FailureReason)
+}
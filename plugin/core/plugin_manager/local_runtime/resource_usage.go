@@ -0,0 +1,66 @@
+package local_runtime
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+)
+
+// processTreeSample is the cumulative usage of a process and its descendants
+type processTreeSample struct {
+	// user and system cpu time in clock ticks
+	cpuTicks  uint64
+	rss       int64
+	openFiles int
+	threads   int
+	processes int
+}
+
+// SampleResourceUsage samples the plugin process and its children, the cpu usage
+// is the average since the previous sample. The usage is kept in the runtime state
+func (r *LocalPluginRuntime) SampleResourceUsage() (*plugin_entities.PluginResourceUsage, error) {
+	r.usageLock.Lock()
+	defer r.usageLock.Unlock()
+
+	if r.pid == 0 || r.Stopped() {
+		r.State.ResourceUsage = nil
+		return nil, errors.New("plugin process is not running")
+	}
+
+	sample, err := sampleProcessTree(r.pid)
+	if err != nil {
+		r.State.ResourceUsage = nil
+		return nil, err
+	}
+
+	now := time.Now()
+	usage := &plugin_entities.PluginResourceUsage{
+		RSS:       sample.rss,
+		OpenFiles: sample.openFiles,
+		Threads:   sample.threads,
+		Processes: sample.processes,
+		SampledAt: now,
+	}
+	// children exited since the last sample take their cpu time with them
+	if !r.lastSampleAt.IsZero() && sample.cpuTicks >= r.lastCPUTicks {
+		elapsed := now.Sub(r.lastSampleAt).Seconds()
+		if elapsed > 0 {
+			usage.CPUPercent = float64(sample.cpuTicks-r.lastCPUTicks) / clockTicks / elapsed * 100
+		}
+	}
+	r.lastCPUTicks = sample.cpuTicks
+	r.lastSampleAt = now
+
+	r.State.ResourceUsage = usage
+	return usage, nil
+}
+
+// setPid records the process to sample, the cpu baseline restarts with it
+func (r *LocalPluginRuntime) setPid(pid int) {
+	r.usageLock.Lock()
+	defer r.usageLock.Unlock()
+	r.pid = pid
+	r.lastCPUTicks = 0
+	r.lastSampleAt = time.Time{}
+}
@@ -0,0 +1,114 @@
+//go:build linux
+
+package local_runtime
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// USER_HZ, fixed to 100 by the kernel for /proc
+const clockTicks = 100
+
+type procStat struct {
+	ppid     int
+	cpuTicks uint64
+	threads  int
+	rssPages int64
+}
+
+// parseProcStat parses /proc/<pid>/stat, the command may contain spaces and
+// parentheses so the fields are read after the last ')'
+func parseProcStat(content string) (procStat, error) {
+	end := strings.LastIndexByte(content, ')')
+	if end == -1 {
+		return procStat{}, fmt.Errorf("invalid stat: %s", content)
+	}
+	// fields from the 3rd one, state
+	fields := strings.Fields(content[end+1:])
+	if len(fields) < 22 {
+		return procStat{}, fmt.Errorf("invalid stat: %s", content)
+	}
+
+	var stat procStat
+	var err error
+	if stat.ppid, err = strconv.Atoi(fields[1]); err != nil {
+		return procStat{}, fmt.Errorf("invalid ppid: %s", fields[1])
+	}
+	utime, err := strconv.ParseUint(fields[11], 10, 64)
+	if err != nil {
+		return procStat{}, fmt.Errorf("invalid utime: %s", fields[11])
+	}
+	stime, err := strconv.ParseUint(fields[12], 10, 64)
+	if err != nil {
+		return procStat{}, fmt.Errorf("invalid stime: %s", fields[12])
+	}
+	stat.cpuTicks = utime + stime
+	if stat.threads, err = strconv.Atoi(fields[17]); err != nil {
+		return procStat{}, fmt.Errorf("invalid num_threads: %s", fields[17])
+	}
+	if stat.rssPages, err = strconv.ParseInt(fields[21], 10, 64); err != nil {
+		return procStat{}, fmt.Errorf("invalid rss: %s", fields[21])
+	}
+	return stat, nil
+}
+
+func readProcStat(pid int) (procStat, error) {
+	content, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return procStat{}, err
+	}
+	return parseProcStat(string(content))
+}
+
+// sampleProcessTree sums the usage of pid and all of its descendants, e.g. the
+// plugin started in a sandbox or the workers it forks
+func sampleProcessTree(pid int) (processTreeSample, error) {
+	root, err := readProcStat(pid)
+	if err != nil {
+		return processTreeSample{}, fmt.Errorf("read stat of process %d: %w", pid, err)
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return processTreeSample{}, err
+	}
+	stats := map[int]procStat{pid: root}
+	children := map[int][]int{}
+	for _, entry := range entries {
+		child, err := strconv.Atoi(entry.Name())
+		if err != nil || child == pid {
+			continue
+		}
+		// processes may exit while walking
+		stat, err := readProcStat(child)
+		if err != nil {
+			continue
+		}
+		stats[child] = stat
+		children[stat.ppid] = append(children[stat.ppid], child)
+	}
+
+	pageSize := int64(os.Getpagesize())
+	sample := processTreeSample{}
+	queue := []int{pid}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		stat := stats[current]
+		sample.cpuTicks += stat.cpuTicks
+		sample.rss += stat.rssPages * pageSize
+		sample.threads += stat.threads
+		sample.processes++
+		if fds, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(current), "fd")); err == nil {
+			sample.openFiles += len(fds)
+		}
+
+		queue = append(queue, children[current]...)
+	}
+	return sample, nil
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package local_runtime
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcStat(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected procStat
+		wantErr  bool
+	}{
+		{
+			name:     "普通进程",
+			content:  "1234 (python) S 1200 1234 1234 0 -1 4194560 100 0 0 0 150 50 0 0 20 0 3 0 100 200000000 2048 18446744073709551615 0 0 0 0 0 0 0 0 0 0 0 0 17 0 0 0 0 0 0",
+			expected: procStat{ppid: 1200, cpuTicks: 200, threads: 3, rssPages: 2048},
+		},
+		{
+			name:     "命令包含空格和括号",
+			content:  "1234 (my (plugin) x) R 1 1234 1234 0 -1 4194560 100 0 0 0 7 3 0 0 20 0 1 0 100 200000000 10 18446744073709551615",
+			expected: procStat{ppid: 1, cpuTicks: 10, threads: 1, rssPages: 10},
+		},
+		{
+			name:    "字段不足",
+			content: "1234 (python) S 1200 1234",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stat, err := parseProcStat(tt.content)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, stat)
+		})
+	}
+}
+
+func TestLocalPluginRuntimeSampleResourceUsage(t *testing.T) {
+	// sh 启动的子进程也计入插件
+	cmd := exec.Command("sh", "-c", "sleep 10 & sleep 10")
+	require.NoError(t, cmd.Start())
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	r := NewLocalPluginRuntime(LocalPluginRuntimeConfig{})
+
+	// 未启动时没有资源占用
+	_, err := r.SampleResourceUsage()
+	assert.Error(t, err)
+
+	r.setPid(cmd.Process.Pid)
+	require.Eventually(t, func() bool {
+		usage, err := r.SampleResourceUsage()
+		return err == nil && usage.Processes >= 3
+	}, 2*time.Second, 50*time.Millisecond)
+
+	usage := r.RuntimeState().ResourceUsage
+	require.NotNil(t, usage)
+	assert.Greater(t, usage.RSS, int64(0))
+	assert.GreaterOrEqual(t, usage.Threads, 3)
+	assert.Greater(t, usage.OpenFiles, 0)
+	assert.GreaterOrEqual(t, usage.CPUPercent, 0.0)
+
+	// 进程退出后清空
+	cmd.Process.Kill()
+	cmd.Wait()
+	_, err = r.SampleResourceUsage()
+	assert.Error(t, err)
+	assert.Nil(t, r.RuntimeState().ResourceUsage)
+}
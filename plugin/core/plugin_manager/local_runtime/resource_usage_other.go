@@ -0,0 +1,15 @@
+//go:build !linux
+
+package local_runtime
+
+import (
+	"errors"
+	"runtime"
+)
+
+const clockTicks = 100
+
+// sampleProcessTree relies on /proc which is only available on linux
+func sampleProcessTree(pid int) (processTreeSample, error) {
+	return processTreeSample{}, errors.New("resource usage is not supported on " + runtime.GOOS)
+}
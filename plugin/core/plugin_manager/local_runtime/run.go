@@ -7,10 +7,12 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"strings"
 	"sync"
 
 	"github.com/jjgagacy/workflow-app/plugin/core/constants"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/access_types"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/sandbox"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
 	"github.com/jjgagacy/workflow-app/plugin/utils"
@@ -33,12 +35,21 @@ type PackageJSON struct {
 	Dependencies map[string]string `json:"dependencies"`
 }
 
+// environ returns the environment the plugin inherits from the daemon, a sandboxed
+// plugin only gets the allowed variables
+func (r *LocalPluginRuntime) environ() []string {
+	if r.sandbox != nil {
+		return sandbox.ScrubEnv(os.Environ(), r.sandbox.EnvAllowList)
+	}
+	return os.Environ()
+}
+
 func (r *LocalPluginRuntime) getCmd() (*exec.Cmd, error) {
 	switch r.Config.Meta.Runner.Language {
 	case constants.Node:
 		cmd := exec.Command(r.nodeExecutePath, r.Config.Meta.Runner.EntryPoint)
 		cmd.Dir = r.State.WorkingPath
-		cmd.Env = cmd.Environ()
+		cmd.Env = r.environ()
 		if r.HttpsProxy != "" {
 			cmd.Env = append(cmd.Env, fmt.Sprintf("HTTPS_PROXY=%s", r.HttpsProxy))
 		}
@@ -53,7 +64,7 @@ func (r *LocalPluginRuntime) getCmd() (*exec.Cmd, error) {
 	case constants.Python:
 		cmd := exec.Command(r.pythonInterpreterPath, "-m", r.Config.Meta.Runner.EntryPoint)
 		cmd.Dir = r.State.WorkingPath
-		cmd.Env = cmd.Environ()
+		cmd.Env = r.environ()
 		if r.HttpsProxy != "" {
 			cmd.Env = append(cmd.Env, fmt.Sprintf("HTTPS_PROXY=%s", r.HttpsProxy))
 		}
@@ -124,10 +135,25 @@ func (r *LocalPluginRuntime) StartPlugin() error {
 	if err != nil {
 		return err
 	}
+	if len(r.stdioProtocols) > 0 {
+		protocols := make([]string, len(r.stdioProtocols))
+		for i, protocol := range r.stdioProtocols {
+			protocols[i] = string(protocol)
+		}
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", STDIO_PROTOCOLS_ENV, strings.Join(protocols, ",")))
+	}
 
 	cmd.Dir = r.State.WorkingPath
 	cmd.Env = append(cmd.Environ(), "INSTALL_METHOD=local", "PATH="+os.Getenv("PATH"))
 
+	if r.sandbox != nil {
+		cleanup, err := sandbox.Wrap(cmd, r.sandbox)
+		if err != nil {
+			return errors.Join(err, fmt.Errorf("sandbox plugin failed"))
+		}
+		defer cleanup()
+	}
+
 	// get stdin
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -158,11 +184,15 @@ func (r *LocalPluginRuntime) StartPlugin() error {
 	}
 
 	r.cmd = cmd
+	r.setPid(cmd.Process.Pid)
 
 	// stdio
 	r.stdioHolder = newStdioHolder(r.Config.Identity(), stdin, stdout, stderr, &StdioHolderConfig{
 		StdoutBufferSize:    r.stdoutBufferSize,
 		StdoutMaxBufferSize: r.stdoutMaxBufferSize,
+		Logs:                r.LogBuffer,
+		Protocols:           r.stdioProtocols,
+		ValidateHandshake:   r.validateHandshake,
 	})
 
 	defer func() {
@@ -187,9 +217,11 @@ func (r *LocalPluginRuntime) StartPlugin() error {
 			}
 		}
 
+		r.running.Store(false)
 		r.gc()
 	}()
 
+	r.running.Store(true)
 	utils.Info("plugin %s started", r.Config.Identity())
 
 	wg := sync.WaitGroup{}
@@ -227,6 +259,12 @@ func (r *LocalPluginRuntime) StartPlugin() error {
 
 	// wait for plugin to exit
 	err = r.stdioHolder.Wait()
+	if refused := r.stdioHolder.Refused(); refused != nil {
+		// the plugin is not restarted, it can't become compatible on its own
+		r.SetIncompatible(refused.Error())
+		_ = cmd.Process.Kill()
+		return refused
+	}
 	if err != nil {
 		return errors.Join(err, r.stdioHolder.Error())
 	}
@@ -262,9 +300,39 @@ func (r *LocalPluginRuntime) WaitStopped() <-chan bool {
 	return c
 }
 
+// WaitReset returns a channel that will receive true when the crash loop is reset
+func (r *LocalPluginRuntime) WaitReset() <-chan bool {
+	return r.resetChan
+}
+
+// ResetCrashLoop restarts a crash looping plugin, it returns false if the plugin is not crash looping
+func (r *LocalPluginRuntime) ResetCrashLoop() bool {
+	if r.State.Status != plugin_entities.PLUGIN_RUNTIME_STATUS_CRASH_LOOP.String() {
+		return false
+	}
+	r.State.FailureReason = ""
+	r.SetPending()
+	select {
+	case r.resetChan <- true:
+	default:
+	}
+	return true
+}
+
+// LastError returns the last stderr output of the plugin
+func (r *LocalPluginRuntime) LastError() string {
+	if r.stdioHolder == nil {
+		return ""
+	}
+	return r.stdioHolder.errMessage
+}
+
 // Stop stops the plugin
 func (r *LocalPluginRuntime) Stop() {
 	r.PluginRuntime.Stop()
+	if r.stopCancel != nil {
+		r.stopCancel()
+	}
 
 	if r.cmd != nil && r.cmd.Process != nil {
 		_ = r.cmd.Process.Kill()
@@ -295,5 +363,7 @@ func (r *LocalPluginRuntime) Listen(sessionId string) (*entities.Broadcast[plugi
 }
 
 func (r *LocalPluginRuntime) Write(sessionId string, action access_types.PluginAccessAction, data []byte) {
-	r.stdioHolder.write(append(data, '\n'))
+	if err := r.stdioHolder.writeMessage(data); err != nil {
+		utils.Error("write to plugin %s failed: %s", r.Config.Identity(), err.Error())
+	}
 }
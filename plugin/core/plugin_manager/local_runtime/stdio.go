@@ -2,22 +2,39 @@ package local_runtime
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
 	"github.com/jjgagacy/workflow-app/plugin/types"
 	"github.com/jjgagacy/workflow-app/plugin/utils"
+	"github.com/jjgagacy/workflow-app/plugin/utils/parser"
 )
 
 const (
 	MAX_ERR_MSG_LEN        = 1024
 	MAX_HEARTBEAT_INTERVAL = 120 * time.Second
+
+	// magic number of the length prefixed frames on stdio
+	STDIO_MAGIC_NUMBER = 0x0f
+	// the stdio protocols offered by the daemon, comma separated in preference order
+	STDIO_PROTOCOLS_ENV = "DAEMON_STDIO_PROTOCOLS"
 )
 
+// capabilities the daemon makes use of, the acknowledgement carries the ones both sides support
+var supportedCapabilities = []plugin_entities.PluginCapability{
+	plugin_entities.PLUGIN_CAPABILITY_CANCEL,
+	plugin_entities.PLUGIN_CAPABILITY_BINARY_FRAMING,
+	plugin_entities.PLUGIN_CAPABILITY_STREAMING_ENDPOINT,
+}
+
 type stdioHolder struct {
 	pluginUniqueIdentifier string
 	writer                 io.WriteCloser
@@ -40,11 +57,33 @@ type stdioHolder struct {
 
 	stdoutBufferSize    int
 	stdoutMaxBufferSize int
+
+	// logs collects log events and stderr of the plugin, optional
+	logs *plugin_entities.PluginLogBuffer
+
+	// protocols the plugin may select in its handshake
+	protocols []plugin_entities.PluginStdioProtocol
+	// the protocol of stdin, switched once the handshake is acknowledged
+	writeLock sync.Mutex
+	protocol  plugin_entities.PluginStdioProtocol
+
+	// checks the sdk of the plugin, nil accepts every plugin
+	validateHandshake func(handshake *plugin_entities.PluginHandshake) error
+	// capabilities negotiated in the handshake, guarded by writeLock
+	capabilities           []plugin_entities.PluginCapability
+	capabilitiesNegotiated bool
+	// why the plugin is refused, set before the holder is stopped
+	refused error
 }
 
 type StdioHolderConfig struct {
 	StdoutBufferSize    int
 	StdoutMaxBufferSize int
+	Logs                *plugin_entities.PluginLogBuffer
+	// protocols accepted in the handshake, json lines only if empty
+	Protocols []plugin_entities.PluginStdioProtocol
+	// called with the handshake, or nil if the plugin sent none, an error refuses the plugin
+	ValidateHandshake func(handshake *plugin_entities.PluginHandshake) error
 }
 
 func newStdioHolder(
@@ -76,6 +115,10 @@ func newStdioHolder(
 		stdoutMaxBufferSize:       config.StdoutMaxBufferSize,
 		waitingControllerChan:     make(chan bool),
 		waitingControllerChanLock: &sync.Mutex{},
+		logs:                      config.Logs,
+		protocols:                 config.Protocols,
+		protocol:                  plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES,
+		validateHandshake:         config.ValidateHandshake,
 	}
 
 	return holder
@@ -101,6 +144,114 @@ func (s *stdioHolder) write(data []byte) error {
 	return err
 }
 
+// writeMessage writes a json message in the protocol of stdin
+func (s *stdioHolder) writeMessage(data []byte) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	switch s.protocol {
+	case plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_JSON:
+		return s.write(parser.LengthPrefixedFrame(STDIO_MAGIC_NUMBER, data))
+	case plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR:
+		message, err := utils.UnmarshalJsonBytes[any](data)
+		if err != nil {
+			return errors.Join(err, fmt.Errorf("decode message failed"))
+		}
+		encoded, err := parser.CBORMarshal(message)
+		if err != nil {
+			return errors.Join(err, fmt.Errorf("encode message to cbor failed"))
+		}
+		return s.write(parser.LengthPrefixedFrame(STDIO_MAGIC_NUMBER, encoded))
+	default:
+		return s.write(append(data, '\n'))
+	}
+}
+
+// acceptHandshake acknowledges the protocol selected by the plugin and switches
+// stdin to it. The plugin writes nothing else until it receives the acknowledgement
+// and uses the acknowledged protocol for stdout from then on, protocols which are
+// not offered fall back to json lines. Plugins announcing their capabilities only
+// get a length prefixed protocol if binary framing is one of them
+func (s *stdioHolder) acceptHandshake(handshake *plugin_entities.PluginHandshake) plugin_entities.PluginStdioProtocol {
+	protocol := plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES
+	if !slices.Contains(s.protocols, handshake.Protocol) {
+		utils.Warn("plugin %s selected unsupported stdio protocol %s, fallback to %s", s.pluginUniqueIdentifier, handshake.Protocol, protocol)
+	} else if handshake.Protocol.LengthPrefixed() && handshake.Capabilities != nil &&
+		!slices.Contains(handshake.Capabilities, plugin_entities.PLUGIN_CAPABILITY_BINARY_FRAMING) {
+		utils.Warn("plugin %s selected stdio protocol %s without binary framing, fallback to %s", s.pluginUniqueIdentifier, handshake.Protocol, protocol)
+	} else {
+		protocol = handshake.Protocol
+	}
+
+	var capabilities []plugin_entities.PluginCapability
+	if handshake.Capabilities != nil {
+		capabilities = []plugin_entities.PluginCapability{}
+		for _, capability := range handshake.Capabilities {
+			if slices.Contains(supportedCapabilities, capability) && !slices.Contains(capabilities, capability) {
+				capabilities = append(capabilities, capability)
+			}
+		}
+	}
+
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	s.writeHandshakeAck(plugin_entities.PluginHandshake{Protocol: protocol, Capabilities: capabilities})
+	s.protocol = protocol
+	if capabilities != nil {
+		s.capabilities = capabilities
+		s.capabilitiesNegotiated = true
+	}
+	return protocol
+}
+
+// refuseHandshake tells the plugin why it's refused and stops the holder, plugins
+// which sent no handshake don't read the acknowledgement so they are only stopped
+func (s *stdioHolder) refuseHandshake(handshake *plugin_entities.PluginHandshake, reason error) {
+	utils.Error("plugin %s is refused: %s", s.pluginUniqueIdentifier, reason.Error())
+	s.appendLog(plugin_entities.PluginLogEntry{
+		Level:   plugin_entities.PLUGIN_LOG_LEVEL_ERROR,
+		Source:  plugin_entities.PLUGIN_LOG_SOURCE_RUNTIME,
+		Message: reason.Error(),
+	})
+
+	if handshake != nil {
+		s.writeLock.Lock()
+		s.writeHandshakeAck(plugin_entities.PluginHandshake{
+			Protocol: plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES,
+			Error:    reason.Error(),
+		})
+		s.writeLock.Unlock()
+	}
+
+	s.refused = reason
+	s.Stop()
+}
+
+// writeHandshakeAck writes the acknowledgement as a json line, the caller holds writeLock
+func (s *stdioHolder) writeHandshakeAck(ack plugin_entities.PluginHandshake) {
+	data := utils.MarshalJsonBytes(map[string]any{
+		"event": plugin_entities.PLUGIN_EVENT_HANDSHAKE,
+		"data":  ack,
+	})
+	if err := s.write(append(data, '\n')); err != nil {
+		utils.Error("plugin %s: acknowledge handshake failed: %s", s.pluginUniqueIdentifier, err.Error())
+	}
+}
+
+// Capabilities returns the capabilities negotiated in the handshake, false if the
+// plugin didn't announce any
+func (s *stdioHolder) Capabilities() ([]plugin_entities.PluginCapability, bool) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	return s.capabilities, s.capabilitiesNegotiated
+}
+
+// Refused returns why the plugin is refused in the handshake, nil if it's accepted
+func (s *stdioHolder) Refused() error {
+	return s.refused
+}
+
 func (s *stdioHolder) Error() error {
 	if time.Since(s.lastErrMessageUpdatedAt) < 60*time.Second {
 		if s.errMessage != "" {
@@ -127,47 +278,166 @@ func (s *stdioHolder) StartStdout(notifyHeartbeat func()) {
 	s.started = true
 	s.lastActiveAt = time.Now()
 
-	scanner := bufio.NewScanner(s.reader)
-	scanner.Buffer(make([]byte, s.stdoutBufferSize), s.stdoutMaxBufferSize)
+	reader := bufio.NewReaderSize(s.reader, s.stdoutBufferSize)
 
-	for scanner.Scan() {
-		data := scanner.Bytes()
+	protocol := plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES
+	handshaked := false
+	for {
+		data, err := readLine(reader, s.stdoutMaxBufferSize)
+		if err != nil {
+			if err != io.EOF {
+				utils.Error("plugin %s has an error on stdout: %s", s.pluginUniqueIdentifier, err)
+			}
+			return
+		}
 		if len(data) == 0 {
 			continue
 		}
 		// update the last active time on each time the plugin sends data
 		s.lastActiveAt = time.Now()
 
-		utils.Info("received: %s\n", data)
-
-		plugin_entities.ParsePluginUniversalEvent(
-			data,
-			"",
-			func(sessionId string, data []byte) {
-				s.mu.Lock()
-				listener := s.listener[sessionId]
-				s.mu.Unlock()
-				if listener != nil {
-					listener(data)
+		// only the first message may select the protocol
+		if !handshaked {
+			handshaked = true
+			handshake, ok := plugin_entities.ParsePluginHandshake(data)
+			if s.validateHandshake != nil {
+				if err := s.validateHandshake(handshake); err != nil {
+					s.refuseHandshake(handshake, err)
+					return
 				}
-			},
-			func() {
-				notifyHeartbeat()
-			},
-			func(err string) {
-				utils.Error("plugin %s: %s", s.pluginUniqueIdentifier, err)
-			},
-			func(message string) {
-				utils.Info("plugin %s: %s", s.pluginUniqueIdentifier, message)
-			},
-		)
-	}
-
-	if err := scanner.Err(); err != nil {
+			}
+			if ok {
+				protocol = s.acceptHandshake(handshake)
+				if protocol.LengthPrefixed() {
+					break
+				}
+				continue
+			}
+		}
+
+		s.handleEvent(data, notifyHeartbeat)
+	}
+
+	utils.Info("plugin %s switched stdio protocol to %s", s.pluginUniqueIdentifier, protocol)
+	err := parser.LengthPrefixedChunking(reader, STDIO_MAGIC_NUMBER, uint32(s.stdoutMaxBufferSize), func(frame []byte) error {
+		s.lastActiveAt = time.Now()
+
+		// a broken frame is skipped, the following ones are still aligned
+		if protocol == plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR {
+			s.handleCBOREvent(frame, notifyHeartbeat)
+		} else {
+			s.handleEvent(frame, notifyHeartbeat)
+		}
+		return nil
+	})
+	if err != nil {
 		utils.Error("plugin %s has an error on stdout: %s", s.pluginUniqueIdentifier, err)
 	}
 }
 
+// readLine reads a line without the line ending, lines longer than max are an error
+func readLine(reader *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(line)+len(chunk) > max {
+			return nil, fmt.Errorf("line is too long: exceeds %d bytes", max)
+		}
+		if err == bufio.ErrBufferFull {
+			line = append(line, chunk...)
+			continue
+		}
+		if err != nil {
+			if err == io.EOF && len(line)+len(chunk) > 0 {
+				return append(line, chunk...), nil
+			}
+			return nil, err
+		}
+
+		if line == nil {
+			line = chunk
+		} else {
+			line = append(line, chunk...)
+		}
+		return bytes.TrimRight(line, "\r\n"), nil
+	}
+}
+
+func (s *stdioHolder) handleEvent(data []byte, notifyHeartbeat func()) {
+	utils.Info("received: %s\n", data)
+
+	sessionHandler, heartbeatHandler, errorHandler, logHandler := s.eventHandlers(notifyHeartbeat)
+	plugin_entities.ParsePluginUniversalEvent(data, "", sessionHandler, heartbeatHandler, errorHandler, logHandler)
+}
+
+// cborUniversalEvent is the envelope of an event in a cbor frame, binary data is a
+// byte string instead of base64
+type cborUniversalEvent struct {
+	SessionId string                          `cbor:"session_id"`
+	Event     plugin_entities.PluginEventType `cbor:"event"`
+	Data      any                             `cbor:"data"`
+}
+
+// handleCBOREvent decodes the envelope from cbor, only the data is converted to
+// json for the listeners so large payloads are not parsed twice
+func (s *stdioHolder) handleCBOREvent(frame []byte, notifyHeartbeat func()) {
+	event, err := parser.CBORUnmarshal[cborUniversalEvent](frame)
+	if err != nil {
+		utils.Error("plugin %s: decode cbor frame failed: %s", s.pluginUniqueIdentifier, err.Error())
+		return
+	}
+	data, err := json.Marshal(event.Data)
+	if err != nil {
+		utils.Error("plugin %s: convert cbor data to json failed: %s", s.pluginUniqueIdentifier, err.Error())
+		return
+	}
+
+	sessionHandler, heartbeatHandler, errorHandler, logHandler := s.eventHandlers(notifyHeartbeat)
+	plugin_entities.HandlePluginUniversalEvent(plugin_entities.PluginUniversalEvent{
+		SessionId: event.SessionId,
+		Event:     event.Event,
+		Data:      data,
+	}, sessionHandler, heartbeatHandler, errorHandler, logHandler)
+}
+
+func (s *stdioHolder) eventHandlers(notifyHeartbeat func()) (
+	func(sessionId string, data []byte),
+	func(),
+	func(err string),
+	func(sessionId string, log plugin_entities.PluginLogEvent),
+) {
+	sessionHandler := func(sessionId string, data []byte) {
+		s.mu.Lock()
+		listener := s.listener[sessionId]
+		s.mu.Unlock()
+		if listener != nil {
+			listener(data)
+		}
+	}
+	errorHandler := func(err string) {
+		utils.Error("plugin %s: %s", s.pluginUniqueIdentifier, err)
+		s.appendLog(plugin_entities.PluginLogEntry{
+			Level:   plugin_entities.PLUGIN_LOG_LEVEL_ERROR,
+			Source:  plugin_entities.PLUGIN_LOG_SOURCE_EVENT,
+			Message: err,
+		})
+	}
+	logHandler := func(sessionId string, log plugin_entities.PluginLogEvent) {
+		utils.Info("plugin %s: %s", s.pluginUniqueIdentifier, log.Message)
+		entry := plugin_entities.PluginLogEntry{
+			Level:     normalizeLogLevel(log.Level),
+			Source:    plugin_entities.PLUGIN_LOG_SOURCE_EVENT,
+			SessionID: sessionId,
+			Message:   log.Message,
+		}
+		if log.Timestamp > 0 {
+			entry.Timestamp = unixFloatToTime(log.Timestamp)
+		}
+		s.appendLog(entry)
+	}
+	return sessionHandler, notifyHeartbeat, errorHandler, logHandler
+}
+
 // WriteError writes the error message to the stdio holder
 func (s *stdioHolder) WriteError(msg string) {
 	if len(msg) > MAX_ERR_MSG_LEN {
@@ -189,6 +459,50 @@ func (s *stdioHolder) WriteError(msg string) {
 	s.lastErrMessageUpdatedAt = time.Now()
 }
 
+func (s *stdioHolder) appendLog(entry plugin_entities.PluginLogEntry) {
+	if s.logs == nil {
+		return
+	}
+	s.logs.Append(entry)
+}
+
+// appendStderr stores each non-empty line of the stderr output as an error log
+func (s *stdioHolder) appendStderr(data []byte) {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if line == "" {
+			continue
+		}
+		s.appendLog(plugin_entities.PluginLogEntry{
+			Level:   plugin_entities.PLUGIN_LOG_LEVEL_ERROR,
+			Source:  plugin_entities.PLUGIN_LOG_SOURCE_STDERR,
+			Message: line,
+		})
+	}
+}
+
+func normalizeLogLevel(level string) plugin_entities.PluginLogLevel {
+	switch strings.ToLower(level) {
+	case "debug":
+		return plugin_entities.PLUGIN_LOG_LEVEL_DEBUG
+	case "warn", "warning":
+		return plugin_entities.PLUGIN_LOG_LEVEL_WARN
+	case "error", "fatal", "critical":
+		return plugin_entities.PLUGIN_LOG_LEVEL_ERROR
+	default:
+		return plugin_entities.PLUGIN_LOG_LEVEL_INFO
+	}
+}
+
+// plugins send unix timestamps in seconds, js plugins may send milliseconds
+func unixFloatToTime(ts float64) time.Time {
+	if ts > 1e12 {
+		return time.UnixMilli(int64(ts))
+	}
+	sec := int64(ts)
+	return time.Unix(sec, int64((ts-float64(sec))*1e9))
+}
+
 // StartStderr starts to read the stderr of the plugin
 // it will write the error message to the stdio holder
 func (s *stdioHolder) StartStderr() {
@@ -203,11 +517,13 @@ func (s *stdioHolder) StartStderr() {
 				break
 			} else if err != nil {
 				s.WriteError(fmt.Sprintf("%s\n", buf[:n]))
+				s.appendStderr(buf[:n])
 				break
 			}
 
 			if n > 0 {
 				s.WriteError(fmt.Sprintf("%s\n", buf[:n]))
+				s.appendStderr(buf[:n])
 			}
 		}
 	}
@@ -0,0 +1,337 @@
+package local_runtime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+	"github.com/jjgagacy/workflow-app/plugin/utils/parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var allStdioProtocols = []plugin_entities.PluginStdioProtocol{
+	plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR,
+	plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_JSON,
+	plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES,
+}
+
+// encodeStdioEvent 按插件选择的协议编码一条消息
+func encodeStdioEvent(t testing.TB, protocol plugin_entities.PluginStdioProtocol, event map[string]any) []byte {
+	switch protocol {
+	case plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_JSON:
+		return parser.LengthPrefixedFrame(STDIO_MAGIC_NUMBER, utils.MarshalJsonBytes(event))
+	case plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR:
+		data, err := parser.CBORMarshal(event)
+		require.NoError(t, err)
+		return parser.LengthPrefixedFrame(STDIO_MAGIC_NUMBER, data)
+	default:
+		return append(utils.MarshalJsonBytes(event), '\n')
+	}
+}
+
+func sessionEvent(sessionId string, payload any) map[string]any {
+	return map[string]any{
+		"event":      plugin_entities.PLUGIN_EVENT_SESSION,
+		"session_id": sessionId,
+		"data": map[string]any{
+			"type": plugin_entities.SESSION_MESSAGE_TYPE_STREAM,
+			"data": payload,
+		},
+	}
+}
+
+func TestStdioHolderHandshake(t *testing.T) {
+	tests := []struct {
+		name      string
+		handshake plugin_entities.PluginStdioProtocol
+		offered   []plugin_entities.PluginStdioProtocol
+		// 实际使用的协议
+		expected plugin_entities.PluginStdioProtocol
+	}{
+		{"没有握手使用 json lines", "", allStdioProtocols, plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES},
+		{"握手选择 json lines", plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES, allStdioProtocols, plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES},
+		{"长度前缀 json", plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_JSON, allStdioProtocols, plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_JSON},
+		{"长度前缀 cbor", plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR, allStdioProtocols, plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR},
+		{"未提供的协议回退到 json lines", plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR, nil, plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdoutReader, stdoutWriter := io.Pipe()
+			stdinReader, stdinWriter := io.Pipe()
+			t.Cleanup(func() {
+				stdoutWriter.Close()
+				stdinReader.Close()
+			})
+
+			holder := newStdioHolder("test-plugin", stdinWriter, stdoutReader, stdoutReader, &StdioHolderConfig{
+				Protocols: tt.offered,
+			})
+			received := make(chan []byte, 1)
+			holder.setEventListener("s1", func(data []byte) {
+				received <- append([]byte{}, data...)
+			})
+			go holder.StartStdout(func() {})
+
+			stdin := bufio.NewReader(stdinReader)
+			if tt.handshake != "" {
+				go stdoutWriter.Write(encodeStdioEvent(t, plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES, map[string]any{
+					"event": plugin_entities.PLUGIN_EVENT_HANDSHAKE,
+					"data":  plugin_entities.PluginHandshake{Protocol: tt.handshake},
+				}))
+
+				// 守护进程在 stdin 上确认协议
+				line, err := stdin.ReadBytes('\n')
+				require.NoError(t, err)
+				ack, ok := plugin_entities.ParsePluginHandshake(line)
+				require.True(t, ok)
+				assert.Equal(t, tt.expected, ack.Protocol)
+			}
+
+			// 插件收到确认后按确认的协议写入 stdout
+			go stdoutWriter.Write(encodeStdioEvent(t, tt.expected, sessionEvent("s1", map[string]any{"text": "hello"})))
+
+			select {
+			case data := <-received:
+				message, err := utils.UnmarshalJsonBytes[plugin_entities.SessionMessage](data)
+				require.NoError(t, err)
+				assert.Equal(t, plugin_entities.SESSION_MESSAGE_TYPE_STREAM, message.Type)
+				assert.JSONEq(t, `{"text":"hello"}`, string(message.Data))
+			case <-time.After(time.Second):
+				t.Fatal("session message is not received")
+			}
+
+			// 守护进程按协商的协议写入 stdin
+			go holder.writeMessage([]byte(`{"session_id":"s1","event":"request","data":{"n":1}}`))
+			var written []byte
+			if tt.expected.LengthPrefixed() {
+				err := parser.LengthPrefixedChunking(stdin, STDIO_MAGIC_NUMBER, 1024, func(frame []byte) error {
+					written = append([]byte{}, frame...)
+					return io.EOF
+				})
+				require.ErrorIs(t, err, io.EOF)
+			} else {
+				line, err := stdin.ReadBytes('\n')
+				require.NoError(t, err)
+				written = bytes.TrimSpace(line)
+			}
+
+			if tt.expected == plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR {
+				message, err := parser.CBORUnmarshal[map[string]any](written)
+				require.NoError(t, err)
+				assert.Equal(t, "s1", message["session_id"])
+				assert.EqualValues(t, 1, message["data"].(map[string]any)["n"])
+			} else {
+				assert.JSONEq(t, `{"session_id":"s1","event":"request","data":{"n":1}}`, string(written))
+			}
+		})
+	}
+}
+
+func TestStdioHolderHandshakeCapabilities(t *testing.T) {
+	tests := []struct {
+		name         string
+		protocol     plugin_entities.PluginStdioProtocol
+		capabilities []plugin_entities.PluginCapability
+		// 确认中的协议和能力
+		expectedProtocol     plugin_entities.PluginStdioProtocol
+		expectedCapabilities []plugin_entities.PluginCapability
+	}{
+		{
+			"未声明能力时沿用选择的协议",
+			plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR, nil,
+			plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR, nil,
+		},
+		{
+			"声明二进制帧",
+			plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR,
+			[]plugin_entities.PluginCapability{plugin_entities.PLUGIN_CAPABILITY_BINARY_FRAMING, plugin_entities.PLUGIN_CAPABILITY_CANCEL},
+			plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR,
+			[]plugin_entities.PluginCapability{plugin_entities.PLUGIN_CAPABILITY_BINARY_FRAMING, plugin_entities.PLUGIN_CAPABILITY_CANCEL},
+		},
+		{
+			"没有二进制帧能力回退到 json lines",
+			plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_JSON,
+			[]plugin_entities.PluginCapability{plugin_entities.PLUGIN_CAPABILITY_STREAMING_ENDPOINT},
+			plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES,
+			[]plugin_entities.PluginCapability{plugin_entities.PLUGIN_CAPABILITY_STREAMING_ENDPOINT},
+		},
+		{
+			"忽略未知能力",
+			plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES,
+			[]plugin_entities.PluginCapability{"unknown", plugin_entities.PLUGIN_CAPABILITY_CANCEL},
+			plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES,
+			[]plugin_entities.PluginCapability{plugin_entities.PLUGIN_CAPABILITY_CANCEL},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stdin := &bytes.Buffer{}
+			holder := newStdioHolder("test-plugin", nopWriteCloser{stdin}, nil, nil, &StdioHolderConfig{
+				Protocols: allStdioProtocols,
+			})
+
+			protocol := holder.acceptHandshake(&plugin_entities.PluginHandshake{
+				Protocol:     tt.protocol,
+				SdkVersion:   "0.1.0",
+				Capabilities: tt.capabilities,
+			})
+			assert.Equal(t, tt.expectedProtocol, protocol)
+
+			ack, ok := plugin_entities.ParsePluginHandshake(bytes.TrimSpace(stdin.Bytes()))
+			require.True(t, ok)
+			assert.Equal(t, tt.expectedProtocol, ack.Protocol)
+			assert.Equal(t, tt.expectedCapabilities, ack.Capabilities)
+
+			capabilities, negotiated := holder.Capabilities()
+			assert.Equal(t, tt.capabilities != nil, negotiated)
+			assert.Equal(t, tt.expectedCapabilities, capabilities)
+		})
+	}
+}
+
+func TestStdioHolderRefuseHandshake(t *testing.T) {
+	stdoutReader, stdoutWriter := io.Pipe()
+	stdinReader, stdinWriter := io.Pipe()
+	t.Cleanup(func() {
+		stdoutWriter.Close()
+		stdinReader.Close()
+	})
+
+	logs := plugin_entities.NewPluginLogBuffer(10)
+	holder := newStdioHolder("test-plugin", stdinWriter, stdoutReader, stdoutReader, &StdioHolderConfig{
+		Protocols: allStdioProtocols,
+		Logs:      logs,
+		ValidateHandshake: func(handshake *plugin_entities.PluginHandshake) error {
+			return errors.New("plugin sdk 0.0.1 is not supported")
+		},
+	})
+	stopped := make(chan struct{})
+	go func() {
+		holder.StartStdout(func() {})
+		close(stopped)
+	}()
+
+	go stdoutWriter.Write(encodeStdioEvent(t, plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES, map[string]any{
+		"event": plugin_entities.PLUGIN_EVENT_HANDSHAKE,
+		"data":  plugin_entities.PluginHandshake{Protocol: plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES, SdkVersion: "0.0.1"},
+	}))
+
+	// 拒绝原因写在确认中
+	line, err := bufio.NewReader(stdinReader).ReadBytes('\n')
+	require.NoError(t, err)
+	ack, ok := plugin_entities.ParsePluginHandshake(line)
+	require.True(t, ok)
+	assert.Equal(t, "plugin sdk 0.0.1 is not supported", ack.Error)
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stdout is still read after the plugin is refused")
+	}
+	assert.EqualError(t, holder.Refused(), "plugin sdk 0.0.1 is not supported")
+	assert.True(t, holder.waitingControllerChanClosed)
+
+	entries := logs.Since(0)
+	require.Len(t, entries, 1)
+	assert.Equal(t, plugin_entities.PLUGIN_LOG_LEVEL_ERROR, entries[0].Level)
+}
+
+func TestReadLine(t *testing.T) {
+	reader := bufio.NewReaderSize(strings.NewReader("short\r\n"+strings.Repeat("a", 100)+"\nlast"), 16)
+
+	line, err := readLine(reader, 128)
+	require.NoError(t, err)
+	assert.Equal(t, "short", string(line))
+
+	// 超过缓冲区的行被拼接
+	line, err = readLine(reader, 128)
+	require.NoError(t, err)
+	assert.Len(t, line, 100)
+
+	line, err = readLine(reader, 128)
+	require.NoError(t, err)
+	assert.Equal(t, "last", string(line))
+
+	_, err = readLine(reader, 128)
+	assert.ErrorIs(t, err, io.EOF)
+
+	// 超过上限
+	_, err = readLine(bufio.NewReaderSize(strings.NewReader(strings.Repeat("a", 200)+"\n"), 16), 128)
+	assert.Error(t, err)
+}
+
+// BenchmarkStdioHolderStdout 对比各协议读取大消息（如 tts 音频）的吞吐
+func BenchmarkStdioHolderStdout(b *testing.B) {
+	audio := make([]byte, 256*1024)
+	for i := range audio {
+		audio[i] = byte(i)
+	}
+	const messages = 32
+
+	for _, protocol := range allStdioProtocols {
+		b.Run(string(protocol), func(b *testing.B) {
+			stream := bytes.NewBuffer(nil)
+			if protocol != plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES {
+				stream.Write(encodeStdioEvent(b, plugin_entities.PLUGIN_STDIO_PROTOCOL_JSON_LINES, map[string]any{
+					"event": plugin_entities.PLUGIN_EVENT_HANDSHAKE,
+					"data":  plugin_entities.PluginHandshake{Protocol: protocol},
+				}))
+			}
+			for range messages {
+				var payload any = base64.StdEncoding.EncodeToString(audio)
+				if protocol == plugin_entities.PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR {
+					// cbor 直接传输二进制
+					payload = audio
+				}
+				stream.Write(encodeStdioEvent(b, protocol, sessionEvent("s1", map[string]any{"result": payload})))
+			}
+			data := stream.Bytes()
+
+			b.SetBytes(int64(messages * len(audio)))
+			b.ResetTimer()
+			for range b.N {
+				holder := newStdioHolder("bench-plugin", nopWriteCloser{}, io.NopCloser(bytes.NewReader(data)), nil, &StdioHolderConfig{
+					StdoutBufferSize:    64 * 1024,
+					StdoutMaxBufferSize: 1024 * 1024,
+					Protocols:           allStdioProtocols,
+				})
+				received := 0
+				holder.setEventListener("s1", func(data []byte) {
+					var message plugin_entities.SessionMessage
+					if err := json.Unmarshal(data, &message); err == nil {
+						received++
+					}
+				})
+				holder.StartStdout(func() {})
+				if received != messages {
+					b.Fatalf("received %d messages, expected %d", received, messages)
+				}
+			}
+		})
+	}
+}
+
+// nopWriteCloser 丢弃写入的数据，或者写入 w
+type nopWriteCloser struct {
+	w io.Writer
+}
+
+func (n nopWriteCloser) Write(p []byte) (int, error) {
+	if n.w != nil {
+		return n.w.Write(p)
+	}
+	return len(p), nil
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -188,7 +188,7 @@ func TestStdioHolder(t *testing.T) {
 			func(err string) {
 				t.Errorf("Error handler should not be called: %s", err)
 			},
-			func(message string) {
+			func(sessionId string, log plugin_entities.PluginLogEvent) {
 				t.Error("Should not call info handler for session event")
 			},
 		)
@@ -218,7 +218,7 @@ func TestStdioHolder(t *testing.T) {
 				errorHandlerCalled = true
 				assert.Equal(t, "\"Test error message\"", err)
 			},
-			func(message string) {
+			func(sessionId string, log plugin_entities.PluginLogEvent) {
 				t.Error("Should not call info handler for error event")
 			},
 		)
@@ -243,7 +243,7 @@ func TestStdioHolder(t *testing.T) {
 				assert.Contains(t, err, "invalid character")
 				assert.Contains(t, err, "test-status")
 			},
-			func(message string) {
+			func(sessionId string, log plugin_entities.PluginLogEvent) {
 				t.Error("Should not call info handler for invalid JSON")
 			},
 		)
@@ -335,3 +335,20 @@ func TestStdioHolderWait(t *testing.T) {
 		}
 	})
 }
+
+func TestStdioHolderCollectLogs(t *testing.T) {
+	logs := plugin_entities.NewPluginLogBuffer(10)
+	pr, pw := io.Pipe()
+	holder := newStdioHolder("test-plugin", pw, pr, pr, &StdioHolderConfig{Logs: logs})
+
+	holder.appendStderr([]byte("Traceback (most recent call last):\n  File \"main.py\"\r\n\n"))
+
+	entries, total := logs.Query(plugin_entities.PluginLogFilter{}, 1, 10)
+	assert.Equal(t, 2, total)
+	assert.Equal(t, "  File \"main.py\"", entries[0].Message)
+	assert.Equal(t, plugin_entities.PLUGIN_LOG_SOURCE_STDERR, entries[0].Source)
+	assert.Equal(t, plugin_entities.PLUGIN_LOG_LEVEL_ERROR, entries[0].Level)
+
+	assert.Equal(t, plugin_entities.PLUGIN_LOG_LEVEL_WARN, normalizeLogLevel("WARNING"))
+	assert.Equal(t, plugin_entities.PLUGIN_LOG_LEVEL_INFO, normalizeLogLevel(""))
+}
@@ -0,0 +1,344 @@
+package local_runtime
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+const (
+	// touched whenever a cached virtual environment is restored, used by the gc
+	venvCacheLastUsedFile = ".last_used"
+	// path of the virtual environment an entry was built at
+	venvCacheOriginFile = ".origin"
+)
+
+// PythonVenvCache shares virtual environments between plugins with the same
+// requirements, entries are keyed by the requirements and the python version and
+// restored into the working path through hardlinks. Isolated plugins, which are able
+// to write their working path, get copies instead so that they can't modify the files
+// shared with other plugins. The wheels downloaded by uv are cached as well, the
+// total size is bounded by the gc
+type PythonVenvCache struct {
+	path    string
+	maxSize int64
+
+	// restoring holds the read lock, the gc never removes an entry being restored
+	lock sync.RWMutex
+}
+
+func NewPythonVenvCache(cachePath string, maxSize int64) *PythonVenvCache {
+	return &PythonVenvCache{
+		path:    cachePath,
+		maxSize: maxSize,
+	}
+}
+
+func (c *PythonVenvCache) Key(requirementsHash string, pythonVersion string) string {
+	sum := sha256.Sum256([]byte(pythonVersion + ":" + requirementsHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// UvCacheDir is passed to uv as UV_CACHE_DIR
+func (c *PythonVenvCache) UvCacheDir() string {
+	return path.Join(c.path, "uv")
+}
+
+func (c *PythonVenvCache) entryPath(key string) string {
+	return path.Join(c.path, "venvs", key)
+}
+
+// Restore links the cached virtual environment of key into venvPath, or copies it if
+// isolated is set, it returns false if there is none
+func (c *PythonVenvCache) Restore(key string, venvPath string, isolated bool) (bool, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	entry := c.entryPath(key)
+	if _, err := os.Stat(entry); err != nil {
+		return false, nil
+	}
+
+	if err := linkTree(entry, venvPath, !isolated); err != nil {
+		os.RemoveAll(venvPath)
+		return false, errors.Join(err, fmt.Errorf("restore virtual environment from cache error"))
+	}
+	os.Remove(path.Join(venvPath, venvCacheLastUsedFile))
+	os.Remove(path.Join(venvPath, venvCacheOriginFile))
+
+	if origin, err := os.ReadFile(path.Join(entry, venvCacheOriginFile)); err == nil {
+		if err := relocateVenvScripts(venvPath, string(origin)); err != nil {
+			os.RemoveAll(venvPath)
+			return false, errors.Join(err, fmt.Errorf("relocate virtual environment error"))
+		}
+	}
+
+	now := time.Now()
+	if err := os.Chtimes(path.Join(entry, venvCacheLastUsedFile), now, now); err != nil {
+		os.WriteFile(path.Join(entry, venvCacheLastUsedFile), nil, 0644)
+	}
+	return true, nil
+}
+
+// Store caches venvPath as the virtual environment of key, an existing entry is kept.
+// The files are copied if isolated is set, the plugin keeps writing to venvPath
+func (c *PythonVenvCache) Store(key string, venvPath string, isolated bool) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	entry := c.entryPath(key)
+	if _, err := os.Stat(entry); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(path.Dir(entry), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(path.Dir(entry), key+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := linkTree(venvPath, tmp, !isolated); err != nil {
+		return errors.Join(err, fmt.Errorf("copy virtual environment to cache error"))
+	}
+	// the meta of the working path is written by the runtime itself
+	os.Remove(path.Join(tmp, "plugin.json"))
+	if err := os.WriteFile(path.Join(tmp, venvCacheLastUsedFile), nil, 0644); err != nil {
+		return err
+	}
+	origin, err := filepath.Abs(venvPath)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(tmp, venvCacheOriginFile), []byte(origin), 0644); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, entry); err != nil {
+		// another plugin cached the same requirements meanwhile
+		if _, statErr := os.Stat(entry); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+type venvCacheEntry struct {
+	path     string
+	size     int64
+	lastUsed time.Time
+}
+
+// GC removes the least recently used virtual environments until the cache fits
+// into maxSize, the wheels of uv are pruned if that's not enough
+func (c *PythonVenvCache) GC(uvPath string) error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	// files are hardlinked between entries and the uv cache, count them only once
+	seen := map[fileKey]bool{}
+
+	uvSize, err := diskUsage(c.UvCacheDir(), seen)
+	if err != nil {
+		return err
+	}
+
+	dirs, err := os.ReadDir(path.Join(c.path, "venvs"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	total := uvSize
+	entries := []venvCacheEntry{}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		entry := venvCacheEntry{path: path.Join(c.path, "venvs", dir.Name())}
+		if info, err := os.Stat(path.Join(entry.path, venvCacheLastUsedFile)); err == nil {
+			entry.lastUsed = info.ModTime()
+		} else if info, err := dir.Info(); err == nil {
+			// interrupted Store leaves temporary directories without the marker
+			entry.lastUsed = info.ModTime()
+		}
+		entry.size, err = diskUsage(entry.path, seen)
+		if err != nil {
+			return err
+		}
+		total += entry.size
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].lastUsed.Before(entries[j].lastUsed)
+	})
+
+	for _, entry := range entries {
+		if total <= c.maxSize {
+			return nil
+		}
+		if err := os.RemoveAll(entry.path); err != nil {
+			return err
+		}
+		utils.Info("removed cached virtual environment %s", path.Base(entry.path))
+		total -= entry.size
+	}
+
+	if total > c.maxSize && uvPath != "" {
+		cmd := exec.Command(uvPath, "cache", "prune", "--cache-dir", c.UvCacheDir())
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to prune uv cache: %s, output: %s", err, output)
+		}
+	}
+	return nil
+}
+
+func diskUsage(root string, seen map[fileKey]bool) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if key, ok := getFileKey(info); ok {
+			if seen[key] {
+				return nil
+			}
+			seen[key] = true
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
+
+// linkTree recreates src in dst, regular files are hardlinked if hardlink is set and
+// copied otherwise or if src and dst are on different filesystems
+func linkTree(src string, dst string, hardlink bool) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm())
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case d.Type().IsRegular():
+			if !hardlink {
+				return copyFile(p, target, info.Mode().Perm())
+			}
+			if err := os.Link(p, target); err == nil {
+				return nil
+			}
+			return copyFile(p, target, info.Mode().Perm())
+		}
+		// sockets, fifos and devices don't belong to a virtual environment
+		return nil
+	})
+}
+
+// relocateVenvScripts rewrites the scripts of a restored virtual environment,
+// shebangs and activate scripts contain the absolute path the venv was built at.
+// The rewritten scripts are replaced instead of modified, they are hardlinks
+func relocateVenvScripts(venvPath string, origin string) error {
+	target, err := filepath.Abs(venvPath)
+	if err != nil {
+		return err
+	}
+	if target == origin {
+		return nil
+	}
+
+	files, err := os.ReadDir(path.Join(venvPath, "bin"))
+	if err != nil {
+		return nil
+	}
+	for _, file := range files {
+		if !file.Type().IsRegular() {
+			continue
+		}
+		p := path.Join(venvPath, "bin", file.Name())
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if !bytes.Contains(content, []byte(origin)) {
+			continue
+		}
+		info, err := file.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(p); err != nil {
+			return err
+		}
+		content = bytes.ReplaceAll(content, []byte(origin), []byte(target))
+		if err := os.WriteFile(p, content, info.Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src string, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
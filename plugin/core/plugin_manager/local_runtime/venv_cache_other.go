@@ -0,0 +1,12 @@
+//go:build !unix
+
+package local_runtime
+
+import "io/fs"
+
+type fileKey struct{}
+
+// hardlinks can't be detected here, every file is counted
+func getFileKey(info fs.FileInfo) (fileKey, bool) {
+	return fileKey{}, false
+}
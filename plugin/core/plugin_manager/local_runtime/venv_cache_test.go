@@ -0,0 +1,194 @@
+package local_runtime
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/constants"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupFakeVenv creates a virtual environment whose python accepts any arguments
+func setupFakeVenv(t *testing.T, venvPath string) {
+	require.NoError(t, os.MkdirAll(path.Join(venvPath, "bin"), 0755))
+	require.NoError(t, os.MkdirAll(path.Join(venvPath, "lib/site-packages"), 0755))
+	require.NoError(t, os.WriteFile(path.Join(venvPath, "bin/python"), []byte("#!/bin/sh\nexit 0\n"), 0755))
+	require.NoError(t, os.Symlink("python", path.Join(venvPath, "bin/python3")))
+	require.NoError(t, os.WriteFile(path.Join(venvPath, "bin/activate"), []byte("VIRTUAL_ENV="+venvPath+"\n"), 0644))
+	require.NoError(t, os.WriteFile(path.Join(venvPath, "lib/site-packages/requests.py"), []byte("# requests"), 0644))
+	require.NoError(t, os.WriteFile(path.Join(venvPath, "plugin.json"), []byte("{}"), 0644))
+}
+
+func TestPythonVenvCacheStoreAndRestore(t *testing.T) {
+	cache := NewPythonVenvCache(t.TempDir(), 0)
+	key := cache.Key("hash", constants.PythonVersion)
+
+	origin := path.Join(t.TempDir(), ".venv")
+	setupFakeVenv(t, origin)
+
+	restored, err := cache.Restore(key, path.Join(t.TempDir(), ".venv"), false)
+	require.NoError(t, err)
+	assert.False(t, restored)
+
+	require.NoError(t, cache.Store(key, origin, false))
+	// an existing entry is kept
+	require.NoError(t, cache.Store(key, origin, false))
+
+	target := path.Join(t.TempDir(), ".venv")
+	restored, err = cache.Restore(key, target, false)
+	require.NoError(t, err)
+	assert.True(t, restored)
+
+	originInfo, err := os.Stat(path.Join(origin, "lib/site-packages/requests.py"))
+	require.NoError(t, err)
+	targetInfo, err := os.Stat(path.Join(target, "lib/site-packages/requests.py"))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(originInfo, targetInfo), "files should be hardlinked")
+
+	link, err := os.Readlink(path.Join(target, "bin/python3"))
+	require.NoError(t, err)
+	assert.Equal(t, "python", link)
+
+	activate, err := os.ReadFile(path.Join(target, "bin/activate"))
+	require.NoError(t, err)
+	assert.Equal(t, "VIRTUAL_ENV="+target+"\n", string(activate))
+	activate, err = os.ReadFile(path.Join(origin, "bin/activate"))
+	require.NoError(t, err)
+	assert.Equal(t, "VIRTUAL_ENV="+origin+"\n", string(activate), "the cached script must not be modified")
+
+	for _, name := range []string{"plugin.json", venvCacheLastUsedFile, venvCacheOriginFile} {
+		_, err := os.Stat(path.Join(target, name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+}
+
+func TestPythonVenvCacheIsolated(t *testing.T) {
+	sameFile := func(a, b string) bool {
+		aInfo, err := os.Stat(a)
+		require.NoError(t, err)
+		bInfo, err := os.Stat(b)
+		require.NoError(t, err)
+		return os.SameFile(aInfo, bInfo)
+	}
+	const requests = "lib/site-packages/requests.py"
+
+	tests := []struct {
+		name            string
+		storeIsolated   bool
+		restoreIsolated bool
+	}{
+		{name: "隔离的插件写入缓存", storeIsolated: true},
+		{name: "隔离的插件从缓存恢复", restoreIsolated: true},
+		{name: "写入和恢复都隔离", storeIsolated: true, restoreIsolated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewPythonVenvCache(t.TempDir(), 0)
+			key := cache.Key("hash", constants.PythonVersion)
+
+			origin := path.Join(t.TempDir(), ".venv")
+			setupFakeVenv(t, origin)
+			require.NoError(t, cache.Store(key, origin, tt.storeIsolated))
+			assert.Equal(t, !tt.storeIsolated, sameFile(path.Join(origin, requests), path.Join(cache.entryPath(key), requests)))
+
+			target := path.Join(t.TempDir(), ".venv")
+			restored, err := cache.Restore(key, target, tt.restoreIsolated)
+			require.NoError(t, err)
+			require.True(t, restored)
+			assert.Equal(t, !tt.restoreIsolated, sameFile(path.Join(target, requests), path.Join(cache.entryPath(key), requests)))
+
+			// writes of an isolated plugin never reach the cached entry
+			if tt.restoreIsolated {
+				require.NoError(t, os.WriteFile(path.Join(target, requests), []byte("# poisoned"), 0644))
+				content, err := os.ReadFile(path.Join(cache.entryPath(key), requests))
+				require.NoError(t, err)
+				assert.Equal(t, "# requests", string(content))
+			}
+			if tt.storeIsolated {
+				require.NoError(t, os.WriteFile(path.Join(origin, requests), []byte("# poisoned"), 0644))
+				content, err := os.ReadFile(path.Join(cache.entryPath(key), requests))
+				require.NoError(t, err)
+				assert.Equal(t, "# requests", string(content))
+			}
+		})
+	}
+}
+
+func TestPythonVenvCacheGC(t *testing.T) {
+	cachePath := t.TempDir()
+	cache := NewPythonVenvCache(cachePath, 250)
+
+	now := time.Now()
+	entries := []struct {
+		key      string
+		size     int
+		lastUsed time.Time
+	}{
+		{"oldest", 100, now.Add(-3 * time.Hour)},
+		{"older", 100, now.Add(-2 * time.Hour)},
+		{"newest", 100, now.Add(-time.Hour)},
+	}
+	for _, entry := range entries {
+		dir := cache.entryPath(entry.key)
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(path.Join(dir, "data"), make([]byte, entry.size), 0644))
+		require.NoError(t, os.WriteFile(path.Join(dir, venvCacheLastUsedFile), nil, 0644))
+		require.NoError(t, os.Chtimes(path.Join(dir, venvCacheLastUsedFile), entry.lastUsed, entry.lastUsed))
+	}
+	// wheels hardlinked into an entry are counted once
+	require.NoError(t, os.MkdirAll(cache.UvCacheDir(), 0755))
+	require.NoError(t, os.Link(path.Join(cache.entryPath("newest"), "data"), path.Join(cache.UvCacheDir(), "wheel")))
+
+	require.NoError(t, cache.GC(""))
+
+	exists := func(key string) bool {
+		_, err := os.Stat(cache.entryPath(key))
+		return err == nil
+	}
+	assert.False(t, exists("oldest"))
+	assert.True(t, exists("older"))
+	assert.True(t, exists("newest"))
+}
+
+func TestInitPythonRestoreFromCache(t *testing.T) {
+	cache := NewPythonVenvCache(t.TempDir(), 0)
+
+	// another plugin built the venv from the same requirements
+	other := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(other, "requirements.txt"), []byte("requests==2.31.0\n"), 0644))
+	hash, err := requirementsHash(other)
+	require.NoError(t, err)
+	setupFakeVenv(t, path.Join(other, ".venv"))
+	require.NoError(t, cache.Store(cache.Key(hash, constants.PythonVersion), path.Join(other, ".venv"), false))
+
+	workingPath := t.TempDir()
+	require.NoError(t, os.WriteFile(path.Join(workingPath, "requirements.txt"), []byte("requests==2.31.0\n"), 0644))
+
+	// uv is not available, only the cache can provide the venv
+	r := NewLocalPluginRuntime(LocalPluginRuntimeConfig{
+		UvPath:          path.Join(workingPath, "not-exists-uv"),
+		PythonVenvCache: cache,
+	})
+	r.State.WorkingPath = workingPath
+
+	progress := []string{}
+	r.SetInstallProgressHandler(func(stage plugin_entities.PluginInstallStage, message string) {
+		progress = append(progress, message)
+	})
+
+	require.NoError(t, r.InitPython())
+	assert.Equal(t, path.Join(workingPath, ".venv/bin/python"), r.pythonInterpreterPath)
+	assert.Equal(t, []string{
+		"requirements cached, reuse the shared virtual environment",
+		"pre-compiling the plugin",
+	}, progress)
+
+	meta, err := readPythonVenvMeta(workingPath)
+	require.NoError(t, err)
+	assert.Equal(t, hash, meta.RequirementsHash)
+}
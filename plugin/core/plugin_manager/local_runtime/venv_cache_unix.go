@@ -0,0 +1,21 @@
+//go:build unix
+
+package local_runtime
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+type fileKey struct {
+	dev uint64
+	ino uint64
+}
+
+func getFileKey(info fs.FileInfo) (fileKey, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, false
+	}
+	return fileKey{dev: uint64(stat.Dev), ino: uint64(stat.Ino)}, true
+}
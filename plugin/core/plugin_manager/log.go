@@ -0,0 +1,58 @@
+package plugin_manager
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+// startLogPersistence periodically flushes new logs of all runtimes to the log bucket
+func (p *PluginManager) startLogPersistence(config *core.Config) {
+	go func() {
+		// last persisted seq of each runtime
+		persisted := map[string]uint64{}
+		for range time.NewTicker(time.Duration(config.PluginLogPersistenceInterval) * time.Second).C {
+			p.persistLogs(persisted)
+		}
+	}()
+}
+
+func (p *PluginManager) persistLogs(persisted map[string]uint64) {
+	alive := map[string]bool{}
+
+	p.m.Range(func(key string, lifetime plugin_entities.PluginLifetime) bool {
+		alive[key] = true
+
+		logs := lifetime.Logs()
+		if logs == nil {
+			return true
+		}
+		entries := logs.Since(persisted[key])
+		if len(entries) == 0 {
+			return true
+		}
+
+		var buf bytes.Buffer
+		for _, entry := range entries {
+			buf.Write(utils.MarshalJsonBytes(entry))
+			buf.WriteByte('\n')
+		}
+
+		if err := p.logBucket.Save(plugin_entities.PluginUniqueIdentifier(key), entries[0].Seq, buf.Bytes()); err != nil {
+			utils.Error("persist logs of plugin %s failed: %s", key, err.Error())
+			return true
+		}
+		persisted[key] = entries[len(entries)-1].Seq
+		return true
+	})
+
+	// forget runtimes which have been removed
+	for key := range persisted {
+		if !alive[key] {
+			delete(persisted, key)
+		}
+	}
+}
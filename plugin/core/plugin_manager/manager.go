@@ -4,13 +4,17 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"runtime"
 	"strings"
 
 	"github.com/jjgagacy/workflow-app/plugin/cache"
 	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/core/constants"
 	"github.com/jjgagacy/workflow-app/plugin/core/db"
 	"github.com/jjgagacy/workflow-app/plugin/core/invocation"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/local_runtime"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/media_transport"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager/decoder"
 	"github.com/jjgagacy/workflow-app/plugin/model"
 	"github.com/jjgagacy/workflow-app/plugin/oss"
@@ -37,6 +41,12 @@ type PluginManager struct {
 	packageBucket *media_transport.PackageBucket
 	// installedBucket is used manage installed plugins
 	installedBucket *media_transport.InstalledBucket
+	// logBucket is used to persist plugin logs
+	logBucket *media_transport.LogBucket
+	// pythonVenvCache shares virtual environments between local plugins, nil if disabled
+	pythonVenvCache *local_runtime.PythonVenvCache
+	// resource alerts firing for each local plugin
+	resourceAlerts utils.Map[string, map[resourceAlert]bool]
 }
 
 var (
@@ -65,15 +75,34 @@ func InitGlobalManager(oss oss.OSS, config *core.Config) *PluginManager {
 			oss,
 			config.PluginInstalledPath,
 		),
+		logBucket: media_transport.NewLogBucket(
+			oss,
+			config.PluginLogPersistencePath,
+		),
+	}
+	if config.PythonVenvCacheEnabled != nil && *config.PythonVenvCacheEnabled {
+		manager.pythonVenvCache = local_runtime.NewPythonVenvCache(
+			config.PythonVenvCachePath,
+			config.PythonVenvCacheMaxSize,
+		)
 	}
 	return manager
 }
 
 func (p *PluginManager) Get(identity plugin_entities.PluginUniqueIdentifier) (plugin_entities.PluginLifetime, error) {
+	// mcp servers are configured on the daemon whatever the platform is
+	if v, ok := p.m.Load(string(identity)); ok && v.Type() == plugin_entities.PLUGIN_RUNTIME_TYPE_MCP {
+		return v, nil
+	}
+
 	if identity.RemoteLike() || p.config.Platform == core.PLATFORM_LOCAL {
 		// check if it's a debugging plugin or a local plugin
 		if v, ok := p.m.Load(string(identity)); ok {
-			return v, nil
+			return p.waitLaunched(v)
+		}
+		if !identity.RemoteLike() {
+			// installed plugins which are not running are launched on the first request
+			return p.coldStart(identity)
 		}
 		return nil, errors.New("plugin not found")
 	} else {
@@ -83,6 +112,42 @@ func (p *PluginManager) Get(identity plugin_entities.PluginUniqueIdentifier) (pl
 	return nil, errors.New("unsupported platform")
 }
 
+// RuntimeState returns the state of a plugin which is running, it's never launched
+func (p *PluginManager) RuntimeState(identity plugin_entities.PluginUniqueIdentifier) (plugin_entities.PluginRuntimeState, bool) {
+	lifetime, ok := p.m.Load(string(identity))
+	if !ok {
+		return plugin_entities.PluginRuntimeState{}, false
+	}
+	return lifetime.RuntimeState(), true
+}
+
+// RuntimeStates returns the states of all running plugins keyed by their unique identifier
+func (p *PluginManager) RuntimeStates() map[string]plugin_entities.PluginRuntimeState {
+	states := map[string]plugin_entities.PluginRuntimeState{}
+	p.m.Range(func(key string, value plugin_entities.PluginLifetime) bool {
+		states[key] = value.RuntimeState()
+		return true
+	})
+	return states
+}
+
+// ResetCrashLoop restarts a crash looping local plugin
+func (p *PluginManager) ResetCrashLoop(identity plugin_entities.PluginUniqueIdentifier) error {
+	lifetime, ok := p.m.Load(string(identity))
+	if !ok {
+		return errors.New("plugin not running")
+	}
+	replicas, ok := lifetime.(*local_runtime.LocalPluginReplicas)
+	if !ok {
+		return errors.New("plugin is not a local plugin")
+	}
+	if !replicas.ResetCrashLoop() {
+		return errors.New("plugin is not crash looping")
+	}
+	utils.Info("crash loop of plugin %s is reset", identity)
+	return nil
+}
+
 func (p *PluginManager) Launch(config *core.Config) {
 	if config.RedisUseSentinel {
 		sentinels := strings.Split(config.RedisSentinels, ",")
@@ -110,6 +175,8 @@ func (p *PluginManager) Launch(config *core.Config) {
 			utils.Panic("failed to init redis: %s", err.Error())
 		}
 	}
+	// declarations changed in place by other daemons
+	cache.SubscribePluginDeclarationInvalidation()
 	// invocation, err := invocation.NewInvocationDaemon(
 	// 	invocation.InvocationDaemonPayload{
 	// 		BaseUrl:      config.InnerApiUrl,
@@ -126,6 +193,7 @@ func (p *PluginManager) Launch(config *core.Config) {
 	// start local watcher
 	if config.Platform == core.PLATFORM_LOCAL {
 		p.startLocalWatcher(config)
+		p.startResourceSampler()
 	}
 	// start serverless watcher
 	if config.Platform == core.PLATFORM_SERVERLESS {
@@ -133,6 +201,12 @@ func (p *PluginManager) Launch(config *core.Config) {
 	}
 	// start remote watcher
 	p.startRemoteWatcher(config)
+	// connect the configured mcp servers
+	p.startMCPServers(config)
+
+	if config.PluginLogPersistenceEnabled {
+		p.startLogPersistence(config)
+	}
 }
 
 func (p *PluginManager) SavePackage(
@@ -150,6 +224,13 @@ func (p *PluginManager) SavePackage(
 		return nil, err
 	}
 
+	// an offline daemon can't fetch anything the package doesn't bundle
+	if p.config.PythonOfflineInstall && declaration.Meta.Runner.Language == constants.Python {
+		if err := plugin_packager.CheckOfflineWheels(zipDecoder, constants.Arch(runtime.GOARCH)); err != nil {
+			return nil, err
+		}
+	}
+
 	assets, err := zipDecoder.Assets()
 	if err != nil {
 		return nil, err
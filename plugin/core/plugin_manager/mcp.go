@@ -0,0 +1,103 @@
+package plugin_manager
+
+import (
+	"runtime/debug"
+
+	"github.com/jjgagacy/workflow-app/plugin/cache"
+	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/core/db"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/mcp_runtime"
+	"github.com/jjgagacy/workflow-app/plugin/model"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/types"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+// startMCPServers registers the mcp servers configured on the daemon, they're kept
+// connected on every platform as the daemon is the only way to reach them
+func (p *PluginManager) startMCPServers(config *core.Config) {
+	if config.MCPServersConfigPath == "" {
+		return
+	}
+
+	servers, err := mcp_runtime.LoadServersConfig(config.MCPServersConfigPath)
+	if err != nil {
+		utils.Error("load mcp servers failed: %s", err.Error())
+		return
+	}
+
+	for _, server := range servers {
+		runtime, err := mcp_runtime.NewMCPPluginRuntime(server, config.PluginLogBufferSize)
+		if err != nil {
+			utils.Error("create mcp runtime %s failed: %s", server.Name, err.Error())
+			continue
+		}
+		identity, _ := runtime.Identity()
+		if _, loaded := p.m.LoadOrStore(identity.String(), runtime); loaded {
+			continue
+		}
+
+		utils.Submit(map[string]string{
+			"module":   "plugin_manager",
+			"function": "startMCPServers",
+		}, func() {
+			defer func() {
+				if err := recover(); err != nil {
+					utils.Error("mcp runtime error: %v, stack: %s", err, debug.Stack())
+				}
+				p.m.Delete(identity.String())
+			}()
+
+			runtime.Run(func(declaration plugin_entities.PluginDeclaration) {
+				if err := saveMCPDeclaration(identity, declaration); err != nil {
+					utils.Error("save declaration of mcp server %s failed: %s", server.Name, err.Error())
+				}
+			})
+		})
+	}
+}
+
+// saveMCPDeclaration stores the declaration synthesized from the tools of the server,
+// it changes in place whenever the server changes its tools so the cached copies
+// are dropped on every daemon
+func saveMCPDeclaration(
+	identity plugin_entities.PluginUniqueIdentifier,
+	declaration plugin_entities.PluginDeclaration,
+) error {
+	record, err := db.GetOne[model.PluginDeclaration](
+		db.Equal("plugin_unique_identifier", identity.String()),
+	)
+	if err == types.ErrRecordNotFound {
+		return db.Create(&model.PluginDeclaration{
+			PluginUniqueIdentifier: identity.String(),
+			PluginID:               identity.PluginID(),
+			Declaration:            declaration,
+		})
+	} else if err != nil {
+		return err
+	}
+
+	if utils.MarshalJson(record.Declaration) == utils.MarshalJson(declaration) {
+		return nil
+	}
+	record.Declaration = declaration
+	if err := db.Update(&record); err != nil {
+		return err
+	}
+	if err := cache.BroadcastPluginDeclarationInvalidation(identity); err != nil {
+		utils.Warn("broadcast declaration invalidation of %s failed: %s", identity, err.Error())
+	}
+	return nil
+}
+
+// MCPServers returns the runtimes of the mcp servers configured on the daemon
+func (p *PluginManager) MCPServers() []*mcp_runtime.MCPPluginRuntime {
+	servers := []*mcp_runtime.MCPPluginRuntime{}
+	p.m.Range(func(key string, value plugin_entities.PluginLifetime) bool {
+		if runtime, ok := value.(*mcp_runtime.MCPPluginRuntime); ok {
+			servers = append(servers, runtime)
+		}
+		return true
+	})
+	return servers
+}
@@ -0,0 +1,187 @@
+package mcp_runtime
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+const (
+	CLIENT_NAME    = "monie-plugin-daemon"
+	CLIENT_VERSION = "0.1.0"
+
+	// max size of a message received from a server
+	MAX_MESSAGE_SIZE = 16 * 1024 * 1024
+)
+
+// message is any json-rpc message received from a server, requests and
+// notifications carry a method, responses a result or an error
+type message struct {
+	JSONRPC string              `json:"jsonrpc"`
+	ID      json.RawMessage     `json:"id,omitempty"`
+	Method  string              `json:"method,omitempty"`
+	Params  json.RawMessage     `json:"params,omitempty"`
+	Result  json.RawMessage     `json:"result,omitempty"`
+	Error   *mcp_entities.Error `json:"error,omitempty"`
+}
+
+func (m *message) isResponse() bool {
+	return m.Method == "" && len(m.ID) > 0
+}
+
+// transport carries the messages of a client to the server
+type transport interface {
+	// roundTrip sends the request and waits for the response of the server, headers
+	// are added to the request if the transport supports it
+	roundTrip(ctx context.Context, request *mcp_entities.Request, headers map[string]string) (*message, error)
+	// notify sends a notification, no response is expected
+	notify(request *mcp_entities.Request, headers map[string]string) error
+	// setProtocolVersion is called once the version is negotiated
+	setProtocolVersion(version string)
+	// done is closed once the connection to the server is lost
+	done() <-chan struct{}
+	close() error
+}
+
+// Client speaks mcp to a server, it's safe for concurrent use
+type Client struct {
+	transport transport
+	timeout   time.Duration
+	nextID    int64
+
+	serverInfo      mcp_entities.Implementation
+	protocolVersion string
+}
+
+func newClient(transport transport, timeout time.Duration) *Client {
+	return &Client{transport: transport, timeout: timeout}
+}
+
+// Initialize negotiates the protocol version with the server, it must be called
+// before any other method
+func (c *Client) Initialize(ctx context.Context) error {
+	var result mcp_entities.InitializeResult
+	if err := c.call(ctx, mcp_entities.METHOD_INITIALIZE, mcp_entities.InitializeParams{
+		ProtocolVersion: mcp_entities.LATEST_PROTOCOL_VERSION,
+		Capabilities:    map[string]any{},
+		ClientInfo:      mcp_entities.Implementation{Name: CLIENT_NAME, Version: CLIENT_VERSION},
+	}, &result, nil); err != nil {
+		return errors.Join(err, fmt.Errorf("initialize mcp session error"))
+	}
+
+	c.serverInfo = result.ServerInfo
+	c.protocolVersion = result.ProtocolVersion
+	c.transport.setProtocolVersion(result.ProtocolVersion)
+
+	return c.transport.notify(&mcp_entities.Request{
+		JSONRPC: mcp_entities.JSONRPC_VERSION,
+		Method:  mcp_entities.METHOD_NOTIFICATIONS_INITIALIZED,
+	}, nil)
+}
+
+// ListTools returns every tool of the server, following the pagination cursors
+func (c *Client) ListTools(ctx context.Context, headers map[string]string) ([]mcp_entities.Tool, error) {
+	tools := []mcp_entities.Tool{}
+	cursor := ""
+	for {
+		var result mcp_entities.ListToolsResult
+		if err := c.call(ctx, mcp_entities.METHOD_TOOLS_LIST, mcp_entities.ListToolsParams{
+			Cursor: cursor,
+		}, &result, headers); err != nil {
+			return nil, err
+		}
+		tools = append(tools, result.Tools...)
+		if result.NextCursor == "" || result.NextCursor == cursor {
+			return tools, nil
+		}
+		cursor = result.NextCursor
+	}
+}
+
+func (c *Client) CallTool(
+	ctx context.Context,
+	headers map[string]string,
+	name string,
+	arguments map[string]any,
+) (*mcp_entities.CallToolResult, error) {
+	var result mcp_entities.CallToolResult
+	if err := c.call(ctx, mcp_entities.METHOD_TOOLS_CALL, mcp_entities.CallToolParams{
+		Name:      name,
+		Arguments: arguments,
+	}, &result, headers); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+func (c *Client) Ping(ctx context.Context) error {
+	return c.call(ctx, mcp_entities.METHOD_PING, nil, nil, nil)
+}
+
+// Done is closed once the connection to the server is lost
+func (c *Client) Done() <-chan struct{} {
+	return c.transport.done()
+}
+
+func (c *Client) Close() error {
+	return c.transport.close()
+}
+
+// call sends a request and decodes its result, the server is told to stop the work
+// if ctx is cancelled before it answers
+func (c *Client) call(
+	ctx context.Context,
+	method string,
+	params any,
+	result any,
+	headers map[string]string,
+) error {
+	request := &mcp_entities.Request{
+		JSONRPC: mcp_entities.JSONRPC_VERSION,
+		ID:      json.RawMessage(strconv.FormatInt(atomic.AddInt64(&c.nextID, 1), 10)),
+		Method:  method,
+	}
+	if params != nil {
+		raw, err := json.Marshal(params)
+		if err != nil {
+			return err
+		}
+		request.Params = raw
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	response, err := c.transport.roundTrip(ctx, request, headers)
+	if err != nil {
+		if ctx.Err() != nil && method != mcp_entities.METHOD_INITIALIZE {
+			// best effort, the server may have answered in the meantime
+			c.transport.notify(&mcp_entities.Request{
+				JSONRPC: mcp_entities.JSONRPC_VERSION,
+				Method:  mcp_entities.METHOD_NOTIFICATIONS_CANCELLED,
+				Params: utils.MarshalJsonBytes(mcp_entities.CancelledParams{
+					RequestID: request.ID,
+					Reason:    ctx.Err().Error(),
+				}),
+			}, headers)
+		}
+		return err
+	}
+	if response.Error != nil {
+		return response.Error
+	}
+	if result == nil || len(response.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(response.Result, result); err != nil {
+		return errors.Join(err, fmt.Errorf("decode result of %s error", method))
+	}
+	return nil
+}
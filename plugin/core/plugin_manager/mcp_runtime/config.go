@@ -0,0 +1,145 @@
+package mcp_runtime
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/manifest_entites"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"gopkg.in/yaml.v3"
+)
+
+// author of the plugins synthesized from mcp servers
+const MCP_PLUGIN_AUTHOR = "mcp"
+
+const defaultServerVersion = "0.0.1"
+
+var serverNameRe = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// MCPServersConfig is the file listing the mcp servers exposed as tool providers
+type MCPServersConfig struct {
+	Servers []MCPServerConfig `yaml:"servers"`
+}
+
+// MCPServerConfig configures an mcp server reached either by launching a command
+// speaking the stdio transport or by the url of its streamable http endpoint
+type MCPServerConfig struct {
+	// name of the plugin and the tool provider, lowercase letters, digits, - and _
+	Name string `yaml:"name"`
+	// bump it to install the server as a new version of the plugin
+	Version     string `yaml:"version"`
+	Label       string `yaml:"label"`
+	Description string `yaml:"description"`
+	Icon        string `yaml:"icon"`
+
+	// stdio transport
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args"`
+	Env     map[string]string `yaml:"env"`
+	Dir     string            `yaml:"dir"`
+
+	// streamable http transport
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers"`
+
+	// seconds to wait for the server to answer a message, 60 if not set
+	Timeout int `yaml:"timeout"`
+
+	// credentials configured on the tool provider, they're passed with every
+	// invocation and forwarded to the server as headers or environment variables
+	Credentials []MCPCredentialConfig `yaml:"credentials"`
+}
+
+type MCPCredentialConfig struct {
+	Name     string `yaml:"name"`
+	Label    string `yaml:"label"`
+	Help     string `yaml:"help"`
+	Required bool   `yaml:"required"`
+	// secret-input if not set, text-input for values which are not secrets
+	Type string `yaml:"type"`
+
+	// header the value is sent in, http transport only
+	Header string `yaml:"header"`
+	// prepended to the value of the header, e.g. "Bearer "
+	Prefix string `yaml:"prefix"`
+	// environment variable the value is set to, stdio transport only
+	Env string `yaml:"env"`
+}
+
+// LoadServersConfig reads the mcp servers from a yaml file
+func LoadServersConfig(path string) ([]MCPServerConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("read mcp servers config error"))
+	}
+
+	var config MCPServersConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, errors.Join(err, fmt.Errorf("parse mcp servers config error"))
+	}
+
+	names := map[string]bool{}
+	for i := range config.Servers {
+		server := &config.Servers[i]
+		if err := server.validate(); err != nil {
+			return nil, fmt.Errorf("invalid mcp server %q: %s", server.Name, err.Error())
+		}
+		if names[server.Name] {
+			return nil, fmt.Errorf("duplicated mcp server %q", server.Name)
+		}
+		names[server.Name] = true
+	}
+	return config.Servers, nil
+}
+
+func (c *MCPServerConfig) validate() error {
+	if !serverNameRe.MatchString(c.Name) {
+		return errors.New("name must be 1-64 lowercase letters, digits, - or _")
+	}
+	if c.Version == "" {
+		c.Version = defaultServerVersion
+	}
+	if !manifest_entites.PluginDeclarationVersionRegex.MatchString(c.Version) {
+		return fmt.Errorf("invalid version %s", c.Version)
+	}
+	if (c.Command == "") == (c.URL == "") {
+		return errors.New("exactly one of command and url is required")
+	}
+	if c.Timeout <= 0 {
+		c.Timeout = 60
+	}
+
+	for i := range c.Credentials {
+		credential := &c.Credentials[i]
+		if credential.Name == "" {
+			return errors.New("name of credential is required")
+		}
+		if credential.Type == "" {
+			credential.Type = string(plugin_entities.CONFIG_TYPE_SECRET_INPUT)
+		}
+		if c.URL != "" && credential.Header == "" {
+			return fmt.Errorf("header of credential %s is required by the http transport", credential.Name)
+		}
+		if c.Command != "" && credential.Env == "" {
+			return fmt.Errorf("env of credential %s is required by the stdio transport", credential.Name)
+		}
+	}
+	return nil
+}
+
+// Identity is the unique identifier of the plugin synthesized from the server, the
+// checksum depends on the name and the version only so that changes of the command
+// or the url don't break the installations
+func (c *MCPServerConfig) Identity() (plugin_entities.PluginUniqueIdentifier, error) {
+	sum := sha256.Sum256([]byte(strings.Join([]string{MCP_PLUGIN_AUTHOR, c.Name, c.Version}, ":")))
+	return plugin_entities.NewPluginUniqueIdentifier(fmt.Sprintf(
+		"%s@%s",
+		plugin_entities.MarshalPluginID(MCP_PLUGIN_AUTHOR, c.Name, c.Version),
+		hex.EncodeToString(sum[:]),
+	))
+}
@@ -0,0 +1,130 @@
+package mcp_runtime
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeServersConfig(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "mcp.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestLoadServersConfig(t *testing.T) {
+	path := writeServersConfig(t, `
+servers:
+  - name: github
+    url: https://mcp.example.com/mcp
+    headers:
+      X-Client: daemon
+    credentials:
+      - name: token
+        header: Authorization
+        prefix: "Bearer "
+        required: true
+  - name: filesystem
+    version: 1.2.0
+    command: npx
+    args: ["-y", "@modelcontextprotocol/server-filesystem", "/data"]
+    timeout: 30
+    credentials:
+      - name: api_key
+        env: API_KEY
+`)
+
+	servers, err := LoadServersConfig(path)
+	require.NoError(t, err)
+	require.Len(t, servers, 2)
+
+	// 未配置的版本、超时和凭据类型使用默认值
+	assert.Equal(t, "0.0.1", servers[0].Version)
+	assert.Equal(t, 60, servers[0].Timeout)
+	assert.Equal(t, "secret-input", servers[0].Credentials[0].Type)
+	assert.Equal(t, "Bearer ", servers[0].Credentials[0].Prefix)
+
+	assert.Equal(t, "1.2.0", servers[1].Version)
+	assert.Equal(t, 30, servers[1].Timeout)
+	assert.Equal(t, []string{"-y", "@modelcontextprotocol/server-filesystem", "/data"}, servers[1].Args)
+}
+
+func TestLoadServersConfigInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{
+			name:    "名称不合法",
+			content: "servers:\n  - name: GitHub\n    url: http://localhost/mcp\n",
+			err:     "name must be",
+		},
+		{
+			name:    "没有命令和地址",
+			content: "servers:\n  - name: github\n",
+			err:     "exactly one of command and url",
+		},
+		{
+			name:    "同时配置命令和地址",
+			content: "servers:\n  - name: github\n    url: http://localhost/mcp\n    command: github-mcp\n",
+			err:     "exactly one of command and url",
+		},
+		{
+			name:    "版本不合法",
+			content: "servers:\n  - name: github\n    version: latest\n    url: http://localhost/mcp\n",
+			err:     "invalid version",
+		},
+		{
+			name:    "http 凭据缺少请求头",
+			content: "servers:\n  - name: github\n    url: http://localhost/mcp\n    credentials:\n      - name: token\n",
+			err:     "header of credential token",
+		},
+		{
+			name:    "stdio 凭据缺少环境变量",
+			content: "servers:\n  - name: github\n    command: github-mcp\n    credentials:\n      - name: token\n",
+			err:     "env of credential token",
+		},
+		{
+			name:    "名称重复",
+			content: "servers:\n  - name: github\n    url: http://localhost/a\n  - name: github\n    url: http://localhost/b\n",
+			err:     "duplicated mcp server",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadServersConfig(writeServersConfig(t, tt.content))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestServerIdentity(t *testing.T) {
+	config := MCPServerConfig{Name: "github", Version: "0.0.1", URL: "http://localhost/mcp"}
+	identity, err := config.Identity()
+	require.NoError(t, err)
+
+	assert.Equal(t, "mcp/github", identity.PluginID())
+	assert.Equal(t, "0.0.1", identity.Version().String())
+	assert.Equal(t, "mcp", identity.Author())
+	assert.Len(t, identity.Checksum(), 64)
+
+	// 更换地址不影响标识，已有的安装仍然有效
+	moved := config
+	moved.URL = "http://other/mcp"
+	movedIdentity, err := moved.Identity()
+	require.NoError(t, err)
+	assert.Equal(t, identity, movedIdentity)
+
+	// 升级版本得到新的标识
+	upgraded := config
+	upgraded.Version = "0.0.2"
+	upgradedIdentity, err := upgraded.Identity()
+	require.NoError(t, err)
+	assert.NotEqual(t, identity.Checksum(), upgradedIdentity.Checksum())
+}
@@ -0,0 +1,81 @@
+package mcp_runtime
+
+import (
+	"strings"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/tool_entities"
+)
+
+// ToolResponseChunks maps the content of an mcp tool result to the chunks a tool
+// plugin emits, it's the reverse of mcp.ToolResult
+//
+//   - text and text resources become text
+//   - images, audio and blob resources become blobs with their mime type
+//   - resource links become links
+//   - the structured content becomes a json chunk
+func ToolResponseChunks(result *mcp_entities.CallToolResult) []tool_entities.ToolResponseChunk {
+	chunks := make([]tool_entities.ToolResponseChunk, 0, len(result.Content)+1)
+	for _, content := range result.Content {
+		switch content.Type {
+		case mcp_entities.CONTENT_TYPE_TEXT:
+			chunks = append(chunks, textChunk(content.Text))
+		case mcp_entities.CONTENT_TYPE_IMAGE, mcp_entities.CONTENT_TYPE_AUDIO:
+			chunks = append(chunks, blobChunk(content.Data, content.MimeType))
+		case mcp_entities.CONTENT_TYPE_RESOURCE:
+			if content.Resource == nil {
+				continue
+			}
+			if content.Resource.Blob != "" {
+				chunks = append(chunks, blobChunk(content.Resource.Blob, content.Resource.MimeType))
+			} else {
+				chunks = append(chunks, textChunk(content.Resource.Text))
+			}
+		case mcp_entities.CONTENT_TYPE_RESOURCE_LINK:
+			chunks = append(chunks, tool_entities.ToolResponseChunk{
+				Type:    tool_entities.ToolResponseChunkTypeLink,
+				Message: map[string]any{"text": content.URI},
+				Meta:    map[string]any{"name": content.Name},
+			})
+		}
+	}
+
+	if result.StructuredContent != nil {
+		chunks = append(chunks, tool_entities.ToolResponseChunk{
+			Type:    tool_entities.ToolResponseChunkTypeJson,
+			Message: map[string]any{"json_object": result.StructuredContent},
+			Meta:    map[string]any{},
+		})
+	}
+	return chunks
+}
+
+// ErrorMessage joins the text of a result flagged as an error
+func ErrorMessage(result *mcp_entities.CallToolResult) string {
+	texts := []string{}
+	for _, content := range result.Content {
+		if content.Type == mcp_entities.CONTENT_TYPE_TEXT && content.Text != "" {
+			texts = append(texts, content.Text)
+		}
+	}
+	if len(texts) == 0 {
+		return "tool call failed"
+	}
+	return strings.Join(texts, "\n")
+}
+
+func textChunk(text string) tool_entities.ToolResponseChunk {
+	return tool_entities.ToolResponseChunk{
+		Type:    tool_entities.ToolResponseChunkTypeText,
+		Message: map[string]any{"text": text},
+		Meta:    map[string]any{},
+	}
+}
+
+func blobChunk(blob string, mimeType string) tool_entities.ToolResponseChunk {
+	return tool_entities.ToolResponseChunk{
+		Type:    tool_entities.ToolResponseChunkTypeBlob,
+		Message: map[string]any{"blob": blob},
+		Meta:    map[string]any{"mime_type": mimeType},
+	}
+}
@@ -0,0 +1,113 @@
+package mcp_runtime
+
+import (
+	"time"
+)
+
+const (
+	// stdio servers launched with credentials are closed once they are idle for this long
+	credentialClientIdleTimeout = 10 * time.Minute
+	// at most this many stdio servers are kept for credentials, the least recently
+	// used idle one is closed to make room
+	maxCredentialClients = 16
+)
+
+type credentialClient struct {
+	client     *Client
+	lastUsedAt time.Time
+	// requests sent through the client which are not finished yet
+	inFlight int
+}
+
+// credentialClients keeps the stdio servers launched with the credentials of a provider
+// by the hash of their environment, it's guarded by the lock of the runtime. Evicted
+// clients are returned to be closed outside of the lock
+type credentialClients struct {
+	clients     map[string]*credentialClient
+	idleTimeout time.Duration
+	max         int
+}
+
+func newCredentialClients(idleTimeout time.Duration, max int) *credentialClients {
+	return &credentialClients{
+		clients:     map[string]*credentialClient{},
+		idleTimeout: idleTimeout,
+		max:         max,
+	}
+}
+
+// acquire returns the client of key and marks it in use until release is called,
+// nil if there is none or its server exited
+func (c *credentialClients) acquire(key string, now time.Time) *Client {
+	entry, ok := c.clients[key]
+	if !ok {
+		return nil
+	}
+	select {
+	case <-entry.client.Done():
+		delete(c.clients, key)
+		return nil
+	default:
+	}
+	entry.inFlight++
+	entry.lastUsedAt = now
+	return entry.client
+}
+
+// add stores a client marked in use, the least recently used idle clients above the
+// limit are evicted
+func (c *credentialClients) add(key string, client *Client, now time.Time) []*Client {
+	c.clients[key] = &credentialClient{client: client, lastUsedAt: now, inFlight: 1}
+
+	evicted := []*Client{}
+	for len(c.clients) > c.max {
+		oldest := ""
+		for k, entry := range c.clients {
+			if entry.inFlight > 0 {
+				continue
+			}
+			if oldest == "" || entry.lastUsedAt.Before(c.clients[oldest].lastUsedAt) {
+				oldest = k
+			}
+		}
+		// all of them are in use, the limit is exceeded until they are released
+		if oldest == "" {
+			break
+		}
+		evicted = append(evicted, c.clients[oldest].client)
+		delete(c.clients, oldest)
+	}
+	return evicted
+}
+
+// release marks a request sent through the client of key finished
+func (c *credentialClients) release(key string, client *Client, now time.Time) {
+	entry, ok := c.clients[key]
+	if !ok || entry.client != client {
+		return
+	}
+	entry.inFlight--
+	entry.lastUsedAt = now
+}
+
+// evictIdle removes the clients not in use for the idle timeout
+func (c *credentialClients) evictIdle(now time.Time) []*Client {
+	evicted := []*Client{}
+	for k, entry := range c.clients {
+		if entry.inFlight == 0 && now.Sub(entry.lastUsedAt) >= c.idleTimeout {
+			evicted = append(evicted, entry.client)
+			delete(c.clients, k)
+		}
+	}
+	return evicted
+}
+
+// reset removes all clients
+func (c *credentialClients) reset() []*Client {
+	evicted := make([]*Client, 0, len(c.clients))
+	for _, entry := range c.clients {
+		evicted = append(evicted, entry.client)
+	}
+	c.clients = map[string]*credentialClient{}
+	return evicted
+}
@@ -0,0 +1,108 @@
+package mcp_runtime
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/stretchr/testify/assert"
+)
+
+// closingTransport 记录是否被关闭
+type closingTransport struct {
+	doneChan  chan struct{}
+	closeOnce sync.Once
+}
+
+func (t *closingTransport) roundTrip(context.Context, *mcp_entities.Request, map[string]string) (*message, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (t *closingTransport) notify(*mcp_entities.Request, map[string]string) error {
+	return nil
+}
+
+func (t *closingTransport) setProtocolVersion(string) {}
+
+func (t *closingTransport) done() <-chan struct{} {
+	return t.doneChan
+}
+
+func (t *closingTransport) close() error {
+	t.closeOnce.Do(func() {
+		close(t.doneChan)
+	})
+	return nil
+}
+
+func newClosingClient() *Client {
+	return newClient(&closingTransport{doneChan: make(chan struct{})}, time.Second)
+}
+
+func TestCredentialClientsEvictIdle(t *testing.T) {
+	clients := newCredentialClients(time.Minute, 16)
+	now := time.Now()
+
+	idle := newClosingClient()
+	busy := newClosingClient()
+	assert.Empty(t, clients.add("idle", idle, now))
+	assert.Empty(t, clients.add("busy", busy, now))
+	clients.release("idle", idle, now)
+
+	// 空闲时间未到不回收
+	assert.Empty(t, clients.evictIdle(now.Add(30*time.Second)))
+
+	// 只回收没有请求的客户端
+	assert.Equal(t, []*Client{idle}, clients.evictIdle(now.Add(time.Minute)))
+	assert.Nil(t, clients.acquire("idle", now))
+
+	// 请求结束后重新计时
+	clients.release("busy", busy, now.Add(time.Minute))
+	assert.Empty(t, clients.evictIdle(now.Add(90*time.Second)))
+	assert.Equal(t, []*Client{busy}, clients.evictIdle(now.Add(2*time.Minute)))
+}
+
+func TestCredentialClientsLimit(t *testing.T) {
+	clients := newCredentialClients(time.Minute, 2)
+	now := time.Now()
+
+	first := newClosingClient()
+	second := newClosingClient()
+	clients.add("first", first, now)
+	clients.add("second", second, now)
+	clients.release("second", second, now.Add(time.Second))
+	clients.release("first", first, now.Add(2*time.Second))
+
+	// 超出上限时回收最久未使用的空闲客户端
+	third := newClosingClient()
+	assert.Equal(t, []*Client{second}, clients.add("third", third, now.Add(3*time.Second)))
+	assert.Same(t, first, clients.acquire("first", now.Add(4*time.Second)))
+
+	// 所有客户端都在使用中时暂不回收
+	fourth := newClosingClient()
+	assert.Empty(t, clients.add("fourth", fourth, now.Add(5*time.Second)))
+	assert.Same(t, third, clients.acquire("third", now.Add(6*time.Second)))
+}
+
+func TestCredentialClientsExited(t *testing.T) {
+	clients := newCredentialClients(time.Minute, 16)
+	now := time.Now()
+
+	client := newClosingClient()
+	clients.add("key", client, now)
+	clients.release("key", client, now)
+	assert.Same(t, client, clients.acquire("key", now))
+
+	// 服务进程退出后不再复用
+	client.Close()
+	assert.Nil(t, clients.acquire("key", now))
+
+	// 断开连接时关闭所有客户端
+	other := newClosingClient()
+	clients.add("other", other, now)
+	assert.Equal(t, []*Client{other}, clients.reset())
+	assert.Nil(t, clients.acquire("other", now))
+}
@@ -0,0 +1,231 @@
+package mcp_runtime
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/manifest_entites"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+)
+
+var invalidToolNameCharRe = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// Declaration synthesizes the declaration of the tool provider backed by the server,
+// tools are named after the mcp tools with the characters a tool name doesn't allow
+// replaced, names maps them back to the names known by the server
+func Declaration(
+	config *MCPServerConfig,
+	tools []mcp_entities.Tool,
+) (declaration plugin_entities.PluginDeclaration, names map[string]string) {
+	label := config.Label
+	if label == "" {
+		label = config.Name
+	}
+	description := config.Description
+	if description == "" {
+		description = fmt.Sprintf("tools of the mcp server %s", config.Name)
+	}
+	icon := config.Icon
+	if icon == "" {
+		icon = "mcp.svg"
+	}
+
+	declaration.Version = manifest_entites.Version(config.Version)
+	declaration.Type = manifest_entites.PluginType
+	declaration.Author = MCP_PLUGIN_AUTHOR
+	declaration.Name = config.Name
+	declaration.Label = plugin_entities.I18nObject{EnUs: label}
+	declaration.Description = plugin_entities.I18nObject{EnUs: description}
+	declaration.IconSmall = icon
+	declaration.IconLarge = icon
+	declaration.Meta = plugin_entities.PluginMeta{
+		Version: "0.0.1",
+		// tool calls are cancelled with the notifications/cancelled of mcp
+		Capabilities: []plugin_entities.PluginCapability{plugin_entities.PLUGIN_CAPABILITY_CANCEL},
+	}
+	declaration.Plugins = plugin_entities.PluginExtensions{Tools: []string{}}
+
+	provider := &plugin_entities.ToolProviderDeclaration{
+		Identity: plugin_entities.ToolProviderIdentity{
+			Author:      MCP_PLUGIN_AUTHOR,
+			Name:        config.Name,
+			Label:       plugin_entities.I18nObject{EnUs: label},
+			Description: plugin_entities.I18nObject{EnUs: description},
+			Icon:        icon,
+		},
+		CredentialsSchema: credentialsSchema(config.Credentials),
+		Tools:             make([]plugin_entities.ToolDeclaration, 0, len(tools)),
+	}
+
+	names = make(map[string]string, len(tools))
+	for _, tool := range tools {
+		name := invalidToolNameCharRe.ReplaceAllString(tool.Name, "_")
+		if _, ok := names[name]; ok || name == "" {
+			// two tools differ in the replaced characters only, the later is unreachable
+			continue
+		}
+		names[name] = tool.Name
+		provider.Tools = append(provider.Tools, toolDeclaration(name, tool))
+	}
+	declaration.Tool = provider
+
+	return declaration, names
+}
+
+func credentialsSchema(credentials []MCPCredentialConfig) []plugin_entities.ProviderConfig {
+	schema := make([]plugin_entities.ProviderConfig, 0, len(credentials))
+	for _, credential := range credentials {
+		label := credential.Label
+		if label == "" {
+			label = credential.Name
+		}
+		config := plugin_entities.ProviderConfig{
+			Name:     credential.Name,
+			Type:     credential.Type,
+			Required: credential.Required,
+			Label:    &plugin_entities.I18nObject{EnUs: label},
+		}
+		if credential.Help != "" {
+			config.Help = &plugin_entities.I18nObject{EnUs: credential.Help}
+		}
+		schema = append(schema, config)
+	}
+	return schema
+}
+
+func toolDeclaration(name string, tool mcp_entities.Tool) plugin_entities.ToolDeclaration {
+	label := tool.Title
+	if label == "" {
+		label = tool.Name
+	}
+	description := tool.Description
+	if description == "" {
+		description = label
+	}
+
+	declaration := plugin_entities.ToolDeclaration{
+		Identity: plugin_entities.ToolIdentity{
+			Author: MCP_PLUGIN_AUTHOR,
+			Name:   name,
+			Label:  plugin_entities.I18nObject{EnUs: label},
+		},
+		Description: plugin_entities.ToolDescription{
+			Description: plugin_entities.I18nObject{EnUs: description},
+			LLM:         description,
+		},
+		Parameters: toolParameters(tool.InputSchema),
+	}
+	if tool.OutputSchema != nil {
+		declaration.OutputSchema = plugin_entities.ToolOutputSchema(tool.OutputSchema)
+	}
+	return declaration
+}
+
+// toolParameters maps the properties of the input schema to parameters filled in by
+// the model, the order of the parameters is the order of their names
+func toolParameters(schema map[string]any) []plugin_entities.ToolParameter {
+	properties, _ := schema["properties"].(map[string]any)
+	required := map[string]bool{}
+	if names, ok := schema["required"].([]any); ok {
+		for _, name := range names {
+			if s, ok := name.(string); ok {
+				required[s] = true
+			}
+		}
+	}
+
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parameters := make([]plugin_entities.ToolParameter, 0, len(names))
+	for _, name := range names {
+		property, _ := properties[name].(map[string]any)
+		parameters = append(parameters, toolParameter(name, property, required[name]))
+	}
+	return parameters
+}
+
+func toolParameter(name string, property map[string]any, required bool) plugin_entities.ToolParameter {
+	description, _ := property["description"].(string)
+	title, _ := property["title"].(string)
+	if title == "" {
+		title = name
+	}
+
+	parameter := plugin_entities.ToolParameter{
+		Name:           name,
+		Label:          plugin_entities.I18nObject{EnUs: title},
+		Description:    plugin_entities.I18nObject{EnUs: description},
+		Form:           plugin_entities.TOOL_PARAMETER_FROM_LLM,
+		LLMDescription: description,
+		Required:       required,
+		Default:        property["default"],
+	}
+
+	// nullable properties are declared as a list of types, e.g. ["string", "null"]
+	propertyType, _ := property["type"].(string)
+	if types, ok := property["type"].([]any); ok {
+		for _, t := range types {
+			if s, ok := t.(string); ok && s != "null" {
+				propertyType = s
+				break
+			}
+		}
+	}
+
+	switch propertyType {
+	case "string":
+		parameter.Type = plugin_entities.TOOL_PARAMETER_TYPE_STRING
+		if enum, ok := property["enum"].([]any); ok && len(enum) > 0 {
+			parameter.Type = plugin_entities.TOOL_PARAMETER_TYPE_SELECT
+			for _, value := range enum {
+				s := fmt.Sprint(value)
+				parameter.Options = append(parameter.Options, plugin_entities.ParameterOption{
+					Value: s,
+					Label: plugin_entities.I18nObject{EnUs: s},
+				})
+			}
+		}
+	case "integer":
+		parameter.Type = plugin_entities.TOOL_PARAMETER_TYPE_NUMBER
+		precision := 0
+		parameter.Precision = &precision
+	case "number":
+		parameter.Type = plugin_entities.TOOL_PARAMETER_TYPE_NUMBER
+	case "boolean":
+		parameter.Type = plugin_entities.TOOL_PARAMETER_TYPE_BOOLEAN
+	case "object":
+		parameter.Type = plugin_entities.TOOL_PARAMETER_TYPE_OBJECT
+	case "array":
+		parameter.Type = plugin_entities.TOOL_PARAMETER_TYPE_ARRAY
+	default:
+		parameter.Type = plugin_entities.TOOL_PARAMETER_TYPE_ANY
+	}
+
+	if parameter.Type == plugin_entities.TOOL_PARAMETER_TYPE_NUMBER {
+		if min, ok := property["minimum"].(float64); ok {
+			parameter.Min = &min
+		}
+		if max, ok := property["maximum"].(float64); ok {
+			parameter.Max = &max
+		}
+	}
+	if !isBasicValue(parameter.Default) {
+		// defaults of objects and arrays are not supported by the declarations
+		parameter.Default = nil
+	}
+	return parameter
+}
+
+func isBasicValue(v any) bool {
+	switch v.(type) {
+	case nil, string, float64, bool:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package mcp_runtime
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/tool_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeSchema(t *testing.T, schema string) map[string]any {
+	var result map[string]any
+	require.NoError(t, json.Unmarshal([]byte(schema), &result))
+	return result
+}
+
+func TestDeclaration(t *testing.T) {
+	config := &MCPServerConfig{
+		Name:    "github",
+		Version: "0.0.1",
+		Label:   "GitHub",
+		URL:     "http://localhost/mcp",
+		Credentials: []MCPCredentialConfig{
+			{Name: "token", Label: "Token", Required: true, Type: "secret-input", Header: "Authorization"},
+		},
+	}
+	tools := []mcp_entities.Tool{
+		{
+			Name:        "search.issues",
+			Title:       "Search issues",
+			Description: "search issues of a repository",
+			InputSchema: decodeSchema(t, `{
+				"type": "object",
+				"properties": {
+					"query": {"type": "string", "description": "search query"},
+					"state": {"type": "string", "enum": ["open", "closed"], "default": "open"},
+					"limit": {"type": "integer", "minimum": 1, "maximum": 100},
+					"score": {"type": "number"},
+					"draft": {"type": "boolean"},
+					"labels": {"type": "array", "items": {"type": "string"}},
+					"filter": {"type": "object", "default": {"a": 1}},
+					"milestone": {"type": ["string", "null"]},
+					"extra": {}
+				},
+				"required": ["query", "limit"]
+			}`),
+		},
+		// 与上一个工具只有被替换的字符不同，无法区分
+		{Name: "search/issues", InputSchema: decodeSchema(t, `{"type": "object"}`)},
+		{Name: "get_me", InputSchema: decodeSchema(t, `{"type": "object"}`)},
+	}
+
+	declaration, names := Declaration(config, tools)
+
+	assert.Equal(t, "mcp/github:0.0.1", declaration.Identity())
+	assert.Equal(t, "GitHub", declaration.Label.EnUs)
+	assert.True(t, declaration.Meta.HasCapability(plugin_entities.PLUGIN_CAPABILITY_CANCEL))
+	require.NotNil(t, declaration.Tool)
+	assert.Equal(t, "github", declaration.Tool.Identity.Name)
+	require.Len(t, declaration.Tool.CredentialsSchema, 1)
+	assert.Equal(t, "token", declaration.Tool.CredentialsSchema[0].Name)
+	assert.Equal(t, "secret-input", declaration.Tool.CredentialsSchema[0].Type)
+	assert.True(t, declaration.Tool.CredentialsSchema[0].Required)
+
+	assert.Equal(t, map[string]string{"search_issues": "search.issues", "get_me": "get_me"}, names)
+	require.Len(t, declaration.Tool.Tools, 2)
+
+	tool := declaration.Tool.Tools[0]
+	assert.Equal(t, "search_issues", tool.Identity.Name)
+	assert.Equal(t, "Search issues", tool.Identity.Label.EnUs)
+	assert.Equal(t, "search issues of a repository", tool.Description.LLM)
+
+	parameters := map[string]plugin_entities.ToolParameter{}
+	for _, parameter := range tool.Parameters {
+		assert.Equal(t, plugin_entities.TOOL_PARAMETER_FROM_LLM, parameter.Form)
+		parameters[parameter.Name] = parameter
+	}
+
+	tests := []struct {
+		name      string
+		paramType plugin_entities.ToolParameterType
+		required  bool
+	}{
+		{"query", plugin_entities.TOOL_PARAMETER_TYPE_STRING, true},
+		{"state", plugin_entities.TOOL_PARAMETER_TYPE_SELECT, false},
+		{"limit", plugin_entities.TOOL_PARAMETER_TYPE_NUMBER, true},
+		{"score", plugin_entities.TOOL_PARAMETER_TYPE_NUMBER, false},
+		{"draft", plugin_entities.TOOL_PARAMETER_TYPE_BOOLEAN, false},
+		{"labels", plugin_entities.TOOL_PARAMETER_TYPE_ARRAY, false},
+		{"filter", plugin_entities.TOOL_PARAMETER_TYPE_OBJECT, false},
+		{"milestone", plugin_entities.TOOL_PARAMETER_TYPE_STRING, false},
+		{"extra", plugin_entities.TOOL_PARAMETER_TYPE_ANY, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parameter, ok := parameters[tt.name]
+			require.True(t, ok)
+			assert.Equal(t, tt.paramType, parameter.Type)
+			assert.Equal(t, tt.required, parameter.Required)
+		})
+	}
+
+	assert.Equal(t, "search query", parameters["query"].LLMDescription)
+	assert.Equal(t, "open", parameters["state"].Default)
+	require.Len(t, parameters["state"].Options, 2)
+	assert.Equal(t, "closed", parameters["state"].Options[1].Value)
+	require.NotNil(t, parameters["limit"].Precision)
+	assert.Equal(t, 0, *parameters["limit"].Precision)
+	assert.Equal(t, float64(100), *parameters["limit"].Max)
+	assert.Nil(t, parameters["score"].Precision)
+	// 对象的默认值不被声明支持
+	assert.Nil(t, parameters["filter"].Default)
+
+	// 生成的参数再转换回 json schema 时保持一致
+	schema := plugin_entities.ToolParametersJsonSchema(tool.Parameters)
+	assert.ElementsMatch(t, []string{"query", "limit"}, schema["required"])
+}
+
+func TestToolResponseChunks(t *testing.T) {
+	result := &mcp_entities.CallToolResult{
+		Content: []mcp_entities.Content{
+			{Type: mcp_entities.CONTENT_TYPE_TEXT, Text: "hello"},
+			{Type: mcp_entities.CONTENT_TYPE_IMAGE, Data: "aW1hZ2U=", MimeType: "image/png"},
+			{Type: mcp_entities.CONTENT_TYPE_AUDIO, Data: "YXVkaW8=", MimeType: "audio/wav"},
+			{Type: mcp_entities.CONTENT_TYPE_RESOURCE, Resource: &mcp_entities.EmbeddedResource{URI: "file:///a.txt", Text: "content"}},
+			{Type: mcp_entities.CONTENT_TYPE_RESOURCE, Resource: &mcp_entities.EmbeddedResource{URI: "file:///a.pdf", Blob: "cGRm", MimeType: "application/pdf"}},
+			{Type: mcp_entities.CONTENT_TYPE_RESOURCE_LINK, URI: "https://example.com/a", Name: "a"},
+		},
+		StructuredContent: map[string]any{"count": float64(1)},
+	}
+
+	chunks := ToolResponseChunks(result)
+	require.Len(t, chunks, 7)
+
+	expected := []struct {
+		chunkType tool_entities.ToolResponseChunkType
+		key       string
+		value     any
+	}{
+		{tool_entities.ToolResponseChunkTypeText, "text", "hello"},
+		{tool_entities.ToolResponseChunkTypeBlob, "blob", "aW1hZ2U="},
+		{tool_entities.ToolResponseChunkTypeBlob, "blob", "YXVkaW8="},
+		{tool_entities.ToolResponseChunkTypeText, "text", "content"},
+		{tool_entities.ToolResponseChunkTypeBlob, "blob", "cGRm"},
+		{tool_entities.ToolResponseChunkTypeLink, "text", "https://example.com/a"},
+		{tool_entities.ToolResponseChunkTypeJson, "json_object", map[string]any{"count": float64(1)}},
+	}
+	for i, e := range expected {
+		assert.Equal(t, e.chunkType, chunks[i].Type)
+		assert.Equal(t, e.value, chunks[i].Message[e.key])
+	}
+	assert.Equal(t, "image/png", chunks[1].Meta["mime_type"])
+	assert.Equal(t, "application/pdf", chunks[4].Meta["mime_type"])
+}
+
+func TestErrorMessage(t *testing.T) {
+	assert.Equal(t, "tool call failed", ErrorMessage(&mcp_entities.CallToolResult{IsError: true}))
+	assert.Equal(t, "a\nb", ErrorMessage(&mcp_entities.CallToolResult{
+		Content: []mcp_entities.Content{
+			{Type: mcp_entities.CONTENT_TYPE_TEXT, Text: "a"},
+			{Type: mcp_entities.CONTENT_TYPE_IMAGE, Data: "x"},
+			{Type: mcp_entities.CONTENT_TYPE_TEXT, Text: "b"},
+		},
+		IsError: true,
+	}))
+}
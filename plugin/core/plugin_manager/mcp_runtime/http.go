@@ -0,0 +1,225 @@
+package mcp_runtime
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+const (
+	HEADER_MCP_SESSION_ID       = "Mcp-Session-Id"
+	HEADER_MCP_PROTOCOL_VERSION = "MCP-Protocol-Version"
+)
+
+// httpTransport speaks to a server over the streamable http transport, the server
+// answers a request either with a json body or with an event stream
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	lock            sync.RWMutex
+	sessionID       string
+	protocolVersion string
+
+	doneChan  chan struct{}
+	closeOnce sync.Once
+}
+
+func newHTTPTransport(config *MCPServerConfig) *httpTransport {
+	return &httpTransport{
+		url:      config.URL,
+		headers:  config.Headers,
+		client:   &http.Client{},
+		doneChan: make(chan struct{}),
+	}
+}
+
+func (t *httpTransport) newRequest(
+	ctx context.Context,
+	method string,
+	body []byte,
+	headers map[string]string,
+) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, t.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+
+	t.lock.RLock()
+	if t.sessionID != "" {
+		req.Header.Set(HEADER_MCP_SESSION_ID, t.sessionID)
+	}
+	if t.protocolVersion != "" {
+		req.Header.Set(HEADER_MCP_PROTOCOL_VERSION, t.protocolVersion)
+	}
+	t.lock.RUnlock()
+
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req, nil
+}
+
+func (t *httpTransport) post(
+	ctx context.Context,
+	body []byte,
+	headers map[string]string,
+) (*http.Response, error) {
+	req, err := t.newRequest(ctx, http.MethodPost, body, headers)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("request mcp server error"))
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		t.lock.RLock()
+		expired := t.sessionID != ""
+		t.lock.RUnlock()
+		if expired {
+			// the session is gone, the client has to initialize a new one
+			resp.Body.Close()
+			t.shutdown()
+			return nil, errors.New("mcp session expired")
+		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("mcp server responded with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	if sessionID := resp.Header.Get(HEADER_MCP_SESSION_ID); sessionID != "" {
+		t.lock.Lock()
+		t.sessionID = sessionID
+		t.lock.Unlock()
+	}
+	return resp, nil
+}
+
+func (t *httpTransport) roundTrip(
+	ctx context.Context,
+	request *mcp_entities.Request,
+	headers map[string]string,
+) (*message, error) {
+	resp, err := t.post(ctx, utils.MarshalJsonBytes(request), headers)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "text/event-stream" {
+		return readEventStream(resp.Body, request.ID)
+	}
+
+	var m message
+	if err := json.NewDecoder(io.LimitReader(resp.Body, MAX_MESSAGE_SIZE)).Decode(&m); err != nil {
+		return nil, errors.Join(err, fmt.Errorf("decode mcp response error"))
+	}
+	return &m, nil
+}
+
+// readEventStream returns the response to the request id carried by the stream,
+// requests and notifications of the server sent before it are skipped
+func readEventStream(reader io.Reader, id json.RawMessage) (*message, error) {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_MESSAGE_SIZE)
+
+	data := bytes.Buffer{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+
+		// an empty line dispatches the event
+		var m message
+		err := json.Unmarshal(data.Bytes(), &m)
+		data.Reset()
+		if err != nil {
+			continue
+		}
+		if m.isResponse() && bytes.Equal(m.ID, id) {
+			return &m, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Join(err, fmt.Errorf("read mcp event stream error"))
+	}
+	return nil, errors.New("mcp event stream closed without response")
+}
+
+func (t *httpTransport) notify(request *mcp_entities.Request, headers map[string]string) error {
+	resp, err := t.post(context.Background(), utils.MarshalJsonBytes(request), headers)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (t *httpTransport) setProtocolVersion(version string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.protocolVersion = version
+}
+
+func (t *httpTransport) done() <-chan struct{} {
+	return t.doneChan
+}
+
+func (t *httpTransport) shutdown() {
+	t.closeOnce.Do(func() {
+		close(t.doneChan)
+	})
+}
+
+// close terminates the session on the server, servers without sessions ignore it
+func (t *httpTransport) close() error {
+	defer t.shutdown()
+
+	t.lock.RLock()
+	sessionID := t.sessionID
+	t.lock.RUnlock()
+	if sessionID == "" {
+		return nil
+	}
+
+	req, err := t.newRequest(context.Background(), http.MethodDelete, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
@@ -0,0 +1,519 @@
+package mcp_runtime
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/access_types"
+	"github.com/jjgagacy/workflow-app/plugin/core/session_manager"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/tool_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+const (
+	minReconnectInterval = time.Second
+	maxReconnectInterval = time.Minute
+)
+
+// MCPPluginRuntime exposes the tools of an mcp server as a tool plugin, the declaration
+// is synthesized from the tool list of the server every time it's connected
+type MCPPluginRuntime struct {
+	plugin_entities.PluginRuntime
+
+	config   MCPServerConfig
+	identity plugin_entities.PluginUniqueIdentifier
+
+	lock sync.RWMutex
+	// nil while the server is not connected
+	client *Client
+	// names of the tools known by the server, by the name of the declared tool
+	names map[string]string
+	// stdio servers launched with the credentials of a provider
+	credentialClients *credentialClients
+
+	listeners utils.Map[string, *entities.Broadcast[plugin_entities.SessionMessage]]
+	cancels   utils.Map[string, context.CancelFunc]
+
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+func NewMCPPluginRuntime(config MCPServerConfig, logBufferSize int) (*MCPPluginRuntime, error) {
+	identity, err := config.Identity()
+	if err != nil {
+		return nil, err
+	}
+
+	declaration, _ := Declaration(&config, nil)
+	return &MCPPluginRuntime{
+		PluginRuntime: plugin_entities.PluginRuntime{
+			Config: declaration,
+			State: plugin_entities.PluginRuntimeState{
+				Status: plugin_entities.PLUGIN_RUNTIME_STATUS_PENDING.String(),
+			},
+			LogBuffer: plugin_entities.NewPluginLogBuffer(logBufferSize),
+		},
+		config:            config,
+		identity:          identity,
+		credentialClients: newCredentialClients(credentialClientIdleTimeout, maxCredentialClients),
+		stopChan:          make(chan struct{}),
+	}, nil
+}
+
+func (r *MCPPluginRuntime) Type() plugin_entities.PluginRuntimeType {
+	return plugin_entities.PLUGIN_RUNTIME_TYPE_MCP
+}
+
+func (r *MCPPluginRuntime) Identity() (plugin_entities.PluginUniqueIdentifier, error) {
+	return r.identity, nil
+}
+
+func (r *MCPPluginRuntime) Checksum() (string, error) {
+	return r.identity.Checksum(), nil
+}
+
+func (r *MCPPluginRuntime) UpdateScheduleAt(t time.Time) {
+	r.State.ScheduleAt = &t
+}
+
+// Configuration returns the declaration synthesized at the last connection
+func (r *MCPPluginRuntime) Configuration() *plugin_entities.PluginDeclaration {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	declaration := r.Config
+	return &declaration
+}
+
+func (r *MCPPluginRuntime) Stop() {
+	r.PluginRuntime.Stop()
+	r.stopOnce.Do(func() {
+		close(r.stopChan)
+	})
+}
+
+func (r *MCPPluginRuntime) Stopped() bool {
+	select {
+	case <-r.stopChan:
+		return true
+	default:
+		return false
+	}
+}
+
+// Run keeps the runtime connected to the server until it's stopped, onConnected
+// receives the declaration every time the server is connected
+func (r *MCPPluginRuntime) Run(onConnected func(declaration plugin_entities.PluginDeclaration)) {
+	defer r.TriggerStop()
+	go r.evictIdleCredentialClients()
+
+	interval := minReconnectInterval
+	for !r.Stopped() {
+		client, err := r.connect()
+		if err != nil {
+			r.State.FailureReason = err.Error()
+			r.Error(fmt.Sprintf("connect to mcp server failed: %s, retry in %s", err.Error(), interval))
+			select {
+			case <-r.stopChan:
+				return
+			case <-time.After(interval):
+			}
+			interval = min(interval*2, maxReconnectInterval)
+			continue
+		}
+
+		interval = minReconnectInterval
+		r.State.FailureReason = ""
+		r.SetActive()
+		r.SetActiveAt(time.Now())
+		r.Log("mcp server connected")
+		if onConnected != nil {
+			onConnected(*r.Configuration())
+		}
+
+		select {
+		case <-r.stopChan:
+		case <-client.Done():
+			r.Warn("connection to mcp server lost, reconnecting")
+			r.SetRestarting()
+			r.AddRestarts()
+		}
+		r.disconnect()
+	}
+}
+
+func (r *MCPPluginRuntime) connect() (*Client, error) {
+	client, err := r.dial(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-r.stopChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	tools, err := client.ListTools(ctx, nil)
+	if err != nil {
+		client.Close()
+		return nil, errors.Join(err, fmt.Errorf("list tools error"))
+	}
+
+	declaration, names := Declaration(&r.config, tools)
+	r.lock.Lock()
+	r.client = client
+	r.names = names
+	r.Config = declaration
+	r.lock.Unlock()
+	return client, nil
+}
+
+// dial connects to the server and initializes the session, env is passed to stdio
+// servers only
+func (r *MCPPluginRuntime) dial(env map[string]string) (*Client, error) {
+	var t transport
+	if r.config.URL != "" {
+		t = newHTTPTransport(&r.config)
+	} else {
+		stdio, err := startStdio(&r.config, env, r.appendStderr)
+		if err != nil {
+			return nil, err
+		}
+		t = stdio
+	}
+
+	client := newClient(t, time.Duration(r.config.Timeout)*time.Second)
+	if err := client.Initialize(context.Background()); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func (r *MCPPluginRuntime) disconnect() {
+	r.lock.Lock()
+	client := r.client
+	clients := r.credentialClients.reset()
+	r.client = nil
+	r.lock.Unlock()
+
+	if client != nil {
+		client.Close()
+	}
+	for _, c := range clients {
+		c.Close()
+	}
+}
+
+// appendStderr stores what the server writes on stderr, mcp servers log there so
+// it's not treated as errors
+func (r *MCPPluginRuntime) appendStderr(line string) {
+	if r.LogBuffer == nil || strings.TrimSpace(line) == "" {
+		return
+	}
+	r.LogBuffer.Append(plugin_entities.PluginLogEntry{
+		Level:   plugin_entities.PLUGIN_LOG_LEVEL_INFO,
+		Source:  plugin_entities.PLUGIN_LOG_SOURCE_STDERR,
+		Message: line,
+	})
+}
+
+// evictIdleCredentialClients closes the stdio servers launched with credentials once
+// they are idle, until the runtime is stopped
+func (r *MCPPluginRuntime) evictIdleCredentialClients() {
+	ticker := time.NewTicker(credentialClientIdleTimeout / 10)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stopChan:
+			return
+		case <-ticker.C:
+			r.lock.Lock()
+			evicted := r.credentialClients.evictIdle(time.Now())
+			r.lock.Unlock()
+			for _, c := range evicted {
+				c.Close()
+			}
+		}
+	}
+}
+
+// clientFor returns the client and the headers a request with the credentials of a
+// provider is sent with, http servers receive the credentials as headers while stdio
+// servers are launched once for each set of credentials. release must be called
+// once the request is finished
+func (r *MCPPluginRuntime) clientFor(credentials map[string]any) (*Client, map[string]string, func(), error) {
+	release := func() {}
+
+	r.lock.RLock()
+	client := r.client
+	r.lock.RUnlock()
+	if client == nil {
+		return nil, nil, release, errors.New("mcp server is not connected")
+	}
+
+	values := map[string]string{}
+	for _, credential := range r.config.Credentials {
+		value, ok := credentials[credential.Name]
+		if !ok || value == nil || fmt.Sprint(value) == "" {
+			continue
+		}
+		key := credential.Header
+		if r.config.URL == "" {
+			key = credential.Env
+		}
+		values[key] = credential.Prefix + fmt.Sprint(value)
+	}
+
+	if r.config.URL != "" {
+		return client, values, release, nil
+	}
+	if len(values) == 0 {
+		return client, nil, release, nil
+	}
+
+	key := envHash(values)
+	r.lock.Lock()
+	c := r.credentialClients.acquire(key, time.Now())
+	evicted := []*Client{}
+	if c == nil {
+		var err error
+		c, err = r.dial(values)
+		if err != nil {
+			r.lock.Unlock()
+			return nil, nil, release, err
+		}
+		evicted = r.credentialClients.add(key, c, time.Now())
+	}
+	r.lock.Unlock()
+
+	for _, e := range evicted {
+		e.Close()
+	}
+	release = func() {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.credentialClients.release(key, c, time.Now())
+	}
+	return c, nil, release, nil
+}
+
+func envHash(env map[string]string) string {
+	keys := make([]string, 0, len(env))
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	hash := sha256.New()
+	for _, k := range keys {
+		hash.Write([]byte(k))
+		hash.Write([]byte{0})
+		hash.Write([]byte(env[k]))
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func (r *MCPPluginRuntime) Listen(sessionId string) (*entities.Broadcast[plugin_entities.SessionMessage], error) {
+	r.lock.RLock()
+	connected := r.client != nil
+	r.lock.RUnlock()
+	if !connected {
+		return nil, errors.New("mcp server is not connected")
+	}
+
+	listener := entities.NewBroadcast[plugin_entities.SessionMessage]()
+	listener.OnClose(func() {
+		r.listeners.Delete(sessionId)
+	})
+	r.listeners.Store(sessionId, listener)
+	return listener, nil
+}
+
+// sessionRequest is the part of a session message the runtime needs
+type sessionRequest struct {
+	Event session_manager.EventStream `json:"event"`
+	Data  json.RawMessage             `json:"data"`
+}
+
+// Write handles a request of a session, the answer is sent to the listener of the
+// session once the server responds
+func (r *MCPPluginRuntime) Write(sessionId string, action access_types.PluginAccessAction, data []byte) {
+	request, err := utils.UnmarshalJsonBytes[sessionRequest](data)
+	if err != nil {
+		utils.Error("unmarshal session message of mcp server %s failed: %s", r.config.Name, err.Error())
+		return
+	}
+
+	switch request.Event {
+	case session_manager.EVENT_STREAM_CANCEL:
+		if cancel, ok := r.cancels.Load(sessionId); ok {
+			cancel()
+		}
+		return
+	case session_manager.EVENT_STREAM_REQUEST:
+	default:
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancels.Store(sessionId, cancel)
+	utils.Submit(map[string]string{
+		"module":   "mcp_runtime",
+		"function": "Write",
+	}, func() {
+		defer func() {
+			r.cancels.Delete(sessionId)
+			cancel()
+		}()
+		r.handle(ctx, sessionId, action, request.Data)
+	})
+}
+
+func (r *MCPPluginRuntime) handle(
+	ctx context.Context,
+	sessionId string,
+	action access_types.PluginAccessAction,
+	data []byte,
+) {
+	switch action {
+	case access_types.PLUGIN_ACCESS_ACTION_INVOKE_TOOL:
+		request, err := utils.UnmarshalJsonBytes[requests.RequestInvokeTool](data)
+		if err != nil {
+			r.sendError(sessionId, "InvalidRequestError", err.Error())
+			return
+		}
+		r.invokeTool(ctx, sessionId, &request)
+	case access_types.PLUGIN_ACCESS_ACTION_VALIDATE_TOOL_CREDENTIALS:
+		request, err := utils.UnmarshalJsonBytes[requests.RequestValidateToolCredentials](data)
+		if err != nil {
+			r.sendError(sessionId, "InvalidRequestError", err.Error())
+			return
+		}
+		r.validateCredentials(ctx, sessionId, request.Credentials)
+	case access_types.PLUGIN_ACCESS_ACTION_GET_TOOL_RUNTIME_PARAMETERS:
+		request, err := utils.UnmarshalJsonBytes[requests.RequestGetToolRuntimeParameters](data)
+		if err != nil {
+			r.sendError(sessionId, "InvalidRequestError", err.Error())
+			return
+		}
+		tool := r.toolDeclaration(request.Tool)
+		if tool == nil {
+			r.sendError(sessionId, "ToolNotFoundError", fmt.Sprintf("tool %s not found", request.Tool))
+			return
+		}
+		r.sendStream(sessionId, tool_entities.GetToolRuntimeParametersResponse{Parameters: tool.Parameters})
+		r.sendEnd(sessionId)
+	default:
+		r.sendError(sessionId, "NotSupportedError", fmt.Sprintf("%s is not supported by mcp servers", action))
+	}
+}
+
+func (r *MCPPluginRuntime) invokeTool(ctx context.Context, sessionId string, request *requests.RequestInvokeTool) {
+	r.lock.RLock()
+	name, ok := r.names[request.Tool]
+	r.lock.RUnlock()
+	if !ok {
+		r.sendError(sessionId, "ToolNotFoundError", fmt.Sprintf("tool %s not found", request.Tool))
+		return
+	}
+
+	client, headers, release, err := r.clientFor(request.Credentials.Credentials)
+	defer release()
+	if err != nil {
+		r.sendError(sessionId, "MCPServerError", err.Error())
+		return
+	}
+
+	result, err := client.CallTool(ctx, headers, name, request.ToolParameters)
+	if err != nil {
+		r.sendError(sessionId, "MCPServerError", err.Error())
+		return
+	}
+	if result.IsError {
+		r.sendError(sessionId, "ToolInvokeError", ErrorMessage(result))
+		return
+	}
+
+	for _, chunk := range ToolResponseChunks(result) {
+		r.sendStream(sessionId, chunk)
+	}
+	r.sendEnd(sessionId)
+}
+
+// validateCredentials lists the tools with the credentials, servers are expected
+// to refuse it if the credentials are wrong
+func (r *MCPPluginRuntime) validateCredentials(ctx context.Context, sessionId string, credentials map[string]any) {
+	valid := false
+	client, headers, release, err := r.clientFor(credentials)
+	defer release()
+	if err == nil {
+		_, err = client.ListTools(ctx, headers)
+		valid = err == nil
+	}
+	if err != nil {
+		r.Warn(fmt.Sprintf("credentials validation failed: %s", err.Error()))
+	}
+	r.sendStream(sessionId, tool_entities.ValidateCredentialResult{Result: valid})
+	r.sendEnd(sessionId)
+}
+
+func (r *MCPPluginRuntime) toolDeclaration(name string) *plugin_entities.ToolDeclaration {
+	declaration := r.Configuration()
+	if declaration.Tool == nil {
+		return nil
+	}
+	for _, tool := range declaration.Tool.Tools {
+		if tool.Identity.Name == name {
+			return &tool
+		}
+	}
+	return nil
+}
+
+func (r *MCPPluginRuntime) send(sessionId string, message plugin_entities.SessionMessage) {
+	if listener, ok := r.listeners.Load(sessionId); ok {
+		listener.Send(message)
+	}
+}
+
+func (r *MCPPluginRuntime) sendStream(sessionId string, data any) {
+	r.send(sessionId, plugin_entities.SessionMessage{
+		Type: plugin_entities.SESSION_MESSAGE_TYPE_STREAM,
+		Data: utils.MarshalJsonBytes(data),
+	})
+}
+
+func (r *MCPPluginRuntime) sendEnd(sessionId string) {
+	r.send(sessionId, plugin_entities.SessionMessage{
+		Type: plugin_entities.SESSION_MESSAGE_TYPE_END,
+		Data: json.RawMessage("{}"),
+	})
+}
+
+func (r *MCPPluginRuntime) sendError(sessionId string, errorType string, message string) {
+	r.send(sessionId, plugin_entities.SessionMessage{
+		Type: plugin_entities.SESSION_MESSAGE_TYPE_ERROR,
+		Data: utils.MarshalJsonBytes(plugin_entities.ErrorResponse{
+			Message:   message,
+			ErrorType: errorType,
+			Args:      map[string]any{},
+		}),
+	})
+}
@@ -0,0 +1,370 @@
+package mcp_runtime
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/access_types"
+	"github.com/jjgagacy/workflow-app/plugin/core/session_manager"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeServer is a minimal streamable http mcp server
+type fakeServer struct {
+	lock    sync.Mutex
+	methods []string
+	headers []http.Header
+	// sse makes tools/call answer with an event stream
+	sse bool
+}
+
+func (s *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodDelete {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var request mcp_entities.Request
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.lock.Lock()
+	s.methods = append(s.methods, request.Method)
+	s.headers = append(s.headers, r.Header.Clone())
+	s.lock.Unlock()
+
+	if request.IsNotification() {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var result any
+	switch request.Method {
+	case mcp_entities.METHOD_INITIALIZE:
+		w.Header().Set(HEADER_MCP_SESSION_ID, "session-1")
+		result = mcp_entities.InitializeResult{
+			ProtocolVersion: mcp_entities.LATEST_PROTOCOL_VERSION,
+			ServerInfo:      mcp_entities.Implementation{Name: "fake", Version: "1.0.0"},
+		}
+	case mcp_entities.METHOD_TOOLS_LIST:
+		var params mcp_entities.ListToolsParams
+		json.Unmarshal(request.Params, &params)
+		if params.Cursor == "" {
+			result = mcp_entities.ListToolsResult{
+				Tools: []mcp_entities.Tool{{
+					Name:        "echo",
+					InputSchema: map[string]any{"type": "object", "properties": map[string]any{"text": map[string]any{"type": "string"}}},
+				}},
+				NextCursor: "page-2",
+			}
+		} else {
+			result = mcp_entities.ListToolsResult{
+				Tools: []mcp_entities.Tool{{Name: "fail", InputSchema: map[string]any{"type": "object"}}},
+			}
+		}
+	case mcp_entities.METHOD_TOOLS_CALL:
+		var params mcp_entities.CallToolParams
+		json.Unmarshal(request.Params, &params)
+		if params.Name == "fail" {
+			result = mcp_entities.CallToolResult{
+				Content: []mcp_entities.Content{{Type: mcp_entities.CONTENT_TYPE_TEXT, Text: "boom"}},
+				IsError: true,
+			}
+		} else {
+			result = mcp_entities.CallToolResult{
+				Content: []mcp_entities.Content{{Type: mcp_entities.CONTENT_TYPE_TEXT, Text: fmt.Sprint(params.Arguments["text"])}},
+			}
+		}
+	default:
+		result = map[string]any{}
+	}
+
+	response := utils.MarshalJsonBytes(mcp_entities.Response{
+		JSONRPC: mcp_entities.JSONRPC_VERSION,
+		ID:      request.ID,
+		Result:  result,
+	})
+	if s.sse && request.Method == mcp_entities.METHOD_TOOLS_CALL {
+		w.Header().Set("Content-Type", "text/event-stream")
+		// 响应之前的服务端通知应被跳过
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", `{"jsonrpc":"2.0","method":"notifications/progress","params":{}}`)
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", response)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(response)
+}
+
+func (s *fakeServer) lastHeader() http.Header {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.headers[len(s.headers)-1]
+}
+
+func TestHTTPClient(t *testing.T) {
+	for _, sse := range []bool{false, true} {
+		t.Run(fmt.Sprintf("sse=%v", sse), func(t *testing.T) {
+			server := &fakeServer{sse: sse}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			client := newClient(newHTTPTransport(&MCPServerConfig{
+				URL:     ts.URL,
+				Headers: map[string]string{"X-Client": "daemon"},
+			}), 5*time.Second)
+			defer client.Close()
+
+			require.NoError(t, client.Initialize(context.Background()))
+			assert.Equal(t, "fake", client.serverInfo.Name)
+
+			// 分页拉取全部工具
+			tools, err := client.ListTools(context.Background(), nil)
+			require.NoError(t, err)
+			require.Len(t, tools, 2)
+			assert.Equal(t, "fail", tools[1].Name)
+
+			// 初始化之后的请求携带会话和协议版本
+			header := server.lastHeader()
+			assert.Equal(t, "session-1", header.Get(HEADER_MCP_SESSION_ID))
+			assert.Equal(t, mcp_entities.LATEST_PROTOCOL_VERSION, header.Get(HEADER_MCP_PROTOCOL_VERSION))
+			assert.Equal(t, "daemon", header.Get("X-Client"))
+
+			result, err := client.CallTool(context.Background(), map[string]string{
+				"Authorization": "Bearer abc",
+			}, "echo", map[string]any{"text": "hi"})
+			require.NoError(t, err)
+			require.Len(t, result.Content, 1)
+			assert.Equal(t, "hi", result.Content[0].Text)
+			assert.Equal(t, "Bearer abc", server.lastHeader().Get("Authorization"))
+		})
+	}
+}
+
+func TestHTTPClientSessionExpired(t *testing.T) {
+	initialized := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !initialized {
+			initialized = true
+			var request mcp_entities.Request
+			json.NewDecoder(r.Body).Decode(&request)
+			w.Header().Set(HEADER_MCP_SESSION_ID, "session-1")
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(utils.MarshalJsonBytes(mcp_entities.Response{
+				JSONRPC: mcp_entities.JSONRPC_VERSION,
+				ID:      request.ID,
+				Result:  mcp_entities.InitializeResult{ProtocolVersion: mcp_entities.LATEST_PROTOCOL_VERSION},
+			}))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	transport := newHTTPTransport(&MCPServerConfig{URL: ts.URL})
+	client := newClient(transport, 5*time.Second)
+	// 通知也会收到 404，会话已失效
+	client.Initialize(context.Background())
+
+	_, err := client.ListTools(context.Background(), nil)
+	require.Error(t, err)
+	select {
+	case <-client.Done():
+	default:
+		t.Fatal("transport should be done once the session expired")
+	}
+}
+
+func TestStdioTransport(t *testing.T) {
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+	transport := newStdioTransport(clientWriter, clientReader)
+	client := newClient(transport, 5*time.Second)
+
+	pingAnswer := make(chan mcp_entities.Response, 1)
+	go func() {
+		decoder := json.NewDecoder(serverReader)
+		encoder := json.NewEncoder(serverWriter)
+		for {
+			var m message
+			if err := decoder.Decode(&m); err != nil {
+				return
+			}
+			if m.isResponse() {
+				var response mcp_entities.Response
+				json.Unmarshal(utils.MarshalJsonBytes(m), &response)
+				pingAnswer <- response
+				continue
+			}
+			if len(m.ID) == 0 {
+				continue
+			}
+			if m.Method == mcp_entities.METHOD_TOOLS_CALL {
+				// 在响应之前向客户端发送 ping
+				encoder.Encode(mcp_entities.Request{
+					JSONRPC: mcp_entities.JSONRPC_VERSION,
+					ID:      json.RawMessage(`"server-1"`),
+					Method:  mcp_entities.METHOD_PING,
+				})
+			}
+			encoder.Encode(mcp_entities.Response{
+				JSONRPC: mcp_entities.JSONRPC_VERSION,
+				ID:      m.ID,
+				Result: mcp_entities.CallToolResult{
+					Content: []mcp_entities.Content{{Type: mcp_entities.CONTENT_TYPE_TEXT, Text: m.Method}},
+				},
+			})
+		}
+	}()
+
+	require.NoError(t, client.Initialize(context.Background()))
+	result, err := client.CallTool(context.Background(), nil, "echo", nil)
+	require.NoError(t, err)
+	assert.Equal(t, mcp_entities.METHOD_TOOLS_CALL, result.Content[0].Text)
+
+	select {
+	case response := <-pingAnswer:
+		assert.Equal(t, `"server-1"`, string(response.ID))
+		assert.Nil(t, response.Error)
+	case <-time.After(5 * time.Second):
+		t.Fatal("ping of the server was not answered")
+	}
+
+	// 服务端退出后传输结束
+	serverWriter.Close()
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("transport should be done once the server exited")
+	}
+}
+
+func invokeSession(
+	t *testing.T,
+	runtime *MCPPluginRuntime,
+	sessionId string,
+	action access_types.PluginAccessAction,
+	data map[string]any,
+) []plugin_entities.SessionMessage {
+	listener, err := runtime.Listen(sessionId)
+	require.NoError(t, err)
+
+	messages := make(chan plugin_entities.SessionMessage, 16)
+	listener.Listen(func(message plugin_entities.SessionMessage) {
+		messages <- message
+	})
+	runtime.Write(sessionId, action, utils.MarshalJsonBytes(map[string]any{
+		"event": session_manager.EVENT_STREAM_REQUEST,
+		"data":  data,
+	}))
+
+	result := []plugin_entities.SessionMessage{}
+	for {
+		select {
+		case message := <-messages:
+			result = append(result, message)
+			if message.Type != plugin_entities.SESSION_MESSAGE_TYPE_STREAM {
+				listener.Close()
+				return result
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("session was not finished")
+		}
+	}
+}
+
+func TestMCPPluginRuntime(t *testing.T) {
+	utils.InitPool(100)
+
+	server := &fakeServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	runtime, err := NewMCPPluginRuntime(MCPServerConfig{
+		Name:    "fake",
+		Version: "0.0.1",
+		URL:     ts.URL,
+		Timeout: 5,
+		Credentials: []MCPCredentialConfig{
+			{Name: "token", Header: "Authorization", Prefix: "Bearer "},
+		},
+	}, 16)
+	require.NoError(t, err)
+
+	connected := make(chan plugin_entities.PluginDeclaration, 1)
+	go runtime.Run(func(declaration plugin_entities.PluginDeclaration) {
+		connected <- declaration
+	})
+	defer runtime.Stop()
+
+	select {
+	case declaration := <-connected:
+		require.NotNil(t, declaration.Tool)
+		assert.Len(t, declaration.Tool.Tools, 2)
+	case <-time.After(5 * time.Second):
+		t.Fatal("mcp server was not connected")
+	}
+
+	t.Run("调用工具", func(t *testing.T) {
+		messages := invokeSession(t, runtime, "s1", access_types.PLUGIN_ACCESS_ACTION_INVOKE_TOOL, map[string]any{
+			"provider":        "fake",
+			"tool":            "echo",
+			"tool_parameters": map[string]any{"text": "hello"},
+			"credentials":     map[string]any{"token": "abc"},
+		})
+		require.Len(t, messages, 2)
+		assert.Equal(t, plugin_entities.SESSION_MESSAGE_TYPE_STREAM, messages[0].Type)
+		assert.Contains(t, string(messages[0].Data), `"text":"hello"`)
+		assert.Equal(t, plugin_entities.SESSION_MESSAGE_TYPE_END, messages[1].Type)
+		// 凭据作为请求头转发
+		assert.Equal(t, "Bearer abc", server.lastHeader().Get("Authorization"))
+	})
+
+	t.Run("工具返回错误", func(t *testing.T) {
+		messages := invokeSession(t, runtime, "s2", access_types.PLUGIN_ACCESS_ACTION_INVOKE_TOOL, map[string]any{
+			"provider": "fake",
+			"tool":     "fail",
+		})
+		require.Len(t, messages, 1)
+		assert.Equal(t, plugin_entities.SESSION_MESSAGE_TYPE_ERROR, messages[0].Type)
+		errorResponse, err := utils.UnmarshalJsonBytes[plugin_entities.ErrorResponse](messages[0].Data)
+		require.NoError(t, err)
+		assert.Equal(t, "ToolInvokeError", errorResponse.ErrorType)
+		assert.Equal(t, "boom", errorResponse.Message)
+	})
+
+	t.Run("工具不存在", func(t *testing.T) {
+		messages := invokeSession(t, runtime, "s3", access_types.PLUGIN_ACCESS_ACTION_INVOKE_TOOL, map[string]any{
+			"provider": "fake",
+			"tool":     "missing",
+		})
+		require.Len(t, messages, 1)
+		assert.Equal(t, plugin_entities.SESSION_MESSAGE_TYPE_ERROR, messages[0].Type)
+	})
+
+	t.Run("校验凭据", func(t *testing.T) {
+		messages := invokeSession(t, runtime, "s4", access_types.PLUGIN_ACCESS_ACTION_VALIDATE_TOOL_CREDENTIALS, map[string]any{
+			"provider":    "fake",
+			"credentials": map[string]any{"token": "abc"},
+		})
+		require.Len(t, messages, 2)
+		assert.JSONEq(t, `{"result":true}`, string(messages[0].Data))
+	})
+
+	t.Run("不支持的操作", func(t *testing.T) {
+		messages := invokeSession(t, runtime, "s5", access_types.PLUGIN_ACCESS_ACTION_INVOKE_LLM, map[string]any{})
+		require.Len(t, messages, 1)
+		assert.Equal(t, plugin_entities.SESSION_MESSAGE_TYPE_ERROR, messages[0].Type)
+	})
+}
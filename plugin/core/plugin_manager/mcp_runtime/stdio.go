@@ -0,0 +1,214 @@
+package mcp_runtime
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+// stdioTransport speaks to a server launched as a subprocess, messages are newline
+// delimited json on its stdin and stdout
+type stdioTransport struct {
+	cmd *exec.Cmd
+
+	writer    io.WriteCloser
+	writeLock sync.Mutex
+
+	pendingLock sync.Mutex
+	pending     map[string]chan *message
+
+	doneChan  chan struct{}
+	closeOnce sync.Once
+}
+
+// startStdio launches the server, env is added to the environment of the daemon and
+// stderr receives every line the server writes on its stderr
+func startStdio(config *MCPServerConfig, env map[string]string, stderr func(string)) (*stdioTransport, error) {
+	cmd := exec.Command(config.Command, config.Args...)
+	cmd.Dir = config.Dir
+	cmd.Env = os.Environ()
+	for k, v := range config.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Join(err, fmt.Errorf("start mcp server %s error", config.Name))
+	}
+
+	t := newStdioTransport(stdin, stdout)
+	t.cmd = cmd
+
+	go func() {
+		scanner := bufio.NewScanner(stderrPipe)
+		for scanner.Scan() {
+			stderr(scanner.Text())
+		}
+	}()
+	go func() {
+		<-t.doneChan
+		cmd.Wait()
+	}()
+
+	return t, nil
+}
+
+// newStdioTransport reads the messages of the server from reader until it's closed
+func newStdioTransport(writer io.WriteCloser, reader io.Reader) *stdioTransport {
+	t := &stdioTransport{
+		writer:   writer,
+		pending:  map[string]chan *message{},
+		doneChan: make(chan struct{}),
+	}
+	go t.read(reader)
+	return t
+}
+
+func (t *stdioTransport) read(reader io.Reader) {
+	defer t.shutdown()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 0, 64*1024), MAX_MESSAGE_SIZE)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var m message
+		if err := json.Unmarshal(line, &m); err != nil {
+			utils.Warn("invalid message from mcp server: %s", err.Error())
+			continue
+		}
+
+		if m.isResponse() {
+			t.pendingLock.Lock()
+			ch, ok := t.pending[string(m.ID)]
+			delete(t.pending, string(m.ID))
+			t.pendingLock.Unlock()
+			if ok {
+				ch <- &m
+			}
+			continue
+		}
+
+		if m.Method != "" && len(m.ID) > 0 {
+			// answered aside, the server may not read before it's done writing
+			go t.answer(&m)
+		}
+		// notifications of the server, e.g. logs and progress, are not used
+	}
+}
+
+// answer replies to the requests of the server, only pings are supported as the
+// daemon declares no client capability
+func (t *stdioTransport) answer(request *message) {
+	response := mcp_entities.Response{JSONRPC: mcp_entities.JSONRPC_VERSION, ID: request.ID}
+	if request.Method == mcp_entities.METHOD_PING {
+		response.Result = map[string]any{}
+	} else {
+		response.Error = &mcp_entities.Error{
+			Code:    mcp_entities.ERROR_CODE_METHOD_NOT_FOUND,
+			Message: fmt.Sprintf("method %s not supported", request.Method),
+		}
+	}
+	if err := t.write(utils.MarshalJsonBytes(response)); err != nil {
+		utils.Warn("answer mcp server request failed: %s", err.Error())
+	}
+}
+
+func (t *stdioTransport) write(data []byte) error {
+	t.writeLock.Lock()
+	defer t.writeLock.Unlock()
+	if _, err := t.writer.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (t *stdioTransport) roundTrip(
+	ctx context.Context,
+	request *mcp_entities.Request,
+	headers map[string]string,
+) (*message, error) {
+	ch := make(chan *message, 1)
+	t.pendingLock.Lock()
+	t.pending[string(request.ID)] = ch
+	t.pendingLock.Unlock()
+
+	removePending := func() {
+		t.pendingLock.Lock()
+		delete(t.pending, string(request.ID))
+		t.pendingLock.Unlock()
+	}
+
+	if err := t.write(utils.MarshalJsonBytes(request)); err != nil {
+		removePending()
+		return nil, errors.Join(err, fmt.Errorf("write to mcp server error"))
+	}
+
+	select {
+	case response := <-ch:
+		return response, nil
+	case <-ctx.Done():
+		removePending()
+		return nil, ctx.Err()
+	case <-t.doneChan:
+		return nil, errors.New("mcp server exited")
+	}
+}
+
+func (t *stdioTransport) notify(request *mcp_entities.Request, headers map[string]string) error {
+	return t.write(utils.MarshalJsonBytes(request))
+}
+
+func (t *stdioTransport) setProtocolVersion(version string) {}
+
+func (t *stdioTransport) done() <-chan struct{} {
+	return t.doneChan
+}
+
+func (t *stdioTransport) shutdown() {
+	t.closeOnce.Do(func() {
+		close(t.doneChan)
+	})
+}
+
+// close closes stdin which asks the server to exit, it's killed if it doesn't
+func (t *stdioTransport) close() error {
+	err := t.writer.Close()
+	if t.cmd == nil {
+		return err
+	}
+
+	select {
+	case <-t.doneChan:
+	case <-time.After(5 * time.Second):
+		t.cmd.Process.Kill()
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package media_transport
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/oss"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+)
+
+type LogBucket struct {
+	oss     oss.OSS
+	logPath string
+}
+
+func NewLogBucket(oss oss.OSS, logPath string) *LogBucket {
+	return &LogBucket{oss: oss, logPath: logPath}
+}
+
+// Save stores a batch of json lines logs, each batch is a separate object named by its time and first seq
+func (b *LogBucket) Save(
+	pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	firstSeq uint64,
+	data []byte,
+) error {
+	name := fmt.Sprintf("%s-%d.jsonl", time.Now().UTC().Format("20060102150405"), firstSeq)
+	return b.oss.Save(filepath.Join(b.logPath, pluginUniqueIdentifier.FsID(), name), data)
+}
+
+func (b *LogBucket) List(pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier) ([]oss.OSSPath, error) {
+	return b.oss.List(filepath.Join(b.logPath, pluginUniqueIdentifier.FsID()))
+}
+
+func (b *LogBucket) Get(pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier, name string) ([]byte, error) {
+	return b.oss.Load(filepath.Join(b.logPath, pluginUniqueIdentifier.FsID(), name))
+}
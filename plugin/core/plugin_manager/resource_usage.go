@@ -0,0 +1,140 @@
+package plugin_manager
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/local_runtime"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+type resourceAlert string
+
+const (
+	RESOURCE_ALERT_MEMORY     resourceAlert = "memory"
+	RESOURCE_ALERT_CPU        resourceAlert = "cpu"
+	RESOURCE_ALERT_OPEN_FILES resourceAlert = "open_files"
+)
+
+func (p *PluginManager) startResourceSampler() {
+	if p.config.PluginResourceSampleInterval <= 0 {
+		return
+	}
+	interval := time.Duration(p.config.PluginResourceSampleInterval) * time.Second
+
+	go func() {
+		for range time.NewTicker(interval).C {
+			p.sampleResourceUsage()
+		}
+	}()
+}
+
+// sampleResourceUsage samples the processes of all local plugins and alerts the
+// plugins above the thresholds
+func (p *PluginManager) sampleResourceUsage() {
+	p.m.Range(func(key string, value plugin_entities.PluginLifetime) bool {
+		replicas, ok := value.(*local_runtime.LocalPluginReplicas)
+		if !ok {
+			return true
+		}
+		usages := replicas.SampleResourceUsage()
+		if len(usages) == 0 {
+			p.resourceAlerts.Delete(key)
+			return true
+		}
+		p.checkResourceAlerts(key, replicas, usages)
+		return true
+	})
+
+	// forget the alerts of plugins which are not running anymore
+	p.resourceAlerts.Range(func(key string, _ map[resourceAlert]bool) bool {
+		if !p.m.Exists(key) {
+			p.resourceAlerts.Delete(key)
+		}
+		return true
+	})
+}
+
+type resourceThreshold struct {
+	alert   resourceAlert
+	current float64
+	limit   float64
+}
+
+// resourceThresholds returns the usage and the limit of each alert, alerts without
+// a limit are skipped
+func (p *PluginManager) resourceThresholds(
+	declaration *plugin_entities.PluginDeclaration,
+	usage *plugin_entities.PluginResourceUsage,
+) []resourceThreshold {
+	thresholds := []resourceThreshold{}
+	if declaration != nil && declaration.Resource.Memory > 0 {
+		thresholds = append(thresholds, resourceThreshold{RESOURCE_ALERT_MEMORY, float64(usage.RSS), float64(declaration.Resource.Memory)})
+	}
+	if p.config.PluginCPUAlertPercent > 0 {
+		thresholds = append(thresholds, resourceThreshold{RESOURCE_ALERT_CPU, usage.CPUPercent, float64(p.config.PluginCPUAlertPercent)})
+	}
+	if p.config.PluginOpenFilesAlert > 0 {
+		thresholds = append(thresholds, resourceThreshold{RESOURCE_ALERT_OPEN_FILES, float64(usage.OpenFiles), float64(p.config.PluginOpenFilesAlert)})
+	}
+	return thresholds
+}
+
+// peakResourceUsage returns the highest usage of the replicas, the limits apply to
+// each process so the replicas are compared one by one instead of summed up
+func peakResourceUsage(usages []*plugin_entities.PluginResourceUsage) *plugin_entities.PluginResourceUsage {
+	peak := &plugin_entities.PluginResourceUsage{}
+	for _, usage := range usages {
+		peak.RSS = max(peak.RSS, usage.RSS)
+		peak.CPUPercent = max(peak.CPUPercent, usage.CPUPercent)
+		peak.OpenFiles = max(peak.OpenFiles, usage.OpenFiles)
+	}
+	return peak
+}
+
+// checkResourceAlerts alerts once when a replica of a plugin goes above a threshold
+// and once when all of them recover, to the daemon log and to the plugin log
+func (p *PluginManager) checkResourceAlerts(
+	key string,
+	lifetime plugin_entities.PluginLifetime,
+	usages []*plugin_entities.PluginResourceUsage,
+) {
+	alerted, _ := p.resourceAlerts.Load(key)
+	firing := map[resourceAlert]bool{}
+
+	for _, threshold := range p.resourceThresholds(lifetime.Configuration(), peakResourceUsage(usages)) {
+		alert, current, limit := threshold.alert, threshold.current, threshold.limit
+		if current <= limit {
+			if alerted[alert] {
+				msg := fmt.Sprintf("%s usage of plugin %s is back to %.0f, limit %.0f", alert, key, current, limit)
+				utils.Info("%s", msg)
+				lifetime.Log(msg)
+			}
+			continue
+		}
+
+		firing[alert] = true
+		if !alerted[alert] {
+			msg := fmt.Sprintf("%s usage of plugin %s is %.0f, above the limit %.0f", alert, key, current, limit)
+			utils.Warn("%s", msg)
+			lifetime.Warn(msg)
+		}
+	}
+
+	p.resourceAlerts.Store(key, firing)
+}
+
+// ResourceAlerts returns the alerts firing for a plugin
+func (p *PluginManager) ResourceAlerts(identity plugin_entities.PluginUniqueIdentifier) []string {
+	alerted, _ := p.resourceAlerts.Load(identity.String())
+	alerts := []string{}
+	for alert, firing := range alerted {
+		if firing {
+			alerts = append(alerts, string(alert))
+		}
+	}
+	sort.Strings(alerts)
+	return alerts
+}
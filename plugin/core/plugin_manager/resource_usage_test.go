@@ -0,0 +1,74 @@
+package plugin_manager
+
+import (
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/local_runtime"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckResourceAlerts(t *testing.T) {
+	p := &PluginManager{config: &core.Config{PluginCPUAlertPercent: 80}}
+
+	runtime := local_runtime.NewLocalPluginRuntime(local_runtime.LocalPluginRuntimeConfig{})
+	runtime.Config.Resource.Memory = 100 * 1024 * 1024
+	runtime.LogBuffer = plugin_entities.NewPluginLogBuffer(10)
+	lifetime := local_runtime.NewLocalPluginReplicas([]*local_runtime.LocalPluginRuntime{runtime})
+
+	key := "langgenius/openai:0.0.1@checksum"
+	identity := plugin_entities.PluginUniqueIdentifier(key)
+
+	// 内存超过 manifest 声明的大小
+	p.checkResourceAlerts(key, lifetime, []*plugin_entities.PluginResourceUsage{&plugin_entities.PluginResourceUsage{RSS: 200 * 1024 * 1024, CPUPercent: 10}})
+	assert.Equal(t, []string{"memory"}, p.ResourceAlerts(identity))
+
+	// 持续超出时不重复告警
+	p.checkResourceAlerts(key, lifetime, []*plugin_entities.PluginResourceUsage{&plugin_entities.PluginResourceUsage{RSS: 200 * 1024 * 1024, CPUPercent: 90}})
+	assert.Equal(t, []string{"cpu", "memory"}, p.ResourceAlerts(identity))
+
+	// 恢复后解除告警
+	p.checkResourceAlerts(key, lifetime, []*plugin_entities.PluginResourceUsage{&plugin_entities.PluginResourceUsage{RSS: 50 * 1024 * 1024, CPUPercent: 10}})
+	assert.Empty(t, p.ResourceAlerts(identity))
+
+	logs := runtime.LogBuffer.Since(0)
+	require.Len(t, logs, 4)
+	assert.Equal(t, plugin_entities.PLUGIN_LOG_LEVEL_WARN, logs[0].Level)
+	assert.Contains(t, logs[0].Message, "memory usage")
+	assert.Equal(t, plugin_entities.PLUGIN_LOG_LEVEL_WARN, logs[1].Level)
+	assert.Contains(t, logs[1].Message, "cpu usage")
+	assert.Equal(t, plugin_entities.PLUGIN_LOG_LEVEL_INFO, logs[2].Level)
+	assert.Equal(t, plugin_entities.PLUGIN_LOG_LEVEL_INFO, logs[3].Level)
+}
+
+func TestCheckResourceAlertsReplicas(t *testing.T) {
+	p := &PluginManager{config: &core.Config{PluginCPUAlertPercent: 80}}
+
+	replicas := []*local_runtime.LocalPluginRuntime{}
+	for i := 0; i < 2; i++ {
+		runtime := local_runtime.NewLocalPluginRuntime(local_runtime.LocalPluginRuntimeConfig{})
+		runtime.Config.Resource.Memory = 100 * 1024 * 1024
+		runtime.LogBuffer = plugin_entities.NewPluginLogBuffer(10)
+		replicas = append(replicas, runtime)
+	}
+	lifetime := local_runtime.NewLocalPluginReplicas(replicas)
+
+	key := "langgenius/openai:0.0.1@checksum"
+	identity := plugin_entities.PluginUniqueIdentifier(key)
+
+	// 每个副本都在限制内，合计超出时不告警
+	p.checkResourceAlerts(key, lifetime, []*plugin_entities.PluginResourceUsage{
+		{RSS: 60 * 1024 * 1024, CPUPercent: 50},
+		{RSS: 60 * 1024 * 1024, CPUPercent: 50},
+	})
+	assert.Empty(t, p.ResourceAlerts(identity))
+
+	// 任一副本超出限制时告警
+	p.checkResourceAlerts(key, lifetime, []*plugin_entities.PluginResourceUsage{
+		{RSS: 60 * 1024 * 1024, CPUPercent: 50},
+		{RSS: 120 * 1024 * 1024, CPUPercent: 90},
+	})
+	assert.Equal(t, []string{"cpu", "memory"}, p.ResourceAlerts(identity))
+}
@@ -0,0 +1,324 @@
+package sandbox
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+	"golang.org/x/sys/unix"
+)
+
+// Init turns the current process into the init process of a sandbox if it was
+// started by Wrap, it must be called at the very beginning of main and never
+// returns in that case
+func Init() {
+	if len(os.Args) == 0 || os.Args[0] != initArg {
+		return
+	}
+
+	code, err := runInit()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "sandbox: %s\n", err.Error())
+		os.Exit(1)
+	}
+	os.Exit(code)
+}
+
+func runInit() (int, error) {
+	config, err := utils.UnmarshalJson[initConfig](os.Getenv(initConfigEnv))
+	if err != nil {
+		return 0, errors.Join(err, fmt.Errorf("parse sandbox config error"))
+	}
+	os.Unsetenv(initConfigEnv)
+
+	if err := setupMounts(&config); err != nil {
+		return 0, err
+	}
+
+	if config.PrivateNetwork {
+		if err := setupLoopback(); err != nil {
+			return 0, err
+		}
+		if err := startProxyListeners(config.ProxyPorts); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := unix.Sethostname([]byte("sandbox")); err != nil {
+		return 0, errors.Join(err, fmt.Errorf("set sandbox hostname error"))
+	}
+
+	// capabilities and seccomp filters are per thread, the plugin is forked from
+	// this thread so it inherits the restrictions while the init process keeps
+	// serving the proxy connections
+	runtime.LockOSThread()
+	if err := dropPrivileges(); err != nil {
+		return 0, err
+	}
+
+	cmd := &exec.Cmd{
+		Path:   config.Path,
+		Args:   config.Args,
+		Env:    config.Env,
+		Dir:    config.Dir,
+		Stdin:  os.Stdin,
+		Stdout: os.Stdout,
+		Stderr: os.Stderr,
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, errors.Join(err, fmt.Errorf("start sandboxed process error"))
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	go func() {
+		for sig := range signals {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	err = cmd.Wait()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal()), nil
+		}
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+func setupMounts(config *initConfig) error {
+	// the writable paths may live under /tmp which is replaced below, keep them open
+	// to bind them back through /proc/self/fd
+	fds := []int{}
+	defer func() {
+		for _, fd := range fds {
+			unix.Close(fd)
+		}
+	}()
+	for _, p := range config.WritablePaths {
+		fd, err := unix.Open(p, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return errors.Join(err, fmt.Errorf("open writable path %s error", p))
+		}
+		fds = append(fds, fd)
+	}
+
+	// keep every mount below private to the sandbox
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return errors.Join(err, fmt.Errorf("make mounts private error"))
+	}
+
+	if err := unix.Mount("tmpfs", "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777"); err != nil {
+		return errors.Join(err, fmt.Errorf("mount /tmp error"))
+	}
+	// not every system has /dev/shm
+	unix.Mount("tmpfs", "/dev/shm", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=1777")
+
+	for i, p := range config.WritablePaths {
+		if err := os.MkdirAll(p, 0755); err != nil {
+			return errors.Join(err, fmt.Errorf("create writable path %s error", p))
+		}
+		source := fmt.Sprintf("/proc/self/fd/%d", fds[i])
+		if err := unix.Mount(source, p, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return errors.Join(err, fmt.Errorf("bind writable path %s error", p))
+		}
+	}
+
+	if err := remountReadOnly(append([]string{"/tmp", "/dev/shm"}, config.WritablePaths...)); err != nil {
+		return err
+	}
+
+	// a fresh procfs only shows the processes of the sandbox
+	if err := unix.Mount("proc", "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+		return errors.Join(err, fmt.Errorf("mount /proc error"))
+	}
+
+	for _, p := range config.MaskedPaths {
+		info, err := os.Stat(p)
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			err = unix.Mount("tmpfs", p, "tmpfs", unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, "")
+		} else {
+			err = unix.Mount("/dev/null", p, "", unix.MS_BIND, "")
+		}
+		if err != nil {
+			return errors.Join(err, fmt.Errorf("mask path %s error", p))
+		}
+	}
+
+	return nil
+}
+
+var mountOptionFlags = map[string]uintptr{
+	"nosuid":      unix.MS_NOSUID,
+	"nodev":       unix.MS_NODEV,
+	"noexec":      unix.MS_NOEXEC,
+	"noatime":     unix.MS_NOATIME,
+	"nodiratime":  unix.MS_NODIRATIME,
+	"relatime":    unix.MS_RELATIME,
+	"strictatime": unix.MS_STRICTATIME,
+}
+
+// remountReadOnly remounts every mount except the writable ones read-only, the
+// flags of the original mount are kept as the kernel refuses to clear locked ones
+func remountReadOnly(writablePaths []string) error {
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("read mountinfo error"))
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		mountPoint := unescapeMountPoint(fields[4])
+		if isUnder(mountPoint, writablePaths) {
+			continue
+		}
+
+		flags := uintptr(unix.MS_REMOUNT | unix.MS_BIND | unix.MS_RDONLY)
+		for _, option := range strings.Split(fields[5], ",") {
+			flags |= mountOptionFlags[option]
+		}
+		if err := unix.Mount("", mountPoint, "", flags, ""); err != nil {
+			// pseudo filesystems are either replaced or harmless, some of them can't be remounted
+			if isUnder(mountPoint, []string{"/proc", "/sys", "/dev"}) {
+				continue
+			}
+			return errors.Join(err, fmt.Errorf("remount %s read-only error", mountPoint))
+		}
+	}
+	return scanner.Err()
+}
+
+func isUnder(p string, parents []string) bool {
+	for _, parent := range parents {
+		if p == parent || strings.HasPrefix(p, strings.TrimSuffix(parent, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeMountPoint decodes the octal escapes of mountinfo, e.g. \040 for a space
+func unescapeMountPoint(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// setupLoopback brings up lo of the private network namespace
+func setupLoopback() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("create socket error"))
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return errors.Join(err, fmt.Errorf("get loopback flags error"))
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	if err := unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr); err != nil {
+		return errors.Join(err, fmt.Errorf("bring loopback up error"))
+	}
+	return nil
+}
+
+// startProxyListeners accepts the proxy connections on the loopback and hands
+// them over to the daemon, which connects them to the real proxies
+func startProxyListeners(ports []int) error {
+	if len(ports) == 0 {
+		return nil
+	}
+
+	file := os.NewFile(proxyControlFd, "sandbox-proxy")
+	conn, err := net.FileConn(file)
+	// the duplicated fd is close-on-exec, the original one must not leak into the plugin
+	file.Close()
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("open sandbox proxy connection error"))
+	}
+	control, ok := conn.(*net.UnixConn)
+	if !ok {
+		return errors.New("sandbox proxy connection is not a unix socket")
+	}
+
+	for i, port := range ports {
+		listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+		if err != nil {
+			return errors.Join(err, fmt.Errorf("listen proxy port %d error", port))
+		}
+
+		index := byte(i)
+		go func() {
+			for {
+				client, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go handoverProxyConn(control, index, client)
+			}
+		}()
+	}
+	return nil
+}
+
+func handoverProxyConn(control *net.UnixConn, index byte, client net.Conn) {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		client.Close()
+		return
+	}
+
+	_, _, err = control.WriteMsgUnix([]byte{index}, unix.UnixRights(fds[1]), nil)
+	unix.Close(fds[1])
+	if err != nil {
+		unix.Close(fds[0])
+		client.Close()
+		return
+	}
+
+	file := os.NewFile(uintptr(fds[0]), "sandbox-proxy-conn")
+	upstream, err := net.FileConn(file)
+	file.Close()
+	if err != nil {
+		client.Close()
+		return
+	}
+	pipe(client, upstream)
+}
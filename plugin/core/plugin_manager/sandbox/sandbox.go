@@ -0,0 +1,132 @@
+package sandbox
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager/decoder"
+)
+
+type Level string
+
+const (
+	// plugin processes run as the daemon user without any isolation
+	LEVEL_DISABLED Level = "disabled"
+	// read-only root, writable working directory, scrubbed environment, full network
+	LEVEL_STANDARD Level = "standard"
+	// same as standard, but the network is only reachable through the configured proxies
+	LEVEL_STRICT Level = "strict"
+)
+
+func ParseLevel(level string) (Level, error) {
+	switch Level(level) {
+	case LEVEL_DISABLED, LEVEL_STANDARD, LEVEL_STRICT:
+		return Level(level), nil
+	}
+	return "", fmt.Errorf("invalid sandbox level: %s", level)
+}
+
+type NetworkMode string
+
+const (
+	NETWORK_MODE_FULL NetworkMode = "full"
+	// the plugin gets a private network namespace, HTTP_PROXY and HTTPS_PROXY
+	// are forwarded to the proxies configured on the daemon
+	NETWORK_MODE_PROXY NetworkMode = "proxy"
+)
+
+// Policy describes the sandbox of a single plugin process
+type Policy struct {
+	// paths which stay writable, everything else is mounted read-only
+	WritablePaths []string
+	// paths hidden behind an empty tmpfs, e.g. the directory holding the daemon config
+	MaskedPaths []string
+	// environment variables passed to the plugin besides the ones set by the runtime
+	EnvAllowList []string
+
+	Network    NetworkMode
+	HttpProxy  string
+	HttpsProxy string
+}
+
+// Config selects the sandbox policy by the authorized category of a plugin
+type Config struct {
+	Enabled bool
+
+	Partner    Level
+	Community  Level
+	Unverified Level
+
+	MaskedPaths  []string
+	EnvAllowList []string
+
+	HttpProxy  string
+	HttpsProxy string
+}
+
+// Level returns the sandbox level of a plugin, verification is nil for unverified plugins
+func (c *Config) Level(verification *decoder.Verification) Level {
+	if c == nil || !c.Enabled {
+		return LEVEL_DISABLED
+	}
+
+	level := c.Unverified
+	if verification != nil {
+		switch verification.AuthorizedCategory {
+		case decoder.AUTHORIZED_CATEGORY_PARTNER:
+			level = c.Partner
+		case decoder.AUTHORIZED_CATEGORY_COMMUNITY:
+			level = c.Community
+		}
+	}
+
+	if level == "" {
+		// fail closed on a missing level
+		return LEVEL_STRICT
+	}
+	return level
+}
+
+// Policy returns the policy of a plugin working in workingPath, nil means no sandbox
+func (c *Config) Policy(verification *decoder.Verification, workingPath string) *Policy {
+	level := c.Level(verification)
+	if level == LEVEL_DISABLED {
+		return nil
+	}
+
+	policy := &Policy{
+		WritablePaths: []string{workingPath},
+		MaskedPaths:   c.MaskedPaths,
+		EnvAllowList:  c.EnvAllowList,
+		Network:       NETWORK_MODE_FULL,
+		HttpProxy:     c.HttpProxy,
+		HttpsProxy:    c.HttpsProxy,
+	}
+	if level == LEVEL_STRICT {
+		policy.Network = NETWORK_MODE_PROXY
+	}
+	return policy
+}
+
+// variables every plugin needs to run, the rest of the daemon environment is dropped
+var defaultEnvAllowList = []string{"PATH", "LANG", "LC_ALL", "LC_CTYPE", "TZ"}
+
+// ScrubEnv keeps only the allowed variables of environ
+func ScrubEnv(environ []string, allowList []string) []string {
+	allowed := map[string]bool{}
+	for _, key := range defaultEnvAllowList {
+		allowed[key] = true
+	}
+	for _, key := range allowList {
+		allowed[strings.TrimSpace(key)] = true
+	}
+
+	result := []string{}
+	for _, kv := range environ {
+		key, _, ok := strings.Cut(kv, "=")
+		if ok && allowed[key] {
+			result = append(result, kv)
+		}
+	}
+	return result
+}
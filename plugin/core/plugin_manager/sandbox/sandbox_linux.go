@@ -0,0 +1,259 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// argv[0] of the re-executed daemon binary acting as the init process of a sandbox
+	initArg = "monie-plugin-sandbox"
+	// environment variable carrying the init config
+	initConfigEnv = "MONIE_PLUGIN_SANDBOX_CONFIG"
+	// fd of the socket used to forward proxy connections out of the sandbox
+	proxyControlFd = 3
+	// proxies are exposed on the loopback of the sandbox starting from this port
+	proxyPortBase = 18080
+)
+
+type initConfig struct {
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	Env  []string `json:"env"`
+	Dir  string   `json:"dir"`
+
+	WritablePaths []string `json:"writable_paths"`
+	MaskedPaths   []string `json:"masked_paths"`
+
+	PrivateNetwork bool `json:"private_network"`
+	// loopback ports forwarded to the proxies, the index is sent to the daemon along with a connection
+	ProxyPorts []int `json:"proxy_ports"`
+}
+
+// Wrap rewrites cmd to run inside the sandbox described by policy, cmd must not be started yet.
+// The returned cleanup releases the resources held by the daemon and must be called once cmd exits
+func Wrap(cmd *exec.Cmd, policy *Policy) (func(), error) {
+	if cmd.Dir == "" {
+		return nil, errors.New("working directory of a sandboxed command is required")
+	}
+
+	dir, err := filepath.Abs(cmd.Dir)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("resolve sandbox working directory error"))
+	}
+
+	config := initConfig{
+		Path:           cmd.Path,
+		Args:           cmd.Args,
+		Env:            append(append([]string{}, cmd.Env...), "HOME="+dir, "TMPDIR=/tmp"),
+		Dir:            dir,
+		MaskedPaths:    policy.MaskedPaths,
+		PrivateNetwork: policy.Network == NETWORK_MODE_PROXY,
+	}
+	for _, p := range policy.WritablePaths {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			return nil, errors.Join(err, fmt.Errorf("resolve sandbox writable path error"))
+		}
+		config.WritablePaths = append(config.WritablePaths, abs)
+	}
+
+	cleanup := func() {}
+	if config.PrivateNetwork {
+		targets, env, err := rewriteProxyEnv(config.Env, policy)
+		if err != nil {
+			return nil, err
+		}
+		config.Env = env
+
+		if len(targets) > 0 {
+			fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_SEQPACKET|unix.SOCK_CLOEXEC, 0)
+			if err != nil {
+				return nil, errors.Join(err, fmt.Errorf("create sandbox proxy socket error"))
+			}
+			local := os.NewFile(uintptr(fds[0]), "sandbox-proxy")
+			remote := os.NewFile(uintptr(fds[1]), "sandbox-proxy")
+			conn, err := net.FileConn(local)
+			local.Close()
+			if err != nil {
+				remote.Close()
+				return nil, errors.Join(err, fmt.Errorf("create sandbox proxy connection error"))
+			}
+
+			for i := range targets {
+				config.ProxyPorts = append(config.ProxyPorts, proxyPortBase+i)
+			}
+			cmd.ExtraFiles = []*os.File{remote}
+
+			utils.Submit(map[string]string{
+				"module":   "sandbox",
+				"function": "serveProxy",
+			}, func() {
+				serveProxy(conn.(*net.UnixConn), targets)
+			})
+
+			cleanup = func() {
+				remote.Close()
+				conn.Close()
+			}
+		}
+	}
+
+	cmd.Path = "/proc/self/exe"
+	cmd.Args = []string{initArg}
+	cmd.Env = []string{initConfigEnv + "=" + utils.MarshalJson(config)}
+	cmd.Dir = dir
+
+	cloneflags := uintptr(syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID |
+		syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS)
+	if config.PrivateNetwork {
+		cloneflags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Cloneflags: cloneflags,
+		// the daemon user becomes root of the sandbox, only to set up the mounts,
+		// the plugin itself runs without any capability
+		UidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}},
+		GidMappings:                []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}},
+		GidMappingsEnableSetgroups: false,
+		Pdeathsig:                  syscall.SIGKILL,
+	}
+
+	return cleanup, nil
+}
+
+var proxyEnvKeys = []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY"}
+
+// rewriteProxyEnv points the proxy variables to the loopback of the sandbox,
+// it returns the addresses of the real proxies in the order of the forwarded ports
+func rewriteProxyEnv(environ []string, policy *Policy) ([]string, []string, error) {
+	env := []string{}
+	for _, kv := range environ {
+		key, _, _ := strings.Cut(kv, "=")
+		isProxy := false
+		for _, proxyKey := range proxyEnvKeys {
+			if strings.EqualFold(key, proxyKey) {
+				isProxy = true
+				break
+			}
+		}
+		if !isProxy {
+			env = append(env, kv)
+		}
+	}
+
+	targets := []string{}
+	for _, proxy := range []struct {
+		key   string
+		value string
+	}{
+		{"HTTP_PROXY", policy.HttpProxy},
+		{"HTTPS_PROXY", policy.HttpsProxy},
+	} {
+		if proxy.value == "" {
+			continue
+		}
+
+		u, err := url.Parse(proxy.value)
+		if err != nil || u.Hostname() == "" {
+			return nil, nil, fmt.Errorf("invalid proxy url: %s", proxy.value)
+		}
+		target := u.Host
+		if u.Port() == "" {
+			switch u.Scheme {
+			case "https":
+				target = net.JoinHostPort(u.Hostname(), "443")
+			case "socks5", "socks5h":
+				target = net.JoinHostPort(u.Hostname(), "1080")
+			default:
+				target = net.JoinHostPort(u.Hostname(), "80")
+			}
+		}
+
+		index := len(targets)
+		for i, t := range targets {
+			if t == target {
+				index = i
+				break
+			}
+		}
+		if index == len(targets) {
+			targets = append(targets, target)
+		}
+
+		u.Host = fmt.Sprintf("127.0.0.1:%d", proxyPortBase+index)
+		env = append(env, proxy.key+"="+u.String(), strings.ToLower(proxy.key)+"="+u.String())
+	}
+
+	return targets, env, nil
+}
+
+// serveProxy receives the connections accepted on the loopback of the sandbox
+// and forwards them to the real proxies
+func serveProxy(control *net.UnixConn, targets []string) {
+	buf := make([]byte, 1)
+	oob := make([]byte, unix.CmsgSpace(4))
+	for {
+		n, oobn, _, _, err := control.ReadMsgUnix(buf, oob)
+		if err != nil {
+			return
+		}
+
+		messages, err := unix.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			continue
+		}
+		for _, message := range messages {
+			fds, err := unix.ParseUnixRights(&message)
+			if err != nil {
+				continue
+			}
+			for _, fd := range fds {
+				file := os.NewFile(uintptr(fd), "sandbox-proxy-conn")
+				conn, err := net.FileConn(file)
+				file.Close()
+				if err != nil {
+					continue
+				}
+				if n != 1 || int(buf[0]) >= len(targets) {
+					conn.Close()
+					continue
+				}
+
+				target := targets[buf[0]]
+				go func() {
+					upstream, err := net.DialTimeout("tcp", target, 10*time.Second)
+					if err != nil {
+						utils.Warn("sandbox failed to connect proxy %s: %s", target, err.Error())
+						conn.Close()
+						return
+					}
+					pipe(conn, upstream)
+				}()
+			}
+		}
+	}
+}
+
+func pipe(a, b net.Conn) {
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+		b.Close()
+	}()
+	io.Copy(b, a)
+	a.Close()
+	b.Close()
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+)
+
+// Wrap is only supported on linux, the daemon refuses to start sandboxed plugins elsewhere
+func Wrap(cmd *exec.Cmd, policy *Policy) (func(), error) {
+	return nil, errors.New("sandbox is not supported on " + runtime.GOOS)
+}
+
+// Init does nothing as no sandbox is ever started on this platform
+func Init() {}
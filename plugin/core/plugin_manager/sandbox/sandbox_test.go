@@ -0,0 +1,92 @@
+package sandbox
+
+import (
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager/decoder"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigLevel(t *testing.T) {
+	config := &Config{
+		Enabled:    true,
+		Partner:    LEVEL_DISABLED,
+		Community:  LEVEL_STANDARD,
+		Unverified: LEVEL_STRICT,
+	}
+
+	tests := []struct {
+		name         string
+		config       *Config
+		verification *decoder.Verification
+		want         Level
+	}{
+		{"未启用沙箱", &Config{Partner: LEVEL_STRICT}, nil, LEVEL_DISABLED},
+		{"未配置", nil, nil, LEVEL_DISABLED},
+		{"合作伙伴插件", config, &decoder.Verification{AuthorizedCategory: decoder.AUTHORIZED_CATEGORY_PARTNER}, LEVEL_DISABLED},
+		{"社区插件", config, &decoder.Verification{AuthorizedCategory: decoder.AUTHORIZED_CATEGORY_COMMUNITY}, LEVEL_STANDARD},
+		{"未验证插件", config, nil, LEVEL_STRICT},
+		{"未知分类按未验证处理", config, &decoder.Verification{AuthorizedCategory: "unknown"}, LEVEL_STRICT},
+		{"级别为空时使用严格模式", &Config{Enabled: true}, nil, LEVEL_STRICT},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.config.Level(tt.verification))
+		})
+	}
+}
+
+func TestConfigPolicy(t *testing.T) {
+	config := &Config{
+		Enabled:     true,
+		Partner:     LEVEL_DISABLED,
+		Community:   LEVEL_STANDARD,
+		Unverified:  LEVEL_STRICT,
+		MaskedPaths: []string{"/etc/monie"},
+		HttpProxy:   "http://proxy:3128",
+	}
+
+	assert.Nil(t, config.Policy(&decoder.Verification{AuthorizedCategory: decoder.AUTHORIZED_CATEGORY_PARTNER}, "/work"))
+
+	standard := config.Policy(&decoder.Verification{AuthorizedCategory: decoder.AUTHORIZED_CATEGORY_COMMUNITY}, "/work")
+	if assert.NotNil(t, standard) {
+		assert.Equal(t, NETWORK_MODE_FULL, standard.Network)
+		assert.Equal(t, []string{"/work"}, standard.WritablePaths)
+		assert.Equal(t, []string{"/etc/monie"}, standard.MaskedPaths)
+	}
+
+	strict := config.Policy(nil, "/work")
+	if assert.NotNil(t, strict) {
+		assert.Equal(t, NETWORK_MODE_PROXY, strict.Network)
+		assert.Equal(t, "http://proxy:3128", strict.HttpProxy)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for _, level := range []string{"disabled", "standard", "strict"} {
+		parsed, err := ParseLevel(level)
+		assert.NoError(t, err)
+		assert.Equal(t, Level(level), parsed)
+	}
+
+	_, err := ParseLevel("loose")
+	assert.Error(t, err)
+}
+
+func TestScrubEnv(t *testing.T) {
+	environ := []string{
+		"PATH=/usr/bin",
+		"LANG=C.UTF-8",
+		"DB_PASSWORD=secret",
+		"SERVER_KEY=secret",
+		"PIP_INDEX_URL=https://mirror",
+		"INVALID",
+	}
+
+	assert.Equal(t, []string{"PATH=/usr/bin", "LANG=C.UTF-8"}, ScrubEnv(environ, nil))
+	assert.Equal(t,
+		[]string{"PATH=/usr/bin", "LANG=C.UTF-8", "PIP_INDEX_URL=https://mirror"},
+		ScrubEnv(environ, []string{" PIP_INDEX_URL"}),
+	)
+}
@@ -0,0 +1,167 @@
+package sandbox
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// syscalls a plugin never needs, most of them are used to escape the namespaces
+// or to tamper with the kernel
+var deniedSyscalls = []uint32{
+	unix.SYS_MOUNT,
+	unix.SYS_UMOUNT2,
+	unix.SYS_PIVOT_ROOT,
+	unix.SYS_CHROOT,
+	unix.SYS_UNSHARE,
+	unix.SYS_SETNS,
+	unix.SYS_OPEN_TREE,
+	unix.SYS_MOVE_MOUNT,
+	unix.SYS_FSOPEN,
+	unix.SYS_FSCONFIG,
+	unix.SYS_FSMOUNT,
+	unix.SYS_FSPICK,
+	unix.SYS_MOUNT_SETATTR,
+	unix.SYS_PTRACE,
+	unix.SYS_PROCESS_VM_READV,
+	unix.SYS_PROCESS_VM_WRITEV,
+	unix.SYS_BPF,
+	unix.SYS_PERF_EVENT_OPEN,
+	unix.SYS_USERFAULTFD,
+	unix.SYS_KEYCTL,
+	unix.SYS_ADD_KEY,
+	unix.SYS_REQUEST_KEY,
+	unix.SYS_OPEN_BY_HANDLE_AT,
+	unix.SYS_NAME_TO_HANDLE_AT,
+	unix.SYS_KEXEC_LOAD,
+	unix.SYS_INIT_MODULE,
+	unix.SYS_FINIT_MODULE,
+	unix.SYS_DELETE_MODULE,
+	unix.SYS_REBOOT,
+	unix.SYS_SWAPON,
+	unix.SYS_SWAPOFF,
+	unix.SYS_ACCT,
+	unix.SYS_SYSLOG,
+	unix.SYS_SETHOSTNAME,
+	unix.SYS_SETDOMAINNAME,
+	unix.SYS_SETTIMEOFDAY,
+	unix.SYS_CLOCK_SETTIME,
+}
+
+// clone flags creating new namespaces
+const namespaceCloneFlags = unix.CLONE_NEWUSER | unix.CLONE_NEWNS | unix.CLONE_NEWPID | unix.CLONE_NEWNET |
+	unix.CLONE_NEWIPC | unix.CLONE_NEWUTS | unix.CLONE_NEWCGROUP
+
+// offsets in struct seccomp_data
+const (
+	seccompDataNr   = 0
+	seccompDataArch = 4
+	seccompDataArg0 = 16
+)
+
+func auditArch() (uint32, error) {
+	switch runtime.GOARCH {
+	case "amd64":
+		return unix.AUDIT_ARCH_X86_64, nil
+	case "arm64":
+		return unix.AUDIT_ARCH_AARCH64, nil
+	}
+	return 0, fmt.Errorf("sandbox is not supported on %s", runtime.GOARCH)
+}
+
+// seccompFilter builds a filter denying deniedSyscalls and the creation of
+// namespaces, clone3 reports ENOSYS as its flags can't be inspected, which
+// makes the libc fall back to clone
+func seccompFilter() ([]unix.SockFilter, error) {
+	arch, err := auditArch()
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k, Jt: jt, Jf: jf}
+	}
+
+	const (
+		load  = unix.BPF_LD | unix.BPF_W | unix.BPF_ABS
+		jeq   = unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K
+		jge   = unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K
+		jset  = unix.BPF_JMP | unix.BPF_JSET | unix.BPF_K
+		ret   = unix.BPF_RET | unix.BPF_K
+		allow = unix.SECCOMP_RET_ALLOW
+		deny  = unix.SECCOMP_RET_ERRNO | uint32(unix.EPERM)
+		nosys = unix.SECCOMP_RET_ERRNO | uint32(unix.ENOSYS)
+	)
+
+	filter := []unix.SockFilter{
+		stmt(load, seccompDataArch),
+		jump(jeq, arch, 1, 0),
+		stmt(ret, unix.SECCOMP_RET_KILL_PROCESS),
+		stmt(load, seccompDataNr),
+	}
+	if runtime.GOARCH == "amd64" {
+		// x32 syscalls share the numbers of x86_64 with this bit set
+		filter = append(filter, jump(jge, 0x40000000, 0, 1), stmt(ret, deny))
+	}
+	for _, nr := range deniedSyscalls {
+		filter = append(filter, jump(jeq, nr, 0, 1), stmt(ret, deny))
+	}
+	filter = append(filter,
+		jump(jeq, unix.SYS_CLONE3, 0, 1),
+		stmt(ret, nosys),
+		jump(jeq, unix.SYS_CLONE, 1, 0),
+		stmt(ret, allow),
+		// the flags are the first argument of clone on both x86_64 and arm64,
+		// namespace flags are in the lower 32 bits
+		stmt(load, seccompDataArg0),
+		jump(jset, namespaceCloneFlags, 0, 1),
+		stmt(ret, deny),
+		stmt(ret, allow),
+	)
+	return filter, nil
+}
+
+// dropPrivileges drops every capability the calling thread may pass to the
+// processes it executes and installs the seccomp filter on it
+func dropPrivileges() error {
+	lastCap := unix.CAP_LAST_CAP
+	if data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap"); err == nil {
+		if v, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil {
+			lastCap = v
+		}
+	}
+	for c := 0; c <= lastCap; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil && err != unix.EINVAL {
+			return errors.Join(err, fmt.Errorf("drop capability %d error", c))
+		}
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil && err != unix.EINVAL {
+		return errors.Join(err, fmt.Errorf("clear ambient capabilities error"))
+	}
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return errors.Join(err, fmt.Errorf("set no_new_privs error"))
+	}
+
+	filter, err := seccompFilter()
+	if err != nil {
+		return err
+	}
+	prog := unix.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	if err := unix.Prctl(unix.PR_SET_SECCOMP, unix.SECCOMP_MODE_FILTER, uintptr(unsafe.Pointer(&prog)), 0, 0); err != nil {
+		return errors.Join(err, fmt.Errorf("install seccomp filter error"))
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package plugin_manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+// Shutdown stops all plugin lifetimes and waits until they exit or ctx is done
+func (p *PluginManager) Shutdown(ctx context.Context) {
+	p.m.Range(func(key string, lifetime plugin_entities.PluginLifetime) bool {
+		utils.Info("stopping plugin %s", key)
+		lifetime.Stop()
+		return true
+	})
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	// lifetimes are removed from m once FullDuplex returns
+	for p.m.Len() > 0 {
+		select {
+		case <-ctx.Done():
+			utils.Warn("%d plugins did not exit before shutdown deadline", p.m.Len())
+			return
+		case <-ticker.C:
+		}
+	}
+}
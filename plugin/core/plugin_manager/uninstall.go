@@ -13,3 +13,21 @@ func (p *PluginManager) UninstallFromLocal(identity plugin_entities.PluginUnique
 	runtime.Stop()
 	return nil
 }
+
+// CancelInstallLocal removes a plugin which is still being installed, its launch is
+// interrupted and the working directory is removed once the runtime exits
+func (p *PluginManager) CancelInstallLocal(identity plugin_entities.PluginUniqueIdentifier) error {
+	exists, err := p.installedBucket.Exists(identity.FsID())
+	if err != nil {
+		return err
+	}
+	if exists {
+		if err := p.installedBucket.Delete(identity); err != nil {
+			return err
+		}
+	}
+	if runtime, ok := p.m.Load(string(identity)); ok {
+		runtime.Stop()
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package plugin_manager
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/local_runtime"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/media_transport"
+	"github.com/jjgagacy/workflow-app/plugin/oss"
+	"github.com/jjgagacy/workflow-app/plugin/oss/local"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stoppingRuntime 记录是否被停止
+type stoppingRuntime struct {
+	plugin_entities.PluginLifetime
+	stopped bool
+}
+
+func (r *stoppingRuntime) Stop() {
+	r.stopped = true
+}
+
+func TestCancelInstallLocal(t *testing.T) {
+	storage, err := local.NewLocalStorage(oss.Args{Local: &oss.Local{Path: t.TempDir()}})
+	require.NoError(t, err)
+
+	const identifier plugin_entities.PluginUniqueIdentifier = "author/plugin:0.0.1@a"
+
+	tests := []struct {
+		name      string
+		installed bool
+		launching bool
+	}{
+		{name: "已写入安装目录且正在启动", installed: true, launching: true},
+		{name: "仅写入安装目录", installed: true},
+		{name: "仅正在启动", launching: true},
+		{name: "尚未开始安装"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager := &PluginManager{
+				installedBucket: media_transport.NewInstalledBucket(storage, "installed"),
+			}
+			if tt.installed {
+				require.NoError(t, manager.installedBucket.Save(identifier, []byte("package")))
+			}
+			runtime := &stoppingRuntime{}
+			if tt.launching {
+				manager.m.Store(identifier.String(), runtime)
+			}
+
+			require.NoError(t, manager.CancelInstallLocal(identifier))
+
+			// 安装目录中的插件被移除，其他副本的监听器据此停止运行时
+			exists, err := manager.installedBucket.Exists(identifier.FsID())
+			require.NoError(t, err)
+			assert.False(t, exists)
+			assert.Equal(t, tt.launching, runtime.stopped)
+		})
+	}
+}
+
+// configuredRuntime 只提供插件声明
+type configuredRuntime struct {
+	plugin_entities.PluginLifetime
+	declaration *plugin_entities.PluginDeclaration
+}
+
+func (r *configuredRuntime) Configuration() *plugin_entities.PluginDeclaration {
+	return r.declaration
+}
+
+func TestRemoveUninstalledWorkingPaths(t *testing.T) {
+	storage, err := local.NewLocalStorage(oss.Args{Local: &oss.Local{Path: t.TempDir()}})
+	require.NoError(t, err)
+
+	workingPath := t.TempDir()
+	manager := &PluginManager{
+		config:          &core.Config{PluginWorkingPath: workingPath},
+		installedBucket: media_transport.NewInstalledBucket(storage, "installed"),
+	}
+
+	const idle plugin_entities.PluginUniqueIdentifier = "author/idle:0.0.1"
+	const installed plugin_entities.PluginUniqueIdentifier = "author/installed:0.0.1"
+	require.NoError(t, manager.installedBucket.Save(idle, []byte("package")))
+	require.NoError(t, manager.installedBucket.Save(installed, []byte("package")))
+
+	idlePath := filepath.Join(workingPath, idle.FsID()+"@a")
+	installedPath := filepath.Join(workingPath, installed.FsID()+"@b")
+	runningPath := filepath.Join(workingPath, "author--running-0.0.1@c")
+	for _, dir := range []string{idlePath, installedPath, runningPath} {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+	}
+
+	// 空闲停止后保留工作目录，生命周期随之移除
+	runtime := local_runtime.NewLocalPluginRuntime(local_runtime.LocalPluginRuntimeConfig{})
+	runtime.Config.Author, runtime.Config.Name, runtime.Config.Version = "author", "idle", "0.0.1"
+	runtime.BasicChecksum.WorkingPath = idlePath
+	replicas := local_runtime.NewLocalPluginReplicas([]*local_runtime.LocalPluginRuntime{runtime})
+	replicas.SetLaunched()
+	require.True(t, replicas.StopIfIdle(0))
+	replicas.Cleanup()
+	_, err = os.Stat(idlePath)
+	require.NoError(t, err)
+
+	// 正在运行的插件由其生命周期清理工作目录
+	manager.m.Store("author/running:0.0.1", &configuredRuntime{
+		declaration: &plugin_entities.PluginDeclaration{
+			PluginDeclarationBaseFields: plugin_entities.PluginDeclarationBaseFields{Author: "author", Name: "running", Version: "0.0.1"},
+		},
+	})
+
+	// 卸载空闲停止的插件后移除其工作目录
+	require.NoError(t, manager.installedBucket.Delete(idle))
+	manager.removeUninstalledLocalPlugins()
+
+	_, err = os.Stat(idlePath)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(installedPath)
+	assert.NoError(t, err)
+	_, err = os.Stat(runningPath)
+	assert.NoError(t, err)
+}
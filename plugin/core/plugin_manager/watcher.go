@@ -1,7 +1,10 @@
 package plugin_manager
 
 import (
+	"os"
+	"path"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,6 +25,7 @@ func (p *PluginManager) startLocalWatcher(config *core.Config) {
 		for range time.NewTicker(time.Second * 30).C {
 			p.handleNewLocalPlugins(config)
 			p.removeUninstalledLocalPlugins()
+			p.stopIdleLocalPlugins()
 		}
 	}()
 }
@@ -48,6 +52,10 @@ func (p *PluginManager) handleNewLocalPlugins(config *core.Config) {
 		if exist {
 			continue
 		}
+		// with an idle timeout plugins are launched on their first request
+		if !p.pinnedWarm(plugin) {
+			continue
+		}
 
 		wg.Add(1)
 		currentPlugin := plugin
@@ -64,7 +72,7 @@ func (p *PluginManager) handleNewLocalPlugins(config *core.Config) {
 				wg.Done()
 			}()
 
-			runtime, launchedChan, errChan, err := p.launchLocal(currentPlugin)
+			runtime, launchedChan, errChan, err := p.launchLocal(currentPlugin, nil)
 			if err != nil {
 				utils.Error("launch local plugin failed: %s", err.Error())
 				return
@@ -102,7 +110,7 @@ func (p *PluginManager) handleNewLocalPlugins(config *core.Config) {
 func (p *PluginManager) removeUninstalledLocalPlugins() {
 	p.m.Range(func(key string, value plugin_entities.PluginLifetime) bool {
 		// try to convert to local runtime
-		runtime, ok := value.(*local_runtime.LocalPluginRuntime)
+		runtime, ok := value.(*local_runtime.LocalPluginReplicas)
 		if !ok {
 			return true
 		}
@@ -111,7 +119,7 @@ func (p *PluginManager) removeUninstalledLocalPlugins() {
 			utils.Error("get plugin identity failed: %s", err.Error())
 			return true
 		}
-		entity := runtime.Config.FsID()
+		entity := runtime.Configuration().FsID()
 		// check if plugin is deleted, stop it if so
 		exists, err := p.installedBucket.Exists(entity)
 		if err != nil {
@@ -123,4 +131,49 @@ func (p *PluginManager) removeUninstalledLocalPlugins() {
 		}
 		return true
 	})
+
+	p.removeUninstalledWorkingPaths()
+}
+
+// removeUninstalledWorkingPaths removes the working paths left by the plugins stopped
+// for idleness, they have no lifetime to clean them up once uninstalled
+func (p *PluginManager) removeUninstalledWorkingPaths() {
+	entries, err := os.ReadDir(p.config.PluginWorkingPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			utils.Error("list plugin working paths failed: %s", err.Error())
+		}
+		return
+	}
+
+	// plugins with a lifetime remove their working path when they are stopped
+	running := map[string]bool{}
+	p.m.Range(func(key string, value plugin_entities.PluginLifetime) bool {
+		if declaration := value.Configuration(); declaration != nil {
+			running[declaration.FsID()] = true
+		}
+		return true
+	})
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		// working paths are named <fsid>@<checksum>
+		entity, _, ok := strings.Cut(entry.Name(), "@")
+		if !ok || running[entity] {
+			continue
+		}
+		exists, err := p.installedBucket.Exists(entity)
+		if err != nil {
+			utils.Error("check plugin existent failed: %s", err.Error())
+			continue
+		}
+		if exists {
+			continue
+		}
+		if err := os.RemoveAll(path.Join(p.config.PluginWorkingPath, entry.Name())); err != nil {
+			utils.Error("remove plugin working path failed: %s", err.Error())
+		}
+	}
 }
@@ -245,3 +245,12 @@ func (z *ZipPluginDecoder) CheckAssetValid() error {
 func (z *ZipPluginDecoder) Verified() bool {
 	return z.PluginDecoderHelper.verified(z)
 }
+
+// Verification returns the verification packed into the plugin, it's nil if the
+// plugin has none or its signature can't be verified
+func (z *ZipPluginDecoder) Verification() *Verification {
+	if z.verification == nil || !z.Verified() {
+		return nil
+	}
+	return z.verification
+}
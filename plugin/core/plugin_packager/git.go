@@ -0,0 +1,280 @@
+package plugin_packager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager/decoder"
+)
+
+const (
+	// commits fetched when the ref is a commit hash, older commits can't be installed
+	gitCloneDepth = 50
+	// interval of checking the size of the clone on disk
+	gitCloneSizeCheckInterval = 200 * time.Millisecond
+)
+
+var (
+	// only tests clone from local paths and file:// urls
+	allowLocalGitRepository = false
+
+	errGitCloneTooLarge = errors.New("repository is too large")
+
+	installGitClientOnce sync.Once
+)
+
+type GitRepository struct {
+	// URL of the repository, only https urls are supported
+	URL string `json:"url"`
+	// Ref is a branch, tag or commit hash, the default branch is used if empty
+	Ref string `json:"ref"`
+	// SubDir is the directory of the plugin inside the repository
+	SubDir string `json:"sub_dir"`
+}
+
+// PackGitRepository clones the repository into a temporary directory and
+// packages the plugin under SubDir, the clone is aborted once it takes more
+// than maxCloneSize on disk
+func PackGitRepository(ctx context.Context, repository GitRepository, maxCloneSize int64, maxSize int64) ([]byte, error) {
+	if err := validateGitRepositoryURL(repository.URL, allowLocalGitRepository); err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp("", "plugin-git-*")
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("create temp directory error"))
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go watchGitCloneSize(ctx, cancel, dir, maxCloneSize)
+
+	if err := cloneGitRepository(ctx, dir, repository); err != nil {
+		if cause := context.Cause(ctx); cause == errGitCloneTooLarge {
+			return nil, errors.Join(err, cause)
+		}
+		return nil, err
+	}
+	cancel(nil)
+
+	// the clone may finish between two checks
+	if dirSize(dir) > maxCloneSize {
+		return nil, errGitCloneTooLarge
+	}
+
+	// repository metadata should never be packaged
+	if err := os.RemoveAll(filepath.Join(dir, ".git")); err != nil {
+		return nil, errors.Join(err, fmt.Errorf("remove .git directory error"))
+	}
+
+	root, err := resolveSubDir(dir, repository.SubDir)
+	if err != nil {
+		return nil, err
+	}
+
+	dec, err := decoder.NewFSPluginDecoder(root)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("decode plugin from repository error"))
+	}
+
+	return NewPackager(dec).Pack(maxSize)
+}
+
+// validateGitRepositoryURL only accepts https urls, other transports would let a tenant
+// read repositories on the host or reach services through ssh and git protocols
+func validateGitRepositoryURL(rawURL string, allowLocal bool) error {
+	if rawURL == "" {
+		return errors.New("repository url is required")
+	}
+
+	u, err := url.Parse(rawURL)
+	if err == nil && u.Scheme == "https" && u.Host != "" {
+		return nil
+	}
+
+	if allowLocal && ((err == nil && u.Scheme == "file") || filepath.IsAbs(rawURL)) {
+		return nil
+	}
+
+	return fmt.Errorf("unsupported repository url %s, only https is allowed", rawURL)
+}
+
+// installGitClient replaces the https transport of go-git with one that refuses to
+// connect to private addresses, the check is done on the resolved address when dialing
+// so that redirects and dns rebinding can't reach internal services
+func installGitClient() {
+	installGitClientOnce.Do(func() {
+		dialer := &net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: func(network, address string, c syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				ip := net.ParseIP(host)
+				if ip == nil || !isPublicIP(ip) {
+					return fmt.Errorf("connecting to %s is not allowed", host)
+				}
+				return nil
+			},
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = dialer.DialContext
+		// a proxy would resolve the host itself and bypass the check above
+		transport.Proxy = nil
+
+		client.InstallProtocol("https", githttp.NewClient(&http.Client{Transport: transport}))
+	})
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !ip.IsLoopback() &&
+		!ip.IsPrivate() &&
+		!ip.IsUnspecified() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast()
+}
+
+// watchGitCloneSize cancels the clone once the directory grows larger than maxSize
+func watchGitCloneSize(ctx context.Context, cancel context.CancelCauseFunc, dir string, maxSize int64) {
+	ticker := time.NewTicker(gitCloneSizeCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if dirSize(dir) > maxSize {
+				cancel(errGitCloneTooLarge)
+				return
+			}
+		}
+	}
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		// files may be moved by git while walking
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+func cloneGitRepository(ctx context.Context, dir string, repository GitRepository) error {
+	installGitClient()
+
+	if repository.Ref == "" {
+		_, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+			URL:          repository.URL,
+			SingleBranch: true,
+			Depth:        1,
+		})
+		if err != nil {
+			return errors.Join(err, fmt.Errorf("clone repository error"))
+		}
+		return nil
+	}
+
+	// try branches and tags first, only the ref itself is fetched
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.NewBranchReferenceName(repository.Ref),
+		plumbing.NewTagReferenceName(repository.Ref),
+	} {
+		_, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+			URL:           repository.URL,
+			ReferenceName: name,
+			SingleBranch:  true,
+			Depth:         1,
+		})
+		if err == nil {
+			return nil
+		}
+
+		var noMatching git.NoMatchingRefSpecError
+		if !errors.As(err, &noMatching) {
+			return errors.Join(err, fmt.Errorf("clone repository error"))
+		}
+
+		// clear the partial clone before the next attempt
+		if err := resetDir(dir); err != nil {
+			return err
+		}
+	}
+
+	// fallback to the recent history of the default branch and checkout the commit
+	repo, err := git.PlainCloneContext(ctx, dir, false, &git.CloneOptions{
+		URL:          repository.URL,
+		SingleBranch: true,
+		Depth:        gitCloneDepth,
+	})
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("clone repository error"))
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(repository.Ref))
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("ref %s not found in repository", repository.Ref))
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("get worktree error"))
+	}
+
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true}); err != nil {
+		return errors.Join(err, fmt.Errorf("checkout %s error", repository.Ref))
+	}
+
+	return nil
+}
+
+// resolveSubDir returns the path of subDir inside dir, cleaning it as an absolute
+// path first so that it never escapes dir
+func resolveSubDir(dir string, subDir string) (string, error) {
+	root := filepath.Join(dir, filepath.Clean(string(filepath.Separator)+subDir))
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return "", errors.Join(err, fmt.Errorf("sub directory %s not found in repository", subDir))
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", subDir)
+	}
+
+	return root, nil
+}
+
+func resetDir(dir string) error {
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.MkdirAll(dir, 0755)
+}
@@ -0,0 +1,246 @@
+package plugin_packager
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createTestGitRepository creates a local repository with the test plugin under plugins/demo
+// and returns the path of the repository and the hash of the first commit
+func createTestGitRepository(t *testing.T) (string, plumbing.Hash) {
+	repoDir := t.TempDir()
+	pluginDir := filepath.Join(repoDir, "plugins", "demo")
+
+	err := filepath.WalkDir("./decoder/test_data", func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel("./decoder/test_data", path)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if rel == "manifest.yaml" {
+			// the shared test manifest lacks the icons required by the packager
+			content = bytes.Replace(content, []byte("icon: icon.png"), []byte("icon_small: icon.png\nicon_large: icon.png"), 1)
+		}
+		target := filepath.Join(pluginDir, rel)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(target, content, 0644)
+	})
+	require.NoError(t, err)
+
+	repo, err := git.PlainInit(repoDir, false)
+	require.NoError(t, err)
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	require.NoError(t, worktree.AddGlob("."))
+	first, err := worktree.Commit("init", &git.CommitOptions{Author: signature})
+	require.NoError(t, err)
+
+	_, err = repo.CreateTag("v0.0.1", first, nil)
+	require.NoError(t, err)
+
+	// the second commit only exists on the default branch
+	require.NoError(t, os.WriteFile(filepath.Join(pluginDir, "CHANGELOG.md"), []byte("# changelog\n"), 0644))
+	require.NoError(t, worktree.AddGlob("."))
+	_, err = worktree.Commit("add changelog", &git.CommitOptions{Author: signature})
+	require.NoError(t, err)
+
+	return repoDir, first
+}
+
+// allowLocalRepository lets the test clone the repositories created on disk
+func allowLocalRepository(t *testing.T) {
+	allowLocalGitRepository = true
+	t.Cleanup(func() { allowLocalGitRepository = false })
+}
+
+func zipFileNames(t *testing.T, data []byte) map[string]bool {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	names := map[string]bool{}
+	for _, file := range reader.File {
+		names[file.Name] = true
+	}
+	return names
+}
+
+func TestPackGitRepository(t *testing.T) {
+	allowLocalRepository(t)
+	repoDir, first := createTestGitRepository(t)
+
+	tests := []struct {
+		name          string
+		repository    GitRepository
+		wantChangelog bool
+		wantErr       string
+	}{
+		{
+			name:          "默认分支",
+			repository:    GitRepository{URL: repoDir, SubDir: "plugins/demo"},
+			wantChangelog: true,
+		},
+		{
+			name:          "file 协议",
+			repository:    GitRepository{URL: "file://" + repoDir, SubDir: "plugins/demo"},
+			wantChangelog: true,
+		},
+		{
+			name:          "指定标签",
+			repository:    GitRepository{URL: repoDir, Ref: "v0.0.1", SubDir: "plugins/demo"},
+			wantChangelog: false,
+		},
+		{
+			name:          "指定提交",
+			repository:    GitRepository{URL: repoDir, Ref: first.String(), SubDir: "/plugins/demo/"},
+			wantChangelog: false,
+		},
+		{
+			name:       "引用不存在",
+			repository: GitRepository{URL: repoDir, Ref: "not-exists", SubDir: "plugins/demo"},
+			wantErr:    "ref not-exists not found",
+		},
+		{
+			name:       "子目录不存在",
+			repository: GitRepository{URL: repoDir, SubDir: "plugins/missing"},
+			wantErr:    "sub directory plugins/missing not found",
+		},
+		{
+			name:       "子目录越界时限制在仓库根目录",
+			repository: GitRepository{URL: repoDir, SubDir: "../.."},
+			wantErr:    "decode plugin from repository error",
+		},
+		{
+			name:       "仓库地址为空",
+			repository: GitRepository{},
+			wantErr:    "repository url is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := PackGitRepository(context.Background(), tt.repository, 10*1024*1024, 10*1024*1024)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			names := zipFileNames(t, data)
+			assert.True(t, names["manifest.yaml"])
+			assert.Equal(t, tt.wantChangelog, names["CHANGELOG.md"])
+			for name := range names {
+				assert.NotContains(t, name, ".git/")
+			}
+		})
+	}
+}
+
+func TestPackGitRepositoryExceedSize(t *testing.T) {
+	allowLocalRepository(t)
+	repoDir, _ := createTestGitRepository(t)
+
+	_, err := PackGitRepository(context.Background(), GitRepository{URL: repoDir, SubDir: "plugins/demo"}, 10*1024*1024, 1024)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Plugin package size is too large")
+}
+
+func TestPackGitRepositoryExceedCloneSize(t *testing.T) {
+	allowLocalRepository(t)
+	repoDir, _ := createTestGitRepository(t)
+
+	// the clone is rejected before the package is built
+	_, err := PackGitRepository(context.Background(), GitRepository{URL: repoDir, SubDir: "plugins/demo"}, 1, 10*1024*1024)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, errGitCloneTooLarge)
+}
+
+func TestPackGitRepositoryRejectsLocal(t *testing.T) {
+	repoDir, _ := createTestGitRepository(t)
+
+	for _, url := range []string{repoDir, "file://" + repoDir} {
+		_, err := PackGitRepository(context.Background(), GitRepository{URL: url, SubDir: "plugins/demo"}, 10*1024*1024, 10*1024*1024)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "only https is allowed")
+	}
+}
+
+func TestValidateGitRepositoryURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		url        string
+		allowLocal bool
+		wantErr    bool
+	}{
+		{name: "https", url: "https://github.com/author/plugin.git"},
+		{name: "地址为空", url: "", wantErr: true},
+		{name: "http", url: "http://github.com/author/plugin.git", wantErr: true},
+		{name: "ssh", url: "ssh://git@github.com/author/plugin.git", wantErr: true},
+		{name: "scp 格式", url: "git@github.com:author/plugin.git", wantErr: true},
+		{name: "git 协议", url: "git://github.com/author/plugin.git", wantErr: true},
+		{name: "缺少主机", url: "https:///author/plugin.git", wantErr: true},
+		{name: "本地路径", url: "/srv/repos/plugin", wantErr: true},
+		{name: "file 协议", url: "file:///srv/repos/plugin", wantErr: true},
+		{name: "测试中允许本地路径", url: "/srv/repos/plugin", allowLocal: true},
+		{name: "测试中允许 file 协议", url: "file:///srv/repos/plugin", allowLocal: true},
+		{name: "相对路径始终拒绝", url: "repos/plugin", allowLocal: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateGitRepositoryURL(tt.url, tt.allowLocal)
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "140.82.112.3", want: true},
+		{ip: "2606:4700::6810:84e5", want: true},
+		{ip: "127.0.0.1"},
+		{ip: "::1"},
+		{ip: "10.0.0.1"},
+		{ip: "172.16.0.1"},
+		{ip: "192.168.1.1"},
+		{ip: "169.254.169.254"},
+		{ip: "0.0.0.0"},
+		{ip: "fd00::1"},
+		{ip: "fe80::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.want, isPublicIP(net.ParseIP(tt.ip)))
+		})
+	}
+}
@@ -16,6 +16,8 @@ import (
 type Packager struct {
 	decoder  decoder.PluginDecoder
 	manifest string
+
+	vendorWheels *VendorWheelsOptions
 }
 
 func NewPackager(decoder decoder.PluginDecoder) *Packager {
@@ -61,6 +63,26 @@ func (p *Packager) Pack(maxSize int64) ([]byte, error) {
 		return nil, err
 	}
 
+	if p.vendorWheels != nil {
+		// wheels already in the plugin directory are replaced by the downloaded ones
+		kept := []FileInfoPath{}
+		for _, file := range files {
+			if strings.HasPrefix(filepath.ToSlash(file.Path), WHEELS_DIR+"/") {
+				totalSize -= file.Size
+				continue
+			}
+			kept = append(kept, file)
+		}
+		wheels, err := p.downloadWheels()
+		if err != nil {
+			return nil, err
+		}
+		for _, wheel := range wheels {
+			totalSize += wheel.Size
+		}
+		files = append(kept, wheels...)
+	}
+
 	if totalSize > maxSize {
 		sort.Slice(files, func(i, j int) bool {
 			return files[i].Size > files[j].Size
@@ -0,0 +1,435 @@
+package plugin_packager
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/constants"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager/decoder"
+)
+
+const (
+	// directory of the wheels bundled into a package for offline installation
+	WHEELS_DIR = "wheels"
+)
+
+type VendorWheelsOptions struct {
+	// interpreter running pip download, python3 if empty
+	PythonPath string
+	// index to download the wheels from, the default of pip if empty
+	IndexUrl string
+}
+
+// SetVendorWheels makes Pack download the wheels of requirements.txt for every
+// arch declared in the manifest into the package, nil disables it
+func (p *Packager) SetVendorWheels(options *VendorWheelsOptions) {
+	p.vendorWheels = options
+}
+
+// platform tags of the wheels downloaded for an arch, pip accepts older
+// manylinux wheels for each of them
+var wheelPlatforms = map[constants.Arch][]string{
+	constants.AMD64: {"manylinux_2_28_x86_64", "manylinux2014_x86_64"},
+	constants.ARM64: {"manylinux_2_28_aarch64", "manylinux2014_aarch64"},
+}
+
+// wheel machine names of the platform tags of an arch
+var wheelMachines = map[constants.Arch]string{
+	constants.AMD64: "x86_64",
+	constants.ARM64: "aarch64",
+}
+
+func (p *Packager) downloadWheels() ([]FileInfoPath, error) {
+	manifest, err := p.decoder.Manifest()
+	if err != nil {
+		return nil, err
+	}
+	if manifest.Meta.Runner.Language != constants.Python {
+		return nil, fmt.Errorf("wheels can only be vendored for python plugins")
+	}
+
+	requirements, err := p.decoder.ReadFile("requirements.txt")
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("read requirements.txt error"))
+	}
+
+	dir, err := os.MkdirTemp("", "plugin-wheels-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	requirementsPath := filepath.Join(dir, "requirements.txt")
+	if err := os.WriteFile(requirementsPath, requirements, 0644); err != nil {
+		return nil, err
+	}
+	wheelsPath := filepath.Join(dir, WHEELS_DIR)
+
+	pythonPath := p.vendorWheels.PythonPath
+	if pythonPath == "" {
+		pythonPath = "python3"
+	}
+
+	for _, arch := range manifest.Meta.Arch {
+		platforms, ok := wheelPlatforms[arch]
+		if !ok {
+			return nil, fmt.Errorf("unsupported arch: %s", arch)
+		}
+
+		args := []string{
+			"-m", "pip", "download",
+			"-r", requirementsPath,
+			"-d", wheelsPath,
+			"--only-binary=:all:",
+			"--implementation", "cp",
+			"--python-version", constants.PythonVersion,
+		}
+		for _, platform := range platforms {
+			args = append(args, "--platform", platform)
+		}
+		if p.vendorWheels.IndexUrl != "" {
+			args = append(args, "-i", p.vendorWheels.IndexUrl)
+		}
+
+		cmd := exec.Command(pythonPath, args...)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			return nil, fmt.Errorf("failed to download wheels for %s: %s, output: %s", arch, err, output)
+		}
+	}
+
+	entries, err := os.ReadDir(wheelsPath)
+	if err != nil {
+		return nil, errors.Join(err, fmt.Errorf("read downloaded wheels error"))
+	}
+
+	files := []FileInfoPath{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".whl") {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(wheelsPath, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, FileInfoPath{
+			Path:    filepath.Join(WHEELS_DIR, entry.Name()),
+			Size:    int64(len(content)),
+			Content: content,
+		})
+	}
+	return files, nil
+}
+
+// CheckOfflineWheels checks every requirement of a python plugin is satisfied by
+// its bundled wheels on arch. Only the requirements listed in requirements.txt
+// are checked, their dependencies are resolved by the installer
+func CheckOfflineWheels(dec decoder.PluginDecoder, arch constants.Arch) error {
+	content, err := dec.ReadFile("requirements.txt")
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("read requirements.txt error"))
+	}
+	requirements, err := parseRequirements(content)
+	if err != nil {
+		return err
+	}
+
+	files, err := dec.ReadDir(WHEELS_DIR)
+	if err != nil {
+		return errors.Join(err, fmt.Errorf("plugin has no bundled wheels"))
+	}
+	wheels := []wheel{}
+	for _, file := range files {
+		w, ok := parseWheelFilename(filepath.Base(file))
+		if ok && w.compatible(arch) {
+			wheels = append(wheels, w)
+		}
+	}
+
+	unsatisfied := []string{}
+	for _, requirement := range requirements {
+		satisfied := false
+		for _, w := range wheels {
+			if w.name == requirement.name && requirement.satisfiedBy(w.version) {
+				satisfied = true
+				break
+			}
+		}
+		if !satisfied {
+			unsatisfied = append(unsatisfied, requirement.raw)
+		}
+	}
+
+	if len(unsatisfied) > 0 {
+		return fmt.Errorf("requirements can't be installed offline on %s: %s", arch, strings.Join(unsatisfied, ", "))
+	}
+	return nil
+}
+
+type requirement struct {
+	raw        string
+	name       string
+	specifiers []versionSpecifier
+}
+
+type versionSpecifier struct {
+	op      string
+	version string
+}
+
+var (
+	requirementNamePattern = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)\s*(\[[^\]]*\])?\s*(.*)$`)
+	specifierPattern       = regexp.MustCompile(`^(~=|===|==|!=|<=|>=|<|>)\s*(\S+)$`)
+	nameSeparatorPattern   = regexp.MustCompile(`[-_.]+`)
+)
+
+// normalizeName normalizes a project name as PEP 503 does
+func normalizeName(name string) string {
+	return strings.ToLower(nameSeparatorPattern.ReplaceAllString(name, "-"))
+}
+
+// parseRequirements parses requirements.txt, requirements with environment markers
+// are skipped as they are evaluated by the installer
+func parseRequirements(content []byte) ([]requirement, error) {
+	requirements := []requirement{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// pip options such as --index-url don't matter offline
+		if strings.HasPrefix(line, "-") {
+			if strings.HasPrefix(line, "-r") || strings.HasPrefix(line, "--requirement") ||
+				strings.HasPrefix(line, "-e") || strings.HasPrefix(line, "--editable") {
+				return nil, fmt.Errorf("unsupported requirement for offline installation: %s", line)
+			}
+			continue
+		}
+		if strings.Contains(line, ";") {
+			continue
+		}
+		if strings.Contains(line, "://") || strings.Contains(line, " @ ") {
+			return nil, fmt.Errorf("requirement from url can't be installed offline: %s", line)
+		}
+
+		matches := requirementNamePattern.FindStringSubmatch(line)
+		if matches == nil {
+			return nil, fmt.Errorf("invalid requirement: %s", line)
+		}
+
+		req := requirement{raw: line, name: normalizeName(matches[1])}
+		rest := strings.TrimSpace(strings.Trim(strings.TrimSpace(matches[3]), "()"))
+		if rest != "" {
+			for _, s := range strings.Split(rest, ",") {
+				specifier := specifierPattern.FindStringSubmatch(strings.TrimSpace(s))
+				if specifier == nil {
+					return nil, fmt.Errorf("invalid version specifier of %s: %s", matches[1], s)
+				}
+				req.specifiers = append(req.specifiers, versionSpecifier{op: specifier[1], version: specifier[2]})
+			}
+		}
+		requirements = append(requirements, req)
+	}
+	return requirements, scanner.Err()
+}
+
+func (r requirement) satisfiedBy(version string) bool {
+	for _, specifier := range r.specifiers {
+		if !specifier.matches(version) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s versionSpecifier) matches(version string) bool {
+	if strings.HasSuffix(s.version, ".*") {
+		prefix := strings.TrimSuffix(s.version, ".*")
+		matched := compareVersions(version, prefix, true) == 0
+		switch s.op {
+		case "==":
+			return matched
+		case "!=":
+			return !matched
+		}
+		return false
+	}
+
+	cmp := compareVersions(version, s.version, false)
+	switch s.op {
+	case "==", "===":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<=":
+		return cmp <= 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case ">":
+		return cmp > 0
+	case "~=":
+		// ~=1.4.2 means >=1.4.2, ==1.4.*
+		release := strings.Split(s.version, ".")
+		if cmp < 0 || len(release) < 2 {
+			return false
+		}
+		return compareVersions(version, strings.Join(release[:len(release)-1], "."), true) == 0
+	}
+	return false
+}
+
+var versionPattern = regexp.MustCompile(`^v?(\d+(?:\.\d+)*)(.*)$`)
+
+// compareVersions compares the release segments of two versions, a version with
+// a suffix such as 1.0rc1 is older than the release itself. prefix compares only
+// the segments present in b, used by wildcards
+func compareVersions(a string, b string, prefix bool) int {
+	ma := versionPattern.FindStringSubmatch(strings.ToLower(a))
+	mb := versionPattern.FindStringSubmatch(strings.ToLower(b))
+	if ma == nil || mb == nil {
+		return strings.Compare(a, b)
+	}
+
+	sa := strings.Split(ma[1], ".")
+	sb := strings.Split(mb[1], ".")
+	n := max(len(sa), len(sb))
+	if prefix {
+		n = len(sb)
+	}
+	for i := 0; i < n; i++ {
+		va, vb := 0, 0
+		if i < len(sa) {
+			va, _ = strconv.Atoi(sa[i])
+		}
+		if i < len(sb) {
+			vb, _ = strconv.Atoi(sb[i])
+		}
+		if va != vb {
+			if va < vb {
+				return -1
+			}
+			return 1
+		}
+	}
+	if prefix {
+		return 0
+	}
+
+	suffixA, suffixB := ma[2], mb[2]
+	switch {
+	case suffixA == suffixB:
+		return 0
+	case isPostRelease(suffixA) != isPostRelease(suffixB):
+		if isPostRelease(suffixA) {
+			return 1
+		}
+		return -1
+	case suffixA == "":
+		return 1
+	case suffixB == "":
+		return -1
+	}
+	return strings.Compare(suffixA, suffixB)
+}
+
+func isPostRelease(suffix string) bool {
+	suffix = strings.TrimLeft(suffix, ".-_")
+	return strings.HasPrefix(suffix, "post")
+}
+
+type wheel struct {
+	name      string
+	version   string
+	pythonTag []string
+	abiTag    []string
+	platforms []string
+}
+
+// parseWheelFilename parses {name}-{version}(-{build})?-{python}-{abi}-{platform}.whl
+func parseWheelFilename(filename string) (wheel, bool) {
+	if !strings.HasSuffix(filename, ".whl") {
+		return wheel{}, false
+	}
+	parts := strings.Split(strings.TrimSuffix(filename, ".whl"), "-")
+	if len(parts) != 5 && len(parts) != 6 {
+		return wheel{}, false
+	}
+	n := len(parts)
+	return wheel{
+		name:      normalizeName(parts[0]),
+		version:   parts[1],
+		pythonTag: strings.Split(parts[n-3], "."),
+		abiTag:    strings.Split(parts[n-2], "."),
+		platforms: strings.Split(parts[n-1], "."),
+	}, true
+}
+
+// compatible reports whether the wheel can be installed by CPython constants.PythonVersion on linux arch
+func (w wheel) compatible(arch constants.Arch) bool {
+	release := strings.ReplaceAll(constants.PythonVersion, ".", "")
+	minor, _ := strconv.Atoi(strings.TrimPrefix(release, "3"))
+
+	pythonOk := false
+	for _, tag := range w.pythonTag {
+		switch {
+		case tag == "py3" || tag == "cp"+release || tag == "py"+release:
+			pythonOk = true
+		case strings.HasPrefix(tag, "cp3") && contains(w.abiTag, "abi3"):
+			// stable abi wheels work on every later version
+			if v, err := strconv.Atoi(strings.TrimPrefix(tag, "cp3")); err == nil && v <= minor {
+				pythonOk = true
+			}
+		}
+	}
+	if !pythonOk {
+		return false
+	}
+
+	abiOk := false
+	for _, tag := range w.abiTag {
+		if tag == "none" || tag == "abi3" || tag == "cp"+release {
+			abiOk = true
+		}
+	}
+	if !abiOk {
+		return false
+	}
+
+	machine := wheelMachines[arch]
+	for _, platform := range w.platforms {
+		if platform == "any" {
+			return true
+		}
+		if strings.HasSuffix(platform, "_"+machine) &&
+			(strings.HasPrefix(platform, "manylinux") || strings.HasPrefix(platform, "linux")) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
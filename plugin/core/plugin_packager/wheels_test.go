@@ -0,0 +1,225 @@
+package plugin_packager
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/constants"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager/decoder"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// copyTestPlugin 复制测试插件，并写入 requirements.txt 和 wheels
+func copyTestPlugin(t *testing.T, requirements string, wheels []string) string {
+	dir := t.TempDir()
+	err := filepath.WalkDir("./decoder/test_data", func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel("./decoder/test_data", path)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return os.MkdirAll(filepath.Join(dir, rel), 0755)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dir, rel), content, 0644)
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "requirements.txt"), []byte(requirements), 0644))
+	if len(wheels) > 0 {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, WHEELS_DIR), 0755))
+		for _, wheel := range wheels {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, WHEELS_DIR, wheel), []byte(wheel), 0644))
+		}
+	}
+	return dir
+}
+
+func TestParseRequirements(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []requirement
+		wantErr  bool
+	}{
+		{
+			name:    "固定版本和范围",
+			content: "requests==2.31.0\nPyYAML >=6.0, <7 # comment\n\nmonie_plugin~=0.1\n",
+			expected: []requirement{
+				{raw: "requests==2.31.0", name: "requests", specifiers: []versionSpecifier{{"==", "2.31.0"}}},
+				{raw: "PyYAML >=6.0, <7", name: "pyyaml", specifiers: []versionSpecifier{{">=", "6.0"}, {"<", "7"}}},
+				{raw: "monie_plugin~=0.1", name: "monie-plugin", specifiers: []versionSpecifier{{"~=", "0.1"}}},
+			},
+		},
+		{
+			name:    "跳过选项和环境标记",
+			content: "--index-url https://pypi.org/simple\nuvloop; sys_platform != 'win32'\nhttpx[http2]\n",
+			expected: []requirement{
+				{raw: "httpx[http2]", name: "httpx"},
+			},
+		},
+		{
+			name:    "引用其他文件",
+			content: "-r base.txt\n",
+			wantErr: true,
+		},
+		{
+			name:    "来自url",
+			content: "requests @ https://example.com/requests.whl\n",
+			wantErr: true,
+		},
+		{
+			name:    "无效版本",
+			content: "requests=2.31.0\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requirements, err := parseRequirements([]byte(tt.content))
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, requirements)
+		})
+	}
+}
+
+func TestVersionSpecifierMatches(t *testing.T) {
+	tests := []struct {
+		name      string
+		specifier versionSpecifier
+		version   string
+		expected  bool
+	}{
+		{"相等", versionSpecifier{"==", "2.31.0"}, "2.31.0", true},
+		{"补零相等", versionSpecifier{"==", "2.31"}, "2.31.0", true},
+		{"不相等", versionSpecifier{"==", "2.31.0"}, "2.31.1", false},
+		{"通配符", versionSpecifier{"==", "2.*"}, "2.31.0", true},
+		{"排除通配符", versionSpecifier{"!=", "2.*"}, "2.31.0", false},
+		{"大于等于", versionSpecifier{">=", "6.0"}, "6.0.1", true},
+		{"小于", versionSpecifier{"<", "7"}, "7.0", false},
+		{"预发布版本更旧", versionSpecifier{"<", "1.0"}, "1.0rc1", true},
+		{"后发布版本更新", versionSpecifier{">", "1.0"}, "1.0.post1", true},
+		{"兼容版本", versionSpecifier{"~=", "1.4.2"}, "1.4.5", true},
+		{"兼容版本不跨次版本", versionSpecifier{"~=", "1.4.2"}, "1.5.0", false},
+		{"兼容版本低于下限", versionSpecifier{"~=", "1.4.2"}, "1.4.1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.specifier.matches(tt.version))
+		})
+	}
+}
+
+func TestWheelCompatible(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		arch     constants.Arch
+		expected bool
+	}{
+		{"纯python", "requests-2.31.0-py3-none-any.whl", constants.AMD64, true},
+		{"当前版本", "pydantic_core-2.14.5-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl", constants.AMD64, true},
+		{"架构不匹配", "pydantic_core-2.14.5-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl", constants.ARM64, false},
+		{"其他python版本", "pydantic_core-2.14.5-cp311-cp311-manylinux_2_17_aarch64.whl", constants.ARM64, false},
+		{"稳定abi", "cryptography-41.0.7-cp37-abi3-manylinux_2_28_aarch64.whl", constants.ARM64, true},
+		{"其他系统", "pyyaml-6.0.1-cp312-cp312-macosx_11_0_arm64.whl", constants.ARM64, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, ok := parseWheelFilename(tt.filename)
+			require.True(t, ok)
+			assert.Equal(t, tt.expected, w.compatible(tt.arch))
+		})
+	}
+}
+
+func TestCheckOfflineWheels(t *testing.T) {
+	wheels := []string{
+		"requests-2.31.0-py3-none-any.whl",
+		"PyYAML-6.0.1-cp312-cp312-manylinux_2_17_x86_64.manylinux2014_x86_64.whl",
+	}
+
+	// 所有依赖都有对应的 wheel
+	dec, err := decoder.NewFSPluginDecoder(copyTestPlugin(t, "requests==2.31.0\npyyaml>=6\n", wheels))
+	require.NoError(t, err)
+	assert.NoError(t, CheckOfflineWheels(dec, constants.AMD64))
+
+	// arm64 缺少 pyyaml
+	err = CheckOfflineWheels(dec, constants.ARM64)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pyyaml>=6")
+	assert.NotContains(t, err.Error(), "requests")
+
+	// 版本不满足
+	dec, err = decoder.NewFSPluginDecoder(copyTestPlugin(t, "requests>=2.32\n", wheels))
+	require.NoError(t, err)
+	assert.Error(t, CheckOfflineWheels(dec, constants.AMD64))
+
+	// 没有打包 wheels
+	dec, err = decoder.NewFSPluginDecoder(copyTestPlugin(t, "requests==2.31.0\n", nil))
+	require.NoError(t, err)
+	assert.Error(t, CheckOfflineWheels(dec, constants.AMD64))
+}
+
+func TestPackagerDownloadWheels(t *testing.T) {
+	// 模拟 pip download，根据 --platform 生成 wheel 并记录参数
+	bin := t.TempDir()
+	python := filepath.Join(bin, "python")
+	script := `#!/bin/sh
+echo "$@" >> "` + filepath.Join(bin, "args") + `"
+while [ $# -gt 0 ]; do
+	case "$1" in
+		-d) dir="$2"; shift ;;
+		--platform) [ -z "$platform" ] && platform="$2"; shift ;;
+	esac
+	shift
+done
+mkdir -p "$dir"
+echo wheel > "$dir/requests-2.31.0-py3-none-any.whl"
+echo wheel > "$dir/pyyaml-6.0.1-cp312-cp312-$platform.whl"
+`
+	require.NoError(t, os.WriteFile(python, []byte(script), 0755))
+
+	dir := copyTestPlugin(t, "requests==2.31.0\npyyaml>=6\n", nil)
+	dec, err := decoder.NewFSPluginDecoder(dir)
+	require.NoError(t, err)
+
+	packager := NewPackager(dec)
+	packager.SetVendorWheels(&VendorWheelsOptions{PythonPath: python, IndexUrl: "https://mirror.example.com/simple"})
+
+	files, err := packager.downloadWheels()
+	require.NoError(t, err)
+
+	paths := []string{}
+	for _, file := range files {
+		paths = append(paths, file.Path)
+		assert.Equal(t, int64(len(file.Content)), file.Size)
+	}
+	sort.Strings(paths)
+	assert.Equal(t, []string{
+		"wheels/pyyaml-6.0.1-cp312-cp312-manylinux_2_28_aarch64.whl",
+		"wheels/pyyaml-6.0.1-cp312-cp312-manylinux_2_28_x86_64.whl",
+		"wheels/requests-2.31.0-py3-none-any.whl",
+	}, paths)
+
+	args, err := os.ReadFile(filepath.Join(bin, "args"))
+	require.NoError(t, err)
+	assert.Contains(t, string(args), "--only-binary=:all: --implementation cp --python-version "+constants.PythonVersion)
+	assert.Contains(t, string(args), "-i https://mirror.example.com/simple")
+}
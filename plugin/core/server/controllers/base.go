@@ -9,9 +9,11 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/jjgagacy/workflow-app/plugin/core/server/server_const"
+	"github.com/jjgagacy/workflow-app/plugin/model"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/validators"
+	"github.com/jjgagacy/workflow-app/plugin/service"
 )
 
 func logRequestBody(ctx *gin.Context) {
@@ -84,7 +86,30 @@ func BindPluginDispatchRequest[T any](rtx *gin.Context, success func(plugin_enti
 		}
 
 		req.UniqueIdentifier = pluginUniqueIdentifier
+		if value, ok := rtx.Get(server_const.PLUGIN_ROLLOUT); ok {
+			if rollout, ok := value.(*model.PluginRollout); ok {
+				req.UniqueIdentifier = service.SelectPluginRolloutIdentifier(rollout, req.ConversationID)
+			}
+		}
 
 		success(req)
 	})
 }
+
+// idempotent runs fn once per Idempotency-Key header of the tenant and route and writes
+// its response, requests without the header always run fn. The key is bound to the
+// request it's first used with, reusing it for another request is answered with 409
+func idempotent(ctx *gin.Context, tenantId string, request any, fn func() *entities.Response) {
+	response := service.WithIdempotencyKey(
+		tenantId,
+		ctx.FullPath(),
+		ctx.GetHeader(server_const.IDEMPOTENCY_KEY),
+		service.IdempotencyFingerprint(request),
+		fn,
+	)
+	if response.Code == entities.ErrConflictCode {
+		ctx.JSON(http.StatusConflict, response)
+		return
+	}
+	ctx.JSON(http.StatusOK, response)
+}
@@ -1,10 +1,12 @@
 package controllers
 
 import (
+	"net/http"
 	"sync/atomic"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
 )
 
 var (
@@ -12,8 +14,34 @@ var (
 	activeRequests int32 = 0
 	// How many plugin dispatching requests are active
 	activeDispatchRequests int32 = 0
+	// Whether the node is shutting down and refuses new dispatches
+	draining int32 = 0
 )
 
+// StartDraining marks the node as draining, health check reports it to the
+// load balancer and new dispatches are refused
+func StartDraining() {
+	atomic.StoreInt32(&draining, 1)
+}
+
+func IsDraining() bool {
+	return atomic.LoadInt32(&draining) == 1
+}
+
+func RejectWhenDraining() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if IsDraining() {
+			ctx.AbortWithStatusJSON(http.StatusServiceUnavailable, entities.NewErrorWithType(
+				entities.ErrInternalCode,
+				"server is shutting down",
+				entities.ErrInternal,
+			).ToResponse())
+			return
+		}
+		ctx.Next()
+	}
+}
+
 func CollectActiveRequests() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		atomic.AddInt32(&activeRequests, 1)
@@ -32,6 +60,16 @@ func CollectActiveDispatchRequests() gin.HandlerFunc {
 
 func HealthCheck(config *core.Config) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
+		if IsDraining() {
+			ctx.JSON(http.StatusServiceUnavailable, gin.H{
+				"status":                   "draining",
+				"platform":                 config.Platform,
+				"active_requests":          atomic.LoadInt32(&activeRequests),
+				"active_dispatch_requests": atomic.LoadInt32(&activeDispatchRequests),
+			})
+			return
+		}
+
 		ctx.JSON(200, gin.H{
 			"status":                   "ok",
 			"platform":                 config.Platform,
@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/core/mcp"
+	"github.com/jjgagacy/workflow-app/plugin/service"
+)
+
+// MCP serves the tools installed by the tenant to mcp clients, the body is the
+// json-rpc message itself so it's not bound as the other requests
+func MCP(config *core.Config) gin.HandlerFunc {
+	server := mcp.NewServer(&service.MCPToolBackend{MaxTimeout: config.PluginMaxExecutionTimeout})
+
+	return func(ctx *gin.Context) {
+		caller := mcp.Caller{
+			TenantID: ctx.Param("tenant_id"),
+			UserID:   ctx.Query("user_id"),
+		}
+		server.HandleHTTP(ctx, caller, mcp.MAX_MESSAGE_SIZE)
+	}
+}
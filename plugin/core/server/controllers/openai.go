@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/core/openai"
+	"github.com/jjgagacy/workflow-app/plugin/service"
+)
+
+func openAIServer(config *core.Config) *openai.Server {
+	return openai.NewServer(
+		&service.OpenAIModelBackend{},
+		time.Duration(config.PluginMaxExecutionTimeout)*time.Second,
+	)
+}
+
+func openAICaller(ctx *gin.Context) openai.Caller {
+	return openai.Caller{
+		TenantID: ctx.Param("tenant_id"),
+		UserID:   ctx.Query("user_id"),
+	}
+}
+
+// OpenAIModels lists the models of the tenant, the body is shaped as the openai api
+// so it's not wrapped as the other responses
+func OpenAIModels(config *core.Config) gin.HandlerFunc {
+	server := openAIServer(config)
+	return func(ctx *gin.Context) {
+		server.Models(ctx, openAICaller(ctx))
+	}
+}
+
+func OpenAIChatCompletions(config *core.Config) gin.HandlerFunc {
+	server := openAIServer(config)
+	return func(ctx *gin.Context) {
+		server.ChatCompletions(ctx, openAICaller(ctx))
+	}
+}
+
+func OpenAIEmbeddings(config *core.Config) gin.HandlerFunc {
+	server := openAIServer(config)
+	return func(ctx *gin.Context) {
+		server.Embeddings(ctx, openAICaller(ctx))
+	}
+}
+
+func OpenAIRerank(config *core.Config) gin.HandlerFunc {
+	server := openAIServer(config)
+	return func(ctx *gin.Context) {
+		server.Rerank(ctx, openAICaller(ctx))
+	}
+}
+
+func OpenAISpeech(config *core.Config) gin.HandlerFunc {
+	server := openAIServer(config)
+	return func(ctx *gin.Context) {
+		server.Speech(ctx, openAICaller(ctx))
+	}
+}
+
+func OpenAITranscriptions(config *core.Config) gin.HandlerFunc {
+	server := openAIServer(config)
+	return func(ctx *gin.Context) {
+		server.Transcriptions(ctx, openAICaller(ctx))
+	}
+}
+
+func OpenAIModerations(config *core.Config) gin.HandlerFunc {
+	server := openAIServer(config)
+	return func(ctx *gin.Context) {
+		server.Moderations(ctx, openAICaller(ctx))
+	}
+}
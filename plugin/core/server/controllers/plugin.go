@@ -8,6 +8,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/jjgagacy/workflow-app/plugin/core"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
 	"github.com/jjgagacy/workflow-app/plugin/service"
@@ -95,16 +96,20 @@ func UpgradePlugin(config *core.Config) gin.HandlerFunc {
 			OriginalPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `json:"original_plugin_unique_identifier" validate:"required,plugin_unique_identifier"`
 			NewPluginUniqueIdentifier      plugin_entities.PluginUniqueIdentifier `json:"new_plugin_unique_identifier" validate:"required,plugin_unique_identifier"`
 			Source                         string                                 `json:"source" validate:"required"`
-			Meta                           map[string]any                         `json"meta" validate:"omitempty"`
+			Meta                           map[string]any                         `json:"meta" validate:"omitempty"`
+			UserID                         string                                 `json:"user_id" validate:"omitempty"`
 		}) {
-			ctx.JSON(http.StatusOK, service.UpgradePlugin(
-				config,
-				request.TenantID,
-				request.Source,
-				request.Meta,
-				request.OriginalPluginUniqueIdentifier,
-				request.NewPluginUniqueIdentifier,
-			))
+			idempotent(ctx, request.TenantID, request, func() *entities.Response {
+				return service.UpgradePlugin(
+					config,
+					request.TenantID,
+					request.Source,
+					request.Meta,
+					request.OriginalPluginUniqueIdentifier,
+					request.NewPluginUniqueIdentifier,
+					request.UserID,
+				)
+			})
 		})
 	}
 }
@@ -116,6 +121,7 @@ func InstallPluginFromIdentifiers(config *core.Config) gin.HandlerFunc {
 			PluginUniqueIdentifier []plugin_entities.PluginUniqueIdentifier `json:"plugin_unique_identifies" validate:"required,max=64,dive,plugin_unique_identifier"`
 			Source                 string                                   `json:"source" validate:"required"`
 			Metas                  []map[string]any                         `json:"meta" validate:"omitempty"`
+			UserID                 string                                   `json:"user_id" validate:"omitempty"`
 		}) {
 			if request.Metas == nil {
 				request.Metas = []map[string]any{}
@@ -132,13 +138,77 @@ func InstallPluginFromIdentifiers(config *core.Config) gin.HandlerFunc {
 				}
 			}
 
-			ctx.JSON(http.StatusOK, service.InstallPluginFromIdentifier(
-				config, request.TenantID, request.PluginUniqueIdentifier, request.Source, request.Metas,
-			))
+			idempotent(ctx, request.TenantID, request, func() *entities.Response {
+				return service.InstallPluginFromIdentifier(
+					config, request.TenantID, request.PluginUniqueIdentifier, request.Source, request.Metas, request.UserID,
+				)
+			})
 		})
 	}
 }
 
+func InstallPluginFromGit(config *core.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		BindRequest(ctx, func(request struct {
+			TenantID string         `uri:"tenant_id" validate:"required"`
+			RepoURL  string         `json:"repo_url" validate:"required,max=1024"`
+			Ref      string         `json:"ref" validate:"omitempty,max=256"`
+			SubDir   string         `json:"sub_dir" validate:"omitempty,max=1024"`
+			Source   string         `json:"source" validate:"omitempty"`
+			Meta     map[string]any `json:"meta" validate:"omitempty"`
+			UserID   string         `json:"user_id" validate:"omitempty"`
+		}) {
+			if request.Source == "" {
+				request.Source = "git"
+			}
+
+			idempotent(ctx, request.TenantID, request, func() *entities.Response {
+				return service.InstallPluginFromGit(
+					config,
+					request.TenantID,
+					plugin_packager.GitRepository{
+						URL:    request.RepoURL,
+						Ref:    request.Ref,
+						SubDir: request.SubDir,
+					},
+					request.Source,
+					request.Meta,
+					request.UserID,
+				)
+			})
+		})
+	}
+}
+
+func RollbackPlugin(config *core.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		BindRequest(ctx, func(request struct {
+			TenantID             string `uri:"tenant_id" validate:"required"`
+			PluginInstallationID string `json:"plugin_installation_id" validate:"required"`
+			UserID               string `json:"user_id" validate:"omitempty"`
+		}) {
+			idempotent(ctx, request.TenantID, request, func() *entities.Response {
+				return service.RollbackPlugin(
+					config, request.TenantID, request.PluginInstallationID, request.UserID,
+				)
+			})
+		})
+	}
+}
+
+func FetchPluginInstallationHistories(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		TenantID string `uri:"tenant_id" validate:"required"`
+		PluginID string `form:"plugin_id" validate:"required"`
+		Page     int    `form:"page" validate:"required,min=1"`
+		PageSize int    `form:"page_size" validate:"required,min=1,max=256"`
+	}) {
+		ctx.JSON(http.StatusOK, service.ListPluginInstallationHistories(
+			request.TenantID, request.PluginID, request.Page, request.PageSize,
+		))
+	})
+}
+
 func ReinstallPluginFromIdentifier(config *core.Config) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 
@@ -171,6 +241,56 @@ func FetchPluginInstallationTask(ctx *gin.Context) {
 		ctx.JSON(http.StatusOK, service.FetchPluginInstallationTask(request.TenantID, request.TaskID))
 	})
 }
+
+func StreamPluginInstallationTask(config *core.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		BindRequest(ctx, func(request struct {
+			TenantID string `uri:"tenant_id" validate:"required"`
+			TaskID   string `uri:"id" validate:"required"`
+		}) {
+			service.StreamPluginInstallationTask(
+				ctx, request.TenantID, request.TaskID, config.PluginInstallTaskStreamTimeout,
+			)
+		})
+	}
+}
+
+// PluginInstallationTaskAction serves cancel and retry of a task, they share the route
+// with the deletion of a task item, which never conflicts since identifiers contain slashes
+func PluginInstallationTaskAction(config *core.Config) gin.HandlerFunc {
+	retry := RetryPluginInstallationTask(config)
+	return func(ctx *gin.Context) {
+		switch ctx.Param("identifier") {
+		case "/cancel":
+			CancelPluginInstallationTask(ctx)
+		case "/retry":
+			retry(ctx)
+		default:
+			DeletePluginInstallationItemFromTask(ctx)
+		}
+	}
+}
+
+func CancelPluginInstallationTask(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		TenantID string `uri:"tenant_id" validate:"required"`
+		TaskID   string `uri:"id" validate:"required"`
+	}) {
+		ctx.JSON(http.StatusOK, service.CancelPluginInstallationTask(request.TenantID, request.TaskID))
+	})
+}
+
+func RetryPluginInstallationTask(config *core.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		BindRequest(ctx, func(request struct {
+			TenantID string `uri:"tenant_id" validate:"required"`
+			TaskID   string `uri:"id" validate:"required"`
+		}) {
+			ctx.JSON(http.StatusOK, service.RetryPluginInstallationTask(config, request.TenantID, request.TaskID))
+		})
+	}
+}
+
 func DeletePluginInstallationTask(ctx *gin.Context) {
 	BindRequest(ctx, func(request struct {
 		TenantID string `uri:"tenant_id" validate:"required"`
@@ -218,8 +338,26 @@ func UninstallPlugin(ctx *gin.Context) {
 	BindRequest(ctx, func(request struct {
 		TenantId             string `uri:"tenant_id" validate:"required"`
 		PluginInstallationID string `json:"plugin_installation_id" validate:"required"`
+		UserID               string `json:"user_id" validate:"omitempty"`
+	}) {
+		ctx.JSON(http.StatusOK, service.UninstallPlugin(request.TenantId, request.PluginInstallationID, request.UserID))
+	})
+}
+
+func ListMCPServers(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, service.ListMCPServers())
+}
+
+func InstallMCPServer(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		TenantID               string                                 `uri:"tenant_id" validate:"required"`
+		PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `json:"plugin_unique_identifier" validate:"required,plugin_unique_identifier"`
+		Meta                   map[string]any                         `json:"meta" validate:"omitempty"`
+		UserID                 string                                 `json:"user_id" validate:"omitempty"`
 	}) {
-		ctx.JSON(http.StatusOK, service.UninstallPlugin(request.TenantId, request.PluginInstallationID))
+		ctx.JSON(http.StatusOK, service.InstallMCPServer(
+			request.TenantID, request.PluginUniqueIdentifier, request.Meta, request.UserID,
+		))
 	})
 }
 
@@ -0,0 +1,54 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/service"
+)
+
+func ListPluginLogs(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		TenantID               string                                 `uri:"tenant_id" validate:"required"`
+		PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `form:"plugin_unique_identifier" validate:"required,plugin_unique_identifier"`
+		Level                  plugin_entities.PluginLogLevel         `form:"level" validate:"omitempty,oneof=debug info warn error"`
+		SessionID              string                                 `form:"session_id" validate:"omitempty"`
+		Page                   int                                    `form:"page" validate:"required,min=1"`
+		PageSize               int                                    `form:"page_size" validate:"required,min=1,max=256"`
+	}) {
+		ctx.JSON(http.StatusOK, service.ListPluginLogs(
+			request.TenantID,
+			request.PluginUniqueIdentifier,
+			plugin_entities.PluginLogFilter{
+				Level:     request.Level,
+				SessionID: request.SessionID,
+			},
+			request.Page,
+			request.PageSize,
+		))
+	})
+}
+
+func TailPluginLogs(config *core.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		BindRequest(ctx, func(request struct {
+			TenantID               string                                 `uri:"tenant_id" validate:"required"`
+			PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `form:"plugin_unique_identifier" validate:"required,plugin_unique_identifier"`
+			Level                  plugin_entities.PluginLogLevel         `form:"level" validate:"omitempty,oneof=debug info warn error"`
+			SessionID              string                                 `form:"session_id" validate:"omitempty"`
+		}) {
+			service.TailPluginLogs(
+				ctx,
+				request.TenantID,
+				request.PluginUniqueIdentifier,
+				plugin_entities.PluginLogFilter{
+					Level:     request.Level,
+					SessionID: request.SessionID,
+				},
+				config.PluginMaxExecutionTimeout,
+			)
+		})
+	}
+}
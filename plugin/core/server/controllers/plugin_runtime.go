@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/service"
+)
+
+func ListPluginRuntimes(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, service.ListPluginRuntimes())
+}
+
+func PluginMetrics(ctx *gin.Context) {
+	ctx.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(service.PluginMetrics()))
+}
+
+func ResetPluginCrashLoop(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `json:"plugin_unique_identifier" validate:"required,plugin_unique_identifier"`
+	}) {
+		ctx.JSON(http.StatusOK, service.ResetPluginCrashLoop(request.PluginUniqueIdentifier))
+	})
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/service"
+)
+
+func StartPluginRollout(config *core.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		BindRequest(ctx, func(request struct {
+			TenantID                     string                                 `uri:"tenant_id" validate:"required"`
+			CanaryPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `json:"canary_plugin_unique_identifier" validate:"required,plugin_unique_identifier"`
+			CanaryWeight                 int                                    `json:"canary_weight" validate:"min=0,max=100"`
+			MinRequests                  int                                    `json:"min_requests" validate:"min=0"`
+			MaxErrorRateDelta            float64                                `json:"max_error_rate_delta" validate:"min=0,max=1"`
+			AutoPromoteRequests          int                                    `json:"auto_promote_requests" validate:"min=0"`
+			UserID                       string                                 `json:"user_id" validate:"omitempty"`
+		}) {
+			ctx.JSON(http.StatusOK, service.StartPluginRollout(
+				config,
+				request.TenantID,
+				request.CanaryPluginUniqueIdentifier,
+				service.PluginRolloutOptions{
+					CanaryWeight:        request.CanaryWeight,
+					MinRequests:         request.MinRequests,
+					MaxErrorRateDelta:   request.MaxErrorRateDelta,
+					AutoPromoteRequests: request.AutoPromoteRequests,
+				},
+				request.UserID,
+			))
+		})
+	}
+}
+
+func UpdatePluginRolloutWeight(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		TenantID     string `uri:"tenant_id" validate:"required"`
+		RolloutID    string `json:"rollout_id" validate:"required"`
+		CanaryWeight int    `json:"canary_weight" validate:"min=0,max=100"`
+	}) {
+		ctx.JSON(http.StatusOK, service.UpdatePluginRolloutWeight(
+			request.TenantID, request.RolloutID, request.CanaryWeight,
+		))
+	})
+}
+
+func PromotePluginRollout(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		TenantID  string `uri:"tenant_id" validate:"required"`
+		RolloutID string `json:"rollout_id" validate:"required"`
+		UserID    string `json:"user_id" validate:"omitempty"`
+	}) {
+		ctx.JSON(http.StatusOK, service.PromotePluginRollout(
+			request.TenantID, request.RolloutID, request.UserID,
+		))
+	})
+}
+
+func RollbackPluginRollout(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		TenantID  string `uri:"tenant_id" validate:"required"`
+		RolloutID string `json:"rollout_id" validate:"required"`
+	}) {
+		ctx.JSON(http.StatusOK, service.RollbackPluginRollout(
+			request.TenantID, request.RolloutID,
+		))
+	})
+}
+
+func ListPluginRollouts(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		TenantID string `uri:"tenant_id" validate:"required"`
+		Page     int    `form:"page" validate:"required,min=1"`
+		PageSize int    `form:"page_size" validate:"required,min=1,max=256"`
+	}) {
+		ctx.JSON(http.StatusOK, service.ListPluginRollouts(
+			request.TenantID, request.Page, request.PageSize,
+		))
+	})
+}
+
+// StartGlobalPluginRollout routes the requests of every tenant on the version installed
+// by TenantID to the canary version, the installation task is created under TenantID
+func StartGlobalPluginRollout(config *core.Config) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		BindRequest(ctx, func(request struct {
+			TenantID                     string                                 `json:"tenant_id" validate:"required"`
+			CanaryPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `json:"canary_plugin_unique_identifier" validate:"required,plugin_unique_identifier"`
+			CanaryWeight                 int                                    `json:"canary_weight" validate:"min=0,max=100"`
+			MinRequests                  int                                    `json:"min_requests" validate:"min=0"`
+			MaxErrorRateDelta            float64                                `json:"max_error_rate_delta" validate:"min=0,max=1"`
+			AutoPromoteRequests          int                                    `json:"auto_promote_requests" validate:"min=0"`
+			UserID                       string                                 `json:"user_id" validate:"omitempty"`
+		}) {
+			ctx.JSON(http.StatusOK, service.StartPluginRollout(
+				config,
+				request.TenantID,
+				request.CanaryPluginUniqueIdentifier,
+				service.PluginRolloutOptions{
+					CanaryWeight:        request.CanaryWeight,
+					Global:              true,
+					MinRequests:         request.MinRequests,
+					MaxErrorRateDelta:   request.MaxErrorRateDelta,
+					AutoPromoteRequests: request.AutoPromoteRequests,
+				},
+				request.UserID,
+			))
+		})
+	}
+}
+
+func UpdateGlobalPluginRolloutWeight(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		RolloutID    string `json:"rollout_id" validate:"required"`
+		CanaryWeight int    `json:"canary_weight" validate:"min=0,max=100"`
+	}) {
+		ctx.JSON(http.StatusOK, service.UpdatePluginRolloutWeight(
+			service.GlobalPluginRolloutTenantID, request.RolloutID, request.CanaryWeight,
+		))
+	})
+}
+
+func PromoteGlobalPluginRollout(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		RolloutID string `json:"rollout_id" validate:"required"`
+		UserID    string `json:"user_id" validate:"omitempty"`
+	}) {
+		ctx.JSON(http.StatusOK, service.PromotePluginRollout(
+			service.GlobalPluginRolloutTenantID, request.RolloutID, request.UserID,
+		))
+	})
+}
+
+func RollbackGlobalPluginRollout(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		RolloutID string `json:"rollout_id" validate:"required"`
+	}) {
+		ctx.JSON(http.StatusOK, service.RollbackPluginRollout(
+			service.GlobalPluginRolloutTenantID, request.RolloutID,
+		))
+	})
+}
+
+func ListGlobalPluginRollouts(ctx *gin.Context) {
+	BindRequest(ctx, func(request struct {
+		Page     int `form:"page" validate:"required,min=1"`
+		PageSize int `form:"page_size" validate:"required,min=1,max=256"`
+	}) {
+		ctx.JSON(http.StatusOK, service.ListPluginRollouts(
+			service.GlobalPluginRolloutTenantID, request.Page, request.PageSize,
+		))
+	})
+}
@@ -3,7 +3,6 @@ package server
 import (
 	"errors"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jjgagacy/workflow-app/plugin/core"
@@ -16,7 +15,7 @@ import (
 	"github.com/jjgagacy/workflow-app/plugin/types"
 )
 
-type EndPointHandler = func(ctx *gin.Context, hookId string, maxExecutionTime time.Duration, path string)
+type EndPointHandler = func(ctx *gin.Context, hookId string, config *core.Config, path string)
 
 func (app *App) EndPoint(config *core.Config) func(ctx *gin.Context) {
 	return func(ctx *gin.Context) {
@@ -34,9 +33,9 @@ func (app *App) EndPoint(config *core.Config) func(ctx *gin.Context) {
 		}
 
 		if app.endPointHandler != nil {
-			app.endPointHandler(ctx, hookId, time.Duration(config.PluginMaxExecutionTimeout)*time.Second, path)
+			app.endPointHandler(ctx, hookId, config, path)
 		} else {
-			app.EndPointHandler(ctx, hookId, time.Duration(config.PluginMaxExecutionTimeout)*time.Second, path)
+			app.EndPointHandler(ctx, hookId, config, path)
 		}
 	}
 }
@@ -48,7 +47,7 @@ func validatePath(path string) bool {
 	return true
 }
 
-func (app *App) EndPointHandler(ctx *gin.Context, hookId string, maxExecutionTime time.Duration, path string) {
+func (app *App) EndPointHandler(ctx *gin.Context, hookId string, config *core.Config, path string) {
 	endPoint, err := db.GetOne[model.EndPoint](
 		db.Equal("hook_id", hookId),
 	)
@@ -75,5 +74,5 @@ func (app *App) EndPointHandler(ctx *gin.Context, hookId string, maxExecutionTim
 		return
 	}
 	// service
-	service.EndPoint(ctx, &endPoint, &pluginInstallation, maxExecutionTime, path)
+	service.EndPoint(ctx, &endPoint, &pluginInstallation, config, path)
 }
@@ -27,9 +27,11 @@ func (app *App) BuildEngine(config *core.Config) *gin.Engine {
 
 	endPointGroup := engine.Group("/endpoint")
 	pluginGroup := engine.Group("/plugin/:tenant_id")
+	openAIGroup := engine.Group("/plugin/:tenant_id/v1")
 
 	app.endPointGroup(endPointGroup, config)
 	app.pluginGroup(pluginGroup, config)
+	app.openAIGroup(openAIGroup, config)
 
 	if config.AdminApiEnabled {
 		if len(config.AdminApiKey) < 10 {
@@ -45,7 +47,7 @@ func (app *App) BuildEngine(config *core.Config) *gin.Engine {
 	return engine
 }
 
-func (app *App) startHttpServer(config *core.Config) func() {
+func (app *App) startHttpServer(config *core.Config) func(ctx context.Context) {
 	if app.Engine == nil {
 		panic("engine is nil, call BuildEngine first")
 	}
@@ -63,9 +65,9 @@ func (app *App) startHttpServer(config *core.Config) func() {
 		}
 	}()
 
-	return func() {
-		if err := srv.Shutdown(context.Background()); err != nil {
-			log.Panicf("Server shutdown: %s\n", err)
+	return func(ctx context.Context) {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("Server shutdown: %s\n", err)
 		}
 	}
 }
@@ -77,10 +79,12 @@ func (app *App) pluginGroup(group *gin.RouterGroup, config *core.Config) {
 	app.pluginManagementGroup(group.Group("/management"), config)
 	app.endPointManagementGroup(group.Group("/endpoint"))
 	app.pluginAssetGroup(group.Group("/asset"))
+	app.pluginMCPGroup(group.Group("/mcp"), config)
 }
 
 func (app *App) endPointGroup(group *gin.RouterGroup, config *core.Config) {
 	if config.PluginEndPointEnabled != nil && *config.PluginEndPointEnabled {
+		group.Use(controllers.RejectWhenDraining())
 		group.HEAD("/:hook_id/*path", app.EndPoint(config))
 		group.POST("/:hook_id/*path", app.EndPoint(config))
 		group.GET("/:hook_id/*path", app.EndPoint(config))
@@ -91,10 +95,18 @@ func (app *App) endPointGroup(group *gin.RouterGroup, config *core.Config) {
 }
 
 func (app *App) adminGroup(group *gin.RouterGroup, config *core.Config) {
-	// todo admin api endpoints
+	group.GET("/plugin/runtimes", controllers.ListPluginRuntimes)
+	group.GET("/metrics", controllers.PluginMetrics)
+	group.POST("/plugin/runtime/reset", controllers.ResetPluginCrashLoop)
+	group.POST("/plugin/rollout/start", controllers.StartGlobalPluginRollout(config))
+	group.POST("/plugin/rollout/weight", controllers.UpdateGlobalPluginRolloutWeight)
+	group.POST("/plugin/rollout/promote", controllers.PromoteGlobalPluginRollout)
+	group.POST("/plugin/rollout/rollback", controllers.RollbackGlobalPluginRollout)
+	group.GET("/plugin/rollout/list", controllers.ListGlobalPluginRollouts)
 }
 
 func (app *App) pluginDispatchGroup(group *gin.RouterGroup, config *core.Config) {
+	group.Use(controllers.RejectWhenDraining())
 	group.Use(controllers.CollectActiveDispatchRequests())
 	group.Use(app.FetchPluginInstallation())
 	// group.Use(app.RedirectPluginInvoke())
@@ -106,11 +118,21 @@ func (app *App) pluginManagementGroup(group *gin.RouterGroup, config *core.Confi
 	group.POST("/install/upload/package", controllers.UploadPlugin(config))
 	group.POST("/install/upload/bundle", controllers.UploadBundle(config))
 	group.POST("/install/identifiers", controllers.InstallPluginFromIdentifiers(config))
+	group.POST("/install/git", controllers.InstallPluginFromGit(config))
+	group.POST("/install/mcp", controllers.InstallMCPServer)
 	group.POST("/install/upgrade", controllers.UpgradePlugin(config))
+	group.POST("/install/rollback", controllers.RollbackPlugin(config))
+	group.GET("/install/histories", controllers.FetchPluginInstallationHistories)
+	group.POST("/rollout/start", controllers.StartPluginRollout(config))
+	group.POST("/rollout/weight", controllers.UpdatePluginRolloutWeight)
+	group.POST("/rollout/promote", controllers.PromotePluginRollout)
+	group.POST("/rollout/rollback", controllers.RollbackPluginRollout)
+	group.GET("/rollout/list", controllers.ListPluginRollouts)
 	group.GET("/decode/from_identifier", controllers.DecodePluginFromIdentifier(config))
 	group.GET("/fetch/manifest", controllers.FetchPluginManifest)
 	group.GET("/fetch/identifiers", controllers.FetchPluginFromIdentifier)
 	group.POST("/uninstall", controllers.UninstallPlugin)
+	group.GET("/mcp/servers", controllers.ListMCPServers)
 	group.GET("/list", controllers.ListPlugins)
 	group.POST("/installation/fetch/batch", controllers.BatchFetchPluginInstallationByIDs)
 	group.POST("/installation/missing", controllers.FetchMissingPluginInstallations)
@@ -121,10 +143,39 @@ func (app *App) pluginManagementGroup(group *gin.RouterGroup, config *core.Confi
 	group.GET("/agent_strategies", controllers.ListAgentStrategies)
 	group.GET("/agent_strategy", controllers.GetAgentStrategy)
 	group.GET("/install/tasks/:id", controllers.FetchPluginInstallationTask)
+	group.GET("/install/tasks/:id/stream", controllers.StreamPluginInstallationTask(config))
 	group.POST("/install/tasks/delete_all", controllers.DeleteAllPluginInstallationTasks)
 	group.POST("/install/task/:id/delete", controllers.DeletePluginInstallationTask)
-	group.POST("/install/tasks/:id/*identifier", controllers.DeletePluginInstallationItemFromTask)
+	group.POST("/install/tasks/:id/*identifier", controllers.PluginInstallationTaskAction(config))
 	group.GET("/install/tasks", controllers.FetchPluginInstallationTasks)
+	group.GET("/logs", controllers.ListPluginLogs)
+	group.GET("/logs/tail", controllers.TailPluginLogs(config))
+}
+
+func (app *App) pluginMCPGroup(group *gin.RouterGroup, config *core.Config) {
+	group.Use(controllers.RejectWhenDraining())
+	group.Use(controllers.CollectActiveDispatchRequests())
+
+	// GET and DELETE are answered with 405 as the server neither pushes messages nor keeps sessions
+	handler := controllers.MCP(config)
+	group.POST("", handler)
+	group.GET("", handler)
+	group.DELETE("", handler)
+}
+
+// openAIGroup serves the openai api, clients send the server key as a bearer token
+func (app *App) openAIGroup(group *gin.RouterGroup, config *core.Config) {
+	group.Use(CheckBearerKey(config.ServerKey))
+	group.Use(controllers.RejectWhenDraining())
+	group.Use(controllers.CollectActiveDispatchRequests())
+
+	group.GET("/models", controllers.OpenAIModels(config))
+	group.POST("/chat/completions", controllers.OpenAIChatCompletions(config))
+	group.POST("/embeddings", controllers.OpenAIEmbeddings(config))
+	group.POST("/rerank", controllers.OpenAIRerank(config))
+	group.POST("/audio/speech", controllers.OpenAISpeech(config))
+	group.POST("/audio/transcriptions", controllers.OpenAITranscriptions(config))
+	group.POST("/moderations", controllers.OpenAIModerations(config))
 }
 
 func (app *App) endPointManagementGroup(group *gin.RouterGroup) {
@@ -2,13 +2,16 @@ package server
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jjgagacy/workflow-app/plugin/core/db"
 	"github.com/jjgagacy/workflow-app/plugin/core/server/server_const"
 	"github.com/jjgagacy/workflow-app/plugin/model"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/openai_entities"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/service"
 	"github.com/jjgagacy/workflow-app/plugin/types"
 )
 
@@ -24,6 +27,21 @@ func CheckKey(key string) gin.HandlerFunc {
 	}
 }
 
+// CheckBearerKey accepts the key as a bearer token as well, openai clients send it so
+func CheckBearerKey(key string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		token, _ := strings.CutPrefix(ctx.GetHeader("Authorization"), "Bearer ")
+		if token != key && ctx.GetHeader(server_const.X_API_KEY) != key {
+			ctx.AbortWithStatusJSON(401, openai_entities.ErrorResponse{Error: openai_entities.Error{
+				Message: "unauthorized",
+				Type:    openai_entities.ERROR_TYPE_AUTHENTICATION,
+			}})
+			return
+		}
+		ctx.Next()
+	}
+}
+
 func (app *App) AdminAPIKey(key string) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		if ctx.GetHeader(server_const.X_ADMIN_API_KEY) != key {
@@ -68,6 +86,16 @@ func (app *App) FetchPluginInstallation() gin.HandlerFunc {
 			return
 		}
 
+		// the version serving the request is picked per request during a rollout
+		rollout, err := service.FetchActivePluginRollout(&installation)
+		if err != nil {
+			ctx.AbortWithStatusJSON(500, entities.InternalError(err).ToResponse())
+			return
+		}
+		if rollout != nil {
+			ctx.Set(server_const.PLUGIN_ROLLOUT, rollout)
+		}
+
 		ctx.Set(server_const.PLUGIN_INSTALLATION, installation)
 		ctx.Set(server_const.PLUGIN_UNIQUE_IDENTIFIER, identity)
 		ctx.Next()
@@ -1,15 +1,22 @@
 package server
 
 import (
+	"context"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
+	"github.com/jjgagacy/workflow-app/plugin/cache"
 	"github.com/jjgagacy/workflow-app/plugin/core"
 	"github.com/jjgagacy/workflow-app/plugin/core/db"
 	"github.com/jjgagacy/workflow-app/plugin/core/persistence"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager"
+	"github.com/jjgagacy/workflow-app/plugin/core/server/controllers"
+	"github.com/jjgagacy/workflow-app/plugin/core/session_manager"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
 )
 
 func (app *App) Init(config *core.Config) (shutdowns []func(), err error) {
@@ -26,6 +33,9 @@ func (app *App) Init(config *core.Config) (shutdowns []func(), err error) {
 	// init oss
 	oss := initOSS(config)
 
+	// validation of plugin responses
+	plugin_daemon.SetResponseValidationMode(plugin_daemon.ResponseValidationMode(config.PluginResponseValidationMode))
+
 	// create manager
 	manager := plugin_manager.InitGlobalManager(oss, config)
 	// init manager
@@ -54,10 +64,45 @@ func (app *App) Run(config *core.Config) {
 
 	log.Println("Shutting down server...")
 
-	shutdown()
+	app.gracefulShutdown(config, shutdown)
 	for _, s := range shutdowns {
 		s()
 	}
 
 	log.Println("Server gracefully stopped")
 }
+
+// gracefulShutdown drains the node before releasing resources:
+// refuse new dispatches, wait for active sessions, stop the http server,
+// stop all plugins, then release the pool, redis and db
+func (app *App) gracefulShutdown(config *core.Config, shutdownHttpServer func(ctx context.Context)) {
+	controllers.StartDraining()
+
+	deadline := time.Now().Add(time.Duration(config.ShutdownDrainTimeout) * time.Second)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	log.Printf("Draining %d active sessions...", session_manager.ActiveSessions())
+	if err := session_manager.WaitSessionsDrained(ctx); err != nil {
+		log.Printf("Drain sessions: %s", err)
+	}
+
+	// give the http server at least a few seconds to flush remaining responses
+	httpCtx, httpCancel := context.WithTimeout(context.Background(), max(time.Until(deadline), 5*time.Second))
+	defer httpCancel()
+	shutdownHttpServer(httpCtx)
+
+	if manager := plugin_manager.Manager(); manager != nil {
+		stopCtx, stopCancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer stopCancel()
+		manager.Shutdown(stopCtx)
+	}
+
+	if err := utils.ReleasePoolTimeout(5 * time.Second); err != nil {
+		log.Printf("Release pool: %s", err)
+	}
+	if err := cache.Close(); err != nil {
+		log.Printf("Close redis: %s", err)
+	}
+	db.Close()
+}
@@ -4,7 +4,9 @@ const (
 	X_PLUGIN_ID     = "X-Plugin-ID"
 	X_API_KEY       = "X-Api-Key"
 	X_ADMIN_API_KEY = "X-Admin-Api-Key"
+	IDEMPOTENCY_KEY = "Idempotency-Key"
 
 	PLUGIN_INSTALLATION      = "plugin_installation"
 	PLUGIN_UNIQUE_IDENTIFIER = "plugin_unique_identifier"
+	PLUGIN_ROLLOUT           = "plugin_rollout"
 )
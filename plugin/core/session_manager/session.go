@@ -1,9 +1,11 @@
 package session_manager
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jjgagacy/workflow-app/plugin/core/invocation"
@@ -34,6 +36,11 @@ type Session struct {
 	AppID          *string        `json:"app_id"`
 	EndPointID     *string        `json:"endpoint_id"`
 	Context        map[string]any `json:"context"`
+
+	// cancelled once the session is cancelled or closed
+	ctx        context.Context
+	cancel     context.CancelFunc
+	cancelOnce sync.Once
 }
 
 func sessionKey(id string) string {
@@ -72,6 +79,7 @@ func NewSession(payload SessionPayload) *Session {
 		EndPointID:             payload.EndPointID,
 		Context:                payload.Context,
 	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 
 	mu.Lock()
 	sessions[s.ID] = s
@@ -83,6 +91,28 @@ func NewSession(payload SessionPayload) *Session {
 	return s
 }
 
+// ActiveSessions returns the number of sessions which are not closed yet
+func ActiveSessions() int {
+	mu.RLock()
+	defer mu.RUnlock()
+	return len(sessions)
+}
+
+// WaitSessionsDrained blocks until all sessions are closed or ctx is done
+func WaitSessionsDrained(ctx context.Context) error {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for ActiveSessions() > 0 {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%d sessions still active: %w", ActiveSessions(), ctx.Err())
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
 type GetSessionPayload struct {
 	ID          string `json:"id"`
 	IgnoreCache bool   `json:"ignore_cache"`
@@ -119,6 +149,7 @@ type CloseSessionPayload struct {
 }
 
 func (s *Session) Close(payload CloseSessionPayload) {
+	s.cancel()
 	DeleteSession(DeleteSessionPayload{
 		ID:          s.ID,
 		IgnoreCache: payload.IgnoreCache,
@@ -141,11 +172,44 @@ func (s *Session) BackwardsInvocation() invocation.BackwardsInvocation {
 	return s.backwardsInvocation
 }
 
+// Done returns a channel which is closed once the session is cancelled or closed,
+// backwards invocations of the session stop on it
+func (s *Session) Done() <-chan struct{} {
+	return s.ctx.Done()
+}
+
+// AfterDone runs f once the session is cancelled or closed, the returned function
+// stops it from being run
+func (s *Session) AfterDone(f func()) func() bool {
+	return context.AfterFunc(s.ctx, f)
+}
+
+// Cancel tells the plugin to stop the work of the session, e.g. the client is
+// disconnected or the execution timed out. Plugins which don't support the cancel
+// event are not notified, only the backwards invocations are cancelled
+func (s *Session) Cancel() {
+	s.cancelOnce.Do(func() {
+		s.cancel()
+
+		if s.runtime == nil {
+			return
+		}
+		if !plugin_entities.HasCapability(s.runtime, plugin_entities.PLUGIN_CAPABILITY_CANCEL) {
+			return
+		}
+		s.runtime.Write(s.ID, s.AccessAction, s.Message(EVENT_STREAM_CANCEL, nil))
+	})
+}
+
 type EventStream string
 
 const (
 	EVENT_STREAM_REQUEST EventStream = "request"
 	EVENT_STREAM_RESONSE EventStream = "response"
+	// streamed request body of an endpoint invocation
+	EVENT_STREAM_REQUEST_BODY EventStream = "request_body"
+	// the session is cancelled, sent to plugins with the cancel capability
+	EVENT_STREAM_CANCEL EventStream = "cancel"
 )
 
 func (s *Session) Message(event EventStream, data any) []byte {
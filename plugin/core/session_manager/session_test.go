@@ -0,0 +1,111 @@
+package session_manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/access_types"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLifetime 记录写入插件的消息
+type fakeLifetime struct {
+	plugin_entities.PluginLifetime
+
+	declaration *plugin_entities.PluginDeclaration
+	written     [][]byte
+}
+
+func (f *fakeLifetime) Configuration() *plugin_entities.PluginDeclaration {
+	return f.declaration
+}
+
+func (f *fakeLifetime) Write(sessionId string, action access_types.PluginAccessAction, data []byte) {
+	f.written = append(f.written, data)
+}
+
+func TestWaitSessionsDrained(t *testing.T) {
+	session := NewSession(SessionPayload{TenantID: "tenant", IgnoreCache: true})
+	assert.Equal(t, 1, ActiveSessions())
+
+	// 超时前会话未关闭
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.Error(t, WaitSessionsDrained(ctx))
+
+	go func() {
+		time.Sleep(150 * time.Millisecond)
+		session.Close(CloseSessionPayload{IgnoreCache: true})
+	}()
+
+	ctx2, cancel2 := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel2()
+	assert.NoError(t, WaitSessionsDrained(ctx2))
+	assert.Equal(t, 0, ActiveSessions())
+}
+
+func TestSessionCancel(t *testing.T) {
+	tests := []struct {
+		name         string
+		capabilities []plugin_entities.PluginCapability
+		notified     bool
+	}{
+		{"支持取消的插件收到取消事件", []plugin_entities.PluginCapability{plugin_entities.PLUGIN_CAPABILITY_CANCEL}, true},
+		{"旧插件不发送取消事件", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runtime := &fakeLifetime{declaration: &plugin_entities.PluginDeclaration{}}
+			runtime.declaration.Meta.Capabilities = tt.capabilities
+
+			session := NewSession(SessionPayload{TenantID: "tenant", IgnoreCache: true})
+			defer session.Close(CloseSessionPayload{IgnoreCache: true})
+			session.BindRuntime(runtime)
+
+			cancelled := make(chan bool, 1)
+			session.AfterDone(func() { cancelled <- true })
+
+			// 重复取消只通知一次
+			session.Cancel()
+			session.Cancel()
+
+			select {
+			case <-cancelled:
+			case <-time.After(time.Second):
+				t.Fatal("session is not cancelled")
+			}
+
+			if !tt.notified {
+				assert.Empty(t, runtime.written)
+				return
+			}
+			require.Len(t, runtime.written, 1)
+			message, err := utils.UnmarshalJsonBytes[map[string]any](runtime.written[0])
+			require.NoError(t, err)
+			assert.Equal(t, session.ID, message["session_id"])
+			assert.Equal(t, string(EVENT_STREAM_CANCEL), message["event"])
+		})
+	}
+}
+
+func TestSessionCloseWithoutCancel(t *testing.T) {
+	runtime := &fakeLifetime{declaration: &plugin_entities.PluginDeclaration{}}
+	runtime.declaration.Meta.Capabilities = []plugin_entities.PluginCapability{plugin_entities.PLUGIN_CAPABILITY_CANCEL}
+
+	session := NewSession(SessionPayload{TenantID: "tenant", IgnoreCache: true})
+	session.BindRuntime(runtime)
+
+	// 正常关闭时结束进行中的反向调用，但不通知插件
+	session.Close(CloseSessionPayload{IgnoreCache: true})
+	select {
+	case <-session.Done():
+	default:
+		t.Fatal("session is not done after closed")
+	}
+	assert.Empty(t, runtime.written)
+}
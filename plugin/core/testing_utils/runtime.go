@@ -28,6 +28,16 @@ func ClearTestingPath(cwd string) {
 // GetRuntime returns a runtime for a plugin
 // Notes: dir MUST be an empty directory
 func GetRuntime(pluginZip []byte, dir string) (*local_runtime.LocalPluginRuntime, error) {
+	return GetRuntimeWithPrepare(pluginZip, dir, nil)
+}
+
+// GetRuntimeWithPrepare is the same as GetRuntime, prepare is called with the working path
+// after the plugin is extracted and before the environment is initialized
+func GetRuntimeWithPrepare(
+	pluginZip []byte,
+	dir string,
+	prepare func(workingPath string) error,
+) (*local_runtime.LocalPluginRuntime, error) {
 	decoder, err := decoder.NewZipPluginDecoder(pluginZip)
 	if err != nil {
 		return nil, errors.Join(err, fmt.Errorf("create plugin zip decoder error"))
@@ -55,6 +65,12 @@ func GetRuntime(pluginZip []byte, dir string) (*local_runtime.LocalPluginRuntime
 		}
 	}
 
+	if prepare != nil {
+		if err := prepare(pluginWorkingPath); err != nil {
+			return nil, errors.Join(err, fmt.Errorf("prepare working directory error"))
+		}
+	}
+
 	uvPath := os.Getenv("UV_PATH")
 	switch manifest.Meta.Runner.Language {
 	case constants.Python:
@@ -81,6 +97,7 @@ func GetRuntime(pluginZip []byte, dir string) (*local_runtime.LocalPluginRuntime
 			Verified:    manifest.Verified,
 			WorkingPath: pluginWorkingPath,
 		},
+		LogBuffer: plugin_entities.NewPluginLogBuffer(0),
 	}
 
 	localPluginRuntime.BasicChecksum = basic_runtime.BasicChecksum{
@@ -111,7 +128,7 @@ func GetRuntime(pluginZip []byte, dir string) (*local_runtime.LocalPluginRuntime
 			<-launchedChan
 		})
 
-		plugin_manager.FullDuplex(localPluginRuntime, launchedChan, errChan)
+		plugin_manager.FullDuplex(localPluginRuntime, launchedChan, errChan, nil)
 	})
 
 	// wait for plugin launched
@@ -5,11 +5,15 @@ import (
 	"log"
 
 	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/sandbox"
 	"github.com/jjgagacy/workflow-app/plugin/core/server"
 	"github.com/jjgagacy/workflow-app/plugin/utils"
 )
 
 func main() {
+	// plugin sandboxes re-execute the daemon binary as their init process
+	sandbox.Init()
+
 	fmt.Println("server starting")
 	// hidden log online
 	utils.SetLogVisibility(true)
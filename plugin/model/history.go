@@ -0,0 +1,27 @@
+package model
+
+type PluginInstallationHistoryAction string
+
+const (
+	PluginInstallationHistoryActionInstall   PluginInstallationHistoryAction = "install"
+	PluginInstallationHistoryActionUpgrade   PluginInstallationHistoryAction = "upgrade"
+	PluginInstallationHistoryActionUninstall PluginInstallationHistoryAction = "uninstall"
+	PluginInstallationHistoryActionRollback  PluginInstallationHistoryAction = "rollback"
+)
+
+// PluginInstallationHistory records every change of a plugin installation of a tenant,
+// CreatedAt is the time the change happened
+type PluginInstallationHistory struct {
+	Model
+	TenantID string                          `gorm:"index;type:uuid;" json:"tenant_id"`
+	PluginID string                          `gorm:"index;size:255" json:"plugin_id"`
+	Action   PluginInstallationHistoryAction `gorm:"size:31" json:"action"`
+	// identifier installed before the change, empty for install
+	OriginalPluginUniqueIdentifier string `gorm:"size:255" json:"original_plugin_unique_identifier"`
+	// identifier installed after the change, empty for uninstall
+	PluginUniqueIdentifier string         `gorm:"size:255" json:"plugin_unique_identifier"`
+	RuntimeType            string         `gorm:"size:127" json:"runtime_type"`
+	Actor                  string         `gorm:"size:255" json:"actor"`
+	Source                 string         `gorm:"column:source;size:63" json:"source"`
+	Meta                   map[string]any `gorm:"column:meta;serializer:json" json:"meta"`
+}
@@ -0,0 +1,30 @@
+package model
+
+type PluginRolloutStatus string
+
+const (
+	PluginRolloutStatusRunning    PluginRolloutStatus = "running"
+	PluginRolloutStatusPromoted   PluginRolloutStatus = "promoted"
+	PluginRolloutStatusRolledBack PluginRolloutStatus = "rolled_back"
+)
+
+// PluginRollout routes a part of the requests of a plugin to a canary version,
+// an empty TenantID means the rollout applies to every tenant running the stable version
+type PluginRollout struct {
+	Model
+	TenantID                     string `gorm:"index;size:64" json:"tenant_id"`
+	PluginID                     string `gorm:"index;size:255" json:"plugin_id"`
+	StablePluginUniqueIdentifier string `gorm:"index;size:255" json:"stable_plugin_unique_identifier"`
+	CanaryPluginUniqueIdentifier string `gorm:"size:255" json:"canary_plugin_unique_identifier"`
+	RuntimeType                  string `gorm:"size:127" json:"runtime_type"`
+	// percentage of requests routed to the canary version, 0-100
+	CanaryWeight int                 `json:"canary_weight"`
+	Status       PluginRolloutStatus `gorm:"size:31;index" json:"status"`
+	// requests the canary version needs to serve before it's evaluated
+	MinRequests int `json:"min_requests"`
+	// the canary version is rolled back once its error rate exceeds the stable one by this value
+	MaxErrorRateDelta float64 `json:"max_error_rate_delta"`
+	// the canary version is promoted after serving this many requests, 0 means manual promotion
+	AutoPromoteRequests int    `json:"auto_promote_requests"`
+	Actor               string `gorm:"size:255" json:"actor"`
+}
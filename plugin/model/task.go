@@ -9,6 +9,8 @@ const (
 	TaskInstallStatusRunning TaskInstallStatus = "running"
 	TaskInstallStatusSuccess TaskInstallStatus = "success"
 	TaskInstallStatusFailed  TaskInstallStatus = "failed"
+	// cancelled by the user, only set on running tasks and their unfinished plugins
+	TaskInstallStatusCancelled TaskInstallStatus = "cancelled"
 )
 
 type TaskPluginInstallStatus struct {
@@ -19,6 +21,29 @@ type TaskPluginInstallStatus struct {
 	PluginID               string                                 `json:"plugin_id"`
 	Status                 TaskInstallStatus                      `json:"status"`
 	Message                string                                 `json:"message"`
+	Meta                   map[string]any                         `json:"meta,omitempty"`
+}
+
+type TaskInstallAction string
+
+const (
+	TaskInstallActionInstall  TaskInstallAction = "install"
+	TaskInstallActionUpgrade  TaskInstallAction = "upgrade"
+	TaskInstallActionRollback TaskInstallAction = "rollback"
+	TaskInstallActionRollout  TaskInstallAction = "rollout"
+)
+
+// TaskInstallOperation tells what is done with the plugins once they're installed,
+// it's kept with the task so that any replica is able to retry it
+type TaskInstallOperation struct {
+	Action      TaskInstallAction `json:"action"`
+	Source      string            `json:"source"`
+	Actor       string            `json:"actor"`
+	RuntimeType string            `json:"runtime_type"`
+	// the identifier replaced by upgrades and rollbacks, or the stable one of rollouts
+	OriginalPluginUniqueIdentifier string `json:"original_plugin_unique_identifier,omitempty"`
+	// the rollout created once the canary version is installed, without the canary identifier
+	Rollout *PluginRollout `json:"rollout,omitempty"`
 }
 
 type TaskInstallation struct {
@@ -28,4 +53,5 @@ type TaskInstallation struct {
 	TotalPlugins     int                       `gorm:"not null" json:"total_plugins"`
 	CompletedPlugins int                       `gorm:"not null" json:"completed_plugins"`
 	Plugins          []TaskPluginInstallStatus `gorm:"serializer:json" json:"plugins"`
+	Operation        TaskInstallOperation      `gorm:"serializer:json" json:"operation"`
 }
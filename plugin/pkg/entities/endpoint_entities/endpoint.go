@@ -4,6 +4,15 @@ const (
 	HeaderXOriginalHost = "X-Original-Host"
 )
 
+// EndpointRequestBodyChunk is a piece of a streamed request body,
+// chunks are sent in Seq order and the last one has End set
+type EndpointRequestBodyChunk struct {
+	Seq   int     `json:"seq"`
+	Chunk string  `json:"chunk"` // hex encoded
+	End   bool    `json:"end"`
+	Error *string `json:"error,omitempty"`
+}
+
 type EndpointResponseChunk struct {
 	Status  *uint16           `json:"status" validate:"omitempty"`
 	Headers map[string]string `json:"headers" validate:"omitempty"`
@@ -16,6 +16,8 @@ const (
 	ErrPluginNotFound          = "ErrPluginNotFound"
 	ErrInvokePlugin            = "ErrInvokePlugin"
 	ErrPermissionDenied        = "ErrPermissionDenied"
+	ErrInvalidParameters       = "ErrInvalidParameters"
+	ErrConflict                = "ErrConflict"
 )
 
 const (
@@ -27,6 +29,7 @@ const (
 	ErrIdentifierInvalidCode = -403
 	ErrNotFoundCode          = -404
 	ErrPermissionDeniedCode  = -405
+	ErrConflictCode          = -409
 )
 
 type PluginError interface {
@@ -117,3 +120,23 @@ func PermissionDeniedError(err error) PluginError {
 	}
 	return NewErrorWithType(ErrPermissionDeniedCode, err.Error(), ErrPermissionDenied)
 }
+
+func ConflictError(err error) PluginError {
+	if err == nil {
+		return nil
+	}
+	if pe, ok := err.(PluginError); ok {
+		return pe
+	}
+	return NewErrorWithType(ErrConflictCode, err.Error(), ErrConflict)
+}
+
+// InvalidParametersError is a bad request which lists every invalid parameter in its args
+func InvalidParametersError(err error, parameters any) PluginError {
+	if err == nil {
+		return nil
+	}
+	return NewErrorWithTypeAndArgs(ErrBadRequestCode, err.Error(), ErrInvalidParameters, map[string]any{
+		"parameters": parameters,
+	})
+}
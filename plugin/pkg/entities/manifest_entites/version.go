@@ -1,7 +1,10 @@
 package manifest_entites
 
 import (
+	"fmt"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/validators"
@@ -13,6 +16,51 @@ func (v Version) String() string {
 	return string(v)
 }
 
+// Compare compares the major, minor and patch numbers of two versions, a pre-release
+// is lower than its release. It returns an error if either is not a valid version
+func (v Version) Compare(other Version) (int, error) {
+	left, leftPre, err := v.parse()
+	if err != nil {
+		return 0, err
+	}
+	right, rightPre, err := other.parse()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range left {
+		if left[i] != right[i] {
+			if left[i] < right[i] {
+				return -1, nil
+			}
+			return 1, nil
+		}
+	}
+
+	switch {
+	case leftPre == rightPre:
+		return 0, nil
+	case leftPre == "":
+		return 1, nil
+	case rightPre == "":
+		return -1, nil
+	}
+	return strings.Compare(leftPre, rightPre), nil
+}
+
+func (v Version) parse() ([3]int, string, error) {
+	var numbers [3]int
+	if !PluginDeclarationVersionRegex.MatchString(string(v)) {
+		return numbers, "", fmt.Errorf("invalid version: %s", v)
+	}
+
+	release, preRelease, _ := strings.Cut(string(v), "-")
+	for i, part := range strings.Split(release, ".") {
+		numbers[i], _ = strconv.Atoi(part)
+	}
+	return numbers, preRelease, nil
+}
+
 const (
 	VERSION_PATTERN   = `\d{1,4}(\.\d{1,4}){2}(-\w{1,16})?`
 	VERSION_X_PATTERN = `(\d{1,4}|[xX])`
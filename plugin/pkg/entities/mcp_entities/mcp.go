@@ -0,0 +1,165 @@
+package mcp_entities
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	JSONRPC_VERSION = "2.0"
+
+	// the latest protocol version the server speaks, older clients are answered
+	// with the version they asked for as long as it's supported
+	LATEST_PROTOCOL_VERSION = "2025-06-18"
+)
+
+var SupportedProtocolVersions = []string{
+	"2025-06-18",
+	"2025-03-26",
+	"2024-11-05",
+}
+
+const (
+	METHOD_INITIALIZE                = "initialize"
+	METHOD_NOTIFICATIONS_INITIALIZED = "notifications/initialized"
+	METHOD_PING                      = "ping"
+	METHOD_TOOLS_LIST                = "tools/list"
+	METHOD_TOOLS_CALL                = "tools/call"
+	METHOD_NOTIFICATIONS_CANCELLED   = "notifications/cancelled"
+)
+
+// json-rpc error codes
+const (
+	ERROR_CODE_PARSE_ERROR      = -32700
+	ERROR_CODE_INVALID_REQUEST  = -32600
+	ERROR_CODE_METHOD_NOT_FOUND = -32601
+	ERROR_CODE_INVALID_PARAMS   = -32602
+	ERROR_CODE_INTERNAL_ERROR   = -32603
+)
+
+// Request is a json-rpc request, it's a notification if the id is absent
+type Request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+func (r *Request) IsNotification() bool {
+	return len(r.ID) == 0
+}
+
+type Response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("mcp error %d: %s", e.Code, e.Message)
+}
+
+type Implementation struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type InitializeParams struct {
+	ProtocolVersion string         `json:"protocolVersion"`
+	Capabilities    map[string]any `json:"capabilities"`
+	ClientInfo      Implementation `json:"clientInfo"`
+}
+
+type ToolsCapability struct {
+	ListChanged bool `json:"listChanged"`
+}
+
+type ServerCapabilities struct {
+	Tools *ToolsCapability `json:"tools,omitempty"`
+}
+
+type CancelledParams struct {
+	RequestID json.RawMessage `json:"requestId"`
+	Reason    string          `json:"reason,omitempty"`
+}
+
+type InitializeResult struct {
+	ProtocolVersion string             `json:"protocolVersion"`
+	Capabilities    ServerCapabilities `json:"capabilities"`
+	ServerInfo      Implementation     `json:"serverInfo"`
+	Instructions    string             `json:"instructions,omitempty"`
+}
+
+type Tool struct {
+	Name         string         `json:"name"`
+	Title        string         `json:"title,omitempty"`
+	Description  string         `json:"description,omitempty"`
+	InputSchema  map[string]any `json:"inputSchema"`
+	OutputSchema map[string]any `json:"outputSchema,omitempty"`
+}
+
+type ListToolsParams struct {
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type ListToolsResult struct {
+	Tools      []Tool `json:"tools"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+type CallToolParams struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+	Meta      *CallToolMeta  `json:"_meta,omitempty"`
+}
+
+// CallToolMeta carries what the tool needs besides its arguments, credentials of
+// the provider are kept by the caller rather than the daemon
+type CallToolMeta struct {
+	Credentials    map[string]any `json:"credentials,omitempty"`
+	CredentialType string         `json:"credential_type,omitempty"`
+}
+
+type ContentType string
+
+const (
+	CONTENT_TYPE_TEXT     ContentType = "text"
+	CONTENT_TYPE_IMAGE    ContentType = "image"
+	CONTENT_TYPE_AUDIO    ContentType = "audio"
+	CONTENT_TYPE_RESOURCE ContentType = "resource"
+	// a link to a resource the client may fetch, sent by servers only
+	CONTENT_TYPE_RESOURCE_LINK ContentType = "resource_link"
+)
+
+// Content is a content block of a tool result, only the fields of its type are set
+type Content struct {
+	Type     ContentType       `json:"type"`
+	Text     string            `json:"text,omitempty"`
+	Data     string            `json:"data,omitempty"`
+	MimeType string            `json:"mimeType,omitempty"`
+	Resource *EmbeddedResource `json:"resource,omitempty"`
+	// set on resource links
+	URI  string `json:"uri,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+type EmbeddedResource struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	// either the text or the base64 encoded blob is set
+	Text string `json:"text,omitempty"`
+	Blob string `json:"blob,omitempty"`
+}
+
+type CallToolResult struct {
+	Content           []Content      `json:"content"`
+	StructuredContent map[string]any `json:"structuredContent,omitempty"`
+	IsError           bool           `json:"isError,omitempty"`
+}
@@ -0,0 +1,365 @@
+package openai_entities
+
+import (
+	"encoding/json"
+)
+
+const (
+	OBJECT_LIST                  = "list"
+	OBJECT_MODEL                 = "model"
+	OBJECT_CHAT_COMPLETION       = "chat.completion"
+	OBJECT_CHAT_COMPLETION_CHUNK = "chat.completion.chunk"
+	OBJECT_EMBEDDING             = "embedding"
+)
+
+const (
+	ROLE_SYSTEM    = "system"
+	ROLE_DEVELOPER = "developer"
+	ROLE_USER      = "user"
+	ROLE_ASSISTANT = "assistant"
+	ROLE_TOOL      = "tool"
+)
+
+const (
+	CONTENT_PART_TYPE_TEXT        = "text"
+	CONTENT_PART_TYPE_IMAGE_URL   = "image_url"
+	CONTENT_PART_TYPE_INPUT_AUDIO = "input_audio"
+	CONTENT_PART_TYPE_FILE        = "file"
+)
+
+const (
+	TOOL_TYPE_FUNCTION = "function"
+)
+
+const (
+	FINISH_REASON_STOP       = "stop"
+	FINISH_REASON_LENGTH     = "length"
+	FINISH_REASON_TOOL_CALLS = "tool_calls"
+)
+
+const (
+	ENCODING_FORMAT_FLOAT  = "float"
+	ENCODING_FORMAT_BASE64 = "base64"
+)
+
+const (
+	TRANSCRIPTION_FORMAT_JSON = "json"
+	TRANSCRIPTION_FORMAT_TEXT = "text"
+)
+
+const (
+	ERROR_TYPE_INVALID_REQUEST = "invalid_request_error"
+	ERROR_TYPE_AUTHENTICATION  = "authentication_error"
+	ERROR_TYPE_NOT_FOUND       = "not_found_error"
+	ERROR_TYPE_API             = "api_error"
+)
+
+const (
+	ERROR_CODE_MODEL_NOT_FOUND = "model_not_found"
+)
+
+type Error struct {
+	Message string  `json:"message"`
+	Type    string  `json:"type"`
+	Param   *string `json:"param"`
+	Code    *string `json:"code"`
+}
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+type ModelList struct {
+	Object string  `json:"object"`
+	Data   []Model `json:"data"`
+}
+
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type InputAudio struct {
+	Data   string `json:"data"`
+	Format string `json:"format"`
+}
+
+type File struct {
+	FileData string `json:"file_data,omitempty"`
+	FileID   string `json:"file_id,omitempty"`
+	Filename string `json:"filename,omitempty"`
+}
+
+type ContentPart struct {
+	Type       string      `json:"type"`
+	Text       string      `json:"text,omitempty"`
+	ImageURL   *ImageURL   `json:"image_url,omitempty"`
+	InputAudio *InputAudio `json:"input_audio,omitempty"`
+	File       *File       `json:"file,omitempty"`
+}
+
+// MessageContent is either a string or an array of content parts
+type MessageContent struct {
+	Text  string
+	Parts []ContentPart
+}
+
+func (c *MessageContent) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, &c.Parts)
+	}
+	return json.Unmarshal(data, &c.Text)
+}
+
+func (c MessageContent) MarshalJSON() ([]byte, error) {
+	if c.Parts != nil {
+		return json.Marshal(c.Parts)
+	}
+	return json.Marshal(c.Text)
+}
+
+type FunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
+}
+
+type ToolCall struct {
+	// Index is set in the deltas of a stream only
+	Index    *int         `json:"index,omitempty"`
+	ID       string       `json:"id,omitempty"`
+	Type     string       `json:"type,omitempty"`
+	Function FunctionCall `json:"function"`
+}
+
+type ChatMessage struct {
+	Role       string          `json:"role"`
+	Content    *MessageContent `json:"content"`
+	Name       string          `json:"name,omitempty"`
+	ToolCalls  []ToolCall      `json:"tool_calls,omitempty"`
+	ToolCallID string          `json:"tool_call_id,omitempty"`
+}
+
+type Function struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Parameters  map[string]any `json:"parameters,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
+}
+
+type Tool struct {
+	Type     string   `json:"type"`
+	Function Function `json:"function"`
+}
+
+type StreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type ResponseFormat struct {
+	Type       string         `json:"type"`
+	JSONSchema map[string]any `json:"json_schema,omitempty"`
+}
+
+// StringOrArray accepts both a string and an array of strings, e.g. the stop field
+type StringOrArray []string
+
+func (s *StringOrArray) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '[' {
+		return json.Unmarshal(data, (*[]string)(s))
+	}
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if value != "" {
+		*s = []string{value}
+	}
+	return nil
+}
+
+type ChatCompletionRequest struct {
+	Model               string          `json:"model"`
+	Messages            []ChatMessage   `json:"messages"`
+	Tools               []Tool          `json:"tools,omitempty"`
+	ToolChoice          any             `json:"tool_choice,omitempty"`
+	Stream              bool            `json:"stream"`
+	StreamOptions       *StreamOptions  `json:"stream_options,omitempty"`
+	Temperature         *float64        `json:"temperature,omitempty"`
+	TopP                *float64        `json:"top_p,omitempty"`
+	MaxTokens           *int            `json:"max_tokens,omitempty"`
+	MaxCompletionTokens *int            `json:"max_completion_tokens,omitempty"`
+	PresencePenalty     *float64        `json:"presence_penalty,omitempty"`
+	FrequencyPenalty    *float64        `json:"frequency_penalty,omitempty"`
+	Seed                *int            `json:"seed,omitempty"`
+	N                   *int            `json:"n,omitempty"`
+	Stop                StringOrArray   `json:"stop,omitempty"`
+	ResponseFormat      *ResponseFormat `json:"response_format,omitempty"`
+	User                string          `json:"user,omitempty"`
+
+	// Credentials of the model provider, it's not part of the openai api, clients
+	// pass it as an extra field of the body
+	Credentials    map[string]any `json:"credentials,omitempty"`
+	CredentialType string         `json:"credential_type,omitempty"`
+}
+
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+type ResponseMessage struct {
+	Role      string     `json:"role"`
+	Content   *string    `json:"content"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+type ChatCompletionChoice struct {
+	Index        int             `json:"index"`
+	Message      ResponseMessage `json:"message"`
+	FinishReason string          `json:"finish_reason"`
+}
+
+type ChatCompletion struct {
+	ID                string                 `json:"id"`
+	Object            string                 `json:"object"`
+	Created           int64                  `json:"created"`
+	Model             string                 `json:"model"`
+	SystemFingerprint string                 `json:"system_fingerprint,omitempty"`
+	Choices           []ChatCompletionChoice `json:"choices"`
+	Usage             *Usage                 `json:"usage,omitempty"`
+}
+
+type ChunkDelta struct {
+	Role      string     `json:"role,omitempty"`
+	Content   *string    `json:"content,omitempty"`
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+}
+
+type ChatCompletionChunkChoice struct {
+	Index        int        `json:"index"`
+	Delta        ChunkDelta `json:"delta"`
+	FinishReason *string    `json:"finish_reason"`
+}
+
+type ChatCompletionChunk struct {
+	ID                string                      `json:"id"`
+	Object            string                      `json:"object"`
+	Created           int64                       `json:"created"`
+	Model             string                      `json:"model"`
+	SystemFingerprint string                      `json:"system_fingerprint,omitempty"`
+	Choices           []ChatCompletionChunkChoice `json:"choices"`
+	Usage             *Usage                      `json:"usage,omitempty"`
+}
+
+type EmbeddingRequest struct {
+	Model          string        `json:"model"`
+	Input          StringOrArray `json:"input"`
+	EncodingFormat string        `json:"encoding_format,omitempty"`
+	Dimensions     *int          `json:"dimensions,omitempty"`
+	User           string        `json:"user,omitempty"`
+
+	// InputType tells the model plugins whether the texts are documents or queries,
+	// it's not part of the openai api and defaults to document
+	InputType      string         `json:"input_type,omitempty"`
+	Credentials    map[string]any `json:"credentials,omitempty"`
+	CredentialType string         `json:"credential_type,omitempty"`
+}
+
+type Embedding struct {
+	Object string `json:"object"`
+	// Embedding is a list of floats, or a base64 string of little-endian float32s
+	Embedding any `json:"embedding"`
+	Index     int `json:"index"`
+}
+
+type EmbeddingResponse struct {
+	Object string      `json:"object"`
+	Data   []Embedding `json:"data"`
+	Model  string      `json:"model"`
+	Usage  Usage       `json:"usage"`
+}
+
+// RerankRequest is shaped as the rerank apis of cohere and jina, openai has none
+type RerankRequest struct {
+	Model           string         `json:"model"`
+	Query           string         `json:"query"`
+	Documents       []RerankInput  `json:"documents"`
+	TopN            *int           `json:"top_n,omitempty"`
+	ReturnDocuments *bool          `json:"return_documents,omitempty"`
+	ScoreThreshold  *float64       `json:"score_threshold,omitempty"`
+	User            string         `json:"user,omitempty"`
+	Credentials     map[string]any `json:"credentials,omitempty"`
+	CredentialType  string         `json:"credential_type,omitempty"`
+}
+
+// RerankInput is either a string or an object with a text field
+type RerankInput struct {
+	Text string `json:"text"`
+}
+
+func (r *RerankInput) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &r.Text)
+	}
+	type input RerankInput
+	return json.Unmarshal(data, (*input)(r))
+}
+
+type RerankResult struct {
+	Index          int          `json:"index"`
+	RelevanceScore float64      `json:"relevance_score"`
+	Document       *RerankInput `json:"document,omitempty"`
+}
+
+type RerankResponse struct {
+	ID      string         `json:"id"`
+	Model   string         `json:"model"`
+	Results []RerankResult `json:"results"`
+}
+
+type SpeechRequest struct {
+	Model          string         `json:"model"`
+	Input          string         `json:"input"`
+	Voice          string         `json:"voice"`
+	ResponseFormat string         `json:"response_format,omitempty"`
+	Speed          *float64       `json:"speed,omitempty"`
+	Instructions   string         `json:"instructions,omitempty"`
+	User           string         `json:"user,omitempty"`
+	Credentials    map[string]any `json:"credentials,omitempty"`
+	CredentialType string         `json:"credential_type,omitempty"`
+}
+
+type Transcription struct {
+	Text string `json:"text"`
+}
+
+type ModerationRequest struct {
+	Model          string         `json:"model"`
+	Input          StringOrArray  `json:"input"`
+	User           string         `json:"user,omitempty"`
+	Credentials    map[string]any `json:"credentials,omitempty"`
+	CredentialType string         `json:"credential_type,omitempty"`
+}
+
+type ModerationResult struct {
+	Flagged        bool               `json:"flagged"`
+	Categories     map[string]bool    `json:"categories"`
+	CategoryScores map[string]float64 `json:"category_scores"`
+}
+
+type ModerationResponse struct {
+	ID      string             `json:"id"`
+	Model   string             `json:"model"`
+	Results []ModerationResult `json:"results"`
+}
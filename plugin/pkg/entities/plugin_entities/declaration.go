@@ -67,6 +67,8 @@ func (p *PluginPermissionRequirement) AllowRegisterEndPoint() bool {
 type PluginResourceRequirement struct {
 	// Memory in bytes
 	Memory int64 `json:"memory" yaml:"memory"`
+	// Replicas is the number of processes the plugin runs with, the daemon default if 0
+	Replicas int `json:"replicas,omitempty" validate:"omitempty,gte=0" yaml:"replicas,omitempty"`
 	// Permission requirements
 	Permission *PluginPermissionRequirement `json:"permission,omitempty" yaml:"permission,omitempty"`
 }
@@ -140,6 +142,28 @@ type PluginMeta struct {
 	Arch           []constants.Arch `json:"arch" validate:"required,dive,is_arch" yaml:"arch"`
 	Runner         PluginRunner     `json:"runner" validate:"required" yaml:"runner"`
 	MinimumVersion *string          `json:"minimum_version" yaml:"minimum_version,omitempty"`
+	// protocol features supported by the plugin sdk, unknown ones are ignored
+	Capabilities []PluginCapability `json:"capabilities,omitempty" yaml:"capabilities,omitempty"`
+}
+
+type PluginCapability string
+
+const (
+	// the plugin stops the work of a session once it receives the cancel event
+	PLUGIN_CAPABILITY_CANCEL PluginCapability = "cancel"
+	// the plugin reads and writes length prefixed frames on stdio
+	PLUGIN_CAPABILITY_BINARY_FRAMING PluginCapability = "binary_framing"
+	// the plugin receives large endpoint request bodies as a stream
+	PLUGIN_CAPABILITY_STREAMING_ENDPOINT PluginCapability = "streaming_endpoint"
+)
+
+func (m *PluginMeta) HasCapability(capability PluginCapability) bool {
+	for _, c := range m.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
 }
 
 func (p *PluginDeclaration) FillInDefaultValues() {
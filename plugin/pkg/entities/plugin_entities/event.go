@@ -13,8 +13,49 @@ const (
 	PLUGIN_EVENT_SESSION   PluginEventType = "session"
 	PLUGIN_EVENT_ERROR     PluginEventType = "error"
 	PLUGIN_EVENT_HEARTBEAT PluginEventType = "heartbeat"
+	// the first message of a plugin selecting the stdio protocol, the daemon
+	// acknowledges it with the same event
+	PLUGIN_EVENT_HANDSHAKE PluginEventType = "handshake"
 )
 
+// PluginStdioProtocol is the framing and the encoding of the messages on stdio
+type PluginStdioProtocol string
+
+const (
+	// newline delimited json, plugins without handshake use it
+	PLUGIN_STDIO_PROTOCOL_JSON_LINES PluginStdioProtocol = "json_lines"
+	// json or cbor in length prefixed frames, see parser.LengthPrefixedChunking
+	PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_JSON PluginStdioProtocol = "length_prefixed_json"
+	PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR PluginStdioProtocol = "length_prefixed_cbor"
+)
+
+func (p PluginStdioProtocol) LengthPrefixed() bool {
+	return p == PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_JSON || p == PLUGIN_STDIO_PROTOCOL_LENGTH_PREFIXED_CBOR
+}
+
+type PluginHandshake struct {
+	Protocol PluginStdioProtocol `json:"protocol"`
+	// version of the plugin sdk, empty for sdks which don't announce it
+	SdkVersion string `json:"sdk_version,omitempty"`
+	// announced by the plugin, the acknowledgement carries the ones the daemon uses
+	Capabilities []PluginCapability `json:"capabilities,omitempty"`
+	// set in the acknowledgement if the plugin is refused, the plugin exits then
+	Error string `json:"error,omitempty"`
+}
+
+// ParsePluginHandshake returns the handshake if data is a handshake event
+func ParsePluginHandshake(data []byte) (*PluginHandshake, bool) {
+	event, err := utils.UnmarshalJsonBytes[PluginUniversalEvent](data)
+	if err != nil || event.Event != PLUGIN_EVENT_HANDSHAKE {
+		return nil, false
+	}
+	handshake, err := utils.UnmarshalJsonBytes[PluginHandshake](event.Data)
+	if err != nil {
+		return nil, false
+	}
+	return &handshake, true
+}
+
 type SessionMessageType string
 
 const (
@@ -62,7 +103,7 @@ func ParsePluginUniversalEvent(
 	sessionHandler func(sessionId string, data []byte),
 	heartbeatHandler func(),
 	errorHandler func(err string),
-	infoHandler func(message string),
+	logHandler func(sessionId string, log PluginLogEvent),
 ) {
 	// handle event
 	event, err := utils.UnmarshalJsonBytes[PluginUniversalEvent](data)
@@ -75,6 +116,17 @@ func ParsePluginUniversalEvent(
 		return
 	}
 
+	HandlePluginUniversalEvent(event, sessionHandler, heartbeatHandler, errorHandler, logHandler)
+}
+
+// HandlePluginUniversalEvent dispatches a decoded event to its handler
+func HandlePluginUniversalEvent(
+	event PluginUniversalEvent,
+	sessionHandler func(sessionId string, data []byte),
+	heartbeatHandler func(),
+	errorHandler func(err string),
+	logHandler func(sessionId string, log PluginLogEvent),
+) {
 	sessionId := event.SessionId
 
 	switch event.Event {
@@ -84,7 +136,7 @@ func ParsePluginUniversalEvent(
 			utils.Error("unmarshal json failed: %s", err.Error())
 			return
 		}
-		infoHandler(logEvent.Message)
+		logHandler(sessionId, logEvent)
 	case PLUGIN_EVENT_SESSION:
 		sessionHandler(sessionId, event.Data)
 	case PLUGIN_EVENT_ERROR:
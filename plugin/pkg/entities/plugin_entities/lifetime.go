@@ -39,6 +39,12 @@ type PluginFullDuplexLifetime interface {
 	TriggerStop()
 	// IsStop
 	Stopped() bool
+	// SetCrashLoop set the plugin crash looping with the reason
+	SetCrashLoop(reason string)
+	// WaitReset receives a value once the crash loop is reset
+	WaitReset() <-chan bool
+	// LastError the last error output of the plugin
+	LastError() string
 }
 
 // PluginRuntime implement PluginRuntimeInterface
@@ -51,7 +57,6 @@ func (r *PluginRuntime) Init() error {
 		StoppedAt:  nil,
 		Verified:   false,
 		ScheduleAt: nil,
-		Logs:       []string{},
 	}
 	return nil
 }
@@ -80,6 +85,16 @@ func (r *PluginRuntime) SetScheduleAt(t time.Time) {
 	r.State.ScheduleAt = &t
 }
 
+func (r *PluginRuntime) SetCrashLoop(reason string) {
+	r.State.Status = string(PLUGIN_RUNTIME_STATUS_CRASH_LOOP)
+	r.State.FailureReason = reason
+}
+
+func (r *PluginRuntime) SetIncompatible(reason string) {
+	r.State.Status = string(PLUGIN_RUNTIME_STATUS_INCOMPATIBLE)
+	r.State.FailureReason = reason
+}
+
 func (r *PluginRuntime) AddRestarts() {
 	r.State.Restarts++
 }
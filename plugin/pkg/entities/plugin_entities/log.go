@@ -0,0 +1,162 @@
+package plugin_entities
+
+import (
+	"sync"
+	"time"
+)
+
+type PluginLogLevel string
+
+const (
+	PLUGIN_LOG_LEVEL_DEBUG PluginLogLevel = "debug"
+	PLUGIN_LOG_LEVEL_INFO  PluginLogLevel = "info"
+	PLUGIN_LOG_LEVEL_WARN  PluginLogLevel = "warn"
+	PLUGIN_LOG_LEVEL_ERROR PluginLogLevel = "error"
+)
+
+type PluginLogSource string
+
+const (
+	// emitted by the plugin through PLUGIN_EVENT_LOG
+	PLUGIN_LOG_SOURCE_EVENT PluginLogSource = "event"
+	// captured from stderr of the plugin process
+	PLUGIN_LOG_SOURCE_STDERR PluginLogSource = "stderr"
+	// written by the daemon itself, e.g. launching or restarting
+	PLUGIN_LOG_SOURCE_RUNTIME PluginLogSource = "runtime"
+)
+
+type PluginLogEntry struct {
+	Seq       uint64          `json:"seq"`
+	Level     PluginLogLevel  `json:"level"`
+	Source    PluginLogSource `json:"source"`
+	SessionID string          `json:"session_id,omitempty"`
+	Message   string          `json:"message"`
+	Timestamp time.Time       `json:"timestamp"`
+}
+
+type PluginLogFilter struct {
+	Level     PluginLogLevel `json:"level"`
+	SessionID string         `json:"session_id"`
+}
+
+func (f PluginLogFilter) Match(entry PluginLogEntry) bool {
+	if f.Level != "" && f.Level != entry.Level {
+		return false
+	}
+	if f.SessionID != "" && f.SessionID != entry.SessionID {
+		return false
+	}
+	return true
+}
+
+// PluginLogBuffer is a fixed size ring buffer of plugin logs,
+// the oldest entries are dropped once the buffer is full
+type PluginLogBuffer struct {
+	mu      sync.RWMutex
+	entries []PluginLogEntry
+	start   int
+	count   int
+	seq     uint64
+
+	subscriberID int
+	subscribers  map[int]func(PluginLogEntry)
+}
+
+func NewPluginLogBuffer(size int) *PluginLogBuffer {
+	if size <= 0 {
+		size = 1000
+	}
+	return &PluginLogBuffer{
+		entries:     make([]PluginLogEntry, size),
+		subscribers: map[int]func(PluginLogEntry){},
+	}
+}
+
+// Append stores the entry and notifies all subscribers, Seq and Timestamp are filled in
+func (b *PluginLogBuffer) Append(entry PluginLogEntry) PluginLogEntry {
+	b.mu.Lock()
+	b.seq++
+	entry.Seq = b.seq
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now()
+	}
+
+	size := len(b.entries)
+	if b.count < size {
+		b.entries[(b.start+b.count)%size] = entry
+		b.count++
+	} else {
+		b.entries[b.start] = entry
+		b.start = (b.start + 1) % size
+	}
+
+	subscribers := make([]func(PluginLogEntry), 0, len(b.subscribers))
+	for _, f := range b.subscribers {
+		subscribers = append(subscribers, f)
+	}
+	b.mu.Unlock()
+
+	for _, f := range subscribers {
+		f(entry)
+	}
+	return entry
+}
+
+// Query returns entries matching the filter, newest first, and the total number of matches
+func (b *PluginLogBuffer) Query(filter PluginLogFilter, page int, pageSize int) ([]PluginLogEntry, int) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 10
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	offset := (page - 1) * pageSize
+	result := []PluginLogEntry{}
+	total := 0
+	for i := b.count - 1; i >= 0; i-- {
+		entry := b.entries[(b.start+i)%len(b.entries)]
+		if !filter.Match(entry) {
+			continue
+		}
+		if total >= offset && len(result) < pageSize {
+			result = append(result, entry)
+		}
+		total++
+	}
+	return result, total
+}
+
+// Since returns all entries with a Seq greater than seq in order
+func (b *PluginLogBuffer) Since(seq uint64) []PluginLogEntry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	result := []PluginLogEntry{}
+	for i := 0; i < b.count; i++ {
+		entry := b.entries[(b.start+i)%len(b.entries)]
+		if entry.Seq > seq {
+			result = append(result, entry)
+		}
+	}
+	return result
+}
+
+// Subscribe registers f to receive every new entry, call the returned function to unsubscribe
+func (b *PluginLogBuffer) Subscribe(f func(PluginLogEntry)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.subscriberID++
+	id := b.subscriberID
+	b.subscribers[id] = f
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subscribers, id)
+	}
+}
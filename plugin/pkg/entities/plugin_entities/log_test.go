@@ -0,0 +1,80 @@
+package plugin_entities
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPluginLogBufferRing(t *testing.T) {
+	buffer := NewPluginLogBuffer(3)
+	for i := 0; i < 5; i++ {
+		buffer.Append(PluginLogEntry{
+			Level:   PLUGIN_LOG_LEVEL_INFO,
+			Message: fmt.Sprintf("message %d", i),
+		})
+	}
+
+	// 只保留最新的 3 条，按时间倒序返回
+	entries, total := buffer.Query(PluginLogFilter{}, 1, 10)
+	assert.Equal(t, 3, total)
+	assert.Equal(t, []string{"message 4", "message 3", "message 2"}, []string{
+		entries[0].Message, entries[1].Message, entries[2].Message,
+	})
+	assert.Equal(t, uint64(5), entries[0].Seq)
+
+	since := buffer.Since(3)
+	assert.Len(t, since, 2)
+	assert.Equal(t, "message 3", since[0].Message)
+}
+
+func TestPluginLogBufferQuery(t *testing.T) {
+	buffer := NewPluginLogBuffer(10)
+	buffer.Append(PluginLogEntry{Level: PLUGIN_LOG_LEVEL_INFO, SessionID: "s1", Message: "a"})
+	buffer.Append(PluginLogEntry{Level: PLUGIN_LOG_LEVEL_ERROR, SessionID: "s1", Message: "b"})
+	buffer.Append(PluginLogEntry{Level: PLUGIN_LOG_LEVEL_ERROR, SessionID: "s2", Message: "c"})
+	buffer.Append(PluginLogEntry{Level: PLUGIN_LOG_LEVEL_ERROR, Source: PLUGIN_LOG_SOURCE_STDERR, Message: "d"})
+
+	tests := []struct {
+		name     string
+		filter   PluginLogFilter
+		page     int
+		pageSize int
+		want     []string
+		total    int
+	}{
+		{"按级别过滤", PluginLogFilter{Level: PLUGIN_LOG_LEVEL_ERROR}, 1, 10, []string{"d", "c", "b"}, 3},
+		{"按会话过滤", PluginLogFilter{SessionID: "s1"}, 1, 10, []string{"b", "a"}, 2},
+		{"级别和会话", PluginLogFilter{Level: PLUGIN_LOG_LEVEL_ERROR, SessionID: "s2"}, 1, 10, []string{"c"}, 1},
+		{"分页", PluginLogFilter{}, 2, 3, []string{"a"}, 4},
+		{"超出范围", PluginLogFilter{}, 3, 3, []string{}, 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, total := buffer.Query(tt.filter, tt.page, tt.pageSize)
+			messages := []string{}
+			for _, entry := range entries {
+				messages = append(messages, entry.Message)
+			}
+			assert.Equal(t, tt.want, messages)
+			assert.Equal(t, tt.total, total)
+		})
+	}
+}
+
+func TestPluginLogBufferSubscribe(t *testing.T) {
+	buffer := NewPluginLogBuffer(10)
+
+	received := []string{}
+	unsubscribe := buffer.Subscribe(func(entry PluginLogEntry) {
+		received = append(received, entry.Message)
+	})
+
+	buffer.Append(PluginLogEntry{Message: "first"})
+	unsubscribe()
+	buffer.Append(PluginLogEntry{Message: "second"})
+
+	assert.Equal(t, []string{"first"}, received)
+}
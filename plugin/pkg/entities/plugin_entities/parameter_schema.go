@@ -0,0 +1,70 @@
+package plugin_entities
+
+// ToolParametersJsonSchema describes the parameters of a tool as a json schema object,
+// parameters with a default are never required as the default is filled in on invoke
+func ToolParametersJsonSchema(parameters []ToolParameter) map[string]any {
+	properties := make(map[string]any, len(parameters))
+	required := []string{}
+	for _, p := range parameters {
+		properties[p.Name] = p.JsonSchema()
+		if p.Required && p.Default == nil {
+			required = append(required, p.Name)
+		}
+	}
+
+	schema := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// JsonSchema returns the schema of the value accepted by the parameter
+func (p ToolParameter) JsonSchema() map[string]any {
+	schema := map[string]any{}
+	switch string(p.Type) {
+	case PARAMETER_TYPE_STRING, PARAMETER_TYPE_TEXT_INPUT, PARAMETER_TYPE_SECRET_INPUT, PARAMETER_TYPE_DYNAMIC_SELECT:
+		schema["type"] = "string"
+	case PARAMETER_TYPE_SELECT:
+		schema["type"] = "string"
+		options := make([]string, 0, len(p.Options))
+		for _, option := range p.Options {
+			options = append(options, option.Value)
+		}
+		schema["enum"] = options
+	case PARAMETER_TYPE_NUMBER:
+		if p.Precision != nil && *p.Precision == 0 {
+			schema["type"] = "integer"
+		} else {
+			schema["type"] = "number"
+		}
+		if p.Min != nil {
+			schema["minimum"] = *p.Min
+		}
+		if p.Max != nil {
+			schema["maximum"] = *p.Max
+		}
+	case PARAMETER_TYPE_BOOLEAN:
+		schema["type"] = "boolean"
+	case PARAMETER_TYPE_FILE, PARAMETER_TYPE_APP_SELECTOR, PARAMETER_TYPE_MODEL_SELECTOR, PARAMETER_TYPE_OBJECT:
+		schema["type"] = "object"
+	case PARAMETER_TYPE_FILES:
+		schema["type"] = "array"
+		schema["items"] = map[string]any{"type": "object"}
+	case PARAMETER_TYPE_ARRAY:
+		schema["type"] = "array"
+	}
+
+	if p.LLMDescription != "" {
+		schema["description"] = p.LLMDescription
+	} else if p.Description.EnUs != "" {
+		schema["description"] = p.Description.EnUs
+	}
+	if p.Default != nil {
+		schema["default"] = p.Default
+	}
+	return schema
+}
@@ -0,0 +1,40 @@
+package plugin_entities
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToolParametersJsonSchema(t *testing.T) {
+	min, max := 1.0, 10.0
+	precision := 0
+	schema := ToolParametersJsonSchema([]ToolParameter{
+		{
+			Name:           "query",
+			Type:           TOOL_PARAMETER_TYPE_STRING,
+			Description:    I18nObject{EnUs: "search query"},
+			LLMDescription: "keywords to search for",
+			Required:       true,
+		},
+		{Name: "limit", Type: TOOL_PARAMETER_TYPE_NUMBER, Required: true, Default: 5, Min: &min, Max: &max, Precision: &precision},
+		{Name: "lang", Type: TOOL_PARAMETER_TYPE_SELECT, Description: I18nObject{EnUs: "language"}, Options: []ParameterOption{{Value: "en"}, {Value: "zh"}}},
+		{Name: "attachments", Type: TOOL_PARAMETER_TYPE_FILES},
+		{Name: "extra", Type: TOOL_PARAMETER_TYPE_ANY},
+	})
+
+	assert.Equal(t, map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			// 优先使用面向模型的描述
+			"query": map[string]any{"type": "string", "description": "keywords to search for"},
+			// 精度为 0 的数字是整数
+			"limit":       map[string]any{"type": "integer", "minimum": 1.0, "maximum": 10.0, "default": 5},
+			"lang":        map[string]any{"type": "string", "enum": []string{"en", "zh"}, "description": "language"},
+			"attachments": map[string]any{"type": "array", "items": map[string]any{"type": "object"}},
+			"extra":       map[string]any{},
+		},
+		// 有默认值的参数不是必填
+		"required": []string{"query"},
+	}, schema)
+}
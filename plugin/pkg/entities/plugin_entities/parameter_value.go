@@ -0,0 +1,238 @@
+package plugin_entities
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// InvalidParameter tells why the value of a parameter is refused, the value itself
+// is never included as it may be a secret
+type InvalidParameter struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+}
+
+// InvalidParametersError lists every invalid parameter of an invocation
+type InvalidParametersError struct {
+	Parameters []InvalidParameter
+}
+
+func (e *InvalidParametersError) Error() string {
+	reasons := make([]string, 0, len(e.Parameters))
+	for _, p := range e.Parameters {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", p.Name, p.Reason))
+	}
+	return "invalid parameters: " + strings.Join(reasons, "; ")
+}
+
+// parameterSpec is what the values of tool and agent strategy parameters are checked against
+type parameterSpec struct {
+	name      string
+	typ       string
+	required  bool
+	def       any
+	min       *float64
+	max       *float64
+	precision *int
+	options   []ParameterOption
+}
+
+// ValidateToolParameters checks the values against the declared parameters of a tool
+// and returns them coerced to the declared types with the defaults filled in, values
+// of undeclared parameters are kept as they are
+func ValidateToolParameters(parameters []ToolParameter, values map[string]any) (map[string]any, error) {
+	specs := make([]parameterSpec, 0, len(parameters))
+	for _, p := range parameters {
+		specs = append(specs, parameterSpec{
+			name:      p.Name,
+			typ:       string(p.Type),
+			required:  p.Required,
+			def:       p.Default,
+			min:       p.Min,
+			max:       p.Max,
+			precision: p.Precision,
+			options:   p.Options,
+		})
+	}
+	return validateParameters(specs, values)
+}
+
+// ValidateAgentStrategyParameters is ValidateToolParameters for agent strategies
+func ValidateAgentStrategyParameters(parameters []AgentStrategyParameter, values map[string]any) (map[string]any, error) {
+	specs := make([]parameterSpec, 0, len(parameters))
+	for _, p := range parameters {
+		required := false
+		if p.Required != nil {
+			required, _ = strconv.ParseBool(*p.Required)
+		}
+		specs = append(specs, parameterSpec{
+			name:      p.Name,
+			typ:       string(p.Type),
+			required:  required,
+			def:       p.Default,
+			min:       p.Min,
+			max:       p.Max,
+			precision: p.Precision,
+			options:   p.Options,
+		})
+	}
+	return validateParameters(specs, values)
+}
+
+func validateParameters(specs []parameterSpec, values map[string]any) (map[string]any, error) {
+	result := make(map[string]any, len(values))
+	for name, value := range values {
+		result[name] = value
+	}
+
+	invalid := []InvalidParameter{}
+	for _, spec := range specs {
+		value, ok := result[spec.name]
+		if !ok || value == nil {
+			if spec.def == nil {
+				if spec.required {
+					invalid = append(invalid, InvalidParameter{Name: spec.name, Reason: "is required"})
+				}
+				continue
+			}
+			value = spec.def
+		}
+
+		coerced, err := coerceParameter(spec, value)
+		if err != nil {
+			invalid = append(invalid, InvalidParameter{Name: spec.name, Reason: err.Error()})
+			continue
+		}
+		result[spec.name] = coerced
+	}
+
+	if len(invalid) > 0 {
+		return nil, &InvalidParametersError{Parameters: invalid}
+	}
+	return result, nil
+}
+
+func coerceParameter(spec parameterSpec, value any) (any, error) {
+	switch spec.typ {
+	case PARAMETER_TYPE_STRING, PARAMETER_TYPE_TEXT_INPUT, PARAMETER_TYPE_SECRET_INPUT, PARAMETER_TYPE_DYNAMIC_SELECT:
+		return coerceString(value)
+	case PARAMETER_TYPE_SELECT:
+		s, err := coerceString(value)
+		if err != nil {
+			return nil, err
+		}
+		for _, option := range spec.options {
+			if option.Value == s {
+				return s, nil
+			}
+		}
+		return nil, fmt.Errorf("must be one of the options")
+	case PARAMETER_TYPE_NUMBER:
+		return coerceNumber(spec, value)
+	case PARAMETER_TYPE_BOOLEAN:
+		return coerceBoolean(value)
+	case PARAMETER_TYPE_FILE, PARAMETER_TYPE_APP_SELECTOR, PARAMETER_TYPE_MODEL_SELECTOR, PARAMETER_TYPE_OBJECT:
+		return coerceJson[map[string]any](value, "an object")
+	case PARAMETER_TYPE_FILES, PARAMETER_TYPE_TOOLS_SELECTOR:
+		items, err := coerceJson[[]any](value, "an array")
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			if _, ok := item.(map[string]any); !ok {
+				return nil, fmt.Errorf("must be an array of objects")
+			}
+		}
+		return items, nil
+	case PARAMETER_TYPE_ARRAY:
+		return coerceJson[[]any](value, "an array")
+	default:
+		return value, nil
+	}
+}
+
+func coerceString(value any) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", fmt.Errorf("must be a string")
+}
+
+func coerceNumber(spec parameterSpec, value any) (float64, error) {
+	var number float64
+	switch v := value.(type) {
+	case float64:
+		number = v
+	case int:
+		number = float64(v)
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("must be a number")
+		}
+		number = parsed
+	default:
+		return 0, fmt.Errorf("must be a number")
+	}
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("must be a finite number")
+	}
+
+	if spec.precision != nil && *spec.precision >= 0 {
+		scale := math.Pow10(*spec.precision)
+		number = math.Round(number*scale) / scale
+	}
+	if spec.min != nil && number < *spec.min {
+		return 0, fmt.Errorf("must not be less than %v", *spec.min)
+	}
+	if spec.max != nil && number > *spec.max {
+		return 0, fmt.Errorf("must not be greater than %v", *spec.max)
+	}
+	return number, nil
+}
+
+func coerceBoolean(value any) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if parsed, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+			return parsed, nil
+		}
+	case float64:
+		if v == 0 || v == 1 {
+			return v == 1, nil
+		}
+	case int:
+		if v == 0 || v == 1 {
+			return v == 1, nil
+		}
+	}
+	return false, fmt.Errorf("must be a boolean")
+}
+
+// coerceJson accepts the value itself or its json encoding in a string
+func coerceJson[T any](value any, kind string) (T, error) {
+	if s, ok := value.(string); ok {
+		var decoded T
+		if err := json.Unmarshal([]byte(s), &decoded); err != nil {
+			return decoded, fmt.Errorf("must be %s", kind)
+		}
+		return decoded, nil
+	}
+	if v, ok := value.(T); ok {
+		return v, nil
+	}
+	var zero T
+	return zero, fmt.Errorf("must be %s", kind)
+}
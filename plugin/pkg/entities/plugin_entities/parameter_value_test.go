@@ -0,0 +1,125 @@
+package plugin_entities
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateToolParameters(t *testing.T) {
+	min, max := 1.0, 10.0
+	precision := 1
+	parameters := []ToolParameter{
+		{Name: "query", Type: TOOL_PARAMETER_TYPE_STRING, Required: true},
+		{Name: "api_key", Type: TOOL_PARAMETER_TYPE_SECRET_INPUT},
+		{Name: "limit", Type: TOOL_PARAMETER_TYPE_NUMBER, Default: 5, Min: &min, Max: &max, Precision: &precision},
+		{Name: "safe", Type: TOOL_PARAMETER_TYPE_BOOLEAN, Default: true},
+		{Name: "lang", Type: TOOL_PARAMETER_TYPE_SELECT, Options: []ParameterOption{{Value: "en"}, {Value: "zh"}}},
+		{Name: "image", Type: TOOL_PARAMETER_TYPE_FILE},
+		{Name: "attachments", Type: TOOL_PARAMETER_TYPE_FILES},
+		{Name: "tags", Type: TOOL_PARAMETER_TYPE_ARRAY},
+	}
+
+	tests := []struct {
+		name     string
+		values   map[string]any
+		expected map[string]any
+		// 非法的参数及原因
+		invalid []InvalidParameter
+	}{
+		{
+			name:     "填充默认值",
+			values:   map[string]any{"query": "go"},
+			expected: map[string]any{"query": "go", "limit": 5.0, "safe": true},
+		},
+		{
+			name: "转换类型",
+			values: map[string]any{
+				"query":       12.0,
+				"limit":       "3.14",
+				"safe":        "false",
+				"lang":        "zh",
+				"image":       `{"url":"https://example.com/a.png"}`,
+				"attachments": []any{map[string]any{"url": "https://example.com/a.txt"}},
+				"tags":        `["a","b"]`,
+			},
+			expected: map[string]any{
+				"query":       "12",
+				"limit":       3.1,
+				"safe":        false,
+				"lang":        "zh",
+				"image":       map[string]any{"url": "https://example.com/a.png"},
+				"attachments": []any{map[string]any{"url": "https://example.com/a.txt"}},
+				"tags":        []any{"a", "b"},
+			},
+		},
+		{
+			name:     "保留未声明的参数",
+			values:   map[string]any{"query": "go", "runtime_option": "x"},
+			expected: map[string]any{"query": "go", "limit": 5.0, "safe": true, "runtime_option": "x"},
+		},
+		{
+			name: "列出所有非法参数",
+			values: map[string]any{
+				"api_key":     map[string]any{"secret": "x"},
+				"limit":       20,
+				"safe":        "maybe",
+				"lang":        "fr",
+				"image":       "not a file",
+				"attachments": []any{"a.txt"},
+			},
+			invalid: []InvalidParameter{
+				{Name: "query", Reason: "is required"},
+				{Name: "api_key", Reason: "must be a string"},
+				{Name: "limit", Reason: "must not be greater than 10"},
+				{Name: "safe", Reason: "must be a boolean"},
+				{Name: "lang", Reason: "must be one of the options"},
+				{Name: "image", Reason: "must be an object"},
+				{Name: "attachments", Reason: "must be an array of objects"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ValidateToolParameters(parameters, tt.values)
+			if tt.invalid == nil {
+				require.NoError(t, err)
+				assert.Equal(t, tt.expected, result)
+				return
+			}
+
+			var invalid *InvalidParametersError
+			require.True(t, errors.As(err, &invalid))
+			assert.Equal(t, tt.invalid, invalid.Parameters)
+			// 错误信息中不包含参数的值
+			assert.NotContains(t, err.Error(), "secret")
+		})
+	}
+}
+
+func TestValidateAgentStrategyParameters(t *testing.T) {
+	required := "true"
+	parameters := []AgentStrategyParameter{
+		{Name: "model", Type: AGENT_STRATEGY_PARAMETER_TYPE_MODEL_SELECTOR, Required: &required},
+		{Name: "tools", Type: AGENT_STRATEGY_PARAMETER_TYPE_TOOLS_SELECTOR},
+		{Name: "max_iterations", Type: AGENT_STRATEGY_PARAMETER_TYPE_NUMBER, Default: 3},
+	}
+
+	result, err := ValidateAgentStrategyParameters(parameters, map[string]any{
+		"model": map[string]any{"provider": "openai", "model": "gpt-4o"},
+		"tools": []any{map[string]any{"provider_name": "weather"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, result["max_iterations"])
+
+	_, err = ValidateAgentStrategyParameters(parameters, map[string]any{"tools": "weather"})
+	var invalid *InvalidParametersError
+	require.True(t, errors.As(err, &invalid))
+	assert.Equal(t, []InvalidParameter{
+		{Name: "model", Reason: "is required"},
+		{Name: "tools", Reason: "must be an array"},
+	}, invalid.Parameters)
+}
@@ -3,7 +3,6 @@ package plugin_entities
 import (
 	"crypto/sha256"
 	"encoding/hex"
-	"fmt"
 	"time"
 
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/access_types"
@@ -16,6 +15,8 @@ const (
 	PLUGIN_RUNTIME_TYPE_LOCAL      PluginRuntimeType = "local"
 	PLUGIN_RUNTIME_TYPE_REMOTE     PluginRuntimeType = "remote"
 	PLUGIN_RUNTIME_TYPE_SERVERLESS PluginRuntimeType = "serverless"
+	// an external mcp server exposed as a tool provider, it's configured on the daemon
+	PLUGIN_RUNTIME_TYPE_MCP PluginRuntimeType = "mcp"
 )
 
 type PluginRuntimeState struct {
@@ -26,7 +27,34 @@ type PluginRuntimeState struct {
 	StoppedAt   *time.Time `json:"stopped_at"`
 	Verified    bool       `json:"verified"`
 	ScheduleAt  *time.Time `json:"scheduled_at"`
-	Logs        []string   `json:"logs"`
+	// last error output of a crash looping plugin, or why an incompatible one is refused
+	FailureReason string `json:"failure_reason,omitempty"`
+	// resources used by the plugin processes, nil if not sampled yet
+	ResourceUsage *PluginResourceUsage `json:"resource_usage,omitempty"`
+}
+
+// PluginResourceUsage is sampled from the plugin process and its children
+type PluginResourceUsage struct {
+	// percentage of one cpu core since the last sample
+	CPUPercent float64 `json:"cpu_percent"`
+	// resident memory in bytes
+	RSS       int64     `json:"rss"`
+	OpenFiles int       `json:"open_files"`
+	Threads   int       `json:"threads"`
+	Processes int       `json:"processes"`
+	SampledAt time.Time `json:"sampled_at"`
+}
+
+// Add sums the usage of several processes, the latest sample time is kept
+func (u *PluginResourceUsage) Add(other *PluginResourceUsage) {
+	u.CPUPercent += other.CPUPercent
+	u.RSS += other.RSS
+	u.OpenFiles += other.OpenFiles
+	u.Threads += other.Threads
+	u.Processes += other.Processes
+	if other.SampledAt.After(u.SampledAt) {
+		u.SampledAt = other.SampledAt
+	}
 }
 
 type PluginRuntimeStatus string
@@ -37,16 +65,36 @@ const (
 	PLUGIN_RUNTIME_STATUS_STOPPED    PluginRuntimeStatus = "stopped"
 	PLUGIN_RUNTIME_STATUS_RESTARTING PluginRuntimeStatus = "restarting"
 	PLUGIN_RUNTIME_STATUS_PENDING    PluginRuntimeStatus = "pending"
+	// the plugin crashed too often and is not restarted until it's reset
+	PLUGIN_RUNTIME_STATUS_CRASH_LOOP PluginRuntimeStatus = "crash_loop"
+	// the plugin sdk is refused by the daemon, the plugin is not restarted
+	PLUGIN_RUNTIME_STATUS_INCOMPATIBLE PluginRuntimeStatus = "incompatible"
 )
 
 func (p PluginRuntimeStatus) String() string {
 	return string(p)
 }
 
+type PluginInstallStage string
+
+const (
+	PLUGIN_INSTALL_STAGE_VERIFY       PluginInstallStage = "verify"
+	PLUGIN_INSTALL_STAGE_EXTRACT      PluginInstallStage = "extract"
+	PLUGIN_INSTALL_STAGE_VENV         PluginInstallStage = "venv"
+	PLUGIN_INSTALL_STAGE_DEPENDENCIES PluginInstallStage = "dependencies"
+	PLUGIN_INSTALL_STAGE_COMPILE      PluginInstallStage = "compile"
+	PLUGIN_INSTALL_STAGE_LAUNCH       PluginInstallStage = "launch"
+	PLUGIN_INSTALL_STAGE_READY        PluginInstallStage = "ready"
+)
+
+// PluginInstallProgressHandler receives the progress of a plugin while it's being installed
+type PluginInstallProgressHandler func(stage PluginInstallStage, message string)
+
 type PluginRuntime struct {
-	State  PluginRuntimeState `json:"state"`
-	Config PluginDeclaration  `json:"config"`
-	onStop []func()           `json:"-"`
+	State     PluginRuntimeState `json:"state"`
+	Config    PluginDeclaration  `json:"config"`
+	LogBuffer *PluginLogBuffer   `json:"-"`
+	onStop    []func()           `json:"-"`
 }
 
 type PluginBasicInfo interface {
@@ -70,6 +118,24 @@ type PluginRuntimeInterface interface {
 	Warn(string)
 	// Error adds an error log to the plugin runtime
 	Error(string)
+	// Logs returns the log buffer of the plugin runtime, nil if logs are not collected
+	Logs() *PluginLogBuffer
+}
+
+// PluginCapabilityReporter is implemented by runtimes which negotiate the
+// capabilities with the plugin process instead of trusting the manifest
+type PluginCapabilityReporter interface {
+	HasCapability(capability PluginCapability) bool
+}
+
+// HasCapability reports whether the plugin behind the runtime supports the capability,
+// the negotiated capabilities take precedence over the ones declared in the manifest
+func HasCapability(runtime PluginBasicInfo, capability PluginCapability) bool {
+	if reporter, ok := runtime.(PluginCapabilityReporter); ok {
+		return reporter.HasCapability(capability)
+	}
+	declaration := runtime.Configuration()
+	return declaration != nil && declaration.Meta.HasCapability(capability)
 }
 
 type PluginClusterLifeTime interface {
@@ -107,16 +173,31 @@ func (r *PluginRuntime) HashedIdentity() (string, error) {
 	return HashedIdentity(r.Config.Identity()), nil
 }
 
+func (r *PluginRuntime) appendLog(level PluginLogLevel, msg string) {
+	if r.LogBuffer == nil {
+		return
+	}
+	r.LogBuffer.Append(PluginLogEntry{
+		Level:   level,
+		Source:  PLUGIN_LOG_SOURCE_RUNTIME,
+		Message: msg,
+	})
+}
+
 func (r *PluginRuntime) Log(msg string) {
-	r.State.Logs = append(r.State.Logs, fmt.Sprintf("[Info] %s: %s", time.Now().Format(time.RFC3339), msg))
+	r.appendLog(PLUGIN_LOG_LEVEL_INFO, msg)
 }
 
 func (r *PluginRuntime) Warn(msg string) {
-	r.State.Logs = append(r.State.Logs, fmt.Sprintf("[Warn] %s: %s", time.Now().Format(time.RFC3339), msg))
+	r.appendLog(PLUGIN_LOG_LEVEL_WARN, msg)
 }
 
 func (r *PluginRuntime) Error(msg string) {
-	r.State.Logs = append(r.State.Logs, fmt.Sprintf("[Error] %s: %s", time.Now().Format(time.RFC3339), msg))
+	r.appendLog(PLUGIN_LOG_LEVEL_ERROR, msg)
+}
+
+func (r *PluginRuntime) Logs() *PluginLogBuffer {
+	return r.LogBuffer
 }
 
 // Checksum() implements by basic_runtime.BasicChecksum
@@ -129,6 +210,5 @@ func (r *PluginRuntime) InitState() {
 		StoppedAt:  nil,
 		Verified:   false,
 		ScheduleAt: nil,
-		Logs:       []string{},
 	}
 }
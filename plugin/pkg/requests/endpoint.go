@@ -3,4 +3,7 @@ package requests
 type RequestInvokeEndPoint struct {
 	RawHttpRequest string         `json:"raw_http_request" validate:"required"`
 	Settings       map[string]any `json:"settings" validate:"required"`
+	// when set, RawHttpRequest only carries the request line and headers,
+	// the body follows as EndpointRequestBodyChunk messages
+	BodyStreaming bool `json:"body_streaming,omitempty"`
 }
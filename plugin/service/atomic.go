@@ -16,6 +16,7 @@ func AtomicInstallPlugin(
 	declaration *plugin_entities.PluginDeclaration,
 	source string,
 	meta map[string]any,
+	actor string,
 ) (*model.Plugin, *model.PluginInstallation, error) {
 	var rPlugin *model.Plugin
 	var rInstallation *model.PluginInstallation
@@ -97,6 +98,19 @@ func AtomicInstallPlugin(
 
 		rInstallation = installation
 
+		if err := db.Create(&model.PluginInstallationHistory{
+			TenantID:               tenantId,
+			PluginID:               pluginUniqueIdentifier.PluginID(),
+			Action:                 model.PluginInstallationHistoryActionInstall,
+			PluginUniqueIdentifier: pluginUniqueIdentifier.String(),
+			RuntimeType:            string(installType),
+			Actor:                  actor,
+			Source:                 source,
+			Meta:                   meta,
+		}, tx); err != nil {
+			return err
+		}
+
 		// create tool installation
 		if declaration.Tool != nil {
 			toolInstallation := &model.ToolInstallation{
@@ -164,6 +178,7 @@ func AtomicUninstallPlugin(
 	pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
 	installationId string,
 	declaration *plugin_entities.PluginDeclaration,
+	actor string,
 ) (*DeletePluginResponse, error) {
 	var rPlugin *model.Plugin
 	var rInstallation *model.PluginInstallation
@@ -222,6 +237,19 @@ func AtomicUninstallPlugin(
 			rInstallation = &installation
 		}
 
+		if err := db.Create(&model.PluginInstallationHistory{
+			TenantID:                       tenantId,
+			PluginID:                       installation.PluginID,
+			Action:                         model.PluginInstallationHistoryActionUninstall,
+			OriginalPluginUniqueIdentifier: pluginUniqueIdentifier.String(),
+			RuntimeType:                    installation.RuntimeType,
+			Actor:                          actor,
+			Source:                         installation.Source,
+			Meta:                           installation.Meta,
+		}, tx); err != nil {
+			return err
+		}
+
 		// delete tool installation
 		if declaration.Tool != nil {
 			toolInstallation := &model.ToolInstallation{
@@ -299,6 +327,63 @@ func AtomicUpgradePlugin(
 	installType plugin_entities.PluginRuntimeType,
 	source string,
 	meta map[string]any,
+	actor string,
+) (*UpgradePluginResponse, error) {
+	return atomicSwitchPlugin(
+		model.PluginInstallationHistoryActionUpgrade,
+		tenantId,
+		originalPluginUniqueIdentifier,
+		newPluginUniqueIdentifier,
+		originalDeclaration,
+		newDeclaration,
+		installType,
+		source,
+		meta,
+		actor,
+	)
+}
+
+// AtomicRollbackPlugin switches the installation of a tenant back to a previous identifier,
+// it behaves the same as AtomicUpgradePlugin but is recorded as a rollback
+func AtomicRollbackPlugin(
+	tenantId string,
+	currentPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	previousPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	currentDeclaration *plugin_entities.PluginDeclaration,
+	previousDeclaration *plugin_entities.PluginDeclaration,
+	installType plugin_entities.PluginRuntimeType,
+	source string,
+	meta map[string]any,
+	actor string,
+) (*UpgradePluginResponse, error) {
+	return atomicSwitchPlugin(
+		model.PluginInstallationHistoryActionRollback,
+		tenantId,
+		currentPluginUniqueIdentifier,
+		previousPluginUniqueIdentifier,
+		currentDeclaration,
+		previousDeclaration,
+		installType,
+		source,
+		meta,
+		actor,
+	)
+}
+
+// atomicSwitchPlugin moves the installation of a tenant from the original identifier
+// to the new one, tool, model and agent strategy installations are re-linked, endpoints
+// refer to the plugin id and therefore follow the installation
+func atomicSwitchPlugin(
+	action model.PluginInstallationHistoryAction,
+	tenantId string,
+	originalPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	newPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	originalDeclaration *plugin_entities.PluginDeclaration,
+	newDeclaration *plugin_entities.PluginDeclaration,
+	installType plugin_entities.PluginRuntimeType,
+	source string,
+	meta map[string]any,
+	actor string,
 ) (*UpgradePluginResponse, error) {
 	var response UpgradePluginResponse
 
@@ -350,6 +435,20 @@ func AtomicUpgradePlugin(
 			return err
 		}
 
+		if err := db.Create(&model.PluginInstallationHistory{
+			TenantID:                       tenantId,
+			PluginID:                       installation.PluginID,
+			Action:                         action,
+			OriginalPluginUniqueIdentifier: originalPluginUniqueIdentifier.String(),
+			PluginUniqueIdentifier:         newPluginUniqueIdentifier.String(),
+			RuntimeType:                    installation.RuntimeType,
+			Actor:                          actor,
+			Source:                         source,
+			Meta:                           meta,
+		}, tx); err != nil {
+			return err
+		}
+
 		// decrease the refers of the original plugin
 		err = db.Run(
 			db.WithTransactionContext(tx),
@@ -423,7 +522,7 @@ func AtomicUpgradePlugin(
 			err := db.DeleteBy(&model.ToolInstallation{
 				PluginID: originalPluginUniqueIdentifier.PluginID(),
 				TenantID: tenantId,
-			})
+			}, tx)
 
 			if err != nil {
 				return err
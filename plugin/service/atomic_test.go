@@ -79,6 +79,7 @@ func TestAutomicInstallPlugin(t *testing.T) {
 			declaration,
 			source,
 			meta,
+			"test-user",
 		)
 		// 断言
 		assert.NoError(t, err)
@@ -161,6 +162,7 @@ func TestAutomicUninstallPlugin(t *testing.T) {
 		pluginUID,
 		uuid.MustParse("fcba873e-910d-4c9a-a6b4-f11d580c3bb8").String(),
 		declaration,
+		"test-user",
 	)
 
 	assert.NoError(t, err)
@@ -234,10 +236,21 @@ func TestAutomicUpgradePlugin(t *testing.T) {
 			installType,
 			source,
 			meta,
+			"test-user",
 		)
 		// 断言
 		assert.NoError(t, err)
 		assert.NotNil(t, response)
+
+		// 验证升级记录
+		history, err := db.GetOne[model.PluginInstallationHistory](
+			db.Equal("tenant_id", tenantID.String()),
+			db.Equal("action", string(model.PluginInstallationHistoryActionUpgrade)),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, pluginUID.String(), history.OriginalPluginUniqueIdentifier)
+		assert.Equal(t, newPluginUID.String(), history.PluginUniqueIdentifier)
+		assert.Equal(t, "test-user", history.Actor)
 	})
 
 }
@@ -8,17 +8,21 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/access_types"
+	"github.com/jjgagacy/workflow-app/plugin/core/server/server_const"
 	"github.com/jjgagacy/workflow-app/plugin/core/session_manager"
+	"github.com/jjgagacy/workflow-app/plugin/model"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
 	"github.com/jjgagacy/workflow-app/plugin/utils"
 )
 
+// baseSSEService streams the chunks to the client, the returned error is the one
+// written to the client, nil if the stream succeeded or the client disconnected
 func baseSSEService[R any](
 	fn func() (*utils.Stream[R], error),
 	ctx *gin.Context,
 	maxTimeout int, // seconds
-) {
+) error {
 	writer := ctx.Writer
 	writer.Header().Set("Content-Type", "text/event-stream")
 	writer.Header().Set("Cache-Control", "no-cache")
@@ -62,9 +66,11 @@ func baseSSEService[R any](
 	if err != nil {
 		writeData(entities.InternalError(err).ToResponse())
 		close(done)
-		return
+		return err
 	}
 
+	var streamErr error
+
 	utils.Submit(map[string]string{
 		"module":   "service",
 		"function": "baseSseService",
@@ -72,6 +78,7 @@ func baseSSEService[R any](
 		for ch.Next() {
 			chunk, err := ch.Read()
 			if err != nil {
+				streamErr = err
 				writeData(entities.InvokePluginError(err).ToResponse())
 				break
 			}
@@ -93,15 +100,18 @@ func baseSSEService[R any](
 	select {
 	case <-writer.CloseNotify():
 		ch.Close()
-		return
+		return nil
 	case <-done:
-		return
+		return streamErr
 	case <-timer.C:
-		writeData(entities.InternalError(errors.New("killed by timeout")).ToResponse())
+		err := errors.New("killed by timeout")
+		writeData(entities.InternalError(err).ToResponse())
+		// stop listening to the plugin, the client already got the timeout
+		ch.Close()
 		if atomic.CompareAndSwapInt32(doneClosed, 0, 1) {
 			close(done)
 		}
-		return
+		return err
 	}
 }
 
@@ -126,11 +136,24 @@ func baseSSEWithSession[T any, R any](
 		IgnoreCache: false,
 	})
 
-	baseSSEService(
+	err = baseSSEService(
 		func() (*utils.Stream[R], error) {
 			return fn(session)
 		},
 		ctx,
 		maxTimeout,
 	)
+
+	if value, ok := ctx.Get(server_const.PLUGIN_ROLLOUT); ok {
+		if rollout, ok := value.(*model.PluginRollout); ok {
+			uniqueIdentifier := request.UniqueIdentifier
+			success := err == nil
+			utils.Submit(map[string]string{
+				"module":   "service",
+				"function": "RecordPluginRolloutResult",
+			}, func() {
+				RecordPluginRolloutResult(rollout, uniqueIdentifier, success)
+			})
+		}
+	}
 }
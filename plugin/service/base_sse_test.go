@@ -237,6 +237,34 @@ func TestSSEServiceTimeout(t *testing.T) {
 	assert.Contains(t, body, "killed by timeout")
 }
 
+func TestSSEServiceTimeoutClosesStream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	stream := utils.NewStream[string](10)
+	router := gin.New()
+	router.GET("/sse", func(ctx *gin.Context) {
+		baseSSEService(
+			func() (*utils.Stream[string], error) {
+				// 插件一直没有返回结果
+				return stream, nil
+			},
+			ctx,
+			1,
+		)
+	})
+	req := httptest.NewRequest("GET", "/sse", nil)
+	w := httptest.NewRecorder()
+	wrapper := &closeNotifyRecorder{
+		ResponseRecorder: w,
+		closeChan:        make(chan bool, 1),
+	}
+	router.ServeHTTP(wrapper, req)
+
+	assert.Contains(t, w.Body.String(), "killed by timeout")
+	// 超时后关闭流，会话随之结束
+	assert.True(t, stream.IsClosed())
+}
+
 type cancelableResponseWriter struct {
 	gin.ResponseWriter
 	ctx context.Context
@@ -2,15 +2,19 @@ package service
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/core"
 	"github.com/jjgagacy/workflow-app/plugin/core/invocation"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/access_types"
@@ -24,7 +28,48 @@ import (
 	"github.com/jjgagacy/workflow-app/plugin/utils"
 )
 
-func copyRequest(req *http.Request, hookId string, path string) (*bytes.Buffer, error) {
+var errEndPointBodyClosed = errors.New("endpoint request has finished")
+
+// endPointBody guards the request body streamed to the plugin, the request is recycled
+// once the handler returns, so reads stop after close or when the request is cancelled
+type endPointBody struct {
+	ctx    context.Context
+	mu     sync.Mutex
+	reader io.Reader
+	closed bool
+}
+
+func newEndPointBody(ctx context.Context, reader io.Reader) *endPointBody {
+	return &endPointBody{ctx: ctx, reader: reader}
+}
+
+func (b *endPointBody) Read(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return 0, errEndPointBodyClosed
+	}
+	if err := b.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return b.reader.Read(p)
+}
+
+// close waits for the read in progress to return, interrupt is called to unblock it
+func (b *endPointBody) close(interrupt func()) {
+	if !b.mu.TryLock() {
+		interrupt()
+		b.mu.Lock()
+	}
+	b.closed = true
+	b.mu.Unlock()
+}
+
+// copyRequest dumps the request which will be forwarded to the plugin, bodies not larger
+// than inlineBodySize are kept in the dump, otherwise the dump only carries the request line
+// and headers, and the returned reader yields the whole body
+func copyRequest(req *http.Request, hookId string, path string, inlineBodySize int64) (*bytes.Buffer, io.Reader, error) {
 	clonedReq := req.Clone(req.Context())
 	// get query params
 	queryParams := req.URL.Query()
@@ -32,15 +77,27 @@ func copyRequest(req *http.Request, hookId string, path string) (*bytes.Buffer,
 	clonedReq.URL.Path = path
 	// set query params
 	clonedReq.URL.RawQuery = queryParams.Encode()
-	// read request body until complete, max 10MB
-	body, err := io.ReadAll(io.LimitReader(req.Body, 10*1024*1024))
+
+	var body io.Reader
+	// read one more byte than the inline size to know whether the body fits
+	head, err := io.ReadAll(io.LimitReader(req.Body, inlineBodySize+1))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	// replace with a new reader
-	clonedReq.Body = io.NopCloser(bytes.NewReader(body))
-	clonedReq.ContentLength = int64(len(body))
+	if int64(len(head)) <= inlineBodySize {
+		// replace with a new reader
+		clonedReq.Body = io.NopCloser(bytes.NewReader(head))
+		clonedReq.ContentLength = int64(len(head))
+	} else {
+		// body is streamed separately, keep the read part in front of the rest
+		body = io.MultiReader(bytes.NewReader(head), req.Body)
+		clonedReq.Body = http.NoBody
+		clonedReq.ContentLength = 0
+		if req.ContentLength > 0 {
+			clonedReq.Header.Set("X-Original-Content-Length", strconv.FormatInt(req.ContentLength, 10))
+		}
+	}
 	clonedReq.TransferEncoding = nil
 
 	// add hook id to header
@@ -70,23 +127,25 @@ func copyRequest(req *http.Request, hookId string, path string) (*bytes.Buffer,
 	// create a buffer to hold the request
 	var buf bytes.Buffer
 	if err := clonedReq.Write(&buf); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	return &buf, nil
+	return &buf, body, nil
 }
 
-func EndPoint(ctx *gin.Context, endPoint *model.EndPoint, pluginInstallation *model.PluginInstallation, maxExecutionTime time.Duration, path string) {
+func EndPoint(ctx *gin.Context, endPoint *model.EndPoint, pluginInstallation *model.PluginInstallation, config *core.Config, path string) {
 	if !endPoint.Enabled {
 		ctx.JSON(404, entities.NotFoundError(errors.New("endpoint not found")).ToResponse())
 		return
 	}
 
-	buffer, err := copyRequest(ctx.Request, endPoint.HookID, path)
-	if err != nil {
-		ctx.JSON(500, entities.InternalError(err).ToResponse())
+	maxExecutionTime := time.Duration(config.PluginMaxExecutionTimeout) * time.Second
+	if ctx.Request.ContentLength > config.PluginEndPointMaxBodySize {
+		ctx.JSON(http.StatusRequestEntityTooLarge, entities.BadRequestError(errors.New("request body too large")).ToResponse())
 		return
 	}
+	// chunked bodies have no content length, fail the read once the limit is exceeded
+	ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, config.PluginEndPointMaxBodySize)
 
 	identifier, err := plugin_entities.NewPluginUniqueIdentifier(pluginInstallation.PluginUniqueIdentifier)
 	if err != nil {
@@ -101,6 +160,22 @@ func EndPoint(ctx *gin.Context, endPoint *model.EndPoint, pluginInstallation *mo
 		return
 	}
 
+	// plugins which can't receive a streamed body get the whole body inline
+	inlineBodySize := config.PluginEndPointInlineBodySize
+	if !plugin_entities.HasCapability(runtime, plugin_entities.PLUGIN_CAPABILITY_STREAMING_ENDPOINT) {
+		inlineBodySize = config.PluginEndPointMaxBodySize
+	}
+	buffer, body, err := copyRequest(ctx.Request, endPoint.HookID, path, inlineBodySize)
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			ctx.JSON(http.StatusRequestEntityTooLarge, entities.BadRequestError(errors.New("request body too large")).ToResponse())
+			return
+		}
+		ctx.JSON(500, entities.InternalError(err).ToResponse())
+		return
+	}
+
 	// fetch endpoint declaration
 	endPointDeclaration := runtime.Configuration().EndPoint
 	if endPointDeclaration == nil {
@@ -149,12 +224,25 @@ func EndPoint(ctx *gin.Context, endPoint *model.EndPoint, pluginInstallation *mo
 
 	session.BindRuntime(runtime)
 
+	if body != nil {
+		// the body is streamed by the daemon, it must not be read after the handler returned
+		guarded := newEndPointBody(ctx.Request.Context(), body)
+		defer guarded.close(func() {
+			// unblock a read which is waiting for the client, the error is ignored
+			// since not every writer supports deadlines
+			http.NewResponseController(ctx.Writer).SetReadDeadline(time.Now())
+		})
+		body = guarded
+	}
+
 	statusCode, headers, response, err := plugin_daemon.InvokeEndPoint(
 		session,
 		&requests.RequestInvokeEndPoint{
 			RawHttpRequest: hex.EncodeToString(buffer.Bytes()),
 			Settings:       decryptSettings,
 		},
+		body,
+		config.PluginEndPointBodyChunkSize,
 	)
 	if err != nil {
 		ctx.JSON(500, entities.InternalError(err).ToResponse())
@@ -2,6 +2,8 @@ package service
 
 import (
 	"bufio"
+	"context"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -20,6 +22,9 @@ func TestCopyRequest(t *testing.T) {
 		wantBody     string
 		checkHeaders func(t *testing.T, req *http.Request)
 		expectError  bool
+		// 超过 inlineBodySize 的请求体通过 reader 单独返回
+		inlineBodySize   int64
+		wantStreamedBody string
 	}{
 		{
 			name: "Basic GET request",
@@ -49,14 +54,50 @@ func TestCopyRequest(t *testing.T) {
 					t.Errorf("Expected X-Forwarded-For header to be removed, got '%s'", req.Header.Get("X-Forwarded-For"))
 				}
 			},
-			wantBody:    "test body content",
-			expectError: false,
+			wantBody:       "test body content",
+			expectError:    false,
+			inlineBodySize: 1024,
+		},
+		{
+			name: "Large body is streamed",
+			setupRequest: func() *http.Request {
+				body := strings.NewReader(strings.Repeat("a", 64))
+				req := httptest.NewRequest("POST", "http://example.com/upload", body)
+				req.Header.Set("Content-Type", "application/octet-stream")
+				return req
+			},
+			hookId:     "test-hook",
+			path:       "/upload",
+			wantHookId: "test-hook",
+			wantMethod: "POST",
+			wantPath:   "/upload",
+			checkHeaders: func(t *testing.T, req *http.Request) {
+				if req.Header.Get("X-Original-Content-Length") != "64" {
+					t.Errorf("Expected X-Original-Content-Length header to be '64', got '%s'", req.Header.Get("X-Original-Content-Length"))
+				}
+			},
+			wantBody:         "",
+			inlineBodySize:   16,
+			wantStreamedBody: strings.Repeat("a", 64),
+		},
+		{
+			name: "Body equal to inline size is kept inline",
+			setupRequest: func() *http.Request {
+				return httptest.NewRequest("PUT", "http://example.com/put", strings.NewReader("0123456789abcdef"))
+			},
+			hookId:         "test-hook",
+			path:           "/put",
+			wantHookId:     "test-hook",
+			wantMethod:     "PUT",
+			wantPath:       "/put",
+			wantBody:       "0123456789abcdef",
+			inlineBodySize: 16,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			req := tt.setupRequest()
-			gotBuffer, err := copyRequest(req, tt.hookId, tt.path)
+			gotBuffer, gotBody, err := copyRequest(req, tt.hookId, tt.path, tt.inlineBodySize)
 			if (err != nil) != tt.expectError {
 				t.Errorf("copyRequest() error = %v, expectError %v", err, tt.expectError)
 				return
@@ -85,6 +126,65 @@ func TestCopyRequest(t *testing.T) {
 			if tt.checkHeaders != nil {
 				tt.checkHeaders(t, gotReq)
 			}
+			if tt.wantStreamedBody == "" {
+				if gotBody != nil {
+					t.Errorf("Expected body to be inlined, got a streamed body")
+				}
+				return
+			}
+			if gotBody == nil {
+				t.Fatalf("Expected a streamed body, got nil")
+			}
+			streamed, err := io.ReadAll(gotBody)
+			if err != nil {
+				t.Fatalf("Failed to read streamed body: %v", err)
+			}
+			if string(streamed) != tt.wantStreamedBody {
+				t.Errorf("Expected streamed body %s, got %s", tt.wantStreamedBody, string(streamed))
+			}
 		})
 	}
 }
+
+func TestEndPointBody(t *testing.T) {
+	// 关闭前正常读取
+	body := newEndPointBody(context.Background(), strings.NewReader("hello"))
+	buf := make([]byte, 5)
+	n, err := body.Read(buf)
+	if err != nil || string(buf[:n]) != "hello" {
+		t.Fatalf("Expected to read 'hello', got '%s', %v", buf[:n], err)
+	}
+
+	// 关闭时没有进行中的读取，无需打断
+	body.close(func() { t.Error("Expected no interrupt without a pending read") })
+	if _, err := body.Read(buf); err != errEndPointBodyClosed {
+		t.Errorf("Expected errEndPointBodyClosed after close, got %v", err)
+	}
+
+	// 进行中的读取被打断后 close 才返回
+	reader, writer := io.Pipe()
+	body = newEndPointBody(context.Background(), reader)
+	reading := make(chan error)
+	go func() {
+		_, err := body.Read(buf)
+		reading <- err
+	}()
+	for body.mu.TryLock() {
+		body.mu.Unlock()
+	}
+	body.close(func() { writer.CloseWithError(io.ErrClosedPipe) })
+	if err := <-reading; err != io.ErrClosedPipe {
+		t.Errorf("Expected the pending read to be interrupted, got %v", err)
+	}
+	if _, err := body.Read(buf); err != errEndPointBodyClosed {
+		t.Errorf("Expected errEndPointBodyClosed after close, got %v", err)
+	}
+
+	// 请求取消后不再读取
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	body = newEndPointBody(ctx, strings.NewReader("hello"))
+	if _, err := body.Read(buf); err != context.Canceled {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+}
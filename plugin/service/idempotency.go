@@ -0,0 +1,93 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/cache"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+const (
+	// responses are replayed for the same key within this period
+	idempotencyKeyExpire = 24 * time.Hour
+	// a request holding the key longer than this is considered lost
+	idempotencyKeyPendingExpire = 5 * time.Minute
+)
+
+// idempotencyRecord is stored under the key, the response is kept as json since
+// the data of a response doesn't survive a cbor round trip
+type idempotencyRecord struct {
+	Fingerprint string `cbor:"fingerprint"`
+	// empty while the first request is running
+	Response string `cbor:"response"`
+}
+
+// IdempotencyFingerprint hashes the request a key is used with
+func IdempotencyFingerprint(request any) string {
+	sum := sha256.Sum256(utils.MarshalJsonBytes(request))
+	return hex.EncodeToString(sum[:])
+}
+
+// WithIdempotencyKey runs fn once per key of a tenant and scope, requests with the same
+// key get the response of the first one, failed responses are discarded so that the
+// request can be retried with the same key.
+// A key is bound to the fingerprint of the first request, reusing it for another
+// request is a conflict rather than a replay of an unrelated response
+func WithIdempotencyKey(
+	tenantId string,
+	scope string,
+	key string,
+	fingerprint string,
+	fn func() *entities.Response,
+) *entities.Response {
+	if key == "" {
+		return fn()
+	}
+
+	cacheKey := cache.IdempotencyKey(tenantId, scope, key)
+	acquired, err := cache.SetNX(cacheKey, idempotencyRecord{Fingerprint: fingerprint}, idempotencyKeyPendingExpire)
+	if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	if !acquired {
+		record, err := cache.Get[idempotencyRecord](cacheKey)
+		if err == cache.ErrNotFound {
+			return entities.BadRequestError(errors.New("idempotency key expired, please retry")).ToResponse()
+		}
+		if err != nil {
+			return entities.InternalError(err).ToResponse()
+		}
+		if record.Fingerprint != fingerprint {
+			return entities.ConflictError(errors.New("idempotency key has been used with a different request")).ToResponse()
+		}
+		if record.Response == "" {
+			return entities.ConflictError(errors.New("a request with the same idempotency key is in progress")).ToResponse()
+		}
+
+		response, err := utils.UnmarshalJson[entities.Response](record.Response)
+		if err != nil {
+			return entities.InternalError(err).ToResponse()
+		}
+		return &response
+	}
+
+	response := fn()
+	if response.Code == 0 {
+		err = cache.Store(cacheKey, idempotencyRecord{
+			Fingerprint: fingerprint,
+			Response:    utils.MarshalJson(response),
+		}, idempotencyKeyExpire)
+	} else {
+		_, err = cache.Del(cacheKey)
+	}
+	if err != nil {
+		utils.Warn("failed to save idempotency key: %s", err.Error())
+	}
+
+	return response
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jjgagacy/workflow-app/plugin/cache"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithIdempotencyKey(t *testing.T) {
+	if err := cache.InitRedisClient("127.0.0.1:6379", "", "", false, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	type request struct {
+		PluginUniqueIdentifier string `json:"plugin_unique_identifier"`
+	}
+	v1 := IdempotencyFingerprint(request{PluginUniqueIdentifier: "author/plugin:0.0.1@a"})
+	v2 := IdempotencyFingerprint(request{PluginUniqueIdentifier: "author/plugin:0.0.2@b"})
+
+	tests := []struct {
+		name        string
+		fingerprint string
+		result      *entities.Response
+		wantCode    int
+		wantData    any
+		wantCalls   int
+	}{
+		{name: "首次请求执行", fingerprint: v1, result: entities.NewSuccessResponse("task-1"), wantData: "task-1", wantCalls: 1},
+		{name: "相同请求重放首次结果", fingerprint: v1, result: entities.NewSuccessResponse("task-2"), wantData: "task-1", wantCalls: 1},
+		{name: "不同请求复用同一个键", fingerprint: v2, result: entities.NewSuccessResponse("task-3"), wantCode: entities.ErrConflictCode, wantCalls: 1},
+	}
+
+	tenantId := uuid.New().String()
+	calls := 0
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := WithIdempotencyKey(tenantId, "/install", "key", tt.fingerprint, func() *entities.Response {
+				calls++
+				return tt.result
+			})
+			require.Equal(t, tt.wantCode, response.Code)
+			if tt.wantData != nil {
+				assert.Equal(t, tt.wantData, response.Data)
+			}
+			assert.Equal(t, tt.wantCalls, calls)
+		})
+	}
+
+	// 失败的结果不保存，同一个键可以重试
+	failed := WithIdempotencyKey(tenantId, "/install", "failed", v1, func() *entities.Response {
+		return entities.BadRequestError(assert.AnError).ToResponse()
+	})
+	assert.Equal(t, entities.ErrBadRequestCode, failed.Code)
+	retried := WithIdempotencyKey(tenantId, "/install", "failed", v2, func() *entities.Response {
+		return entities.NewSuccessResponse("task-4")
+	})
+	assert.Equal(t, "task-4", retried.Data)
+
+	// 没有键时总是执行
+	WithIdempotencyKey(tenantId, "/install", "", v1, func() *entities.Response {
+		calls++
+		return entities.NewSuccessResponse(nil)
+	})
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotencyFingerprint(t *testing.T) {
+	type request struct {
+		Source string         `json:"source"`
+		Meta   map[string]any `json:"meta"`
+	}
+
+	a := IdempotencyFingerprint(request{Source: "marketplace", Meta: map[string]any{"a": 1, "b": 2}})
+	assert.Equal(t, a, IdempotencyFingerprint(request{Source: "marketplace", Meta: map[string]any{"b": 2, "a": 1}}))
+	assert.NotEqual(t, a, IdempotencyFingerprint(request{Source: "github", Meta: map[string]any{"a": 1, "b": 2}}))
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/core/db"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager"
+	"github.com/jjgagacy/workflow-app/plugin/model"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/types"
+)
+
+type RollbackPluginResponse struct {
+	InstallPluginResponse
+	// the identifier the installation is rolled back to
+	PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `json:"plugin_unique_identifier"`
+}
+
+// previousPluginUniqueIdentifier returns the identifier which current was upgraded from,
+// histories MUST be ordered from newest to oldest.
+// Rollbacks are skipped so that repeated rollbacks walk back through the upgrades one by one,
+// and records before the latest install belong to a former installation and are ignored.
+func previousPluginUniqueIdentifier(
+	histories []model.PluginInstallationHistory,
+	current string,
+) (string, bool) {
+	for _, history := range histories {
+		switch history.Action {
+		case model.PluginInstallationHistoryActionInstall:
+			return "", false
+		case model.PluginInstallationHistoryActionUpgrade:
+			if history.PluginUniqueIdentifier == current && history.OriginalPluginUniqueIdentifier != "" {
+				return history.OriginalPluginUniqueIdentifier, true
+			}
+		}
+	}
+	return "", false
+}
+
+// pluginUniqueIdentifierSource returns the source the identifier was installed from by the
+// latest installation, histories MUST be ordered from newest to oldest
+func pluginUniqueIdentifierSource(
+	histories []model.PluginInstallationHistory,
+	pluginUniqueIdentifier string,
+) (string, bool) {
+	for _, history := range histories {
+		if history.PluginUniqueIdentifier == pluginUniqueIdentifier && history.Source != "" {
+			return history.Source, true
+		}
+		if history.Action == model.PluginInstallationHistoryActionInstall {
+			break
+		}
+	}
+	return "", false
+}
+
+// RollbackPlugin restores the identifier an installation was upgraded from
+func RollbackPlugin(
+	config *core.Config,
+	tenantId string,
+	pluginInstallationId string,
+	actor string,
+) *entities.Response {
+	installation, err := db.GetOne[model.PluginInstallation](
+		db.Equal("tenant_id", tenantId),
+		db.Equal("id", pluginInstallationId),
+	)
+	if err == types.ErrRecordNotFound {
+		return entities.PluginNotFoundError(errors.New("plugin installation not found for this tenant")).ToResponse()
+	}
+	if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	histories, err := db.GetAll[model.PluginInstallationHistory](
+		db.Equal("tenant_id", tenantId),
+		db.Equal("plugin_id", installation.PluginID),
+		db.OrderBy("created_at", true),
+	)
+	if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	previous, ok := previousPluginUniqueIdentifier(histories, installation.PluginUniqueIdentifier)
+	if !ok {
+		return entities.BadRequestError(errors.New("no previous version to roll back to")).ToResponse()
+	}
+
+	// the previous version keeps the source it was installed from, installations made
+	// before histories were recorded fall back to the current one
+	source, ok := pluginUniqueIdentifierSource(histories, previous)
+	if !ok {
+		source = installation.Source
+	}
+
+	currentPluginUniqueIdentifier, err := plugin_entities.NewPluginUniqueIdentifier(installation.PluginUniqueIdentifier)
+	if err != nil {
+		return entities.UniqueIdentifierInvalidError(err).ToResponse()
+	}
+	previousPluginUniqueIdentifier, err := plugin_entities.NewPluginUniqueIdentifier(previous)
+	if err != nil {
+		return entities.UniqueIdentifierInvalidError(err).ToResponse()
+	}
+
+	// packages are kept in the package bucket after upgrades, the runtime is
+	// reinstalled from it if no tenant is using the previous version anymore
+	if installation.RuntimeType == string(plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL) {
+		if _, err := plugin_manager.Manager().GetPackage(previousPluginUniqueIdentifier); err != nil {
+			return entities.BadRequestError(errors.Join(err, errors.New("package of the previous version not found"))).ToResponse()
+		}
+	}
+
+	response, err := switchPluginInstallation(
+		config,
+		tenantId,
+		model.TaskInstallActionRollback,
+		&installation,
+		source,
+		installation.Meta,
+		currentPluginUniqueIdentifier,
+		previousPluginUniqueIdentifier,
+		actor,
+	)
+	if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(RollbackPluginResponse{
+		InstallPluginResponse:  *response,
+		PluginUniqueIdentifier: previousPluginUniqueIdentifier,
+	})
+}
+
+func ListPluginInstallationHistories(
+	tenantId string,
+	pluginId string,
+	page int,
+	pageSize int,
+) *entities.Response {
+	histories, err := db.GetAll[model.PluginInstallationHistory](
+		db.Equal("tenant_id", tenantId),
+		db.Equal("plugin_id", pluginId),
+		db.OrderBy("created_at", true),
+		db.Page(page, pageSize),
+	)
+	if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(histories)
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviousPluginUniqueIdentifier(t *testing.T) {
+	const (
+		v1 = "author/plugin:0.0.1@a"
+		v2 = "author/plugin:0.0.2@b"
+		v3 = "author/plugin:0.0.3@c"
+	)
+
+	history := func(action model.PluginInstallationHistoryAction, original, current string) model.PluginInstallationHistory {
+		return model.PluginInstallationHistory{
+			Action:                         action,
+			OriginalPluginUniqueIdentifier: original,
+			PluginUniqueIdentifier:         current,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		histories []model.PluginInstallationHistory // newest first
+		current   string
+		want      string
+		wantOK    bool
+	}{
+		{
+			name: "仅安装，无法回滚",
+			histories: []model.PluginInstallationHistory{
+				history(model.PluginInstallationHistoryActionInstall, "", v1),
+			},
+			current: v1,
+		},
+		{
+			name: "升级后回滚到上一版本",
+			histories: []model.PluginInstallationHistory{
+				history(model.PluginInstallationHistoryActionUpgrade, v1, v2),
+				history(model.PluginInstallationHistoryActionInstall, "", v1),
+			},
+			current: v2,
+			want:    v1,
+			wantOK:  true,
+		},
+		{
+			name: "连续回滚逐级回退",
+			histories: []model.PluginInstallationHistory{
+				history(model.PluginInstallationHistoryActionRollback, v3, v2),
+				history(model.PluginInstallationHistoryActionUpgrade, v2, v3),
+				history(model.PluginInstallationHistoryActionUpgrade, v1, v2),
+				history(model.PluginInstallationHistoryActionInstall, "", v1),
+			},
+			current: v2,
+			want:    v1,
+			wantOK:  true,
+		},
+		{
+			name: "回滚到最初版本后无法继续回滚",
+			histories: []model.PluginInstallationHistory{
+				history(model.PluginInstallationHistoryActionRollback, v2, v1),
+				history(model.PluginInstallationHistoryActionUpgrade, v1, v2),
+				history(model.PluginInstallationHistoryActionInstall, "", v1),
+			},
+			current: v1,
+		},
+		{
+			name: "忽略卸载前的安装记录",
+			histories: []model.PluginInstallationHistory{
+				history(model.PluginInstallationHistoryActionInstall, "", v2),
+				history(model.PluginInstallationHistoryActionUninstall, v2, ""),
+				history(model.PluginInstallationHistoryActionUpgrade, v1, v2),
+				history(model.PluginInstallationHistoryActionInstall, "", v1),
+			},
+			current: v2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := previousPluginUniqueIdentifier(tt.histories, tt.current)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPluginUniqueIdentifierSource(t *testing.T) {
+	const (
+		v0 = "author/plugin:0.0.0@z"
+		v1 = "author/plugin:0.0.1@a"
+		v2 = "author/plugin:0.0.2@b"
+		v3 = "author/plugin:0.0.3@c"
+	)
+
+	history := func(action model.PluginInstallationHistoryAction, original, current, source string) model.PluginInstallationHistory {
+		return model.PluginInstallationHistory{
+			Action:                         action,
+			OriginalPluginUniqueIdentifier: original,
+			PluginUniqueIdentifier:         current,
+			Source:                         source,
+		}
+	}
+
+	// 上传安装后从 git 升级，再从市场升级
+	histories := []model.PluginInstallationHistory{
+		history(model.PluginInstallationHistoryActionUpgrade, v2, v3, "marketplace"),
+		history(model.PluginInstallationHistoryActionUpgrade, v1, v2, "git"),
+		history(model.PluginInstallationHistoryActionInstall, "", v1, "package"),
+		history(model.PluginInstallationHistoryActionUninstall, v3, "", ""),
+		history(model.PluginInstallationHistoryActionInstall, "", v0, "github"),
+	}
+
+	tests := []struct {
+		name       string
+		identifier string
+		want       string
+		wantOK     bool
+	}{
+		{name: "升级得到的版本", identifier: v2, want: "git", wantOK: true},
+		{name: "安装得到的版本", identifier: v1, want: "package", wantOK: true},
+		{name: "忽略卸载前的记录", identifier: v0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := pluginUniqueIdentifierSource(histories, tt.identifier)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/jjgagacy/workflow-app/plugin/cache"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager/mcp_runtime"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/types"
+)
+
+const MCP_INSTALL_SOURCE = "mcp"
+
+type MCPServer struct {
+	PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `json:"plugin_unique_identifier"`
+	Declaration            *plugin_entities.PluginDeclaration     `json:"declaration"`
+	State                  plugin_entities.PluginRuntimeState     `json:"state"`
+}
+
+// ListMCPServers lists the mcp servers configured on the daemon, tenants install them
+// by their unique identifier
+func ListMCPServers() *entities.Response {
+	manager := plugin_manager.Manager()
+	if manager == nil {
+		return entities.InternalError(errors.New("failed to get plugin manager")).ToResponse()
+	}
+
+	servers := []MCPServer{}
+	for _, runtime := range manager.MCPServers() {
+		identity, _ := runtime.Identity()
+		servers = append(servers, MCPServer{
+			PluginUniqueIdentifier: identity,
+			Declaration:            runtime.Configuration(),
+			State:                  runtime.RuntimeState(),
+		})
+	}
+	return entities.NewSuccessResponse(servers)
+}
+
+// InstallMCPServer installs the tool provider of a mcp server for the tenant, the
+// server must have been connected once so that its tools are known
+func InstallMCPServer(
+	tenantId string,
+	pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	meta map[string]any,
+	actor string,
+) *entities.Response {
+	manager := plugin_manager.Manager()
+	if manager == nil {
+		return entities.InternalError(errors.New("failed to get plugin manager")).ToResponse()
+	}
+
+	var server *mcp_runtime.MCPPluginRuntime
+	for _, runtime := range manager.MCPServers() {
+		if identity, _ := runtime.Identity(); identity == pluginUniqueIdentifier {
+			server = runtime
+			break
+		}
+	}
+	if server == nil {
+		return entities.PluginNotFoundError(errors.New("mcp server not found")).ToResponse()
+	}
+
+	declaration, err := cache.CombinedGetPluginDeclaration(
+		pluginUniqueIdentifier,
+		plugin_entities.PLUGIN_RUNTIME_TYPE_MCP,
+	)
+	if errors.Is(err, types.ErrPluginNotFound) {
+		return entities.BadRequestError(errors.New("mcp server has never been connected")).ToResponse()
+	}
+	if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	if meta == nil {
+		meta = map[string]any{}
+	}
+	_, installation, err := AtomicInstallPlugin(
+		tenantId,
+		pluginUniqueIdentifier,
+		plugin_entities.PLUGIN_RUNTIME_TYPE_MCP,
+		declaration,
+		MCP_INSTALL_SOURCE,
+		meta,
+		actor,
+	)
+	if err != nil {
+		if errors.Is(err, types.ErrPluginAlreadyExists) {
+			return entities.BadRequestError(err).ToResponse()
+		}
+		return entities.InternalError(err).ToResponse()
+	}
+	return entities.NewSuccessResponse(installation)
+}
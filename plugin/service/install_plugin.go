@@ -3,7 +3,6 @@ package service
 import (
 	"errors"
 	"fmt"
-	"time"
 
 	"github.com/jjgagacy/workflow-app/plugin/cache"
 	"github.com/jjgagacy/workflow-app/plugin/core"
@@ -14,7 +13,6 @@ import (
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
 	"github.com/jjgagacy/workflow-app/plugin/types"
-	"github.com/jjgagacy/workflow-app/plugin/utils"
 	"gorm.io/gorm"
 )
 
@@ -35,38 +33,17 @@ func InstallPluginFromIdentifier(
 	pluginUniqueIdentifiers []plugin_entities.PluginUniqueIdentifier,
 	source string,
 	metas []map[string]any,
+	actor string,
 ) *entities.Response {
 	response, err := InstallPluginRuntimeToTenant(
 		config,
 		tenantId,
 		pluginUniqueIdentifiers,
-		source,
 		metas,
-		func(
-			pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
-			declaration *plugin_entities.PluginDeclaration,
-			meta map[string]any,
-		) error {
-			runtimeType := plugin_entities.PluginRuntimeType("")
-
-			switch config.Platform {
-			case core.PLATFORM_SERVERLESS:
-				runtimeType = plugin_entities.PLUGIN_RUNTIME_TYPE_SERVERLESS
-			case core.PLATFORM_LOCAL:
-				runtimeType = plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL
-			default:
-				return fmt.Errorf("unsupported platform: %s", config.Platform)
-			}
-
-			_, _, err := AtomicInstallPlugin(
-				tenantId,
-				pluginUniqueIdentifier,
-				runtimeType,
-				declaration,
-				source,
-				meta,
-			)
-			return err
+		model.TaskInstallOperation{
+			Action: model.TaskInstallActionInstall,
+			Source: source,
+			Actor:  actor,
 		},
 	)
 
@@ -80,13 +57,15 @@ func InstallPluginFromIdentifier(
 	return entities.NewSuccessResponse(response)
 }
 
+// InstallPluginRuntimeToTenant installs the runtimes of the plugins and applies the
+// operation to the tenant once they're ready, plugins whose runtimes are installed
+// already are applied right away, the others through an installation task
 func InstallPluginRuntimeToTenant(
 	config *core.Config,
 	tenantId string,
 	pluginUniqueIdentifiers []plugin_entities.PluginUniqueIdentifier,
-	source string,
 	metas []map[string]any,
-	done InstallPluginDoneHandler,
+	operation model.TaskInstallOperation,
 ) (*InstallPluginResponse, error) {
 	response := &InstallPluginResponse{}
 	pluginWaitingInstallations := []plugin_entities.PluginUniqueIdentifier{}
@@ -100,6 +79,10 @@ func InstallPluginRuntimeToTenant(
 	default:
 		return nil, fmt.Errorf("unsupported platform: %s", config.Platform)
 	}
+	if operation.RuntimeType == "" {
+		operation.RuntimeType = string(runtimeType)
+	}
+	done := pluginInstallDoneHandler(tenantId, operation)
 
 	task := &model.TaskInstallation{
 		Status:           model.TaskInstallStatusRunning,
@@ -107,6 +90,7 @@ func InstallPluginRuntimeToTenant(
 		TotalPlugins:     len(pluginUniqueIdentifiers),
 		CompletedPlugins: 0,
 		Plugins:          []model.TaskPluginInstallStatus{},
+		Operation:        operation,
 	}
 
 	for i, pluginUniqueIdentifier := range pluginUniqueIdentifiers {
@@ -132,6 +116,7 @@ func InstallPluginRuntimeToTenant(
 			IconDark:               pluginDeclaration.IconSmallDark,
 			Label:                  pluginDeclaration.Label,
 			Message:                "",
+			Meta:                   metas[i],
 		})
 
 		if err == nil {
@@ -165,156 +150,8 @@ func InstallPluginRuntimeToTenant(
 	}
 
 	response.TaskID = task.ID
-	manager := plugin_manager.Manager()
-
-	tasks := []func(){}
-	for i, pluginUniqueIdentifier := range pluginWaitingInstallations {
-		// copy the variable to avoid race condition
-		pluginUniqueIdentifier := pluginUniqueIdentifier
-
-		declaration, err := cache.CombinedGetPluginDeclaration(
-			pluginUniqueIdentifier,
-			runtimeType,
-		)
-
-		if err != nil {
-			return nil, err
-		}
-
-		i := i
-		tasks = append(tasks, func() {
-			updateTaskStatus := func(modifier func(taskInstallation *model.TaskInstallation, pluginInstallation *model.TaskPluginInstallStatus)) {
-				if err := db.WithTransaction(func(tx *gorm.DB) error {
-					task, err := db.GetOne[model.TaskInstallation](
-						db.WithTransactionContext(tx),
-						db.Equal("id", task.ID),
-						db.WLock(), // write lock, multiple tasks can't update the same task
-					)
-					if err == types.ErrRecordNotFound {
-						return nil
-					}
-
-					if err != nil {
-						return err
-					}
-
-					updateTask := &task
-					var pluginStatus *model.TaskPluginInstallStatus
-					for i := range task.Plugins {
-						if task.Plugins[i].PluginUniqueIdentifier == pluginUniqueIdentifier {
-							pluginStatus = &task.Plugins[i]
-							break
-						}
-					}
-
-					if pluginStatus == nil {
-						return nil
-					}
-
-					modifier(updateTask, pluginStatus)
-
-					suc := 0
-					for _, plugin := range updateTask.Plugins {
-						if plugin.Status == model.TaskInstallStatusSuccess {
-							suc++
-						}
-					}
-
-					if suc == len(updateTask.Plugins) {
-						// update status
-						updateTask.Status = model.TaskInstallStatusSuccess
-						// delete the task
-						time.AfterFunc(120*time.Second, func() {
-							db.Delete(updateTask)
-						})
-					}
-
-					return db.Update(updateTask, tx)
-				}); err != nil {
-					utils.Error("failed to update TaskInstallStatus %s", err.Error())
-					return
-				}
-			}
-
-			// Update installing
-			updateTaskStatus(func(task *model.TaskInstallation, plugin *model.TaskPluginInstallStatus) {
-				plugin.Status = model.TaskInstallStatusRunning
-				plugin.Message = "Installing"
-			})
-
-			// Update from stream
-			var stream *utils.Stream[plugin_manager.PluginInstallResponse]
-			switch config.Platform {
-			case core.PLATFORM_SERVERLESS:
-				// todo: isntall serverless
-				return
-			case core.PLATFORM_LOCAL:
-				// install local plugin
-				stream, err = manager.InstallLocal(pluginUniqueIdentifier)
-			default:
-				updateTaskStatus(func(task *model.TaskInstallation, plugin *model.TaskPluginInstallStatus) {
-					task.Status = model.TaskInstallStatusFailed
-					plugin.Status = model.TaskInstallStatusFailed
-					plugin.Message = "Unsupported platform"
-				})
-				return
-			}
-
-			if err != nil {
-				updateTaskStatus(func(task *model.TaskInstallation, plugin *model.TaskPluginInstallStatus) {
-					task.Status = model.TaskInstallStatusFailed
-					plugin.Status = model.TaskInstallStatusFailed
-					plugin.Message = err.Error()
-				})
-				return
-			}
-
-			for stream.Next() {
-				message, err := stream.Read()
-				if err != nil {
-					updateTaskStatus(func(task *model.TaskInstallation, plugin *model.TaskPluginInstallStatus) {
-						task.Status = model.TaskInstallStatusFailed
-						plugin.Status = model.TaskInstallStatusFailed
-						plugin.Message = err.Error()
-					})
-					return
-				}
-
-				if message.Event == plugin_manager.PluginInstallEventError {
-					updateTaskStatus(func(task *model.TaskInstallation, plugin *model.TaskPluginInstallStatus) {
-						task.Status = model.TaskInstallStatusFailed
-						plugin.Status = model.TaskInstallStatusFailed
-						plugin.Message = message.Data
-					})
-					return
-				}
-
-				if message.Event == plugin_manager.PluginInstallEventDone {
-					if err := done(pluginUniqueIdentifier, declaration, metas[i]); err != nil {
-						updateTaskStatus(func(task *model.TaskInstallation, plugin *model.TaskPluginInstallStatus) {
-							task.Status = model.TaskInstallStatusFailed
-							plugin.Status = model.TaskInstallStatusFailed
-							plugin.Message = "Failed to create plugin, perhaps it's already installed"
-						})
-						return
-					}
-				}
-			}
-
-			updateTaskStatus(func(task *model.TaskInstallation, plugin *model.TaskPluginInstallStatus) {
-				plugin.Status = model.TaskInstallStatusSuccess
-				plugin.Message = "Installed"
-				task.CompletedPlugins++
-
-				if task.CompletedPlugins == task.TotalPlugins {
-					task.Status = model.TaskInstallStatusSuccess
-				}
-			})
-		})
-	}
 
-	// submit async tasks
-	utils.WithMaxRoutine(5, tasks)
+	newPluginInstallTask(config, task).run(pluginWaitingInstallations)
 
 	return response, nil
 }
@@ -326,6 +163,7 @@ func UpgradePlugin(
 	meta map[string]any,
 	originalPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
 	newPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	actor string,
 ) *entities.Response {
 	if originalPluginUniqueIdentifier == newPluginUniqueIdentifier {
 		return entities.BadRequestError(errors.New("original and new plugin unique identifier are the same")).ToResponse()
@@ -335,10 +173,11 @@ func UpgradePlugin(
 		return entities.BadRequestError(errors.New("original and new plugin id are different")).ToResponse()
 	}
 
+	// the new version may come from another source than the installed one, e.g. a
+	// marketplace upgrade of a package which was uploaded
 	installation, err := db.GetOne[model.PluginInstallation](
 		db.Equal("tenant_id", tenantId),
 		db.Equal("plugin_unique_identifier", originalPluginUniqueIdentifier.String()),
-		db.Equal("source", source),
 	)
 
 	if err == types.ErrRecordNotFound {
@@ -349,53 +188,114 @@ func UpgradePlugin(
 		return entities.InternalError(err).ToResponse()
 	}
 
-	response, err := InstallPluginRuntimeToTenant(
+	response, err := switchPluginInstallation(
 		config,
 		tenantId,
-		[]plugin_entities.PluginUniqueIdentifier{newPluginUniqueIdentifier},
+		model.TaskInstallActionUpgrade,
+		&installation,
 		source,
+		meta,
+		originalPluginUniqueIdentifier,
+		newPluginUniqueIdentifier,
+		actor,
+	)
+
+	if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(response)
+}
+
+// switchPluginInstallation installs the runtime of the new identifier and switches the
+// installation to it once it's ready, the action is either an upgrade or a rollback.
+// source is where the new identifier comes from, not the one of the installation
+func switchPluginInstallation(
+	config *core.Config,
+	tenantId string,
+	action model.TaskInstallAction,
+	installation *model.PluginInstallation,
+	source string,
+	meta map[string]any,
+	originalPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	newPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	actor string,
+) (*InstallPluginResponse, error) {
+	return InstallPluginRuntimeToTenant(
+		config,
+		tenantId,
+		[]plugin_entities.PluginUniqueIdentifier{newPluginUniqueIdentifier},
 		[]map[string]any{meta},
-		func(
+		model.TaskInstallOperation{
+			Action:                         action,
+			Source:                         source,
+			Actor:                          actor,
+			RuntimeType:                    installation.RuntimeType,
+			OriginalPluginUniqueIdentifier: originalPluginUniqueIdentifier.String(),
+		},
+	)
+}
+
+// pluginInstallDoneHandler returns what is done with a plugin once its runtime is
+// installed, it only depends on the operation so that it can be rebuilt from a task
+func pluginInstallDoneHandler(tenantId string, operation model.TaskInstallOperation) InstallPluginDoneHandler {
+	runtimeType := plugin_entities.PluginRuntimeType(operation.RuntimeType)
+
+	switch operation.Action {
+	case model.TaskInstallActionInstall:
+		return func(
 			pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
 			declaration *plugin_entities.PluginDeclaration,
 			meta map[string]any,
 		) error {
-			originalDeclaration, err := cache.CombinedGetPluginDeclaration(
-				originalPluginUniqueIdentifier,
-				plugin_entities.PluginRuntimeType(installation.RuntimeType),
-			)
-			if err != nil {
-				return err
-			}
-
-			newDeclaration, err := cache.CombinedGetPluginDeclaration(
-				newPluginUniqueIdentifier,
-				plugin_entities.PluginRuntimeType(installation.RuntimeType),
+			_, _, err := AtomicInstallPlugin(
+				tenantId,
+				pluginUniqueIdentifier,
+				runtimeType,
+				declaration,
+				operation.Source,
+				meta,
+				operation.Actor,
 			)
+			return err
+		}
+	case model.TaskInstallActionUpgrade, model.TaskInstallActionRollback:
+		atomicSwitch := AtomicUpgradePlugin
+		if operation.Action == model.TaskInstallActionRollback {
+			atomicSwitch = AtomicRollbackPlugin
+		}
+		return func(
+			pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+			declaration *plugin_entities.PluginDeclaration,
+			meta map[string]any,
+		) error {
+			originalPluginUniqueIdentifier := plugin_entities.PluginUniqueIdentifier(operation.OriginalPluginUniqueIdentifier)
+			originalDeclaration, err := cache.CombinedGetPluginDeclaration(originalPluginUniqueIdentifier, runtimeType)
 			if err != nil {
 				return err
 			}
 
 			// Uninstall the original plugin
-			upgradeResponse, err := AtomicUpgradePlugin(
+			switchResponse, err := atomicSwitch(
 				tenantId,
 				originalPluginUniqueIdentifier,
-				newPluginUniqueIdentifier,
+				pluginUniqueIdentifier,
 				originalDeclaration,
-				newDeclaration,
-				plugin_entities.PluginRuntimeType(installation.RuntimeType),
-				source,
+				declaration,
+				runtimeType,
+				operation.Source,
 				meta,
+				operation.Actor,
 			)
 			if err != nil {
 				return err
 			}
 
-			if upgradeResponse.OriginalPluginDeleted {
+			if switchResponse.OriginalPluginDeleted {
 				manager := plugin_manager.Manager()
-				if string(upgradeResponse.DeletedPlugin.InstallType) == string(plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL) {
+				if string(switchResponse.DeletedPlugin.InstallType) == string(plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL) {
 					err := manager.UninstallFromLocal(
-						plugin_entities.PluginUniqueIdentifier(upgradeResponse.DeletedPlugin.PluginUniqueIdentifier),
+						plugin_entities.PluginUniqueIdentifier(switchResponse.DeletedPlugin.PluginUniqueIdentifier),
 					)
 					if err != nil {
 						return err
@@ -403,14 +303,24 @@ func UpgradePlugin(
 				}
 			}
 			return nil
-		},
-	)
-
-	if err != nil {
-		return entities.InternalError(err).ToResponse()
+		}
+	case model.TaskInstallActionRollout:
+		return func(
+			pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+			declaration *plugin_entities.PluginDeclaration,
+			meta map[string]any,
+		) error {
+			return createPluginRollout(operation, pluginUniqueIdentifier)
+		}
 	}
 
-	return entities.NewSuccessResponse(response)
+	return func(
+		pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+		declaration *plugin_entities.PluginDeclaration,
+		meta map[string]any,
+	) error {
+		return fmt.Errorf("unsupported installation action: %s", operation.Action)
+	}
 }
 
 // Decode a plugin from a given identifier, this ensure that the plugin
@@ -463,6 +373,7 @@ func FetchPluginFromIdentifier(
 func UninstallPlugin(
 	tenantId string,
 	pluginInstallationId string,
+	actor string,
 ) *entities.Response {
 	installation, err := db.GetOne[model.PluginInstallation](
 		db.Equal("tenant_id", tenantId),
@@ -494,6 +405,7 @@ func UninstallPlugin(
 		pluginUniqueIdentifier,
 		installation.ID,
 		declaration,
+		actor,
 	)
 	if err != nil {
 		return entities.InternalError(fmt.Errorf("failed to uninstall plugin: %s", err.Error())).ToResponse()
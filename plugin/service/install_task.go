@@ -0,0 +1,395 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/cache"
+	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/core/db"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager"
+	"github.com/jjgagacy/workflow-app/plugin/model"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/types"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+	"gorm.io/gorm"
+)
+
+// pluginInstallTask runs the plugins of an installation task, it's rebuilt from the
+// persisted task whenever it runs so that the task can be retried through any replica
+type pluginInstallTask struct {
+	config      *core.Config
+	tenantId    string
+	taskId      string
+	runtimeType plugin_entities.PluginRuntimeType
+	done        InstallPluginDoneHandler
+	metas       map[plugin_entities.PluginUniqueIdentifier]map[string]any
+}
+
+func newPluginInstallTask(config *core.Config, task *model.TaskInstallation) *pluginInstallTask {
+	metas := map[plugin_entities.PluginUniqueIdentifier]map[string]any{}
+	for _, plugin := range task.Plugins {
+		metas[plugin.PluginUniqueIdentifier] = plugin.Meta
+	}
+
+	return &pluginInstallTask{
+		config:      config,
+		tenantId:    task.TenantID,
+		taskId:      task.ID,
+		runtimeType: plugin_entities.PluginRuntimeType(task.Operation.RuntimeType),
+		done:        pluginInstallDoneHandler(task.TenantID, task.Operation),
+		metas:       metas,
+	}
+}
+
+func (t *pluginInstallTask) run(pluginUniqueIdentifiers []plugin_entities.PluginUniqueIdentifier) {
+	tasks := []func(){}
+	for _, pluginUniqueIdentifier := range pluginUniqueIdentifiers {
+		// copy the variable to avoid race condition
+		pluginUniqueIdentifier := pluginUniqueIdentifier
+		tasks = append(tasks, func() {
+			t.install(pluginUniqueIdentifier)
+		})
+	}
+
+	// submit async tasks
+	utils.WithMaxRoutine(5, tasks)
+}
+
+// cancelled reports whether the task has been cancelled, the task may be cancelled
+// through any replica so it's always read from the database
+func (t *pluginInstallTask) cancelled() bool {
+	task, err := db.GetOne[model.TaskInstallation](
+		db.Equal("id", t.taskId),
+	)
+	if err == types.ErrRecordNotFound {
+		// deleted tasks are cancelled as well
+		return true
+	}
+	if err != nil {
+		utils.Error("failed to fetch TaskInstallation %s", err.Error())
+		return false
+	}
+	return task.Status == model.TaskInstallStatusCancelled
+}
+
+func (t *pluginInstallTask) updateStatus(
+	pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	modifier func(taskInstallation *model.TaskInstallation, pluginInstallation *model.TaskPluginInstallStatus),
+) {
+	var updated *model.TaskInstallation
+	if err := db.WithTransaction(func(tx *gorm.DB) error {
+		task, err := db.GetOne[model.TaskInstallation](
+			db.WithTransactionContext(tx),
+			db.Equal("id", t.taskId),
+			db.WLock(), // write lock, multiple tasks can't update the same task
+		)
+		if err == types.ErrRecordNotFound {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		// a cancelled task is never updated by the plugins still running
+		if task.Status == model.TaskInstallStatusCancelled {
+			return nil
+		}
+
+		updateTask := &task
+		var pluginStatus *model.TaskPluginInstallStatus
+		for i := range task.Plugins {
+			if task.Plugins[i].PluginUniqueIdentifier == pluginUniqueIdentifier {
+				pluginStatus = &task.Plugins[i]
+				break
+			}
+		}
+
+		if pluginStatus == nil {
+			return nil
+		}
+
+		modifier(updateTask, pluginStatus)
+
+		suc := 0
+		for _, plugin := range updateTask.Plugins {
+			if plugin.Status == model.TaskInstallStatusSuccess {
+				suc++
+			}
+		}
+
+		if suc == len(updateTask.Plugins) {
+			// update status
+			updateTask.Status = model.TaskInstallStatusSuccess
+			// delete the task
+			time.AfterFunc(120*time.Second, func() {
+				db.Delete(updateTask)
+			})
+		}
+
+		if err := db.Update(updateTask, tx); err != nil {
+			return err
+		}
+		updated = updateTask
+		return nil
+	}); err != nil {
+		utils.Error("failed to update TaskInstallStatus %s", err.Error())
+		return
+	}
+
+	if updated != nil {
+		publishPluginInstallationTaskEvent(PluginInstallationTaskEvent{
+			Event:                  PluginInstallationTaskEventStatus,
+			TaskID:                 updated.ID,
+			PluginUniqueIdentifier: pluginUniqueIdentifier,
+			Task:                   updated,
+		})
+	}
+}
+
+func (t *pluginInstallTask) fail(pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier, message string) {
+	t.updateStatus(pluginUniqueIdentifier, func(task *model.TaskInstallation, plugin *model.TaskPluginInstallStatus) {
+		task.Status = model.TaskInstallStatusFailed
+		plugin.Status = model.TaskInstallStatusFailed
+		plugin.Message = message
+	})
+}
+
+func (t *pluginInstallTask) install(pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier) {
+	// pending plugins are never launched once the task is cancelled
+	if t.cancelled() {
+		return
+	}
+
+	declaration, err := cache.CombinedGetPluginDeclaration(
+		pluginUniqueIdentifier,
+		t.runtimeType,
+	)
+	if err != nil {
+		t.fail(pluginUniqueIdentifier, err.Error())
+		return
+	}
+
+	// Update installing
+	t.updateStatus(pluginUniqueIdentifier, func(task *model.TaskInstallation, plugin *model.TaskPluginInstallStatus) {
+		plugin.Status = model.TaskInstallStatusRunning
+		plugin.Message = "Installing"
+	})
+
+	// Update from stream
+	var stream *utils.Stream[plugin_manager.PluginInstallResponse]
+	switch t.config.Platform {
+	case core.PLATFORM_SERVERLESS:
+		// todo: isntall serverless
+		return
+	case core.PLATFORM_LOCAL:
+		// install local plugin
+		stream, err = plugin_manager.Manager().InstallLocal(pluginUniqueIdentifier)
+	default:
+		t.fail(pluginUniqueIdentifier, "Unsupported platform")
+		return
+	}
+
+	if err != nil {
+		t.fail(pluginUniqueIdentifier, err.Error())
+		return
+	}
+
+	installed := false
+	lastStage := plugin_entities.PluginInstallStage("")
+	for stream.Next() {
+		message, err := stream.Read()
+		if err != nil {
+			t.fail(pluginUniqueIdentifier, err.Error())
+			return
+		}
+
+		if message.Event == plugin_manager.PluginInstallEventProgress {
+			publishPluginInstallationTaskEvent(PluginInstallationTaskEvent{
+				Event:                  PluginInstallationTaskEventProgress,
+				TaskID:                 t.taskId,
+				PluginUniqueIdentifier: pluginUniqueIdentifier,
+				Stage:                  message.Stage,
+				Message:                message.Data,
+			})
+
+			// the task only keeps the latest stage, not every line of it
+			if message.Stage != lastStage {
+				lastStage = message.Stage
+				t.updateStatus(pluginUniqueIdentifier, func(task *model.TaskInstallation, plugin *model.TaskPluginInstallStatus) {
+					plugin.Message = message.Data
+				})
+			}
+			continue
+		}
+
+		if message.Event == plugin_manager.PluginInstallEventError {
+			t.fail(pluginUniqueIdentifier, message.Data)
+			return
+		}
+
+		if message.Event == plugin_manager.PluginInstallEventDone {
+			// the runtime may have been launched right before the task is cancelled
+			if t.cancelled() {
+				return
+			}
+			if err := t.done(pluginUniqueIdentifier, declaration, t.metas[pluginUniqueIdentifier]); err != nil {
+				t.fail(pluginUniqueIdentifier, "Failed to create plugin, perhaps it's already installed")
+				return
+			}
+			installed = true
+		}
+	}
+
+	if !installed {
+		t.fail(pluginUniqueIdentifier, "Installation timeout")
+		return
+	}
+
+	t.updateStatus(pluginUniqueIdentifier, func(task *model.TaskInstallation, plugin *model.TaskPluginInstallStatus) {
+		plugin.Status = model.TaskInstallStatusSuccess
+		plugin.Message = "Installed"
+		task.CompletedPlugins++
+
+		if task.CompletedPlugins == task.TotalPlugins {
+			task.Status = model.TaskInstallStatusSuccess
+		}
+	})
+}
+
+// CancelPluginInstallationTask stops the plugins of the task which are not installed yet,
+// runtimes being launched are stopped and their working directories removed
+func CancelPluginInstallationTask(
+	tenantId string,
+	taskId string,
+) *entities.Response {
+	var cancelled *model.TaskInstallation
+	var interrupted []plugin_entities.PluginUniqueIdentifier
+	err := db.WithTransaction(func(tx *gorm.DB) error {
+		task, err := db.GetOne[model.TaskInstallation](
+			db.WithTransactionContext(tx),
+			db.Equal("id", taskId),
+			db.Equal("tenant_id", tenantId),
+			db.WLock(),
+		)
+		if err != nil {
+			return err
+		}
+
+		if task.Status != model.TaskInstallStatusRunning && task.Status != model.TaskInstallStatusPending {
+			return errors.New("only running tasks can be cancelled")
+		}
+
+		task.Status = model.TaskInstallStatusCancelled
+		for i := range task.Plugins {
+			plugin := &task.Plugins[i]
+			if plugin.Status == model.TaskInstallStatusSuccess || plugin.Status == model.TaskInstallStatusFailed {
+				continue
+			}
+			if plugin.Status == model.TaskInstallStatusRunning {
+				interrupted = append(interrupted, plugin.PluginUniqueIdentifier)
+			}
+			plugin.Status = model.TaskInstallStatusCancelled
+			plugin.Message = "Cancelled"
+		}
+
+		if err := db.Update(&task, tx); err != nil {
+			return err
+		}
+		cancelled = &task
+		return nil
+	})
+	if err == types.ErrRecordNotFound {
+		return entities.NotFoundError(errors.New("task not found")).ToResponse()
+	}
+	if err != nil {
+		return entities.BadRequestError(err).ToResponse()
+	}
+
+	publishPluginInstallationTaskEvent(PluginInstallationTaskEvent{
+		Event:  PluginInstallationTaskEventStatus,
+		TaskID: cancelled.ID,
+		Task:   cancelled,
+	})
+
+	for _, pluginUniqueIdentifier := range interrupted {
+		// the runtime is shared once any tenant has installed the plugin
+		if _, err := db.GetOne[model.Plugin](
+			db.Equal("plugin_unique_identifier", pluginUniqueIdentifier.String()),
+		); err != types.ErrRecordNotFound {
+			continue
+		}
+
+		// runtimes launched by other replicas are stopped by their watchers
+		// once the plugin is removed from the installed bucket
+		if err := plugin_manager.Manager().CancelInstallLocal(pluginUniqueIdentifier); err != nil {
+			utils.Error("failed to cancel installation of %s: %s", pluginUniqueIdentifier, err.Error())
+		}
+	}
+
+	return entities.NewSuccessResponse(cancelled)
+}
+
+// RetryPluginInstallationTask installs the failed plugins of the task again
+func RetryPluginInstallationTask(
+	config *core.Config,
+	tenantId string,
+	taskId string,
+) *entities.Response {
+	var retried *model.TaskInstallation
+	var failed []plugin_entities.PluginUniqueIdentifier
+	err := db.WithTransaction(func(tx *gorm.DB) error {
+		task, err := db.GetOne[model.TaskInstallation](
+			db.WithTransactionContext(tx),
+			db.Equal("id", taskId),
+			db.Equal("tenant_id", tenantId),
+			db.WLock(),
+		)
+		if err != nil {
+			return err
+		}
+
+		// tasks created before operations were recorded can't be rebuilt
+		if task.Operation.Action == "" {
+			return errors.New("task can't be retried anymore, please install the plugins again")
+		}
+
+		for i := range task.Plugins {
+			plugin := &task.Plugins[i]
+			if plugin.Status != model.TaskInstallStatusFailed {
+				continue
+			}
+			failed = append(failed, plugin.PluginUniqueIdentifier)
+			plugin.Status = model.TaskInstallStatusPending
+			plugin.Message = ""
+		}
+		if len(failed) == 0 {
+			return errors.New("no failed plugin to retry")
+		}
+
+		task.Status = model.TaskInstallStatusRunning
+		if err := db.Update(&task, tx); err != nil {
+			return err
+		}
+		retried = &task
+		return nil
+	})
+	if err == types.ErrRecordNotFound {
+		return entities.NotFoundError(errors.New("task not found")).ToResponse()
+	}
+	if err != nil {
+		return entities.BadRequestError(err).ToResponse()
+	}
+
+	publishPluginInstallationTaskEvent(PluginInstallationTaskEvent{
+		Event:  PluginInstallationTaskEventStatus,
+		TaskID: retried.ID,
+		Task:   retried,
+	})
+
+	newPluginInstallTask(config, retried).run(failed)
+
+	return entities.NewSuccessResponse(retried)
+}
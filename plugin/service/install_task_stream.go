@@ -0,0 +1,106 @@
+package service
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/cache"
+	"github.com/jjgagacy/workflow-app/plugin/core/db"
+	"github.com/jjgagacy/workflow-app/plugin/model"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+type PluginInstallationTaskEventType string
+
+const (
+	// the task as it is when the client subscribes
+	PluginInstallationTaskEventSnapshot PluginInstallationTaskEventType = "snapshot"
+	// progress of a plugin in the task, every line of the pip output is a progress
+	PluginInstallationTaskEventProgress PluginInstallationTaskEventType = "progress"
+	// the task has been updated
+	PluginInstallationTaskEventStatus PluginInstallationTaskEventType = "status"
+)
+
+type PluginInstallationTaskEvent struct {
+	Event                  PluginInstallationTaskEventType        `json:"event"`
+	TaskID                 string                                 `json:"task_id"`
+	PluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier `json:"plugin_unique_identifier,omitempty"`
+	Stage                  plugin_entities.PluginInstallStage     `json:"stage,omitempty"`
+	Message                string                                 `json:"message,omitempty"`
+	// set for snapshot and status events
+	Task *model.TaskInstallation `json:"task,omitempty"`
+}
+
+// publishPluginInstallationTaskEvent broadcasts the event to every replica,
+// events are dropped if there is no subscriber
+func publishPluginInstallationTaskEvent(event PluginInstallationTaskEvent) {
+	if err := cache.Publish(cache.PluginInstallationTaskChannel(event.TaskID), event); err != nil {
+		utils.Warn("failed to publish installation task event: %s", err.Error())
+	}
+}
+
+func isPluginInstallationTaskFinished(task *model.TaskInstallation) bool {
+	return task.Status == model.TaskInstallStatusSuccess ||
+		task.Status == model.TaskInstallStatusFailed ||
+		task.Status == model.TaskInstallStatusCancelled
+}
+
+// StreamPluginInstallationTask streams the progress of an installation task until it's finished
+func StreamPluginInstallationTask(
+	ctx *gin.Context,
+	tenantId string,
+	taskId string,
+	maxTimeout int,
+) {
+	baseSSEService(
+		func() (*utils.Stream[PluginInstallationTaskEvent], error) {
+			// subscribe before fetching the task, otherwise events between them are lost
+			events, unsubscribe := cache.Subscribe[PluginInstallationTaskEvent](
+				cache.PluginInstallationTaskChannel(taskId),
+			)
+			// the subscription blocks until its events are consumed, drain them all
+			forward := func(stream *utils.Stream[PluginInstallationTaskEvent]) {
+				for event := range events {
+					if stream == nil {
+						continue
+					}
+					stream.Write(event)
+					if event.Task != nil && isPluginInstallationTaskFinished(event.Task) {
+						stream.Close()
+					}
+				}
+			}
+
+			task, err := db.GetOne[model.TaskInstallation](
+				db.Equal("id", taskId),
+				db.Equal("tenant_id", tenantId),
+			)
+			if err != nil {
+				unsubscribe()
+				go forward(nil)
+				return nil, err
+			}
+
+			stream := utils.NewStream[PluginInstallationTaskEvent](512)
+			stream.OnClose(unsubscribe)
+			stream.Write(PluginInstallationTaskEvent{
+				Event:  PluginInstallationTaskEventSnapshot,
+				TaskID: task.ID,
+				Task:   &task,
+			})
+			if isPluginInstallationTaskFinished(&task) {
+				stream.Close()
+			}
+
+			utils.Submit(map[string]string{
+				"module":   "service",
+				"function": "StreamPluginInstallationTask",
+			}, func() {
+				forward(stream)
+			})
+
+			return stream, nil
+		},
+		ctx,
+		maxTimeout,
+	)
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/core/db"
+	"github.com/jjgagacy/workflow-app/plugin/model"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsPluginInstallationTaskFinished(t *testing.T) {
+	tests := []struct {
+		status model.TaskInstallStatus
+		want   bool
+	}{
+		{status: model.TaskInstallStatusPending},
+		{status: model.TaskInstallStatusRunning},
+		{status: model.TaskInstallStatusSuccess, want: true},
+		{status: model.TaskInstallStatusFailed, want: true},
+		// 取消后进度流同样结束
+		{status: model.TaskInstallStatusCancelled, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.status), func(t *testing.T) {
+			assert.Equal(t, tt.want, isPluginInstallationTaskFinished(&model.TaskInstallation{Status: tt.status}))
+		})
+	}
+}
+
+func TestPluginInstallDoneHandler(t *testing.T) {
+	const identifier plugin_entities.PluginUniqueIdentifier = "author/plugin:0.0.1@a"
+
+	// 未记录操作的任务无法重建
+	done := pluginInstallDoneHandler("tenant", model.TaskInstallOperation{})
+	assert.ErrorContains(t, done(identifier, nil, nil), "unsupported installation action")
+
+	// 灰度发布需要任务中保存的发布参数
+	done = pluginInstallDoneHandler("tenant", model.TaskInstallOperation{Action: model.TaskInstallActionRollout})
+	assert.Error(t, done(identifier, nil, nil))
+}
+
+// createInstallationTask 创建一个包含指定状态插件的安装任务
+func createInstallationTask(
+	t *testing.T,
+	status model.TaskInstallStatus,
+	operation model.TaskInstallOperation,
+	plugins map[plugin_entities.PluginUniqueIdentifier]model.TaskInstallStatus,
+) *model.TaskInstallation {
+	task := &model.TaskInstallation{
+		Status:       status,
+		TenantID:     uuid.New().String(),
+		TotalPlugins: len(plugins),
+		Operation:    operation,
+	}
+	for identifier, status := range plugins {
+		task.Plugins = append(task.Plugins, model.TaskPluginInstallStatus{
+			PluginUniqueIdentifier: identifier,
+			PluginID:               identifier.PluginID(),
+			Status:                 status,
+		})
+	}
+	require.NoError(t, db.Create(task))
+	t.Cleanup(func() { db.Delete(task) })
+	return task
+}
+
+func pluginStatuses(task *model.TaskInstallation) map[plugin_entities.PluginUniqueIdentifier]model.TaskInstallStatus {
+	statuses := map[plugin_entities.PluginUniqueIdentifier]model.TaskInstallStatus{}
+	for _, plugin := range task.Plugins {
+		statuses[plugin.PluginUniqueIdentifier] = plugin.Status
+	}
+	return statuses
+}
+
+func TestCancelPluginInstallationTask(t *testing.T) {
+	setUpTestDB()
+	defer db.Close()
+
+	const (
+		installed  plugin_entities.PluginUniqueIdentifier = "author/installed:0.0.1@a"
+		installing plugin_entities.PluginUniqueIdentifier = "author/installing:0.0.1@b"
+		pending    plugin_entities.PluginUniqueIdentifier = "author/pending:0.0.1@c"
+		failed     plugin_entities.PluginUniqueIdentifier = "author/failed:0.0.1@d"
+	)
+
+	// 其他租户已安装的运行时不会被停止
+	shared := &model.Plugin{
+		PluginID:               installing.PluginID(),
+		PluginUniqueIdentifier: installing.String(),
+		InstallType:            plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL,
+		Refers:                 1,
+	}
+	require.NoError(t, db.Create(shared))
+	defer db.Delete(shared)
+
+	plugins := map[plugin_entities.PluginUniqueIdentifier]model.TaskInstallStatus{
+		installed:  model.TaskInstallStatusSuccess,
+		installing: model.TaskInstallStatusRunning,
+		pending:    model.TaskInstallStatusPending,
+		failed:     model.TaskInstallStatusFailed,
+	}
+
+	tests := []struct {
+		name     string
+		status   model.TaskInstallStatus
+		wantCode int
+		want     map[plugin_entities.PluginUniqueIdentifier]model.TaskInstallStatus
+	}{
+		{
+			name:   "取消运行中的任务，已结束的插件保持不变",
+			status: model.TaskInstallStatusRunning,
+			want: map[plugin_entities.PluginUniqueIdentifier]model.TaskInstallStatus{
+				installed:  model.TaskInstallStatusSuccess,
+				installing: model.TaskInstallStatusCancelled,
+				pending:    model.TaskInstallStatusCancelled,
+				failed:     model.TaskInstallStatusFailed,
+			},
+		},
+		{name: "已失败的任务不能取消", status: model.TaskInstallStatusFailed, wantCode: entities.ErrBadRequestCode},
+		{name: "已取消的任务不能再次取消", status: model.TaskInstallStatusCancelled, wantCode: entities.ErrBadRequestCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := createInstallationTask(t, tt.status, model.TaskInstallOperation{}, plugins)
+
+			response := CancelPluginInstallationTask(task.TenantID, task.ID)
+			require.Equal(t, tt.wantCode, response.Code)
+			if tt.wantCode != 0 {
+				return
+			}
+
+			cancelled, err := db.GetOne[model.TaskInstallation](db.Equal("id", task.ID))
+			require.NoError(t, err)
+			assert.Equal(t, model.TaskInstallStatusCancelled, cancelled.Status)
+			assert.Equal(t, tt.want, pluginStatuses(&cancelled))
+		})
+	}
+
+	// 其他租户的任务视为不存在
+	task := createInstallationTask(t, model.TaskInstallStatusRunning, model.TaskInstallOperation{}, plugins)
+	response := CancelPluginInstallationTask(uuid.New().String(), task.ID)
+	assert.Equal(t, entities.ErrNotFoundCode, response.Code)
+}
+
+func TestRetryPluginInstallationTask(t *testing.T) {
+	setUpTestDB()
+	defer db.Close()
+
+	const (
+		installed plugin_entities.PluginUniqueIdentifier = "author/installed:0.0.1@a"
+		failed    plugin_entities.PluginUniqueIdentifier = "author/failed:0.0.1@b"
+	)
+	config := &core.Config{Platform: core.PLATFORM_LOCAL}
+	operation := model.TaskInstallOperation{
+		Action:      model.TaskInstallActionInstall,
+		Source:      "marketplace",
+		RuntimeType: string(plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL),
+	}
+
+	tests := []struct {
+		name      string
+		operation model.TaskInstallOperation
+		plugins   map[plugin_entities.PluginUniqueIdentifier]model.TaskInstallStatus
+		wantCode  int
+	}{
+		{
+			name:      "重试失败的插件",
+			operation: operation,
+			plugins: map[plugin_entities.PluginUniqueIdentifier]model.TaskInstallStatus{
+				installed: model.TaskInstallStatusSuccess,
+				failed:    model.TaskInstallStatusFailed,
+			},
+		},
+		{
+			name:      "没有失败的插件",
+			operation: operation,
+			plugins: map[plugin_entities.PluginUniqueIdentifier]model.TaskInstallStatus{
+				installed: model.TaskInstallStatusSuccess,
+			},
+			wantCode: entities.ErrBadRequestCode,
+		},
+		{
+			name: "未记录操作的任务无法重试",
+			plugins: map[plugin_entities.PluginUniqueIdentifier]model.TaskInstallStatus{
+				failed: model.TaskInstallStatusFailed,
+			},
+			wantCode: entities.ErrBadRequestCode,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := createInstallationTask(t, model.TaskInstallStatusFailed, tt.operation, tt.plugins)
+
+			// 任务从数据库重建，与创建任务的副本无关
+			response := RetryPluginInstallationTask(config, task.TenantID, task.ID)
+			require.Equal(t, tt.wantCode, response.Code)
+			if tt.wantCode != 0 {
+				return
+			}
+
+			retried, ok := response.Data.(*model.TaskInstallation)
+			require.True(t, ok)
+			assert.Equal(t, model.TaskInstallStatusRunning, retried.Status)
+			assert.Equal(t, map[plugin_entities.PluginUniqueIdentifier]model.TaskInstallStatus{
+				installed: model.TaskInstallStatusSuccess,
+				failed:    model.TaskInstallStatusPending,
+			}, pluginStatuses(retried))
+		})
+	}
+
+	response := RetryPluginInstallationTask(config, uuid.New().String(), uuid.New().String())
+	assert.Equal(t, entities.ErrNotFoundCode, response.Code)
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/jjgagacy/workflow-app/plugin/cache"
 	"github.com/jjgagacy/workflow-app/plugin/core/db"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager"
 	"github.com/jjgagacy/workflow-app/plugin/model"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/manifest_entites"
@@ -100,22 +101,25 @@ func ListTools(tenantId string, page int, pageSize int) *entities.Response {
 
 func ListPlugins(tenantId string, page int, pageSize int) *entities.Response {
 	type installations struct {
-		ID                     string                             `json:"id"`
-		Name                   string                             `json:"name"`
-		PluginID               string                             `json:"plugin_id"`
-		TenantID               string                             `json:"tenant_id"`
-		PluginUniqueIdentifier string                             `json:"plugin_unique_identifier"`
-		EndPointActive         int                                `json:"endpoint_active"`
-		EndPointSetups         int                                `json:"endpoint_setups"`
-		InstallationID         string                             `json:"installation_id"`
-		Declaration            *plugin_entities.PluginDeclaration `json:"declaration"`
-		RuntimeType            plugin_entities.PluginRuntimeType  `json:"runtime_type"`
-		Version                manifest_entites.Version           `json:"version"`
-		CreatedAt              time.Time                          `json:"created_at"`
-		UpdatedAt              time.Time                          `json:"updated_at"`
-		Source                 string                             `json:"source"`
-		Checksum               string                             `json:"checksum"`
-		Meta                   map[string]any                     `json:"meta"`
+		ID                     string                               `json:"id"`
+		Name                   string                               `json:"name"`
+		PluginID               string                               `json:"plugin_id"`
+		TenantID               string                               `json:"tenant_id"`
+		PluginUniqueIdentifier string                               `json:"plugin_unique_identifier"`
+		EndPointActive         int                                  `json:"endpoint_active"`
+		EndPointSetups         int                                  `json:"endpoint_setups"`
+		InstallationID         string                               `json:"installation_id"`
+		Declaration            *plugin_entities.PluginDeclaration   `json:"declaration"`
+		RuntimeType            plugin_entities.PluginRuntimeType    `json:"runtime_type"`
+		Version                manifest_entites.Version             `json:"version"`
+		CreatedAt              time.Time                            `json:"created_at"`
+		UpdatedAt              time.Time                            `json:"updated_at"`
+		Source                 string                               `json:"source"`
+		Checksum               string                               `json:"checksum"`
+		Meta                   map[string]any                       `json:"meta"`
+		Status                 string                               `json:"status"`
+		FailureReason          string                               `json:"failure_reason,omitempty"`
+		ResourceUsage          *plugin_entities.PluginResourceUsage `json:"resource_usage,omitempty"`
 	}
 
 	type responseData struct {
@@ -158,6 +162,16 @@ func ListPlugins(tenantId string, page int, pageSize int) *entities.Response {
 			return entities.InternalError(err).ToResponse()
 		}
 
+		// plugins which are not running are stopped, e.g. for idleness
+		status := plugin_entities.PLUGIN_RUNTIME_STATUS_STOPPED.String()
+		failureReason := ""
+		var resourceUsage *plugin_entities.PluginResourceUsage
+		if state, ok := plugin_manager.Manager().RuntimeState(pluginUniqueIdentifier); ok {
+			status = state.Status
+			failureReason = state.FailureReason
+			resourceUsage = state.ResourceUsage
+		}
+
 		data = append(data, installations{
 			ID:                     installation.ID,
 			Name:                   declaration.Name,
@@ -175,6 +189,9 @@ func ListPlugins(tenantId string, page int, pageSize int) *entities.Response {
 			Source:                 installation.Source,
 			Meta:                   installation.Meta,
 			Checksum:               pluginUniqueIdentifier.Checksum(),
+			Status:                 status,
+			FailureReason:          failureReason,
+			ResourceUsage:          resourceUsage,
 		})
 	}
 
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/cache"
+	"github.com/jjgagacy/workflow-app/plugin/core/db"
+	"github.com/jjgagacy/workflow-app/plugin/core/mcp"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/access_types"
+	"github.com/jjgagacy/workflow-app/plugin/core/session_manager"
+	"github.com/jjgagacy/workflow-app/plugin/model"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/mcp_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/tool_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+// MCPToolBackend exposes the tools installed by a tenant to the mcp server, tools are
+// invoked through the same session path as the dispatch api
+type MCPToolBackend struct {
+	MaxTimeout int // seconds
+}
+
+func (b *MCPToolBackend) ListTools(caller mcp.Caller) ([]mcp.InstalledTool, error) {
+	toolInstallations, err := db.GetAll[model.ToolInstallation](
+		db.Equal("tenant_id", caller.TenantID),
+		db.OrderBy("created_at", false),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	tools := []mcp.InstalledTool{}
+	for _, toolInstallation := range toolInstallations {
+		pluginUniqueIdentifier := plugin_entities.PluginUniqueIdentifier(toolInstallation.PluginUniqueIdentifier)
+		var runtimeType plugin_entities.PluginRuntimeType
+		if pluginUniqueIdentifier.RemoteLike() {
+			runtimeType = plugin_entities.PLUGIN_RUNTIME_TYPE_REMOTE
+		} else {
+			runtimeType = plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL
+		}
+
+		declaration, err := cache.CombinedGetPluginDeclaration(pluginUniqueIdentifier, runtimeType)
+		if err != nil {
+			// a broken plugin shouldn't hide the tools of the others
+			utils.Warn("failed to get declaration of %s: %s", pluginUniqueIdentifier, err.Error())
+			continue
+		}
+		if declaration.Tool == nil {
+			continue
+		}
+
+		for _, tool := range declaration.Tool.Tools {
+			tools = append(tools, mcp.InstalledTool{
+				PluginUniqueIdentifier: pluginUniqueIdentifier,
+				Provider:               toolInstallation.Provider,
+				Declaration:            tool,
+			})
+		}
+	}
+	return tools, nil
+}
+
+func (b *MCPToolBackend) InvokeTool(
+	caller mcp.Caller,
+	tool mcp.InstalledTool,
+	parameters map[string]any,
+	meta *mcp_entities.CallToolMeta,
+) ([]tool_entities.ToolResponseChunk, error) {
+	request := &plugin_entities.InvokePluginRequest[requests.RequestInvokeTool]{
+		InvokePluginUserIdentity: plugin_entities.InvokePluginUserIdentity{
+			TenantID: caller.TenantID,
+			UserID:   caller.UserID,
+		},
+		BasePluginIdentifier: plugin_entities.BasePluginIdentifier{
+			PluginID: tool.PluginUniqueIdentifier.PluginID(),
+		},
+		UniqueIdentifier: tool.PluginUniqueIdentifier,
+	}
+	request.Data.Provider = tool.Provider
+	request.Data.Tool = tool.Declaration.Identity.Name
+	request.Data.ToolParameters = parameters
+	if meta != nil {
+		request.Data.Credentials.Credentials = meta.Credentials
+		request.Data.CredentialType = meta.CredentialType
+	}
+
+	session, err := createSession(
+		request,
+		access_types.PLUGIN_ACCESS_TYPE_TOOL,
+		access_types.PLUGIN_ACCESS_ACTION_INVOKE_TOOL,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close(session_manager.CloseSessionPayload{
+		IgnoreCache: false,
+	})
+
+	stream, err := plugin_daemon.InvokeTool(session, &request.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	timedOut := new(int32)
+	timer := time.AfterFunc(time.Duration(b.MaxTimeout)*time.Second, func() {
+		atomic.StoreInt32(timedOut, 1)
+		stream.Close()
+	})
+	defer timer.Stop()
+
+	chunks := []tool_entities.ToolResponseChunk{}
+	for stream.Next() {
+		chunk, err := stream.Read()
+		if err != nil {
+			return nil, err
+		}
+		chunks = append(chunks, chunk)
+	}
+	if atomic.LoadInt32(timedOut) == 1 {
+		return nil, errors.New("killed by timeout")
+	}
+	return chunks, nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"github.com/jjgagacy/workflow-app/plugin/cache"
+	"github.com/jjgagacy/workflow-app/plugin/core/db"
+	"github.com/jjgagacy/workflow-app/plugin/core/openai"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/access_types"
+	"github.com/jjgagacy/workflow-app/plugin/core/session_manager"
+	"github.com/jjgagacy/workflow-app/plugin/model"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/model_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+// OpenAIModelBackend exposes the model providers installed by a tenant to the openai
+// api, models are invoked through the same session path as the dispatch api
+type OpenAIModelBackend struct{}
+
+func (b *OpenAIModelBackend) ListProviders(caller openai.Caller) ([]openai.InstalledProvider, error) {
+	modelInstallations, err := db.GetAll[model.AIModelInstallation](
+		db.Equal("tenant_id", caller.TenantID),
+		db.OrderBy("created_at", false),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	providers := []openai.InstalledProvider{}
+	for _, modelInstallation := range modelInstallations {
+		pluginUniqueIdentifier := plugin_entities.PluginUniqueIdentifier(modelInstallation.PluginUniqueIdentifier)
+		var runtimeType plugin_entities.PluginRuntimeType
+		if pluginUniqueIdentifier.RemoteLike() {
+			runtimeType = plugin_entities.PLUGIN_RUNTIME_TYPE_REMOTE
+		} else {
+			runtimeType = plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL
+		}
+
+		declaration, err := cache.CombinedGetPluginDeclaration(pluginUniqueIdentifier, runtimeType)
+		if err != nil {
+			// a broken plugin shouldn't hide the models of the others
+			utils.Warn("failed to get declaration of %s: %s", pluginUniqueIdentifier, err.Error())
+			continue
+		}
+		if declaration.Model == nil {
+			continue
+		}
+
+		providers = append(providers, openai.InstalledProvider{
+			PluginUniqueIdentifier: pluginUniqueIdentifier,
+			Declaration:            *declaration.Model,
+		})
+	}
+	return providers, nil
+}
+
+func (b *OpenAIModelBackend) InvokeLLM(
+	caller openai.Caller,
+	provider *openai.InstalledProvider,
+	request *requests.RequestInvokeLLM,
+) (*utils.Stream[model_entities.LLMResultChunk], error) {
+	return invokeOpenAIModel(caller, provider, request, access_types.PLUGIN_ACCESS_ACTION_INVOKE_LLM, plugin_daemon.InvokeLLM)
+}
+
+func (b *OpenAIModelBackend) InvokeTextEmbedding(
+	caller openai.Caller,
+	provider *openai.InstalledProvider,
+	request *requests.RequestInvokeTextEmbedding,
+) (*utils.Stream[model_entities.TextEmbeddingResult], error) {
+	return invokeOpenAIModel(caller, provider, request, access_types.PLUGIN_ACCESS_ACTION_INVOKE_TEXT_EMBEDDING, plugin_daemon.InvokeTextEmbedding)
+}
+
+func (b *OpenAIModelBackend) InvokeRerank(
+	caller openai.Caller,
+	provider *openai.InstalledProvider,
+	request *requests.RequestInvokeRerank,
+) (*utils.Stream[model_entities.RerankResult], error) {
+	return invokeOpenAIModel(caller, provider, request, access_types.PLUGIN_ACCESS_ACTION_INVOKE_RERANK, plugin_daemon.InvokeRerank)
+}
+
+func (b *OpenAIModelBackend) InvokeTTS(
+	caller openai.Caller,
+	provider *openai.InstalledProvider,
+	request *requests.RequestInvokeTTS,
+) (*utils.Stream[model_entities.TTSResult], error) {
+	return invokeOpenAIModel(caller, provider, request, access_types.PLUGIN_ACCESS_ACTION_INVOKE_TTS, plugin_daemon.InvokeTTS)
+}
+
+func (b *OpenAIModelBackend) InvokeSpeech2Text(
+	caller openai.Caller,
+	provider *openai.InstalledProvider,
+	request *requests.RequestInvokeSpeech2Text,
+) (*utils.Stream[model_entities.Speech2TextResult], error) {
+	return invokeOpenAIModel(caller, provider, request, access_types.PLUGIN_ACCESS_ACTION_INVOKE_SPEECH2TEXT, plugin_daemon.InvokeSpeech2Text)
+}
+
+func (b *OpenAIModelBackend) InvokeModeration(
+	caller openai.Caller,
+	provider *openai.InstalledProvider,
+	request *requests.RequestInvokeModeration,
+) (*utils.Stream[model_entities.ModerationResult], error) {
+	return invokeOpenAIModel(caller, provider, request, access_types.PLUGIN_ACCESS_ACTION_INVOKE_MODERATION, plugin_daemon.InvokeModeration)
+}
+
+// invokeOpenAIModel starts the invocation of a model, the session lives until the
+// stream is closed either by the plugin or by the server
+func invokeOpenAIModel[T any, R any](
+	caller openai.Caller,
+	provider *openai.InstalledProvider,
+	data *T,
+	accessAction access_types.PluginAccessAction,
+	invoke func(*session_manager.Session, *T) (*utils.Stream[R], error),
+) (*utils.Stream[R], error) {
+	request := &plugin_entities.InvokePluginRequest[T]{
+		InvokePluginUserIdentity: plugin_entities.InvokePluginUserIdentity{
+			TenantID: caller.TenantID,
+			UserID:   caller.UserID,
+		},
+		BasePluginIdentifier: plugin_entities.BasePluginIdentifier{
+			PluginID: provider.PluginUniqueIdentifier.PluginID(),
+		},
+		UniqueIdentifier: provider.PluginUniqueIdentifier,
+		Data:             *data,
+	}
+
+	session, err := createSession(request, access_types.PLUGIN_ACCESS_TYPE_MODEL, accessAction)
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := invoke(session, &request.Data)
+	if err != nil {
+		session.Close(session_manager.CloseSessionPayload{IgnoreCache: false})
+		return nil, err
+	}
+	stream.OnClose(func() {
+		session.Close(session_manager.CloseSessionPayload{IgnoreCache: false})
+	})
+	return stream, nil
+}
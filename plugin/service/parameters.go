@@ -0,0 +1,43 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jjgagacy/workflow-app/plugin/cache"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/types"
+)
+
+// pluginDeclaration returns the cached declaration of an installed plugin, debugging
+// plugins are only known to the manager while they're connected.
+// types.ErrPluginNotFound is returned if the plugin is neither installed nor connected
+func pluginDeclaration(identifier plugin_entities.PluginUniqueIdentifier) (*plugin_entities.PluginDeclaration, error) {
+	if identifier.RemoteLike() {
+		runtime, err := plugin_manager.Manager().Get(identifier)
+		if err != nil {
+			return nil, errors.Join(types.ErrPluginNotFound, err)
+		}
+		return runtime.Configuration(), nil
+	}
+	return cache.CombinedGetPluginDeclaration(identifier, plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL)
+}
+
+// validateToolDeclarationParameters checks the parameters against the declaration of the
+// tool, the returned parameters are coerced to the declared types with defaults filled in
+func validateToolDeclarationParameters(
+	declaration *plugin_entities.PluginDeclaration,
+	tool string,
+	parameters map[string]any,
+) (map[string]any, error) {
+	if declaration.Tool == nil {
+		return nil, fmt.Errorf("plugin has no tool provider")
+	}
+	for _, t := range declaration.Tool.Tools {
+		if t.Identity.Name == tool {
+			return plugin_entities.ValidateToolParameters(t.Parameters, parameters)
+		}
+	}
+	return nil, fmt.Errorf("tool %s not found", tool)
+}
@@ -1,15 +1,18 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"io"
 	"mime/multipart"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jjgagacy/workflow-app/plugin/cache"
 	"github.com/jjgagacy/workflow-app/plugin/core"
 	"github.com/jjgagacy/workflow-app/plugin/core/bundle_packager"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_packager/decoder"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/bundle_entities"
@@ -64,6 +67,61 @@ func UploadPluginPkg(
 	})
 }
 
+// InstallPluginFromGit packages the plugin from a git repository, saves the
+// package and installs it to the tenant through the normal install task
+func InstallPluginFromGit(
+	config *core.Config,
+	tenantId string,
+	repository plugin_packager.GitRepository,
+	source string,
+	meta map[string]any,
+	actor string,
+) *entities.Response {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.PluginGitCloneTimeout)*time.Second)
+	defer cancel()
+
+	pluginFile, err := plugin_packager.PackGitRepository(ctx, repository, config.PluginGitCloneMaxSize, config.MaxPluginPackageSize)
+	if err != nil {
+		return entities.BadRequestError(errors.Join(err, errors.New("failed to package plugin from git repository"))).ToResponse()
+	}
+
+	pluginDecoder, err := decoder.NewZipPluginDecoderWithLimitSize(pluginFile, config.MaxPluginPackageSize)
+	if err != nil {
+		return entities.BadRequestError(err).ToResponse()
+	}
+
+	pluginUniqueIdentifier, err := pluginDecoder.UniqueIdentity()
+	if err != nil {
+		return entities.BadRequestError(err).ToResponse()
+	}
+
+	if pluginUniqueIdentifier.RemoteLike() {
+		return entities.BadRequestError(errors.New("author cannot be a uuid")).ToResponse()
+	}
+
+	manager := plugin_manager.Manager()
+	if _, err := manager.SavePackage(pluginUniqueIdentifier, pluginFile, &decoder.ThirdPartySignatureVerificationConfig{
+		Enabled:        config.ThirdPartySignatureVerificationEnabled,
+		PublicKeyPaths: config.ThirdPartySignatureVerificationPublicKeys,
+	}); err != nil {
+		return entities.BadRequestError(errors.Join(err, errors.New("failed to save package"))).ToResponse()
+	}
+
+	if meta == nil {
+		meta = map[string]any{}
+	}
+	meta["repository"] = repository
+
+	return InstallPluginFromIdentifier(
+		config,
+		tenantId,
+		[]plugin_entities.PluginUniqueIdentifier{pluginUniqueIdentifier},
+		source,
+		[]map[string]any{meta},
+		actor,
+	)
+}
+
 func UploadPluginBundle(
 	config *core.Config,
 	ctx *gin.Context,
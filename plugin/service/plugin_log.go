@@ -0,0 +1,92 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/core/db"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager"
+	"github.com/jjgagacy/workflow-app/plugin/model"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/types"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+)
+
+// getTenantPluginLogs returns the log buffer of a running plugin installed by the tenant
+func getTenantPluginLogs(
+	tenantId string,
+	pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+) (*plugin_entities.PluginLogBuffer, error) {
+	_, err := db.GetOne[model.PluginInstallation](
+		db.Equal("tenant_id", tenantId),
+		db.Equal("plugin_unique_identifier", pluginUniqueIdentifier.String()),
+	)
+	if err == types.ErrRecordNotFound {
+		return nil, entities.NotFoundError(errors.New("plugin installation not found"))
+	}
+	if err != nil {
+		return nil, entities.InternalError(err)
+	}
+
+	runtime, err := plugin_manager.Manager().Get(pluginUniqueIdentifier)
+	if err != nil {
+		return nil, entities.PluginNotFoundError(err)
+	}
+
+	logs := runtime.Logs()
+	if logs == nil {
+		return nil, entities.NotFoundError(errors.New("logs of the plugin are not collected"))
+	}
+	return logs, nil
+}
+
+func ListPluginLogs(
+	tenantId string,
+	pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	filter plugin_entities.PluginLogFilter,
+	page int,
+	pageSize int,
+) *entities.Response {
+	logs, err := getTenantPluginLogs(tenantId, pluginUniqueIdentifier)
+	if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	entries, total := logs.Query(filter, page, pageSize)
+	return entities.NewSuccessResponse(map[string]any{
+		"logs":  entries,
+		"total": total,
+	})
+}
+
+// TailPluginLogs streams new logs of the plugin to the client until it disconnects or maxTimeout reached
+func TailPluginLogs(
+	ctx *gin.Context,
+	tenantId string,
+	pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	filter plugin_entities.PluginLogFilter,
+	maxTimeout int,
+) {
+	baseSSEService(
+		func() (*utils.Stream[plugin_entities.PluginLogEntry], error) {
+			logs, err := getTenantPluginLogs(tenantId, pluginUniqueIdentifier)
+			if err != nil {
+				return nil, err
+			}
+
+			stream := utils.NewStream[plugin_entities.PluginLogEntry](512)
+			unsubscribe := logs.Subscribe(func(entry plugin_entities.PluginLogEntry) {
+				if !filter.Match(entry) {
+					return
+				}
+				// never block the plugin on a slow client, drop the entry instead
+				stream.Write(entry)
+			})
+			stream.OnClose(unsubscribe)
+			return stream, nil
+		},
+		ctx,
+		maxTimeout,
+	)
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+)
+
+type pluginRuntime struct {
+	PluginUniqueIdentifier string                             `json:"plugin_unique_identifier"`
+	State                  plugin_entities.PluginRuntimeState `json:"state"`
+	// resource alerts firing for the plugin
+	Alerts []string `json:"alerts"`
+}
+
+func listPluginRuntimes() []pluginRuntime {
+	manager := plugin_manager.Manager()
+	runtimes := []pluginRuntime{}
+	for identifier, state := range manager.RuntimeStates() {
+		runtimes = append(runtimes, pluginRuntime{
+			PluginUniqueIdentifier: identifier,
+			State:                  state,
+			Alerts:                 manager.ResourceAlerts(plugin_entities.PluginUniqueIdentifier(identifier)),
+		})
+	}
+	sort.Slice(runtimes, func(i, j int) bool {
+		return runtimes[i].PluginUniqueIdentifier < runtimes[j].PluginUniqueIdentifier
+	})
+	return runtimes
+}
+
+// ListPluginRuntimes returns the state and the resource usage of all running plugins
+func ListPluginRuntimes() *entities.Response {
+	return entities.NewSuccessResponse(listPluginRuntimes())
+}
+
+// PluginMetrics renders the resource usage of the running plugins in the prometheus
+// text format
+func PluginMetrics() string {
+	return renderPluginMetrics(listPluginRuntimes())
+}
+
+// ResetPluginCrashLoop restarts a crash looping plugin, the runtime is shared by
+// all tenants which installed the plugin
+func ResetPluginCrashLoop(pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier) *entities.Response {
+	if err := plugin_manager.Manager().ResetCrashLoop(pluginUniqueIdentifier); err != nil {
+		return entities.BadRequestError(err).ToResponse()
+	}
+	return entities.NewSuccessResponse(true)
+}
+
+func renderPluginMetrics(runtimes []pluginRuntime) string {
+	metrics := []struct {
+		name  string
+		help  string
+		typ   string
+		value func(r pluginRuntime) (float64, bool)
+	}{
+		{"plugin_restarts_total", "Restarts of the plugin processes.", "counter", func(r pluginRuntime) (float64, bool) {
+			return float64(r.State.Restarts), true
+		}},
+		{"plugin_cpu_percent", "CPU usage of the plugin processes in percentage of a core.", "gauge", func(r pluginRuntime) (float64, bool) {
+			if r.State.ResourceUsage == nil {
+				return 0, false
+			}
+			return r.State.ResourceUsage.CPUPercent, true
+		}},
+		{"plugin_resident_memory_bytes", "Resident memory of the plugin processes.", "gauge", func(r pluginRuntime) (float64, bool) {
+			if r.State.ResourceUsage == nil {
+				return 0, false
+			}
+			return float64(r.State.ResourceUsage.RSS), true
+		}},
+		{"plugin_open_files", "Open files of the plugin processes.", "gauge", func(r pluginRuntime) (float64, bool) {
+			if r.State.ResourceUsage == nil {
+				return 0, false
+			}
+			return float64(r.State.ResourceUsage.OpenFiles), true
+		}},
+		{"plugin_threads", "Threads of the plugin processes.", "gauge", func(r pluginRuntime) (float64, bool) {
+			if r.State.ResourceUsage == nil {
+				return 0, false
+			}
+			return float64(r.State.ResourceUsage.Threads), true
+		}},
+		{"plugin_processes", "Processes of the plugin including children.", "gauge", func(r pluginRuntime) (float64, bool) {
+			if r.State.ResourceUsage == nil {
+				return 0, false
+			}
+			return float64(r.State.ResourceUsage.Processes), true
+		}},
+	}
+
+	var b strings.Builder
+	for _, metric := range metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n", metric.name, metric.help)
+		fmt.Fprintf(&b, "# TYPE %s %s\n", metric.name, metric.typ)
+		for _, r := range runtimes {
+			if value, ok := metric.value(r); ok {
+				fmt.Fprintf(&b, "%s{plugin=%q,status=%q} %g\n", metric.name, r.PluginUniqueIdentifier, r.State.Status, value)
+			}
+		}
+	}
+
+	b.WriteString("# HELP plugin_resource_alert Resource alerts firing for the plugin.\n")
+	b.WriteString("# TYPE plugin_resource_alert gauge\n")
+	for _, r := range runtimes {
+		for _, alert := range r.Alerts {
+			fmt.Fprintf(&b, "plugin_resource_alert{plugin=%q,alert=%q} 1\n", r.PluginUniqueIdentifier, alert)
+		}
+	}
+	return b.String()
+}
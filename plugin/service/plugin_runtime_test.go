@@ -0,0 +1,42 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderPluginMetrics(t *testing.T) {
+	metrics := renderPluginMetrics([]pluginRuntime{
+		{
+			PluginUniqueIdentifier: "langgenius/openai:0.0.1@checksum",
+			State: plugin_entities.PluginRuntimeState{
+				Status:   "active",
+				Restarts: 2,
+				ResourceUsage: &plugin_entities.PluginResourceUsage{
+					CPUPercent: 12.5,
+					RSS:        1048576,
+					OpenFiles:  12,
+					Threads:    4,
+					Processes:  2,
+				},
+			},
+			Alerts: []string{"memory"},
+		},
+		{
+			// 尚未采样的插件只输出重启次数
+			PluginUniqueIdentifier: "langgenius/tavily:0.0.1@checksum",
+			State:                  plugin_entities.PluginRuntimeState{Status: "launching"},
+			Alerts:                 []string{},
+		},
+	})
+
+	assert.Contains(t, metrics, "# TYPE plugin_restarts_total counter\n")
+	assert.Contains(t, metrics, `plugin_restarts_total{plugin="langgenius/openai:0.0.1@checksum",status="active"} 2`+"\n")
+	assert.Contains(t, metrics, `plugin_restarts_total{plugin="langgenius/tavily:0.0.1@checksum",status="launching"} 0`+"\n")
+	assert.Contains(t, metrics, `plugin_cpu_percent{plugin="langgenius/openai:0.0.1@checksum",status="active"} 12.5`+"\n")
+	assert.Contains(t, metrics, `plugin_resident_memory_bytes{plugin="langgenius/openai:0.0.1@checksum",status="active"} 1.048576e+06`+"\n")
+	assert.NotContains(t, metrics, `plugin_cpu_percent{plugin="langgenius/tavily`)
+	assert.Contains(t, metrics, `plugin_resource_alert{plugin="langgenius/openai:0.0.1@checksum",alert="memory"} 1`+"\n")
+}
@@ -0,0 +1,630 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/jjgagacy/workflow-app/plugin/cache"
+	"github.com/jjgagacy/workflow-app/plugin/core"
+	"github.com/jjgagacy/workflow-app/plugin/core/db"
+	"github.com/jjgagacy/workflow-app/plugin/core/plugin_manager"
+	"github.com/jjgagacy/workflow-app/plugin/model"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/types"
+	"github.com/jjgagacy/workflow-app/plugin/utils"
+	"gorm.io/gorm"
+)
+
+const (
+	// stats are kept a while after the rollout is finished for inspection
+	pluginRolloutStatsExpire = 7 * 24 * time.Hour
+	// the running rollout is cached for dispatch requests, changes invalidate it
+	// explicitly, the expiration only bounds a stale entry written concurrently
+	pluginRolloutCacheExpire = time.Minute
+	// actor recorded in installation histories when a rollout is promoted automatically
+	pluginRolloutAutoActor = "rollout"
+)
+
+// GlobalPluginRolloutTenantID is the tenant of rollouts covering every tenant,
+// they are only managed through the admin api
+const GlobalPluginRolloutTenantID = ""
+
+var errPluginRolloutFinished = errors.New("rollout has already finished")
+
+type PluginRolloutOptions struct {
+	CanaryWeight        int
+	Global              bool
+	MinRequests         int
+	MaxErrorRateDelta   float64
+	AutoPromoteRequests int
+}
+
+type PluginRolloutStats struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+}
+
+func (s PluginRolloutStats) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Requests)
+}
+
+type PluginRolloutWithStats struct {
+	model.PluginRollout
+	Stable PluginRolloutStats `json:"stable"`
+	Canary PluginRolloutStats `json:"canary"`
+}
+
+type pluginRolloutDecision int
+
+const (
+	pluginRolloutDecisionContinue pluginRolloutDecision = iota
+	pluginRolloutDecisionPromote
+	pluginRolloutDecisionRollback
+)
+
+// evaluatePluginRollout compares the error rates of both versions, nothing is decided
+// until the canary version has served MinRequests, the stable version is only used as
+// the baseline once it has served MinRequests as well
+func evaluatePluginRollout(
+	rollout *model.PluginRollout,
+	stable PluginRolloutStats,
+	canary PluginRolloutStats,
+) pluginRolloutDecision {
+	if canary.Requests < int64(rollout.MinRequests) {
+		return pluginRolloutDecisionContinue
+	}
+
+	baseline := 0.0
+	if stable.Requests >= int64(rollout.MinRequests) {
+		baseline = stable.ErrorRate()
+	}
+
+	if canary.ErrorRate()-baseline > rollout.MaxErrorRateDelta {
+		return pluginRolloutDecisionRollback
+	}
+
+	if rollout.AutoPromoteRequests > 0 && canary.Requests >= int64(rollout.AutoPromoteRequests) {
+		return pluginRolloutDecisionPromote
+	}
+
+	return pluginRolloutDecisionContinue
+}
+
+// pickPluginRolloutCanary reports whether a request goes to the canary version,
+// requests of the same conversation always go to the same version
+func pickPluginRolloutCanary(rollout *model.PluginRollout, conversationId *string) bool {
+	if rollout.CanaryWeight <= 0 {
+		return false
+	}
+	if rollout.CanaryWeight >= 100 {
+		return true
+	}
+
+	if conversationId == nil || *conversationId == "" {
+		return rand.Intn(100) < rollout.CanaryWeight
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(rollout.ID))
+	h.Write([]byte(*conversationId))
+	return int(h.Sum32()%100) < rollout.CanaryWeight
+}
+
+// SelectPluginRolloutIdentifier returns the identifier a dispatch request is routed to,
+// the stable version is used while the canary runtime is not launched
+func SelectPluginRolloutIdentifier(
+	rollout *model.PluginRollout,
+	conversationId *string,
+) plugin_entities.PluginUniqueIdentifier {
+	stable := plugin_entities.PluginUniqueIdentifier(rollout.StablePluginUniqueIdentifier)
+	if !pickPluginRolloutCanary(rollout, conversationId) {
+		return stable
+	}
+
+	canary := plugin_entities.PluginUniqueIdentifier(rollout.CanaryPluginUniqueIdentifier)
+	if manager := plugin_manager.Manager(); manager != nil {
+		if _, err := manager.Get(canary); err != nil {
+			return stable
+		}
+	}
+
+	return canary
+}
+
+// pluginRolloutCacheRecord is cached even if there is no running rollout, plugins
+// without rollouts are the common case and shouldn't query the database either
+type pluginRolloutCacheRecord struct {
+	Rollout *model.PluginRollout `cbor:"rollout"`
+}
+
+// FetchActivePluginRollout returns the running rollout of the installation,
+// rollouts of the tenant take precedence over global ones
+func FetchActivePluginRollout(installation *model.PluginInstallation) (*model.PluginRollout, error) {
+	for _, tenantId := range []string{installation.TenantID, GlobalPluginRolloutTenantID} {
+		rollout, err := fetchRunningPluginRollout(tenantId, installation.PluginID)
+		if err != nil {
+			return nil, err
+		}
+		// the rollout only covers installations of its stable version
+		if rollout != nil && rollout.StablePluginUniqueIdentifier == installation.PluginUniqueIdentifier {
+			return rollout, nil
+		}
+	}
+	return nil, nil
+}
+
+// fetchRunningPluginRollout returns the running rollout of a plugin owned by the tenant,
+// at most one rollout of a plugin runs per tenant
+func fetchRunningPluginRollout(tenantId string, pluginId string) (*model.PluginRollout, error) {
+	key := cache.PluginRolloutCacheKey(tenantId, pluginId)
+	record, err := cache.Get[pluginRolloutCacheRecord](key)
+	if err == nil {
+		return record.Rollout, nil
+	}
+	if err != cache.ErrNotFound {
+		utils.Warn("failed to get the cached rollout of %s: %s", pluginId, err.Error())
+	}
+
+	rollout, err := db.GetOne[model.PluginRollout](
+		db.Equal("tenant_id", tenantId),
+		db.Equal("plugin_id", pluginId),
+		db.Equal("status", string(model.PluginRolloutStatusRunning)),
+	)
+	if err != nil && err != types.ErrRecordNotFound {
+		return nil, err
+	}
+
+	record = &pluginRolloutCacheRecord{}
+	if err == nil {
+		record.Rollout = &rollout
+	}
+	if err := cache.Store(key, record, pluginRolloutCacheExpire); err != nil {
+		utils.Warn("failed to cache the rollout of %s: %s", pluginId, err.Error())
+	}
+	return record.Rollout, nil
+}
+
+// invalidatePluginRolloutCache is called after a rollout is changed in the database
+func invalidatePluginRolloutCache(rollout *model.PluginRollout) {
+	if _, err := cache.Del(cache.PluginRolloutCacheKey(rollout.TenantID, rollout.PluginID)); err != nil {
+		utils.Warn("failed to invalidate the cached rollout of %s: %s", rollout.PluginID, err.Error())
+	}
+}
+
+func fetchPluginRolloutStats(rolloutId string, pluginUniqueIdentifier string) (PluginRolloutStats, error) {
+	stats := PluginRolloutStats{}
+	for field, value := range map[string]*int64{
+		"requests": &stats.Requests,
+		"errors":   &stats.Errors,
+	} {
+		v, err := cache.GetString(cache.PluginRolloutStatsKey(rolloutId, pluginUniqueIdentifier, field))
+		if err == cache.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return stats, err
+		}
+		if *value, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return stats, err
+		}
+	}
+	return stats, nil
+}
+
+func incrPluginRolloutStats(rolloutId string, pluginUniqueIdentifier string, field string) error {
+	key := cache.PluginRolloutStatsKey(rolloutId, pluginUniqueIdentifier, field)
+	n, err := cache.Incr(key)
+	if err != nil {
+		return err
+	}
+	if n == 1 {
+		_, err = cache.Expire(key, pluginRolloutStatsExpire)
+	}
+	return err
+}
+
+// RecordPluginRolloutResult counts the result of a request served during a rollout
+// and promotes or rolls back the canary version once the rollout is decided
+func RecordPluginRolloutResult(
+	rollout *model.PluginRollout,
+	pluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	success bool,
+) {
+	if err := incrPluginRolloutStats(rollout.ID, pluginUniqueIdentifier.String(), "requests"); err != nil {
+		utils.Error("failed to record rollout stats: %s", err.Error())
+		return
+	}
+	if !success {
+		if err := incrPluginRolloutStats(rollout.ID, pluginUniqueIdentifier.String(), "errors"); err != nil {
+			utils.Error("failed to record rollout stats: %s", err.Error())
+			return
+		}
+	}
+
+	stable, err := fetchPluginRolloutStats(rollout.ID, rollout.StablePluginUniqueIdentifier)
+	if err != nil {
+		utils.Error("failed to fetch rollout stats: %s", err.Error())
+		return
+	}
+	canary, err := fetchPluginRolloutStats(rollout.ID, rollout.CanaryPluginUniqueIdentifier)
+	if err != nil {
+		utils.Error("failed to fetch rollout stats: %s", err.Error())
+		return
+	}
+
+	switch evaluatePluginRollout(rollout, stable, canary) {
+	case pluginRolloutDecisionPromote:
+		err = promotePluginRollout(rollout.ID, pluginRolloutAutoActor)
+	case pluginRolloutDecisionRollback:
+		err = rollbackPluginRollout(rollout.ID)
+	}
+	if err != nil && err != errPluginRolloutFinished {
+		utils.Error("failed to finish rollout %s: %s", rollout.ID, err.Error())
+	}
+}
+
+// StartPluginRollout installs the runtime of the canary version and starts routing
+// a part of the requests of the tenant installation to it, the rollout is created
+// once the canary runtime is ready
+func StartPluginRollout(
+	config *core.Config,
+	tenantId string,
+	canaryPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+	options PluginRolloutOptions,
+	actor string,
+) *entities.Response {
+	if options.CanaryWeight < 0 || options.CanaryWeight > 100 {
+		return entities.BadRequestError(errors.New("canary weight must be between 0 and 100")).ToResponse()
+	}
+
+	installation, err := db.GetOne[model.PluginInstallation](
+		db.Equal("tenant_id", tenantId),
+		db.Equal("plugin_id", canaryPluginUniqueIdentifier.PluginID()),
+	)
+	if err == types.ErrRecordNotFound {
+		return entities.PluginNotFoundError(errors.New("plugin installation not found for this tenant")).ToResponse()
+	}
+	if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	if installation.PluginUniqueIdentifier == canaryPluginUniqueIdentifier.String() {
+		return entities.BadRequestError(errors.New("canary version is already installed")).ToResponse()
+	}
+
+	rolloutTenantId := tenantId
+	if options.Global {
+		rolloutTenantId = GlobalPluginRolloutTenantID
+	}
+
+	if _, err := db.GetOne[model.PluginRollout](
+		db.Equal("tenant_id", rolloutTenantId),
+		db.Equal("plugin_id", installation.PluginID),
+		db.Equal("status", string(model.PluginRolloutStatusRunning)),
+	); err == nil {
+		return entities.BadRequestError(errors.New("a rollout of this plugin is already running")).ToResponse()
+	} else if err != types.ErrRecordNotFound {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	response, err := InstallPluginRuntimeToTenant(
+		config,
+		tenantId,
+		[]plugin_entities.PluginUniqueIdentifier{canaryPluginUniqueIdentifier},
+		[]map[string]any{installation.Meta},
+		model.TaskInstallOperation{
+			Action:                         model.TaskInstallActionRollout,
+			Source:                         installation.Source,
+			Actor:                          actor,
+			RuntimeType:                    installation.RuntimeType,
+			OriginalPluginUniqueIdentifier: installation.PluginUniqueIdentifier,
+			Rollout: &model.PluginRollout{
+				TenantID:                     rolloutTenantId,
+				PluginID:                     installation.PluginID,
+				StablePluginUniqueIdentifier: installation.PluginUniqueIdentifier,
+				RuntimeType:                  installation.RuntimeType,
+				CanaryWeight:                 options.CanaryWeight,
+				MinRequests:                  options.MinRequests,
+				MaxErrorRateDelta:            options.MaxErrorRateDelta,
+				AutoPromoteRequests:          options.AutoPromoteRequests,
+				Actor:                        actor,
+			},
+		},
+	)
+	if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(response)
+}
+
+// createPluginRollout starts the rollout of the operation once its canary version is installed
+func createPluginRollout(
+	operation model.TaskInstallOperation,
+	canaryPluginUniqueIdentifier plugin_entities.PluginUniqueIdentifier,
+) error {
+	if operation.Rollout == nil {
+		return errors.New("rollout of the installation task not found")
+	}
+
+	rollout := *operation.Rollout
+	rollout.CanaryPluginUniqueIdentifier = canaryPluginUniqueIdentifier.String()
+	rollout.Status = model.PluginRolloutStatusRunning
+
+	if err := db.WithTransaction(func(tx *gorm.DB) error {
+		// both runtimes are referred by the rollout so that neither of them
+		// is removed until the rollout is finished
+		if err := referPlugin(tx, rollout.StablePluginUniqueIdentifier, rollout.RuntimeType); err != nil {
+			return err
+		}
+		if err := referPlugin(tx, rollout.CanaryPluginUniqueIdentifier, rollout.RuntimeType); err != nil {
+			return err
+		}
+
+		return db.Create(&rollout, tx)
+	}); err != nil {
+		return err
+	}
+
+	invalidatePluginRolloutCache(&rollout)
+	return nil
+}
+
+// referPlugin increases the refers of a plugin, the plugin is created if it's not referred yet
+func referPlugin(tx *gorm.DB, pluginUniqueIdentifier string, runtimeType string) error {
+	plugin, err := db.GetOne[model.Plugin](
+		db.WithTransactionContext(tx),
+		db.Equal("plugin_unique_identifier", pluginUniqueIdentifier),
+		db.WLock(),
+	)
+	if err == types.ErrRecordNotFound {
+		identifier := plugin_entities.PluginUniqueIdentifier(pluginUniqueIdentifier)
+		return db.Create(&model.Plugin{
+			PluginID:               identifier.PluginID(),
+			PluginUniqueIdentifier: pluginUniqueIdentifier,
+			InstallType:            plugin_entities.PluginRuntimeType(runtimeType),
+			Refers:                 1,
+		}, tx)
+	}
+	if err != nil {
+		return err
+	}
+
+	plugin.Refers++
+	return db.Update(&plugin, tx)
+}
+
+// releasePlugin decreases the refers of a plugin and removes its runtime once
+// no one refers to it anymore
+func releasePlugin(pluginUniqueIdentifier string) error {
+	var deleted *model.Plugin
+	if err := db.WithTransaction(func(tx *gorm.DB) error {
+		plugin, err := db.GetOne[model.Plugin](
+			db.WithTransactionContext(tx),
+			db.Equal("plugin_unique_identifier", pluginUniqueIdentifier),
+			db.WLock(),
+		)
+		if err == types.ErrRecordNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		plugin.Refers--
+		if plugin.Refers > 0 {
+			return db.Update(&plugin, tx)
+		}
+
+		deleted = &plugin
+		return db.Delete(&plugin, tx)
+	}); err != nil {
+		return err
+	}
+
+	if deleted != nil && deleted.InstallType == plugin_entities.PLUGIN_RUNTIME_TYPE_LOCAL {
+		return plugin_manager.Manager().UninstallFromLocal(
+			plugin_entities.PluginUniqueIdentifier(deleted.PluginUniqueIdentifier),
+		)
+	}
+	return nil
+}
+
+// finishPluginRollout marks a running rollout as finished, only one caller wins
+// when the rollout is finished concurrently
+func finishPluginRollout(rolloutId string, status model.PluginRolloutStatus) (*model.PluginRollout, error) {
+	var rollout model.PluginRollout
+	err := db.WithTransaction(func(tx *gorm.DB) error {
+		var err error
+		rollout, err = db.GetOne[model.PluginRollout](
+			db.WithTransactionContext(tx),
+			db.Equal("id", rolloutId),
+			db.WLock(),
+		)
+		if err != nil {
+			return err
+		}
+		if rollout.Status != model.PluginRolloutStatusRunning {
+			return errPluginRolloutFinished
+		}
+
+		rollout.Status = status
+		return db.Update(&rollout, tx)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	invalidatePluginRolloutCache(&rollout)
+	return &rollout, nil
+}
+
+// promotePluginRollout upgrades every installation covered by the rollout to the canary version
+func promotePluginRollout(rolloutId string, actor string) error {
+	rollout, err := finishPluginRollout(rolloutId, model.PluginRolloutStatusPromoted)
+	if err != nil {
+		return err
+	}
+
+	stable := plugin_entities.PluginUniqueIdentifier(rollout.StablePluginUniqueIdentifier)
+	canary := plugin_entities.PluginUniqueIdentifier(rollout.CanaryPluginUniqueIdentifier)
+	runtimeType := plugin_entities.PluginRuntimeType(rollout.RuntimeType)
+
+	stableDeclaration, err := cache.CombinedGetPluginDeclaration(stable, runtimeType)
+	if err != nil {
+		return err
+	}
+	canaryDeclaration, err := cache.CombinedGetPluginDeclaration(canary, runtimeType)
+	if err != nil {
+		return err
+	}
+
+	queries := []db.GenericQuery{
+		db.Equal("plugin_id", rollout.PluginID),
+		db.Equal("plugin_unique_identifier", rollout.StablePluginUniqueIdentifier),
+	}
+	if rollout.TenantID != "" {
+		queries = append(queries, db.Equal("tenant_id", rollout.TenantID))
+	}
+	installations, err := db.GetAll[model.PluginInstallation](queries...)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, installation := range installations {
+		if _, err := AtomicUpgradePlugin(
+			installation.TenantID,
+			stable,
+			canary,
+			stableDeclaration,
+			canaryDeclaration,
+			runtimeType,
+			installation.Source,
+			installation.Meta,
+			actor,
+		); err != nil {
+			errs = append(errs, fmt.Errorf("upgrade installation %s: %w", installation.ID, err))
+		}
+	}
+
+	// the stable runtime is removed here if no installation refers to it anymore
+	if err := releasePluginRolloutReferences(rollout); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// rollbackPluginRollout stops routing requests to the canary version
+func rollbackPluginRollout(rolloutId string) error {
+	rollout, err := finishPluginRollout(rolloutId, model.PluginRolloutStatusRolledBack)
+	if err != nil {
+		return err
+	}
+	return releasePluginRolloutReferences(rollout)
+}
+
+func releasePluginRolloutReferences(rollout *model.PluginRollout) error {
+	return errors.Join(
+		releasePlugin(rollout.StablePluginUniqueIdentifier),
+		releasePlugin(rollout.CanaryPluginUniqueIdentifier),
+	)
+}
+
+// fetchTenantPluginRollout only returns rollouts owned by the tenant, global rollouts
+// affect every tenant and are fetched with GlobalPluginRolloutTenantID
+func fetchTenantPluginRollout(tenantId string, rolloutId string) (*model.PluginRollout, error) {
+	rollout, err := db.GetOne[model.PluginRollout](
+		db.Equal("id", rolloutId),
+		db.Equal("tenant_id", tenantId),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &rollout, nil
+}
+
+func finishPluginRolloutResponse(tenantId string, rolloutId string, finish func(rolloutId string) error) *entities.Response {
+	if _, err := fetchTenantPluginRollout(tenantId, rolloutId); err == types.ErrRecordNotFound {
+		return entities.NotFoundError(errors.New("rollout not found")).ToResponse()
+	} else if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	if err := finish(rolloutId); err == errPluginRolloutFinished {
+		return entities.BadRequestError(err).ToResponse()
+	} else if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	return entities.NewSuccessResponse(true)
+}
+
+func PromotePluginRollout(tenantId string, rolloutId string, actor string) *entities.Response {
+	return finishPluginRolloutResponse(tenantId, rolloutId, func(rolloutId string) error {
+		return promotePluginRollout(rolloutId, actor)
+	})
+}
+
+func RollbackPluginRollout(tenantId string, rolloutId string) *entities.Response {
+	return finishPluginRolloutResponse(tenantId, rolloutId, rollbackPluginRollout)
+}
+
+func UpdatePluginRolloutWeight(tenantId string, rolloutId string, canaryWeight int) *entities.Response {
+	if canaryWeight < 0 || canaryWeight > 100 {
+		return entities.BadRequestError(errors.New("canary weight must be between 0 and 100")).ToResponse()
+	}
+
+	rollout, err := fetchTenantPluginRollout(tenantId, rolloutId)
+	if err == types.ErrRecordNotFound {
+		return entities.NotFoundError(errors.New("rollout not found")).ToResponse()
+	}
+	if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+	if rollout.Status != model.PluginRolloutStatusRunning {
+		return entities.BadRequestError(errPluginRolloutFinished).ToResponse()
+	}
+
+	rollout.CanaryWeight = canaryWeight
+	if err := db.Update(rollout); err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+	invalidatePluginRolloutCache(rollout)
+
+	return entities.NewSuccessResponse(rollout)
+}
+
+func ListPluginRollouts(tenantId string, page int, pageSize int) *entities.Response {
+	rollouts, err := db.GetAll[model.PluginRollout](
+		db.Equal("tenant_id", tenantId),
+		db.OrderBy("created_at", true),
+		db.Page(page, pageSize),
+	)
+	if err != nil {
+		return entities.InternalError(err).ToResponse()
+	}
+
+	result := make([]PluginRolloutWithStats, 0, len(rollouts))
+	for _, rollout := range rollouts {
+		item := PluginRolloutWithStats{PluginRollout: rollout}
+		if item.Stable, err = fetchPluginRolloutStats(rollout.ID, rollout.StablePluginUniqueIdentifier); err != nil {
+			return entities.InternalError(err).ToResponse()
+		}
+		if item.Canary, err = fetchPluginRolloutStats(rollout.ID, rollout.CanaryPluginUniqueIdentifier); err != nil {
+			return entities.InternalError(err).ToResponse()
+		}
+		result = append(result, item)
+	}
+
+	return entities.NewSuccessResponse(result)
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jjgagacy/workflow-app/plugin/cache"
+	"github.com/jjgagacy/workflow-app/plugin/core/db"
+	"github.com/jjgagacy/workflow-app/plugin/model"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluatePluginRollout(t *testing.T) {
+	rollout := &model.PluginRollout{
+		MinRequests:         100,
+		MaxErrorRateDelta:   0.05,
+		AutoPromoteRequests: 1000,
+	}
+
+	tests := []struct {
+		name   string
+		stable PluginRolloutStats
+		canary PluginRolloutStats
+		want   pluginRolloutDecision
+	}{
+		{
+			name:   "灰度请求不足，继续观察",
+			stable: PluginRolloutStats{Requests: 1000, Errors: 0},
+			canary: PluginRolloutStats{Requests: 99, Errors: 99},
+			want:   pluginRolloutDecisionContinue,
+		},
+		{
+			name:   "错误率与稳定版本接近，继续观察",
+			stable: PluginRolloutStats{Requests: 1000, Errors: 100},
+			canary: PluginRolloutStats{Requests: 200, Errors: 25},
+			want:   pluginRolloutDecisionContinue,
+		},
+		{
+			name:   "错误率超出阈值，自动回滚",
+			stable: PluginRolloutStats{Requests: 1000, Errors: 10},
+			canary: PluginRolloutStats{Requests: 200, Errors: 20},
+			want:   pluginRolloutDecisionRollback,
+		},
+		{
+			name:   "稳定版本请求不足时以零错误率为基准",
+			stable: PluginRolloutStats{Requests: 10, Errors: 5},
+			canary: PluginRolloutStats{Requests: 200, Errors: 20},
+			want:   pluginRolloutDecisionRollback,
+		},
+		{
+			name:   "达到自动晋升请求数",
+			stable: PluginRolloutStats{Requests: 5000, Errors: 50},
+			canary: PluginRolloutStats{Requests: 1000, Errors: 10},
+			want:   pluginRolloutDecisionPromote,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, evaluatePluginRollout(rollout, tt.stable, tt.canary))
+		})
+	}
+
+	t.Run("未开启自动晋升", func(t *testing.T) {
+		manual := *rollout
+		manual.AutoPromoteRequests = 0
+		assert.Equal(t, pluginRolloutDecisionContinue, evaluatePluginRollout(
+			&manual,
+			PluginRolloutStats{Requests: 5000},
+			PluginRolloutStats{Requests: 5000},
+		))
+	})
+}
+
+func TestPickPluginRolloutCanary(t *testing.T) {
+	rollout := &model.PluginRollout{CanaryWeight: 30}
+	rollout.ID = "rollout"
+
+	t.Run("同一会话路由稳定", func(t *testing.T) {
+		conversationId := "conversation"
+		first := pickPluginRolloutCanary(rollout, &conversationId)
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, first, pickPluginRolloutCanary(rollout, &conversationId))
+		}
+	})
+
+	t.Run("按权重分流", func(t *testing.T) {
+		canary := 0
+		for i := 0; i < 10000; i++ {
+			conversationId := fmt.Sprintf("conversation-%d", i)
+			if pickPluginRolloutCanary(rollout, &conversationId) {
+				canary++
+			}
+		}
+		assert.InDelta(t, 3000, canary, 300)
+	})
+
+	t.Run("权重边界", func(t *testing.T) {
+		assert.False(t, pickPluginRolloutCanary(&model.PluginRollout{CanaryWeight: 0}, nil))
+		assert.True(t, pickPluginRolloutCanary(&model.PluginRollout{CanaryWeight: 100}, nil))
+	})
+}
+
+func TestUpdatePluginRolloutWeightTenantScope(t *testing.T) {
+	setUpTestDB()
+	defer db.Close()
+
+	tenantId := uuid.New().String()
+	createRollout := func(tenantId string) *model.PluginRollout {
+		rollout := &model.PluginRollout{
+			TenantID:     tenantId,
+			PluginID:     "author/plugin",
+			CanaryWeight: 10,
+			Status:       model.PluginRolloutStatusRunning,
+		}
+		require.NoError(t, db.Create(rollout))
+		t.Cleanup(func() { db.Delete(rollout) })
+		return rollout
+	}
+	own := createRollout(tenantId)
+	other := createRollout(uuid.New().String())
+	global := createRollout(GlobalPluginRolloutTenantID)
+
+	tests := []struct {
+		name     string
+		tenantId string
+		rollout  *model.PluginRollout
+		wantCode int
+	}{
+		{name: "租户修改自己的灰度发布", tenantId: tenantId, rollout: own},
+		{name: "租户不能修改其他租户的灰度发布", tenantId: tenantId, rollout: other, wantCode: entities.ErrNotFoundCode},
+		// 全局灰度发布只能通过管理接口修改
+		{name: "租户不能修改全局灰度发布", tenantId: tenantId, rollout: global, wantCode: entities.ErrNotFoundCode},
+		{name: "管理接口修改全局灰度发布", tenantId: GlobalPluginRolloutTenantID, rollout: global},
+		{name: "管理接口不能修改租户的灰度发布", tenantId: GlobalPluginRolloutTenantID, rollout: own, wantCode: entities.ErrNotFoundCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := UpdatePluginRolloutWeight(tt.tenantId, tt.rollout.ID, 50)
+			assert.Equal(t, tt.wantCode, response.Code)
+		})
+	}
+}
+
+func TestFetchActivePluginRolloutCache(t *testing.T) {
+	if err := cache.InitRedisClient("127.0.0.1:6379", "", "", false, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+
+	const (
+		stable = "author/plugin:0.0.1@a"
+		other  = "author/plugin:0.0.2@b"
+	)
+	tenantRollout := &model.PluginRollout{PluginID: "author/plugin", StablePluginUniqueIdentifier: stable, CanaryWeight: 10}
+	globalRollout := &model.PluginRollout{PluginID: "author/plugin", StablePluginUniqueIdentifier: stable, CanaryWeight: 20}
+
+	tests := []struct {
+		name    string
+		tenant  *model.PluginRollout
+		global  *model.PluginRollout
+		stable  string
+		want    int
+		wantNil bool
+	}{
+		{name: "租户的灰度发布优先", tenant: tenantRollout, global: globalRollout, stable: stable, want: 10},
+		{name: "租户没有灰度发布时使用全局的", global: globalRollout, stable: stable, want: 20},
+		{name: "稳定版本不一致时不参与灰度发布", tenant: tenantRollout, global: globalRollout, stable: other, wantNil: true},
+		{name: "没有灰度发布", stable: stable, wantNil: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installation := &model.PluginInstallation{
+				TenantID:               uuid.New().String(),
+				PluginID:               "author/plugin-" + uuid.New().String(),
+				PluginUniqueIdentifier: tt.stable,
+			}
+			// 只写入缓存，命中缓存时不会查询数据库
+			for tenantId, rollout := range map[string]*model.PluginRollout{
+				installation.TenantID:       tt.tenant,
+				GlobalPluginRolloutTenantID: tt.global,
+			} {
+				key := cache.PluginRolloutCacheKey(tenantId, installation.PluginID)
+				require.NoError(t, cache.Store(key, pluginRolloutCacheRecord{Rollout: rollout}, time.Minute))
+				defer cache.Del(key)
+			}
+
+			rollout, err := FetchActivePluginRollout(installation)
+			require.NoError(t, err)
+			if tt.wantNil {
+				assert.Nil(t, rollout)
+				return
+			}
+			require.NotNil(t, rollout)
+			assert.Equal(t, tt.want, rollout.CanaryWeight)
+		})
+	}
+
+	// 灰度发布变更后缓存失效
+	rollout := &model.PluginRollout{TenantID: uuid.New().String(), PluginID: "author/plugin"}
+	key := cache.PluginRolloutCacheKey(rollout.TenantID, rollout.PluginID)
+	require.NoError(t, cache.Store(key, pluginRolloutCacheRecord{Rollout: rollout}, time.Minute))
+	invalidatePluginRolloutCache(rollout)
+	_, err := cache.Get[pluginRolloutCacheRecord](key)
+	assert.Equal(t, cache.ErrNotFound, err)
+}
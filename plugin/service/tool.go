@@ -1,13 +1,18 @@
 package service
 
 import (
+	"errors"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon"
 	"github.com/jjgagacy/workflow-app/plugin/core/plugin_daemon/access_types"
 	"github.com/jjgagacy/workflow-app/plugin/core/session_manager"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/tool_entities"
 	"github.com/jjgagacy/workflow-app/plugin/pkg/requests"
+	"github.com/jjgagacy/workflow-app/plugin/types"
 	"github.com/jjgagacy/workflow-app/plugin/utils"
 )
 
@@ -16,6 +21,20 @@ func InvokeTool(
 	req *plugin_entities.InvokePluginRequest[requests.RequestInvokeTool],
 	maxTimeout int,
 ) {
+	declaration, err := pluginDeclaration(req.UniqueIdentifier)
+	if err != nil {
+		writePluginDeclarationError(ctx, err)
+		return
+	}
+
+	// parameters are checked before the plugin is bothered with them
+	parameters, err := validateToolDeclarationParameters(declaration, req.Data.Tool, req.Data.ToolParameters)
+	if err != nil {
+		writeToolParametersError(ctx, err)
+		return
+	}
+	req.Data.ToolParameters = parameters
+
 	baseSSEWithSession(
 		func(session *session_manager.Session) (*utils.Stream[tool_entities.ToolResponseChunk], error) {
 			return plugin_daemon.InvokeTool(session, &req.Data)
@@ -28,6 +47,27 @@ func InvokeTool(
 	)
 }
 
+// writePluginDeclarationError responds to a failed declaration lookup, only a missing
+// plugin is the fault of the caller
+func writePluginDeclarationError(ctx *gin.Context, err error) {
+	if errors.Is(err, types.ErrPluginNotFound) {
+		ctx.JSON(http.StatusNotFound, entities.PluginNotFoundError(err).ToResponse())
+		return
+	}
+	ctx.JSON(http.StatusInternalServerError, entities.InternalError(errors.Join(err, errors.New("failed to get plugin declaration"))).ToResponse())
+}
+
+// writeToolParametersError lists every invalid parameter so that the caller can fix
+// them at once, a tool missing from the declaration is a bad request as well
+func writeToolParametersError(ctx *gin.Context, err error) {
+	var invalid *plugin_entities.InvalidParametersError
+	if errors.As(err, &invalid) {
+		ctx.JSON(http.StatusBadRequest, entities.InvalidParametersError(err, invalid.Parameters).ToResponse())
+		return
+	}
+	ctx.JSON(http.StatusBadRequest, entities.BadRequestError(err).ToResponse())
+}
+
 func ValidateToolCredentials(
 	ctx *gin.Context,
 	req *plugin_entities.InvokePluginRequest[requests.RequestValidateToolCredentials],
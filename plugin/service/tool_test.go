@@ -0,0 +1,124 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities"
+	"github.com/jjgagacy/workflow-app/plugin/pkg/entities/plugin_entities"
+	"github.com/jjgagacy/workflow-app/plugin/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeErrorResponse 解析写入的错误响应，错误详情以 json 字符串保存在 message 中
+func decodeErrorResponse(t *testing.T, w *httptest.ResponseRecorder) (entities.Response, map[string]any) {
+	var response entities.Response
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	detail := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(response.Message), &detail))
+	return response, detail
+}
+
+func TestWriteToolParametersError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	min, max := 1.0, 10.0
+	declaration := &plugin_entities.PluginDeclaration{
+		Tool: &plugin_entities.ToolProviderDeclaration{
+			Tools: []plugin_entities.ToolDeclaration{{
+				Identity: plugin_entities.ToolIdentity{Name: "search"},
+				Parameters: []plugin_entities.ToolParameter{
+					{Name: "query", Type: plugin_entities.TOOL_PARAMETER_TYPE_STRING, Required: true},
+					{Name: "limit", Type: plugin_entities.TOOL_PARAMETER_TYPE_NUMBER, Min: &min, Max: &max},
+					{Name: "lang", Type: plugin_entities.TOOL_PARAMETER_TYPE_SELECT, Options: []plugin_entities.ParameterOption{{Value: "en"}, {Value: "zh"}}},
+					{Name: "safe", Type: plugin_entities.TOOL_PARAMETER_TYPE_BOOLEAN},
+				},
+			}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		tool        string
+		parameters  map[string]any
+		wantErrType string
+		// 响应中列出的非法参数
+		wantInvalid []string
+	}{
+		{
+			name:        "列出所有非法参数",
+			tool:        "search",
+			parameters:  map[string]any{"limit": 20, "lang": "fr", "safe": true},
+			wantErrType: entities.ErrInvalidParameters,
+			wantInvalid: []string{"query", "limit", "lang"},
+		},
+		{
+			name:        "工具不存在",
+			tool:        "missing",
+			parameters:  map[string]any{"query": "go"},
+			wantErrType: entities.ErrBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := validateToolDeclarationParameters(declaration, tt.tool, tt.parameters)
+			require.Error(t, err)
+
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			writeToolParametersError(ctx, err)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			response, detail := decodeErrorResponse(t, w)
+			assert.Equal(t, entities.ErrBadRequestCode, response.Code)
+			assert.Equal(t, tt.wantErrType, detail["error_type"])
+			if tt.wantInvalid == nil {
+				return
+			}
+
+			args, ok := detail["args"].(map[string]any)
+			require.True(t, ok)
+			parameters, ok := args["parameters"].([]any)
+			require.True(t, ok)
+			names := []string{}
+			for _, parameter := range parameters {
+				names = append(names, parameter.(map[string]any)["name"].(string))
+			}
+			assert.ElementsMatch(t, tt.wantInvalid, names)
+		})
+	}
+}
+
+func TestWritePluginDeclarationError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   int
+	}{
+		{name: "插件不存在", err: types.ErrPluginNotFound, wantStatus: http.StatusNotFound, wantCode: entities.ErrPluginNotFoundCode},
+		{name: "调试插件未连接", err: errors.Join(types.ErrPluginNotFound, errors.New("plugin not found")), wantStatus: http.StatusNotFound, wantCode: entities.ErrPluginNotFoundCode},
+		// 查询失败不是调用方的问题
+		{name: "数据库错误", err: errors.New("connection refused"), wantStatus: http.StatusInternalServerError, wantCode: entities.ErrInternalCode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(w)
+			writePluginDeclarationError(ctx, tt.err)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			response, _ := decodeErrorResponse(t, w)
+			assert.Equal(t, tt.wantCode, response.Code)
+		})
+	}
+}
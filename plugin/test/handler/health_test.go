@@ -14,6 +14,8 @@ func TestHello(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 
 	cfg := test.DefaultTestConfig()
+	// 日志写到临时目录，避免改动仓库中的文件
+	cfg.LoggingLocalPath = t.TempDir()
 	app := &server.App{}
 	shutdowns, err := app.Init(cfg)
 	if err != nil {
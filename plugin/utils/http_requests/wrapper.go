@@ -64,6 +64,10 @@ func RequestAndParseStream[T any](client *http.Client, url string, method string
 	}
 
 	ch := utils.NewStream[T](1024)
+	// abort the request once the stream is closed by the reader
+	ch.OnClose(func() {
+		resp.Body.Close()
+	})
 
 	// get read timeout
 	readTimeout := int64(60000)
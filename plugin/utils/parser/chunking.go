@@ -104,3 +104,13 @@ func LengthPrefixedChunking(
 		}
 	}
 }
+
+// LengthPrefixedFrame encodes data in the format read by LengthPrefixedChunking
+func LengthPrefixedFrame(magicNumber byte, data []byte) []byte {
+	frame := make([]byte, 14+len(data))
+	frame[0] = magicNumber
+	binary.LittleEndian.PutUint16(frame[2:4], 0xa)
+	binary.LittleEndian.PutUint32(frame[4:8], uint32(len(data)))
+	copy(frame[14:], data)
+	return frame
+}
@@ -316,3 +316,17 @@ func TestLengthPrefixedChunking_ThreadSafety(t *testing.T) {
 		t.Log("✅ 检测到真正的并发处理器调用")
 	}
 }
+
+func TestLengthPrefixedFrame(t *testing.T) {
+	// 与手工构造的数据包一致，并能被读取
+	require.Equal(t, createTestPacket(0x0f, []byte("Hello")), LengthPrefixedFrame(0x0f, []byte("Hello")))
+
+	stream := append(LengthPrefixedFrame(0x0f, []byte("Hello")), LengthPrefixedFrame(0x0f, nil)...)
+	chunks := []string{}
+	err := LengthPrefixedChunking(bytes.NewReader(stream), 0x0f, 1024, func(data []byte) error {
+		chunks = append(chunks, string(data))
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"Hello", ""}, chunks)
+}
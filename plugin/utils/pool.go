@@ -134,6 +134,19 @@ func ReleasePool() {
 	}
 }
 
+// ReleasePoolTimeout releases the pool and waits up to timeout for running tasks to exit
+func ReleasePoolTimeout(timeout time.Duration) error {
+	pl.Lock()
+	defer pl.Unlock()
+
+	if pool == nil {
+		return nil
+	}
+	err := pool.ReleaseTimeout(timeout)
+	pool = nil
+	return err
+}
+
 func WithMaxRoutineBlocking(maxRoutine int, tasks []func(), done ...func()) {
 	if maxRoutine <= 0 {
 		maxRoutine = 1